@@ -14,6 +14,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/ovh/erlenmeyer/middlewares"
+	"github.com/ovh/erlenmeyer/proto/flux"
 	"github.com/ovh/erlenmeyer/proto/graphite"
 	"github.com/ovh/erlenmeyer/proto/influxdb"
 	"github.com/ovh/erlenmeyer/proto/opentsdb"
@@ -85,6 +86,18 @@ func initConfig() {
 	viper.SetDefault("prometheus.query.labels.replace.enabled", false)
 	viper.SetDefault("prometheus.query.labels.replace.map", make(map[string]string))
 
+	viper.SetDefault("graphite.tags.gcount", 10000)
+
+	viper.SetDefault("opentsdb.annotations.classname", "opentsdb.annotations")
+	viper.SetDefault("opentsdb.query.parallelism", 4)
+	viper.SetDefault("opentsdb.uid.gcount", 100000)
+
+	viper.SetDefault("influxdb.health.timeout", "5s")
+	viper.SetDefault("influxdb.health.cache", "10s")
+	viper.SetDefault("influxdb.cardinality.gcount", 100000)
+
+	viper.SetDefault("flux.query.maxsize", 1<<20)
+
 	// Default time range limits for series endpoint
 	viper.SetDefault("warp10.find.activeafter.min", "24h")
 	viper.SetDefault("warp10.find.activeafter.max", "168h") // 7 days = 7 * 24 hours
@@ -174,10 +187,22 @@ var RootCmd = &cobra.Command{
 		gOpenTSDB := r.Group("/opentsdb", middlewares.Protocol("opentsdb"), middlewares.Deny(tokens))
 		gOpenTSDB.Any("/api/query*", middlewares.Native(openTSDB.HandleQuery))
 		gOpenTSDB.Any("/api/query/last*", middlewares.Native(openTSDB.HandleQueryLast))
+		gOpenTSDB.Any("/api/query/exp*", middlewares.Native(openTSDB.HandleQueryExp))
+		gOpenTSDB.Any("/api/query/gexp*", middlewares.Native(openTSDB.HandleQueryGExp))
+		gOpenTSDB.Any("/api/annotation", middlewares.Native(openTSDB.HandleAnnotation))
+		gOpenTSDB.Any("/api/annotation/bulk", middlewares.Native(openTSDB.HandleAnnotationBulk))
 		gOpenTSDB.Any("/api/suggest*", middlewares.Native(openTSDB.HandleSuggest))
 		gOpenTSDB.Any("/api/aggregators*", middlewares.Native(openTSDB.HandleAggregators))
 		gOpenTSDB.Any("/api/search/lookup*", middlewares.Native(openTSDB.HandleLookup))
+		gOpenTSDB.Any("/api/search/tsmeta*", middlewares.Native(openTSDB.HandleSearchTSMeta))
+		gOpenTSDB.Any("/api/search/uidmeta*", middlewares.Native(openTSDB.HandleSearchUIDMeta))
+		gOpenTSDB.Any("/api/uid/assign*", middlewares.Native(openTSDB.HandleUIDAssign))
+		gOpenTSDB.Any("/api/uid/uidmeta*", middlewares.Native(openTSDB.HandleUIDMeta))
+		gOpenTSDB.Any("/api/uid/tsmeta*", middlewares.Native(openTSDB.HandleTSMeta))
 		gOpenTSDB.Any("/api/config/filters*", middlewares.Native(openTSDB.HandleConfigFilters))
+		gOpenTSDB.Any("/api/config", middlewares.Native(openTSDB.HandleConfig))
+		gOpenTSDB.Any("/api/version", middlewares.Native(openTSDB.HandleVersion))
+		gOpenTSDB.Any("/api/serializers", middlewares.Native(openTSDB.HandleSerializers))
 
 		// Register prometheus query language
 		promQL := prom.NewPromQL()
@@ -197,11 +222,28 @@ var RootCmd = &cobra.Command{
 		gGraphite.Any("/metrics/find*", middlewares.Native(graphite.Find))
 		gGraphite.Any("/metrics/expand*", middlewares.Native(graphite.Expand))
 		gGraphite.Any("/metrics/index.json*", middlewares.Native(graphite.Index))
+		gGraphite.Any("/functions", middlewares.Native(graphite.Functions))
+		gGraphite.Any("/functions/:name", middlewares.Native(graphite.Functions))
+		gGraphite.Any("/version", middlewares.Native(graphite.Version))
+		gGraphite.Any("/tags", middlewares.Native(graphite.Tags))
+		gGraphite.Any("/tags/findSeries*", middlewares.Native(graphite.TagsFindSeries))
+		gGraphite.Any("/tags/autoComplete/tags*", middlewares.Native(graphite.TagsAutoCompleteTags))
+		gGraphite.Any("/tags/autoComplete/values*", middlewares.Native(graphite.TagsAutoCompleteValues))
+		gGraphite.Any("/tags/:tag", middlewares.Native(graphite.TagDetails))
 
 		// Register influx query language
 		i := influxdb.NewInfluxDB()
-		gInfluxDB := r.Group("/influxdb", middlewares.Protocol("influxdb"), middlewares.Deny(tokens))
-		gInfluxDB.Any("/query*", middlewares.Native(i.Query))
+		// ping and health endpoints are reachable without a token
+		gInfluxDB := r.Group("/influxdb", middlewares.Protocol("influxdb"))
+		gInfluxDB.Any("/query*", middlewares.Native(i.Query), middlewares.Deny(tokens))
+		gInfluxDB.Any("/ping", middlewares.Native(i.Ping))
+		gInfluxDB.Any("/health", middlewares.Native(i.Health))
+
+		// Register flux query language
+		f := flux.NewFlux()
+		gFlux := r.Group("/influxdb/api/v2", middlewares.Protocol("flux"), middlewares.Deny(tokens))
+		gFlux.Any("/query", middlewares.Native(f.Query))
+		gFlux.Any("/buckets", middlewares.Native(f.Buckets))
 
 		// Register warp handler
 		gWarp := r.Group("/warp", middlewares.Protocol("warp10"))
@@ -13,8 +13,14 @@ func init() {
 
 // RetrieveToken from multiple sources
 func RetrieveToken(req *http.Request) string {
+	// retrieve token from the InfluxDB 2.x token auth
+	token := retrieveTokenFromTokenAuth(req)
+	if token != "" {
+		return token
+	}
+
 	// retrieve token from the basic auth
-	token := retrieveTokenFromBasicAuth(req)
+	token = retrieveTokenFromBasicAuth(req)
 	if token != "" {
 		return token
 	}
@@ -23,6 +29,26 @@ func RetrieveToken(req *http.Request) string {
 	return retrieveTokenFromInfluxVariables(req)
 }
 
+// RetrieveWriteToken retrieve the write token provided alongside the read
+// token, from the X-Warp10-Write-Token header or the write_token parameter
+func RetrieveWriteToken(req *http.Request) string {
+	if token := req.Header.Get("X-Warp10-Write-Token"); token != "" {
+		return token
+	}
+	return req.FormValue("write_token")
+}
+
+// retrieveTokenFromTokenAuth is fetching the token of an InfluxDB 2.x
+// "Authorization: Token <token>" header
+// https://docs.influxdata.com/influxdb/v2.0/api/#section/Authentication/TokenAuthentication
+func retrieveTokenFromTokenAuth(request *http.Request) string {
+	s := strings.SplitN(request.Header.Get("Authorization"), " ", 2)
+	if len(s) != 2 || s[0] != "Token" {
+		return ""
+	}
+	return strings.TrimSpace(s[1])
+}
+
 // retrieveTokenFromBasicAuth is fetching the token for an HTTP Request
 func retrieveTokenFromBasicAuth(request *http.Request) string {
 	// Getting token from BasicAuth
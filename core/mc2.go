@@ -185,6 +185,14 @@ func (n *Node) Write(b *bytes.Buffer) {
 		}
 
 	case FindPayload:
+		if p.GCount > 0 {
+			b.WriteString("{ 'token' $token 'class' '")
+			b.WriteString(p.ClassName)
+			b.WriteString("' 'labels' ")
+			b.WriteString(printLabelsAsWarpScriptHash(p.Labels))
+			b.WriteString(fmt.Sprintf("'gcount' %d } FIND \n", p.GCount))
+			break
+		}
 		b.WriteString("[ $token '")
 		b.WriteString(p.ClassName)
 		b.WriteString("' ")
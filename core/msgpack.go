@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// MsgpackWriter is a minimal MessagePack writer shared by the protocols
+// serializing their responses with msgpack
+// https://github.com/msgpack/msgpack/blob/master/spec.md
+type MsgpackWriter struct {
+	w   *bufio.Writer
+	buf [16]byte
+}
+
+// NewMsgpackWriter return a buffered MessagePack writer, to flush once written
+func NewMsgpackWriter(w io.Writer) *MsgpackWriter {
+	return &MsgpackWriter{w: bufio.NewWriter(w)}
+}
+
+// Flush write the buffered data to the underlying writer
+func (m *MsgpackWriter) Flush() error {
+	return m.w.Flush()
+}
+
+// writeHeader write a size header, using the fixed format up to fixMax then
+// the 8, 16 or 32 bits formats, mark8 is 0 for types without 8 bits format
+func (m *MsgpackWriter) writeHeader(fix byte, fixMax int, mark8, mark16, mark32 byte, size int) {
+	switch {
+	case size <= fixMax:
+		m.w.WriteByte(fix | byte(size))
+	case mark8 != 0 && size <= math.MaxUint8:
+		m.w.Write([]byte{mark8, byte(size)})
+	case size <= math.MaxUint16:
+		binary.BigEndian.PutUint16(m.buf[:2], uint16(size))
+		m.w.WriteByte(mark16)
+		m.w.Write(m.buf[:2])
+	default:
+		binary.BigEndian.PutUint32(m.buf[:4], uint32(size))
+		m.w.WriteByte(mark32)
+		m.w.Write(m.buf[:4])
+	}
+}
+
+// WriteMapHeader start a map of size key value pairs
+func (m *MsgpackWriter) WriteMapHeader(size int) {
+	m.writeHeader(0x80, 15, 0, 0xde, 0xdf, size)
+}
+
+// WriteArrayHeader start an array of size items
+func (m *MsgpackWriter) WriteArrayHeader(size int) {
+	m.writeHeader(0x90, 15, 0, 0xdc, 0xdd, size)
+}
+
+// WriteString write a string
+func (m *MsgpackWriter) WriteString(s string) {
+	m.writeHeader(0xa0, 31, 0xd9, 0xda, 0xdb, len(s))
+	m.w.WriteString(s)
+}
+
+// WriteBool write a boolean
+func (m *MsgpackWriter) WriteBool(b bool) {
+	if b {
+		m.w.WriteByte(0xc3)
+	} else {
+		m.w.WriteByte(0xc2)
+	}
+}
+
+// WriteNil write a nil value
+func (m *MsgpackWriter) WriteNil() {
+	m.w.WriteByte(0xc0)
+}
+
+// WriteInt write an integer, using the fixint formats when possible
+func (m *MsgpackWriter) WriteInt(i int64) {
+	if i >= 0 && i <= 127 {
+		m.w.WriteByte(byte(i))
+		return
+	}
+	if i < 0 && i >= -32 {
+		m.w.WriteByte(byte(int8(i)))
+		return
+	}
+	binary.BigEndian.PutUint64(m.buf[:8], uint64(i))
+	m.w.WriteByte(0xd3)
+	m.w.Write(m.buf[:8])
+}
+
+// WriteFloat write a 64 bits float
+func (m *MsgpackWriter) WriteFloat(f float64) {
+	binary.BigEndian.PutUint64(m.buf[:8], math.Float64bits(f))
+	m.w.WriteByte(0xcb)
+	m.w.Write(m.buf[:8])
+}
+
+// WriteTime write a time as the timestamp extension of type 5 used by the
+// InfluxDB clients, seconds and nanoseconds
+func (m *MsgpackWriter) WriteTime(t time.Time) {
+	binary.BigEndian.PutUint64(m.buf[:8], uint64(t.Unix()))
+	binary.BigEndian.PutUint32(m.buf[8:12], uint32(t.Nanosecond()))
+	m.w.Write([]byte{0xc7, 12, 5})
+	m.w.Write(m.buf[:12])
+}
@@ -134,6 +134,8 @@ type BucketizePayload struct {
 type FindPayload struct {
 	ClassName string
 	Labels    map[string]string
+	// GCount bounds the number of series found, unbounded when 0
+	GCount int
 }
 
 // WarpScriptPayload is the payload to push WarpScript directly in the tree
@@ -75,6 +75,34 @@ type QueryResult struct {
 	Count   int             `json:"count"`
 	Fetched int             `json:"fetched"`
 	GTS     []GeoTimeSeries `json:"gts"`
+	Series  []GeoTimeSeries `json:"series,omitempty"`
+	Stats   ExecStats       `json:"-"`
+}
+
+// ExecStats are the execution statistics sent by Warp10 in the response headers
+type ExecStats struct {
+	// Elapsed is the execution time in nanoseconds
+	Elapsed float64
+	// Fetched is the number of fetched datapoints
+	Fetched float64
+	// Ops is the number of executed WarpScript operations
+	Ops float64
+}
+
+// ParseExecStats read the execution statistics of a Warp10 response, missing headers are zero
+func ParseExecStats(resp *http.Response) ExecStats {
+	stats := ExecStats{}
+	for header, value := range map[string]*float64{
+		"X-Warp10-Elapsed": &stats.Elapsed,
+		"X-Warp10-Fetched": &stats.Fetched,
+		"X-Warp10-Ops":     &stats.Ops,
+	} {
+		if parsed, err := strconv.ParseFloat(resp.Header.Get(header), 64); err == nil {
+			*value = parsed
+		}
+	}
+
+	return stats
 }
 
 // A GeoTimeSeries as returned by Warp10 (https://warp10.io/)
@@ -140,6 +168,7 @@ func (server *HTTPWarp10Server) QueryGTS(body, txn string) (*QueryResult, error)
 	if err != nil {
 		return nil, err
 	}
+	result[0].Stats = ParseExecStats(warp10Resp)
 	return &(result[0]), nil
 }
 
@@ -295,44 +324,33 @@ func (server *HTTPWarp10Server) Query(body string, txn string) (*http.Response,
 		"protocol": server.Protocol,
 	}).Inc()
 
-	elapsed, err := strconv.ParseFloat(warp10Resp.Header.Get("X-Warp10-Elapsed"), 64)
-	if err != nil {
-		elapsed = 0
-	}
+	stats := ParseExecStats(warp10Resp)
 	times.With(prometheus.Labels{
 		"token_id": tokenID,
 		"app":      application,
 		"protocol": server.Protocol,
-	}).Add(elapsed)
+	}).Add(stats.Elapsed)
 
-	datapoints, err := strconv.ParseFloat(warp10Resp.Header.Get("X-Warp10-Fetched"), 64)
-	if err != nil {
-		datapoints = 0
-	}
 	fetched.With(prometheus.Labels{
 		"token_id": tokenID,
 		"app":      application,
 		"protocol": server.Protocol,
-	}).Add(datapoints)
-	if datapoints > hugeNumberOfDatapoints {
+	}).Add(stats.Fetched)
+	if stats.Fetched > hugeNumberOfDatapoints {
 		log.WithFields(log.Fields{
 			"token_id":   tokenID,
 			"app":        application,
-			"datapoints": datapoints,
-			"elapsed":    elapsed,
+			"datapoints": stats.Fetched,
+			"elapsed":    stats.Elapsed,
 			"txn":        txn,
 		}).Warn("killroy")
 	}
 
-	ops, err := strconv.ParseFloat(warp10Resp.Header.Get("X-Warp10-Ops"), 64)
-	if err != nil {
-		ops = 0
-	}
 	operations.With(prometheus.Labels{
 		"token_id": tokenID,
 		"app":      application,
 		"protocol": server.Protocol,
-	}).Add(ops)
+	}).Add(stats.Ops)
 
 	return warp10Resp, nil
 }
@@ -378,6 +396,21 @@ func (series *GeoTimeSeries) TimeAndValue(i int) (bool, time.Time, float64) {
 	return true, t, val
 }
 
+// Check is executing an empty WarpScript to ensure the Warp backend is reachable
+func (server *HTTPWarp10Server) Check(timeout time.Duration) error {
+	client := &http.Client{Timeout: timeout}
+	warp10Resp, err := client.Post(strings.TrimSuffix(server.Endpoint, "/")+"/api/v0/exec", "text/plain", strings.NewReader("REV"))
+	if err != nil {
+		return err
+	}
+	defer warp10Resp.Body.Close()
+
+	if warp10Resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Warp 10 exec endpoint answered %s", warp10Resp.Status)
+	}
+	return nil
+}
+
 // Delete is handling /api/v0/delete in Warp
 func (server *HTTPWarp10Server) Delete(token string, query string) error {
 	// Checking the trailing char
@@ -409,6 +442,86 @@ func (server *HTTPWarp10Server) Delete(token string, query string) error {
 	return nil
 }
 
+// DeleteDryRun is handling /api/v0/delete in Warp with the dryrun flag, it
+// returns the number of series that would be deleted by the query
+func (server *HTTPWarp10Server) DeleteDryRun(token string, query string) (int, error) {
+	// Checking the trailing char
+	if server.Endpoint[len(server.Endpoint)-1:] != "/" {
+		server.Endpoint += "/"
+	}
+
+	resource := fmt.Sprintf("%sapi/v0/delete?%s&dryrun=true", server.Endpoint, query)
+	req, _ := http.NewRequest("GET", resource, nil) // nolint: gas
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("X-Warp10-Token", token)
+	req.Header.Set("X-CityzenData-Token", token)
+	warpResp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer warpResp.Body.Close()
+
+	body, err := ioutil.ReadAll(warpResp.Body)
+	if err != nil {
+		return 0, errors.Wrapf(err, "infos: %+v", warpResp.Header)
+	}
+
+	if warpResp.StatusCode != 200 {
+		return 0, errors.New(string(body))
+	}
+
+	count := 0
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Update is handling /api/v0/update in Warp, body is in the GTS input format
+func (server *HTTPWarp10Server) Update(token string, body string) error {
+	return server.post("update", token, body)
+}
+
+// Meta is handling /api/v0/meta in Warp, body is in the GTS metadata format
+func (server *HTTPWarp10Server) Meta(token string, body string) error {
+	return server.post("meta", token, body)
+}
+
+// post a body to a Warp write endpoint
+func (server *HTTPWarp10Server) post(endpoint, token, body string) error {
+	// Checking the trailing char
+	if server.Endpoint[len(server.Endpoint)-1:] != "/" {
+		server.Endpoint += "/"
+	}
+
+	resource := fmt.Sprintf("%sapi/v0/%s", server.Endpoint, endpoint)
+	req, _ := http.NewRequest("POST", resource, strings.NewReader(body)) // nolint: gas
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("X-Warp10-Token", token)
+	req.Header.Set("X-CityzenData-Token", token)
+	warpResp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer warpResp.Body.Close()
+
+	if warpResp.StatusCode != 200 {
+		var body []byte
+		body, err = ioutil.ReadAll(warpResp.Body)
+		if err != nil {
+			return errors.Wrapf(err, "infos: %+v", warpResp.Header)
+		}
+		return errors.New(string(body))
+	}
+	return nil
+}
+
 // FindParameters contains all parameters for the Find operation
 type FindParameters struct {
 	ActiveAfter time.Time
@@ -30,6 +30,15 @@ func Deny(tokens []string) echo.MiddlewareFunc {
 				return ctx.NoContent(http.StatusForbidden)
 			}
 
+			// The write token sent alongside the read token is checked too,
+			// as it is used to write and delete series
+			if writeToken := core.RetrieveWriteToken(ctx.Request()); writeToken != "" {
+				if _, ok := mapper[writeToken]; ok {
+					logger.Warn("Write token is forbidden")
+					return ctx.NoContent(http.StatusForbidden)
+				}
+			}
+
 			return next(ctx)
 		}
 	}
@@ -5,6 +5,19 @@ type (
 	Error struct {
 		Error string `json:"error,omitempty"`
 	}
+
+	// DetailedError structure, an error carrying its HTTP status as OpenTSDB ones
+	DetailedError struct {
+		Error *ErrorDetails `json:"error"`
+	}
+
+	// ErrorDetails structure of a DetailedError
+	ErrorDetails struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Details string `json:"details,omitempty"`
+		Trace   string `json:"trace,omitempty"`
+	}
 )
 
 // NewError create an instance of error using the error type
@@ -13,3 +26,14 @@ func NewError(err error) *Error {
 		Error: err.Error(),
 	}
 }
+
+// NewDetailedError create an instance of detailed error using its HTTP status
+func NewDetailedError(code int, message string, details string) *DetailedError {
+	return &DetailedError{
+		Error: &ErrorDetails{
+			Code:    code,
+			Message: message,
+			Details: details,
+		},
+	}
+}
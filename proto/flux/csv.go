@@ -0,0 +1,179 @@
+package flux
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// table is a Flux output table, one per Warp 10 series, as left on the
+// stack by the translated WarpScript
+type table struct {
+	Result string            `json:"result"`
+	Start  int64             `json:"start"`
+	Stop   int64             `json:"stop"`
+	Labels map[string]string `json:"labels"`
+	Ticks  []int64           `json:"ticks"`
+	Values []interface{}     `json:"values"`
+}
+
+// dialect is the Flux CSV dialect of a query request
+// https://docs.influxdata.com/influxdb/v2.0/reference/syntax/annotated-csv/
+type dialect struct {
+	Header      *bool    `json:"header"`
+	Delimiter   string   `json:"delimiter"`
+	Annotations []string `json:"annotations"`
+}
+
+// defaultDialect is the dialect used when the request doesn't set one
+func defaultDialect() *dialect {
+	return &dialect{Annotations: []string{"datatype", "group", "default"}}
+}
+
+// hasAnnotation return true when the dialect include the annotation
+func (d *dialect) hasAnnotation(annotation string) bool {
+	for _, a := range d.Annotations {
+		if a == annotation {
+			return true
+		}
+	}
+	return false
+}
+
+// valueType return the annotated CSV data type of a table values
+func (t *table) valueType() string {
+	for _, value := range t.Values {
+		switch value := value.(type) {
+		case json.Number:
+			if strings.ContainsAny(value.String(), ".eE") {
+				return "double"
+			}
+			return "long"
+		case bool:
+			return "boolean"
+		case string:
+			return "string"
+		}
+	}
+	return "double"
+}
+
+// labelKeys return the table group key labels, sorted
+func (t *table) labelKeys() []string {
+	keys := make([]string, 0, len(t.Labels))
+	for key := range t.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatTick format a Warp 10 tick as a RFC3339 date time
+func formatTick(tick int64) string {
+	return time.Unix(0, tick*tickNanos()).UTC().Format(time.RFC3339Nano)
+}
+
+// formatValue format a table value in annotated CSV
+func formatValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case json.Number:
+		if f, err := value.Float64(); err == nil && strings.ContainsAny(value.String(), ".eE") {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	case string:
+		return value
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// writeAnnotatedCSV write the tables in the Flux annotated CSV format. A new
+// header block is written, after an empty line, each time the result or the
+// tables schema change.
+// nolint: gocyclo
+func writeAnnotatedCSV(w io.Writer, tables []table, d *dialect) error {
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = true
+	if d.Delimiter != "" {
+		writer.Comma = []rune(d.Delimiter)[0]
+	}
+	header := d.Header == nil || *d.Header
+
+	schema := ""
+	result := ""
+	tableID := 0
+
+	for index, t := range tables {
+		keys := t.labelKeys()
+		valueType := t.valueType()
+		tableSchema := t.Result + "|" + valueType + "|" + strings.Join(keys, ",")
+
+		if t.Result != result {
+			result = t.Result
+			tableID = 0
+		}
+
+		if tableSchema != schema {
+			if index > 0 {
+				writer.Write([]string{})
+			}
+			schema = tableSchema
+
+			columns := append([]string{"", "result", "table", "_start", "_stop", "_time", "_value"}, keys...)
+			if d.hasAnnotation("datatype") {
+				record := []string{"#datatype", "string", "long", "dateTime:RFC3339", "dateTime:RFC3339", "dateTime:RFC3339", valueType}
+				for range keys {
+					record = append(record, "string")
+				}
+				writer.Write(record)
+			}
+			if d.hasAnnotation("group") {
+				record := []string{"#group", "false", "false", "true", "true", "false", "false"}
+				for range keys {
+					record = append(record, "true")
+				}
+				writer.Write(record)
+			}
+			if d.hasAnnotation("default") {
+				record := make([]string, len(columns))
+				record[0] = "#default"
+				record[1] = t.Result
+				writer.Write(record)
+			}
+			if header {
+				writer.Write(columns)
+			}
+		}
+
+		resultColumn := t.Result
+		if d.hasAnnotation("default") {
+			resultColumn = ""
+		}
+		start := formatTick(t.Start)
+		stop := formatTick(t.Stop)
+
+		for i, tick := range t.Ticks {
+			record := []string{"", resultColumn, strconv.Itoa(tableID), start, stop, formatTick(tick), ""}
+			if i < len(t.Values) {
+				record[6] = formatValue(t.Values[i])
+			}
+			for _, key := range keys {
+				record = append(record, t.Labels[key])
+			}
+			writer.Write(record)
+		}
+		tableID++
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,64 @@
+package flux
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteAnnotatedCSV(t *testing.T) {
+	output := `[[
+		{"result":"_result","start":1546300800000000,"stop":1546300860000000,"labels":{"_field":"usage","_measurement":"cpu","host":"a"},"ticks":[1546300800000000,1546300830000000],"values":[1.5,null]},
+		{"result":"_result","start":1546300800000000,"stop":1546300860000000,"labels":{"_field":"usage","_measurement":"cpu","host":"b"},"ticks":[1546300800000000],"values":[2.0]},
+		{"result":"_result","start":1546300800000000,"stop":1546300860000000,"labels":{"_field":"count","_measurement":"cpu","host":"a"},"ticks":[1546300800000000],"values":[3]}
+	]]`
+
+	decoder := json.NewDecoder(strings.NewReader(output))
+	decoder.UseNumber()
+	stack := make([][]table, 0)
+	if err := decoder.Decode(&stack); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	var b bytes.Buffer
+	if err := writeAnnotatedCSV(&b, stack[0], defaultDialect()); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339,double,string,string,string",
+		"#group,false,false,true,true,false,false,true,true,true",
+		"#default,_result,,,,,,,,",
+		",result,table,_start,_stop,_time,_value,_field,_measurement,host",
+		",,0,2019-01-01T00:00:00Z,2019-01-01T00:01:00Z,2019-01-01T00:00:00Z,1.5,usage,cpu,a",
+		",,0,2019-01-01T00:00:00Z,2019-01-01T00:01:00Z,2019-01-01T00:00:30Z,,usage,cpu,a",
+		",,1,2019-01-01T00:00:00Z,2019-01-01T00:01:00Z,2019-01-01T00:00:00Z,2,usage,cpu,b",
+		"",
+		"#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339,long,string,string,string",
+		"#group,false,false,true,true,false,false,true,true,true",
+		"#default,_result,,,,,,,,",
+		",result,table,_start,_stop,_time,_value,_field,_measurement,host",
+		",,2,2019-01-01T00:00:00Z,2019-01-01T00:01:00Z,2019-01-01T00:00:00Z,3,count,cpu,a",
+		"",
+	}, "\r\n")
+
+	if b.String() != expected {
+		t.Errorf("Expected\n%q\ngot\n%q", expected, b.String())
+	}
+}
+
+func TestWriteAnnotatedCSVDialect(t *testing.T) {
+	header := false
+	tables := []table{{Result: "r", Labels: map[string]string{}, Ticks: []int64{0}, Values: []interface{}{"v"}}}
+
+	var b bytes.Buffer
+	if err := writeAnnotatedCSV(&b, tables, &dialect{Header: &header, Delimiter: ";"}); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	expected := ";r;0;1970-01-01T00:00:00Z;1970-01-01T00:00:00Z;1970-01-01T00:00:00Z;v\r\n"
+	if b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+}
@@ -0,0 +1,199 @@
+package flux
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// exprCompiler compile a Flux function body into a WarpScript pushing its
+// value. Record columns are read from the variables set by the filter and map
+// macros: $labels for the group key, $tick and $value for the row.
+type exprCompiler struct {
+	// record is the function parameter name, usually r
+	record string
+	// usesRow is true when the expression reads _time or _value
+	usesRow bool
+}
+
+// newExprCompiler return a compiler for a one parameter Flux function
+func newExprCompiler(fn expr) (*exprCompiler, *functionExpr, error) {
+	function, ok := fn.(*functionExpr)
+	if !ok {
+		return nil, nil, fmt.Errorf("fn must be a function, like (r) => r._value > 0")
+	}
+	if len(function.params) != 1 {
+		return nil, nil, fmt.Errorf("fn must have a single record parameter")
+	}
+	return &exprCompiler{record: function.params[0]}, function, nil
+}
+
+// column return the WarpScript pushing a record column
+func (c *exprCompiler) column(name string) string {
+	switch name {
+	case "_value":
+		c.usesRow = true
+		return "$value"
+	case "_time":
+		c.usesRow = true
+		return "$tick"
+	case "_start":
+		return "$start"
+	case "_stop":
+		return "$stop"
+	}
+	return "$labels " + quote(name) + " GET"
+}
+
+// recordColumn return the column name of a record member expression
+func (c *exprCompiler) recordColumn(e expr) (string, bool) {
+	member, ok := e.(*memberExpr)
+	if !ok {
+		return "", false
+	}
+	object, ok := member.object.(*identExpr)
+	if !ok || object.name != c.record {
+		return "", false
+	}
+	return member.property, true
+}
+
+// nolint: gocyclo
+func (c *exprCompiler) compile(e expr) (string, error) {
+	switch e := e.(type) {
+	case *memberExpr:
+		name, ok := c.recordColumn(e)
+		if !ok {
+			return "", fmt.Errorf("unsupported member expression on %s", c.record)
+		}
+		return c.column(name), nil
+
+	case *stringExpr:
+		return quote(e.value), nil
+	case *intExpr:
+		return strconv.FormatInt(e.value, 10), nil
+	case *floatExpr:
+		return formatFloat(e.value), nil
+	case *timeExpr:
+		return strconv.FormatInt(e.value.UnixNano()/tickNanos(), 10), nil
+	case *durationExpr:
+		return strconv.FormatInt(e.value.Nanoseconds()/tickNanos(), 10), nil
+
+	case *identExpr:
+		switch e.name {
+		case "true", "false":
+			return e.name, nil
+		}
+		return "", fmt.Errorf("undefined identifier %s", e.name)
+
+	case *unaryExpr:
+		if e.op == "exists" {
+			name, ok := c.recordColumn(e.arg)
+			if !ok {
+				return "", fmt.Errorf("exists operator expects a record column")
+			}
+			switch name {
+			case "_value", "_time", "_start", "_stop":
+				return "true", nil
+			}
+			return "$labels " + quote(name) + " CONTAINSKEY SWAP DROP", nil
+		}
+
+		arg, err := c.compile(e.arg)
+		if err != nil {
+			return "", err
+		}
+		if e.op == "not" {
+			return arg + " !", nil
+		}
+		return arg + " -1 *", nil
+
+	case *binaryExpr:
+		left, err := c.compile(e.left)
+		if err != nil {
+			return "", err
+		}
+
+		if e.op == "=~" || e.op == "!~" {
+			regex, ok := e.right.(*regexExpr)
+			if !ok {
+				return "", fmt.Errorf("%s operator expects a regular expression", e.op)
+			}
+			// Flux regular expressions match a part of the string, MATCH the
+			// whole string, a group is set so a match is never empty
+			mc2 := fmt.Sprintf("%s DUP ISNULL <%% DROP '' %%> IFT %s MATCH SIZE 0 >", left, quote("(?s).*("+regex.value+").*"))
+			if e.op == "!~" {
+				mc2 += " !"
+			}
+			return mc2, nil
+		}
+
+		right, err := c.compile(e.right)
+		if err != nil {
+			return "", err
+		}
+
+		switch e.op {
+		case "and":
+			return left + " " + right + " &&", nil
+		case "or":
+			return left + " " + right + " ||", nil
+		case "==", "!=", "<", "<=", ">", ">=", "+", "-", "*", "/", "%":
+			return left + " " + right + " " + e.op, nil
+		}
+		return "", fmt.Errorf("unsupported operator %s", e.op)
+
+	case *callExpr:
+		return c.compileCall(e)
+	}
+	return "", fmt.Errorf("unsupported expression in function body")
+}
+
+// fluxConversions are the supported Flux type conversion functions
+var fluxConversions = map[string]string{
+	"float":  "TODOUBLE",
+	"int":    "TOLONG",
+	"string": "TOSTRING",
+	"bool":   "TOBOOLEAN",
+}
+
+// compileCall compile the type conversion functions calls
+func (c *exprCompiler) compileCall(e *callExpr) (string, error) {
+	ident, ok := e.callee.(*identExpr)
+	if !ok {
+		return "", fmt.Errorf("unsupported function call in function body")
+	}
+	if ident.name == "now" {
+		return "$now", nil
+	}
+
+	conversion, ok := fluxConversions[ident.name]
+	if !ok {
+		return "", fmt.Errorf("unsupported function %s() in function body", ident.name)
+	}
+	arg, ok := e.args["v"]
+	if !ok {
+		return "", fmt.Errorf("missing required argument v in %s()", ident.name)
+	}
+	value, err := c.compile(arg)
+	if err != nil {
+		return "", err
+	}
+	return value + " " + conversion, nil
+}
+
+// quote return a WarpScript string constant, the quote and characters that
+// could break the script are percent encoded
+func quote(s string) string {
+	replacer := strings.NewReplacer("%", "%25", "'", "%27", "+", "%2B", "\n", "%0A", "\r", "%0D")
+	return "'" + replacer.Replace(s) + "'"
+}
+
+// formatFloat return a WarpScript double constant
+func formatFloat(f float64) string {
+	formatted := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(formatted, ".") {
+		formatted += ".0"
+	}
+	return formatted
+}
@@ -0,0 +1,262 @@
+package flux
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/ovh/erlenmeyer/core"
+	"github.com/ovh/erlenmeyer/middlewares"
+	"github.com/ovh/erlenmeyer/proto/influxdb"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	// orgID is the organization id of the buckets, erlenmeyer has no
+	// organizations
+	orgID = "0000000000000000"
+)
+
+// Flux endpoint
+type Flux struct {
+	ReqCounter  prometheus.Counter
+	ErrCounter  prometheus.Counter
+	WarnCounter prometheus.Counter
+}
+
+// GetReqCounter satisfies the protocol interface
+func (f *Flux) GetReqCounter() prometheus.Counter {
+	return f.ReqCounter
+}
+
+// NewFlux is creating a new Flux query handler
+func NewFlux() *Flux {
+	f := &Flux{}
+
+	// metrics
+	f.ReqCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "erlenmeyer",
+		Subsystem: "flux",
+		Name:      "request",
+		Help:      "Number of request handled.",
+	})
+	prometheus.MustRegister(f.ReqCounter)
+	f.ErrCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "erlenmeyer",
+		Subsystem: "flux",
+		Name:      "errors",
+		Help:      "Number of request in errors.",
+	})
+	prometheus.MustRegister(f.ErrCounter)
+	f.WarnCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "erlenmeyer",
+		Subsystem: "flux",
+		Name:      "warning",
+		Help:      "Number of errored client requests.",
+	})
+	prometheus.MustRegister(f.WarnCounter)
+
+	return f
+}
+
+// Error is an InfluxDB 2.x API error
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeError write an InfluxDB 2.x API error
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&Error{Code: code, Message: message})
+}
+
+// queryRequest is the JSON body of a query request
+type queryRequest struct {
+	Query   string   `json:"query"`
+	Type    string   `json:"type"`
+	Dialect *dialect `json:"dialect"`
+}
+
+// Query execute a Flux query, answering the tables as annotated CSV
+// https://docs.influxdata.com/influxdb/v2.0/api/#operation/PostQuery
+func (f *Flux) Query(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		f.WarnCounter.Inc()
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed", "query requires a POST request")
+		return
+	}
+
+	token := core.RetrieveToken(r)
+	if len(token) == 0 {
+		f.WarnCounter.Inc()
+		writeError(w, http.StatusUnauthorized, "unauthorized", "unauthorized access")
+		return
+	}
+
+	reader := r.Body
+	if maxSize := viper.GetInt64("flux.query.maxsize"); maxSize > 0 {
+		reader = http.MaxBytesReader(w, r.Body, maxSize)
+	}
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		f.WarnCounter.Inc()
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	request := &queryRequest{}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/vnd.flux" {
+		request.Query = string(body)
+	} else if err = json.Unmarshal(body, request); err != nil {
+		f.WarnCounter.Inc()
+		writeError(w, http.StatusBadRequest, "invalid", "failed to decode request body: "+err.Error())
+		return
+	}
+	if request.Type != "" && request.Type != "flux" {
+		f.WarnCounter.Inc()
+		writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("unsupported query type %s", request.Type))
+		return
+	}
+	if request.Dialect == nil {
+		request.Dialect = defaultDialect()
+	}
+
+	exprs, err := parseScript(request.Query)
+	if err != nil {
+		f.WarnCounter.Inc()
+		writeError(w, http.StatusBadRequest, "invalid", "compilation failed: "+err.Error())
+		return
+	}
+
+	mc2, err := toWarpScript(exprs, token)
+	if err != nil {
+		f.WarnCounter.Inc()
+		writeError(w, http.StatusBadRequest, "invalid", "compilation failed: "+err.Error())
+		return
+	}
+
+	tables, err := execute(mc2, w.Header().Get(middlewares.TxnHeader))
+	if err != nil {
+		f.ErrCounter.Inc()
+		writeError(w, http.StatusInternalServerError, "internal error", err.Error())
+		return
+	}
+
+	f.ReqCounter.Inc()
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err = writeAnnotatedCSV(w, tables, request.Dialect); err != nil {
+		log.WithError(err).Error("Could not answer to the flux request")
+	}
+}
+
+// execute run the translated WarpScript and decode the output tables
+func execute(mc2, txn string) ([]table, error) {
+	warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "flux")
+
+	res, err := warpServer.Query(mc2, txn)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+			"proto": "flux",
+		}).Error("Bad response from Egress")
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	decoder := json.NewDecoder(res.Body)
+	decoder.UseNumber()
+
+	stack := make([][]table, 0)
+	if err = decoder.Decode(&stack); err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+			"proto": "flux",
+		}).Error("Cannot unmarshal egress response")
+		return nil, err
+	}
+	if len(stack) == 0 {
+		return []table{}, nil
+	}
+	return stack[0], nil
+}
+
+// Bucket is an InfluxDB 2.x bucket, erlenmeyer buckets are the measurements
+type Bucket struct {
+	ID             string        `json:"id"`
+	OrgID          string        `json:"orgID"`
+	Type           string        `json:"type"`
+	Name           string        `json:"name"`
+	RetentionRules []interface{} `json:"retentionRules"`
+}
+
+// Buckets is the InfluxDB 2.x buckets list response
+type Buckets struct {
+	Links   map[string]string `json:"links"`
+	Buckets []Bucket          `json:"buckets"`
+}
+
+// bucketID return a stable 16 hexadecimal characters id of a bucket name
+func bucketID(name string) string {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// Buckets list the buckets, using the InfluxQL SHOW MEASUREMENTS discovery
+// https://docs.influxdata.com/influxdb/v2.0/api/#operation/GetBuckets
+func (f *Flux) Buckets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		f.WarnCounter.Inc()
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed", "buckets listing requires a GET request")
+		return
+	}
+
+	token := core.RetrieveToken(r)
+	if len(token) == 0 {
+		f.WarnCounter.Inc()
+		writeError(w, http.StatusUnauthorized, "unauthorized", "unauthorized access")
+		return
+	}
+
+	measurements, err := influxdb.Measurements(w.Header().Get(middlewares.TxnHeader), token)
+	if err != nil {
+		f.ErrCounter.Inc()
+		writeError(w, http.StatusInternalServerError, "internal error", err.Error())
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	response := &Buckets{
+		Links:   map[string]string{"self": r.URL.Path},
+		Buckets: make([]Bucket, 0, len(measurements)),
+	}
+	for _, measurement := range measurements {
+		if name != "" && measurement != name {
+			continue
+		}
+		response.Buckets = append(response.Buckets, Bucket{
+			ID:             bucketID(measurement),
+			OrgID:          orgID,
+			Type:           "user",
+			Name:           measurement,
+			RetentionRules: []interface{}{},
+		})
+	}
+
+	f.ReqCounter.Inc()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,777 @@
+package flux
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// tokenType is the kind of a Flux lexical token
+type tokenType int
+
+const (
+	eofToken tokenType = iota
+	identToken
+	stringToken
+	intToken
+	floatToken
+	durationToken
+	timeToken
+	regexToken
+	operatorToken
+)
+
+// token is a Flux lexical token
+type token struct {
+	kind  tokenType
+	value string
+	pos   int
+}
+
+// fluxOperators are the supported Flux operators and punctuation, longest
+// first
+var fluxOperators = []string{
+	"|>", "=>", "==", "!=", "=~", "!~", "<=", ">=",
+	"<", ">", "+", "-", "*", "/", "%", "(", ")", "[", "]", "{", "}", ",", ":", ".", "=",
+}
+
+// durationUnits are the Flux duration units
+// https://docs.influxdata.com/flux/v0.x/spec/lexical-elements/#duration-literals
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+// lex split a Flux script into tokens
+// nolint: gocyclo
+func lex(script string) ([]token, error) {
+	tokens := make([]token, 0)
+	runes := []rune(script)
+
+	for pos := 0; pos < len(runes); {
+		r := runes[pos]
+
+		switch {
+		case unicode.IsSpace(r):
+			pos++
+
+		case r == '/' && pos+1 < len(runes) && runes[pos+1] == '/':
+			// Comment up to the end of the line
+			for pos < len(runes) && runes[pos] != '\n' {
+				pos++
+			}
+
+		case r == '"':
+			value, end, err := lexString(runes, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: stringToken, value: value, pos: pos})
+			pos = end
+
+		case r == '/' && regexAllowed(tokens):
+			end := pos + 1
+			var b strings.Builder
+			for ; end < len(runes) && runes[end] != '/'; end++ {
+				if runes[end] == '\\' && end+1 < len(runes) && runes[end+1] == '/' {
+					end++
+				}
+				b.WriteRune(runes[end])
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated regular expression at position %d", pos)
+			}
+			tokens = append(tokens, token{kind: regexToken, value: b.String(), pos: pos})
+			pos = end + 1
+
+		case unicode.IsDigit(r):
+			tok, end, err := lexNumber(runes, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			pos = end
+
+		case r == '_' || unicode.IsLetter(r):
+			end := pos
+			for end < len(runes) && (runes[end] == '_' || unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+				end++
+			}
+			tokens = append(tokens, token{kind: identToken, value: string(runes[pos:end]), pos: pos})
+			pos = end
+
+		default:
+			matched := false
+			for _, op := range fluxOperators {
+				if hasRunePrefix(runes[pos:], op) {
+					tokens = append(tokens, token{kind: operatorToken, value: op, pos: pos})
+					pos += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, pos)
+			}
+		}
+	}
+
+	return append(tokens, token{kind: eofToken, pos: len(runes)}), nil
+}
+
+// hasRunePrefix return true when the runes start with the ASCII operator,
+// without copying the rest of the script
+func hasRunePrefix(runes []rune, op string) bool {
+	if len(runes) < len(op) {
+		return false
+	}
+	for i := 0; i < len(op); i++ {
+		if runes[i] != rune(op[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// regexAllowed return true when a slash starts a regular expression literal
+// instead of a division
+func regexAllowed(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	last := tokens[len(tokens)-1]
+	if last.kind != operatorToken {
+		return false
+	}
+	switch last.value {
+	case ")", "]", "}":
+		return false
+	}
+	return true
+}
+
+// lexString read a double quoted string literal
+func lexString(runes []rune, pos int) (string, int, error) {
+	var b strings.Builder
+	for end := pos + 1; end < len(runes); end++ {
+		switch runes[end] {
+		case '"':
+			return b.String(), end + 1, nil
+		case '\\':
+			end++
+			if end >= len(runes) {
+				break
+			}
+			switch runes[end] {
+			case 'n':
+				b.WriteRune('\n')
+			case 't':
+				b.WriteRune('\t')
+			case 'r':
+				b.WriteRune('\r')
+			default:
+				b.WriteRune(runes[end])
+			}
+		default:
+			b.WriteRune(runes[end])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string at position %d", pos)
+}
+
+// lexNumber read an integer, float, duration or date time literal
+func lexNumber(runes []rune, pos int) (token, int, error) {
+	end := pos
+	for end < len(runes) && unicode.IsDigit(runes[end]) {
+		end++
+	}
+
+	// Date time literal, read up to the next delimiter
+	if end-pos == 4 && end < len(runes) && runes[end] == '-' {
+		for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune(",)]}", runes[end]) {
+			end++
+		}
+		return token{kind: timeToken, value: string(runes[pos:end]), pos: pos}, end, nil
+	}
+
+	// Duration literal, a sequence of integers and units
+	if end < len(runes) && unicode.IsLetter(runes[end]) {
+		for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+			end++
+		}
+		return token{kind: durationToken, value: string(runes[pos:end]), pos: pos}, end, nil
+	}
+
+	if end+1 < len(runes) && runes[end] == '.' && unicode.IsDigit(runes[end+1]) {
+		end++
+		for end < len(runes) && unicode.IsDigit(runes[end]) {
+			end++
+		}
+		return token{kind: floatToken, value: string(runes[pos:end]), pos: pos}, end, nil
+	}
+	return token{kind: intToken, value: string(runes[pos:end]), pos: pos}, end, nil
+}
+
+// parseDuration parse a Flux duration literal like 1h30m
+func parseDuration(s string) (time.Duration, error) {
+	var d time.Duration
+	runes := []rune(s)
+	for pos := 0; pos < len(runes); {
+		start := pos
+		for pos < len(runes) && unicode.IsDigit(runes[pos]) {
+			pos++
+		}
+		if start == pos {
+			return 0, fmt.Errorf("invalid duration %s", s)
+		}
+		magnitude, err := strconv.ParseInt(string(runes[start:pos]), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+
+		start = pos
+		for pos < len(runes) && unicode.IsLetter(runes[pos]) {
+			pos++
+		}
+		unit, ok := durationUnits[string(runes[start:pos])]
+		if !ok {
+			return 0, fmt.Errorf("unsupported duration unit %q in %s", string(runes[start:pos]), s)
+		}
+		d += time.Duration(magnitude) * unit
+	}
+	return d, nil
+}
+
+// expr is a Flux expression
+type expr interface{}
+
+type identExpr struct {
+	name string
+}
+
+type stringExpr struct {
+	value string
+}
+
+type intExpr struct {
+	value int64
+}
+
+type floatExpr struct {
+	value float64
+}
+
+type durationExpr struct {
+	value time.Duration
+}
+
+type timeExpr struct {
+	value time.Time
+}
+
+type regexExpr struct {
+	value string
+}
+
+type memberExpr struct {
+	object   expr
+	property string
+}
+
+type callExpr struct {
+	callee expr
+	args   map[string]expr
+}
+
+type pipeExpr struct {
+	arg  expr
+	call *callExpr
+}
+
+type binaryExpr struct {
+	op    string
+	left  expr
+	right expr
+}
+
+type unaryExpr struct {
+	op  string
+	arg expr
+}
+
+type arrayExpr struct {
+	elements []expr
+}
+
+type property struct {
+	key   string
+	value expr
+}
+
+type objectExpr struct {
+	with  expr
+	props []property
+}
+
+type functionExpr struct {
+	params []string
+	body   expr
+}
+
+// parser is a recursive descent parser of the Flux subset handled by
+// erlenmeyer
+// https://docs.influxdata.com/flux/v0.x/spec/
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parseScript parse a Flux script into its top level expressions, imports
+// are skipped
+func parseScript(script string) ([]expr, error) {
+	tokens, err := lex(script)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+
+	exprs := make([]expr, 0)
+	for p.peek().kind != eofToken {
+		if p.isIdent("import") {
+			p.next()
+			if _, err := p.expect(stringToken, ""); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+	if len(exprs) == 0 {
+		return nil, fmt.Errorf("empty Flux query")
+	}
+	return exprs, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != eofToken {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) isOperator(op string) bool {
+	tok := p.peek()
+	return tok.kind == operatorToken && tok.value == op
+}
+
+func (p *parser) isIdent(name string) bool {
+	tok := p.peek()
+	return tok.kind == identToken && tok.value == name
+}
+
+// expect consume a token of the given kind, and value when not empty
+func (p *parser) expect(kind tokenType, value string) (token, error) {
+	tok := p.next()
+	if tok.kind != kind || (value != "" && tok.value != value) {
+		if tok.kind == eofToken {
+			return tok, fmt.Errorf("unexpected end of query")
+		}
+		return tok, fmt.Errorf("unexpected token %q at position %d", tok.value, tok.pos)
+	}
+	return tok, nil
+}
+
+func (p *parser) parseExpr() (expr, error) {
+	return p.parsePipe()
+}
+
+func (p *parser) parsePipe() (expr, error) {
+	left, err := p.parseLogical("or")
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("|>") {
+		p.next()
+		right, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		call, ok := right.(*callExpr)
+		if !ok {
+			return nil, fmt.Errorf("pipe destination must be a function call")
+		}
+		left = &pipeExpr{arg: left, call: call}
+	}
+	return left, nil
+}
+
+// parseLogical parse the "or" then "and" operators, by precedence
+func (p *parser) parseLogical(op string) (expr, error) {
+	parseOperand := func() (expr, error) {
+		if op == "or" {
+			return p.parseLogical("and")
+		}
+		return p.parseUnaryLogical()
+	}
+
+	left, err := parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for p.isIdent(op) {
+		p.next()
+		right, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnaryLogical() (expr, error) {
+	if p.isIdent("not") || p.isIdent("exists") {
+		op := p.next().value
+		arg, err := p.parseUnaryLogical()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: op, arg: arg}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "=~", "!~", "<=", ">=", "<", ">"} {
+		if p.isOperator(op) {
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return &binaryExpr{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("+") || p.isOperator("-") {
+		op := p.next().value
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("*") || p.isOperator("/") || p.isOperator("%") {
+		op := p.next().value
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.isOperator("-") {
+		p.next()
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		// Fold negative literals
+		switch arg := arg.(type) {
+		case *intExpr:
+			return &intExpr{value: -arg.value}, nil
+		case *floatExpr:
+			return &floatExpr{value: -arg.value}, nil
+		case *durationExpr:
+			return &durationExpr{value: -arg.value}, nil
+		}
+		return &unaryExpr{op: "-", arg: arg}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (expr, error) {
+	e, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.isOperator("."):
+			p.next()
+			tok, err := p.expect(identToken, "")
+			if err != nil {
+				return nil, err
+			}
+			e = &memberExpr{object: e, property: tok.value}
+		case p.isOperator("["):
+			p.next()
+			tok, err := p.expect(stringToken, "")
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(operatorToken, "]"); err != nil {
+				return nil, err
+			}
+			e = &memberExpr{object: e, property: tok.value}
+		case p.isOperator("("):
+			args, err := p.parseArguments()
+			if err != nil {
+				return nil, err
+			}
+			e = &callExpr{callee: e, args: args}
+		default:
+			return e, nil
+		}
+	}
+}
+
+// parseArguments parse the named arguments of a function call
+func (p *parser) parseArguments() (map[string]expr, error) {
+	if _, err := p.expect(operatorToken, "("); err != nil {
+		return nil, err
+	}
+	args := make(map[string]expr)
+	for !p.isOperator(")") {
+		key, err := p.expect(identToken, "")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(operatorToken, ":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args[key.value] = value
+
+		if !p.isOperator(",") {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(operatorToken, ")"); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// nolint: gocyclo
+func (p *parser) parsePrimary() (expr, error) {
+	tok := p.peek()
+
+	switch tok.kind {
+	case identToken:
+		p.next()
+		return &identExpr{name: tok.value}, nil
+	case stringToken:
+		p.next()
+		return &stringExpr{value: tok.value}, nil
+	case intToken:
+		p.next()
+		value, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &intExpr{value: value}, nil
+	case floatToken:
+		p.next()
+		value, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &floatExpr{value: value}, nil
+	case durationToken:
+		p.next()
+		value, err := parseDuration(tok.value)
+		if err != nil {
+			return nil, err
+		}
+		return &durationExpr{value: value}, nil
+	case timeToken:
+		p.next()
+		value, err := time.Parse(time.RFC3339Nano, tok.value)
+		if err != nil {
+			if value, err = time.Parse("2006-01-02", tok.value); err != nil {
+				return nil, fmt.Errorf("invalid date time %s", tok.value)
+			}
+		}
+		return &timeExpr{value: value}, nil
+	case regexToken:
+		p.next()
+		return &regexExpr{value: tok.value}, nil
+	}
+
+	switch {
+	case p.isOperator("("):
+		if p.isFunction() {
+			return p.parseFunction()
+		}
+		p.next()
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(operatorToken, ")"); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case p.isOperator("["):
+		p.next()
+		array := &arrayExpr{elements: make([]expr, 0)}
+		for !p.isOperator("]") {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			array.elements = append(array.elements, e)
+			if !p.isOperator(",") {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expect(operatorToken, "]"); err != nil {
+			return nil, err
+		}
+		return array, nil
+	case p.isOperator("{"):
+		return p.parseObject()
+	}
+
+	if tok.kind == eofToken {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	return nil, fmt.Errorf("unexpected token %q at position %d", tok.value, tok.pos)
+}
+
+// isFunction return true when the opening parenthesis starts a function
+// literal parameters list
+func (p *parser) isFunction() bool {
+	offset := 1
+	for {
+		tok := p.peekAt(offset)
+		if tok.kind == operatorToken && tok.value == ")" {
+			next := p.peekAt(offset + 1)
+			return next.kind == operatorToken && next.value == "=>"
+		}
+		if tok.kind != identToken {
+			return false
+		}
+		offset++
+		if sep := p.peekAt(offset); sep.kind == operatorToken && sep.value == "," {
+			offset++
+		}
+	}
+}
+
+func (p *parser) parseFunction() (expr, error) {
+	p.next()
+	fn := &functionExpr{params: make([]string, 0)}
+	for !p.isOperator(")") {
+		tok, err := p.expect(identToken, "")
+		if err != nil {
+			return nil, err
+		}
+		fn.params = append(fn.params, tok.value)
+		if p.isOperator(",") {
+			p.next()
+		}
+	}
+	p.next()
+	if _, err := p.expect(operatorToken, "=>"); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	fn.body = body
+	return fn, nil
+}
+
+// parseObject parse an object literal, with an optional "with" source
+// record
+func (p *parser) parseObject() (expr, error) {
+	p.next()
+	object := &objectExpr{props: make([]property, 0)}
+
+	if p.peek().kind == identToken && p.peekAt(1).kind == identToken && p.peekAt(1).value == "with" {
+		object.with = &identExpr{name: p.next().value}
+		p.next()
+	}
+
+	for !p.isOperator("}") {
+		key := p.next()
+		if key.kind != identToken && key.kind != stringToken {
+			return nil, fmt.Errorf("unexpected token %q at position %d", key.value, key.pos)
+		}
+		if _, err := p.expect(operatorToken, ":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		object.props = append(object.props, property{key: key.value, value: value})
+
+		if !p.isOperator(",") {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(operatorToken, "}"); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
@@ -0,0 +1,120 @@
+package flux
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScript(t *testing.T) {
+	var tests = []struct {
+		q     string
+		calls []string
+		err   bool
+	}{
+		{`from(bucket: "cpu") |> range(start: -1h)`, []string{"from", "range"}, false},
+		{`import "strings"
+		// usage per host
+		from(bucket: "cpu")
+			|> range(start: 2019-01-01T00:00:00Z, stop: now())
+			|> filter(fn: (r) => r._field == "usage" and r["host"] =~ /^web/)
+			|> aggregateWindow(every: 1m, fn: mean, createEmpty: false)
+			|> group(columns: ["host"])
+			|> map(fn: (r) => ({ r with _value: r._value * 2.0 }))
+			|> yield(name: "usage")`, []string{"from", "range", "filter", "aggregateWindow", "group", "map", "yield"}, false},
+		{`from(bucket: "cpu") |> range(start: -1h`, nil, true},
+		{`from(bucket: "cpu") |> 1`, nil, true},
+		{`from(bucket: "cpu") |> filter(fn: (r) => r.host == "a)`, nil, true},
+		{``, nil, true},
+	}
+
+	for _, test := range tests {
+		exprs, err := parseScript(test.q)
+		if test.err {
+			if err == nil {
+				t.Errorf("Expected an error for %s", test.q)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected nil for %s, got %v", test.q, err)
+			continue
+		}
+
+		calls, err := flattenPipeline(exprs[0])
+		if err != nil {
+			t.Errorf("Expected nil for %s, got %v", test.q, err)
+			continue
+		}
+		if len(calls) != len(test.calls) {
+			t.Errorf("Expected %d calls for %s, got %d", len(test.calls), test.q, len(calls))
+			continue
+		}
+		for index, call := range calls {
+			if callName(call) != test.calls[index] {
+				t.Errorf("Expected %s call, got %s", test.calls[index], callName(call))
+			}
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	var tests = []struct {
+		s        string
+		expected time.Duration
+		err      bool
+	}{
+		{"1h", time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"2d", 48 * time.Hour, false},
+		{"10ms", 10 * time.Millisecond, false},
+		{"1mo", 0, true},
+	}
+
+	for _, test := range tests {
+		d, err := parseDuration(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("Expected an error for %s", test.s)
+			}
+			continue
+		}
+		if err != nil || d != test.expected {
+			t.Errorf("Expected %v for %s, got %v (%v)", test.expected, test.s, d, err)
+		}
+	}
+}
+
+func TestLexRegexAndDivision(t *testing.T) {
+	tokens, err := lex(`r._value / 2.0 > 1 and r.host =~ /a\/b/`)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	var division, regex bool
+	for _, tok := range tokens {
+		if tok.kind == operatorToken && tok.value == "/" {
+			division = true
+		}
+		if tok.kind == regexToken && tok.value == "a/b" {
+			regex = true
+		}
+	}
+	if !division || !regex {
+		t.Errorf("Expected a division and a regex, got %+v", tokens)
+	}
+}
+
+func TestLexLongScript(t *testing.T) {
+	tokens, err := lex(strings.Repeat("(", 100000))
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if len(tokens) != 100001 {
+		t.Errorf("Expected 100000 operators and the end of script, got %d tokens", len(tokens))
+	}
+
+	if _, err = parseScript(strings.Repeat("(", 40000)); err == nil {
+		t.Error("Expected an unbalanced script to fail")
+	}
+}
@@ -0,0 +1,582 @@
+package flux
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ovh/erlenmeyer/core"
+	"github.com/spf13/viper"
+)
+
+const (
+	// separator is the separator between the measurement and the field in
+	// the Warp 10 classnames, as in InfluxQL
+	separator = "."
+	// defaultResult is the Flux default result name
+	defaultResult = "_result"
+)
+
+// bucketizers are the aggregateWindow functions with their Warp 10
+// bucketizer
+var bucketizers = map[string]string{
+	"mean":   "bucketizer.mean",
+	"sum":    "bucketizer.sum",
+	"count":  "bucketizer.count",
+	"min":    "bucketizer.min",
+	"max":    "bucketizer.max",
+	"first":  "bucketizer.first",
+	"last":   "bucketizer.last",
+	"median": "bucketizer.median",
+	"stddev": "true bucketizer.sd",
+}
+
+// tickNanos return the number of nanoseconds of a Warp 10 platform tick
+func tickNanos() int64 {
+	switch viper.GetString("timeunit") {
+	case "ms":
+		return 1000000
+	case "ns":
+		return 1
+	}
+
+	// by default assume the platform is in microseconds
+	return 1000
+}
+
+// pipeline hold the translation state of a from() pipeline, the WarpScript
+// is built as a node chain, each node taking its input from its Left node
+type pipeline struct {
+	bucket  string
+	start   string
+	stop    string
+	fetched bool
+	pending []expr
+	result  string
+	node    *core.Node
+}
+
+// toWarpScript translate Flux top level expressions into a WarpScript leaving
+// on the stack the list of the output tables
+func toWarpScript(exprs []expr, token string) (string, error) {
+	var b strings.Builder
+
+	b.WriteString("'" + token + "' 'token' STORE \n")
+	b.WriteString("$token CAPADD \n")
+	b.WriteString("'stack.maxops.hard' STACKATTRIBUTE DUP <% ISNULL ! %> <% MAXOPS %> <% DROP %> IFTE\n")
+	b.WriteString("'fetch.limit.hard' STACKATTRIBUTE DUP <% ISNULL ! %> <% LIMIT %> <% DROP %> IFTE\n")
+	b.WriteString("'gts.limit.hard' STACKATTRIBUTE DUP <% ISNULL ! %> <% MAXGTS %> <% DROP %> IFTE\n")
+	b.WriteString("NOW 'now' STORE\n")
+
+	for _, e := range exprs {
+		calls, err := flattenPipeline(e)
+		if err != nil {
+			return "", err
+		}
+
+		p := &pipeline{result: defaultResult}
+		node, err := p.translate(calls)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(node.InternalToWarpScript(""))
+	}
+
+	b.WriteString("DEPTH ->LIST FLATTEN\n")
+	return b.String(), nil
+}
+
+// flattenPipeline return the calls of a pipe expression, in order
+func flattenPipeline(e expr) ([]*callExpr, error) {
+	switch e := e.(type) {
+	case *pipeExpr:
+		calls, err := flattenPipeline(e.arg)
+		if err != nil {
+			return nil, err
+		}
+		return append(calls, e.call), nil
+	case *callExpr:
+		return []*callExpr{e}, nil
+	}
+	return nil, fmt.Errorf("unsupported statement, a query must be a from() pipeline")
+}
+
+// callName return the name of the called function
+func callName(call *callExpr) string {
+	if ident, ok := call.callee.(*identExpr); ok {
+		return ident.name
+	}
+	return ""
+}
+
+// add append a WarpScript node to the pipeline chain
+func (p *pipeline) add(mc2 string) {
+	node := core.NewNode(core.WarpScriptPayload{WarpScript: mc2})
+	node.Left = p.node
+	p.node = node
+}
+
+// translate build the pipeline node chain
+// nolint: gocyclo
+func (p *pipeline) translate(calls []*callExpr) (*core.Node, error) {
+	if callName(calls[0]) != "from" {
+		return nil, fmt.Errorf("a query must start with from()")
+	}
+	bucket, err := stringArg(calls[0], "bucket", "")
+	if err != nil {
+		return nil, err
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("missing required argument bucket in from()")
+	}
+	p.bucket = bucket
+
+	for _, call := range calls[1:] {
+		name := callName(call)
+
+		switch name {
+		case "range":
+			if p.start != "" {
+				return nil, fmt.Errorf("range() is already set")
+			}
+			if err = p.parseRange(call); err != nil {
+				return nil, err
+			}
+			continue
+		case "filter":
+			fn, ok := call.args["fn"]
+			if !ok {
+				return nil, fmt.Errorf("missing required argument fn in filter()")
+			}
+			if !p.fetched {
+				p.pending = append(p.pending, fn)
+				continue
+			}
+			if err = p.filter(fn); err != nil {
+				return nil, err
+			}
+			continue
+		case "yield":
+			if p.result, err = stringArg(call, "name", defaultResult); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err = p.fetch(); err != nil {
+			return nil, err
+		}
+
+		switch name {
+		case "aggregateWindow":
+			err = p.aggregateWindow(call)
+		case "group":
+			err = p.group(call)
+		case "map":
+			err = p.mapValues(call)
+		default:
+			err = fmt.Errorf("unsupported function %s()", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = p.fetch(); err != nil {
+		return nil, err
+	}
+	p.output()
+	return p.node, nil
+}
+
+// parseRange store the range bounds, stop defaults to now()
+func (p *pipeline) parseRange(call *callExpr) error {
+	start, ok := call.args["start"]
+	if !ok {
+		return fmt.Errorf("missing required argument start in range()")
+	}
+	startTick, err := timeArg(start)
+	if err != nil {
+		return err
+	}
+
+	stopTick := "$now"
+	if stop, ok := call.args["stop"]; ok {
+		if stopTick, err = timeArg(stop); err != nil {
+			return err
+		}
+	}
+
+	p.start = startTick
+	p.stop = stopTick
+	p.add(fmt.Sprintf("%s 'start' STORE %s 'stop' STORE", startTick, stopTick))
+	return nil
+}
+
+// timeArg return the WarpScript tick of a range bound: a relative duration,
+// a date time, a unix timestamp in seconds or now()
+func timeArg(e expr) (string, error) {
+	switch e := e.(type) {
+	case *durationExpr:
+		return fmt.Sprintf("$now %d +", e.value.Nanoseconds()/tickNanos()), nil
+	case *timeExpr:
+		return strconv.FormatInt(e.value.UnixNano()/tickNanos(), 10), nil
+	case *intExpr:
+		return strconv.FormatInt(e.value*(1000000000/tickNanos()), 10), nil
+	case *callExpr:
+		if callName(e) == "now" {
+			return "$now", nil
+		}
+	}
+	return "", fmt.Errorf("unsupported range bound, expecting a duration, a time or now()")
+}
+
+// stringArg return a string argument of a call
+func stringArg(call *callExpr, name, defaultValue string) (string, error) {
+	arg, ok := call.args[name]
+	if !ok {
+		return defaultValue, nil
+	}
+	value, ok := arg.(*stringExpr)
+	if !ok {
+		return "", fmt.Errorf("argument %s of %s() must be a string", name, callName(call))
+	}
+	return value.value, nil
+}
+
+// fetch emit the FETCH of the pipeline bucket, the filters set before it are
+// pushed down as classname and labels selectors when possible
+func (p *pipeline) fetch() error {
+	if p.fetched {
+		return nil
+	}
+	if p.start == "" {
+		return fmt.Errorf("range() is required after from()")
+	}
+	p.fetched = true
+
+	fields := ".*"
+	labels := make(map[string]string)
+	remaining := make([]expr, 0)
+
+	for _, fn := range p.pending {
+		compiler, function, err := newExprCompiler(fn)
+		if err != nil {
+			return err
+		}
+
+		for _, conjunct := range conjuncts(function.body) {
+			if fields == ".*" {
+				if names, ok := compiler.fieldNames(conjunct); ok {
+					quoted := make([]string, len(names))
+					for i, name := range names {
+						quoted[i] = regexp.QuoteMeta(name)
+					}
+					fields = "(" + strings.Join(quoted, "|") + ")"
+					continue
+				}
+			}
+			if key, selector, ok := compiler.labelSelector(conjunct); ok {
+				if _, exists := labels[key]; !exists {
+					labels[key] = selector
+					continue
+				}
+			}
+			remaining = append(remaining, &functionExpr{params: function.params, body: conjunct})
+		}
+	}
+
+	labelsSelectors := make([]string, 0, len(labels))
+	for key, selector := range labels {
+		labelsSelectors = append(labelsSelectors, quote(key)+" "+quote(selector))
+	}
+	sort.Strings(labelsSelectors)
+	labelsMap := "{}"
+	if len(labelsSelectors) > 0 {
+		labelsMap = "{ " + strings.Join(labelsSelectors, " ") + " }"
+	}
+
+	classname := "~" + regexp.QuoteMeta(p.bucket+separator) + fields
+	mc2 := fmt.Sprintf("[ $token %s %s $stop 1 - $stop $start - ] FETCH\n", quote(classname), labelsMap)
+	// Expose the measurement and field as labels, like Flux columns
+	mc2 += fmt.Sprintf("<%% DROP DUP NAME %s '' REPLACE 'field' STORE { '_measurement' %s '_field' $field } RELABEL %%> LMAP",
+		quote("^"+regexp.QuoteMeta(p.bucket+separator)), quote(p.bucket))
+	p.add(mc2)
+
+	for _, fn := range remaining {
+		if err := p.filter(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// conjuncts split an expression on its top level and operators
+func conjuncts(e expr) []expr {
+	if binary, ok := e.(*binaryExpr); ok && binary.op == "and" {
+		return append(conjuncts(binary.left), conjuncts(binary.right)...)
+	}
+	return []expr{e}
+}
+
+// fieldNames return the fields of a r._field == "name" predicate, or of a
+// disjunction of such predicates
+func (c *exprCompiler) fieldNames(e expr) ([]string, bool) {
+	binary, ok := e.(*binaryExpr)
+	if !ok {
+		return nil, false
+	}
+
+	if binary.op == "or" {
+		left, ok := c.fieldNames(binary.left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := c.fieldNames(binary.right)
+		if !ok {
+			return nil, false
+		}
+		return append(left, right...), true
+	}
+
+	column, value, ok := c.columnEquality(binary)
+	if !ok || column != "_field" {
+		return nil, false
+	}
+	return []string{value}, true
+}
+
+// labelSelector return the Warp 10 label selector of a tag equality or
+// regular expression predicate
+func (c *exprCompiler) labelSelector(e expr) (string, string, bool) {
+	binary, ok := e.(*binaryExpr)
+	if !ok {
+		return "", "", false
+	}
+
+	if binary.op == "=~" {
+		column, ok := c.recordColumn(binary.left)
+		regex, isRegex := binary.right.(*regexExpr)
+		if !ok || !isRegex || strings.HasPrefix(column, "_") {
+			return "", "", false
+		}
+		return column, "~.*(" + regex.value + ").*", true
+	}
+
+	column, value, ok := c.columnEquality(binary)
+	if !ok || strings.HasPrefix(column, "_") {
+		return "", "", false
+	}
+	return column, "=" + value, true
+}
+
+// columnEquality return the column and value of a r.column == "value"
+// predicate
+func (c *exprCompiler) columnEquality(binary *binaryExpr) (string, string, bool) {
+	if binary.op != "==" {
+		return "", "", false
+	}
+	column, ok := c.recordColumn(binary.left)
+	value, isString := binary.right.(*stringExpr)
+	if !ok || !isString {
+		column, ok = c.recordColumn(binary.right)
+		value, isString = binary.left.(*stringExpr)
+	}
+	if !ok || !isString {
+		return "", "", false
+	}
+	return column, value.value, true
+}
+
+// rowMacro return a MAP call applying a macro mapper on each row of the
+// series, the macro has $tick and $value set and push the output value, a
+// NULL value drops the row
+func rowMacro(mc2 string) string {
+	return `[ [ $gts ] <%
+		'w' STORE $w 0 GET 'tick' STORE $w 7 GET 0 GET 'value' STORE
+		$w 0 GET NaN NaN NaN ` + mc2 + ` 5 ->LIST
+	%> MACROMAPPER 0 0 0 ] MAP 0 GET`
+}
+
+// filter translate a filter() predicate. Predicates on the group key only
+// filter whole series, the others filter the series rows.
+func (p *pipeline) filter(fn expr) error {
+	compiler, function, err := newExprCompiler(fn)
+	if err != nil {
+		return err
+	}
+	predicate, err := compiler.compile(function.body)
+	if err != nil {
+		return err
+	}
+
+	if !compiler.usesRow {
+		p.add("[] SWAP <% 'gts' STORE $gts LABELS 'labels' STORE " + predicate + " <% $gts +! %> IFT %> FOREACH")
+		return nil
+	}
+
+	p.add("<% DROP 'gts' STORE $gts LABELS 'labels' STORE " +
+		rowMacro(predicate+" <% $value %> <% NULL %> IFTE") + " %> LMAP")
+	return nil
+}
+
+// mapValues translate a map() function returning a record. The _value
+// column is computed on each row, the other columns are set as labels.
+func (p *pipeline) mapValues(call *callExpr) error {
+	fn, ok := call.args["fn"]
+	if !ok {
+		return fmt.Errorf("missing required argument fn in map()")
+	}
+	compiler, function, err := newExprCompiler(fn)
+	if err != nil {
+		return err
+	}
+	record, ok := function.body.(*objectExpr)
+	if !ok {
+		return fmt.Errorf("map() fn must return a record, like (r) => ({ r with _value: r._value * 2.0 })")
+	}
+
+	value := ""
+	labels := make([]string, 0)
+	for _, prop := range record.props {
+		switch prop.key {
+		case "_value":
+			if value, err = compiler.compile(prop.value); err != nil {
+				return err
+			}
+			continue
+		case "_time", "_start", "_stop":
+			// Only keeping the column is supported
+			if column, ok := compiler.recordColumn(prop.value); !ok || column != prop.key {
+				return fmt.Errorf("map() can't update the %s column", prop.key)
+			}
+			continue
+		}
+
+		label := &exprCompiler{record: compiler.record}
+		mc2, err := label.compile(prop.value)
+		if err != nil {
+			return err
+		}
+		if label.usesRow {
+			return fmt.Errorf("map() column %s can't depend on _time or _value", prop.key)
+		}
+		labels = append(labels, quote(prop.key)+" "+mc2+" TOSTRING")
+	}
+
+	mc2 := "<% DROP 'gts' STORE $gts LABELS 'labels' STORE "
+	if len(labels) > 0 {
+		mc2 += "$gts { " + strings.Join(labels, " ") + " } RELABEL 'gts' STORE "
+	}
+	if value != "" {
+		mc2 += rowMacro(value)
+	} else {
+		mc2 += "$gts"
+	}
+	p.add(mc2 + " %> LMAP")
+	return nil
+}
+
+// aggregateWindow translate an aggregateWindow() call into a BUCKETIZE. The
+// buckets end one tick before the Flux windows stop, then are shifted, so
+// they hold the same [start, stop) points.
+func (p *pipeline) aggregateWindow(call *callExpr) error {
+	every, ok := call.args["every"].(*durationExpr)
+	if !ok {
+		return fmt.Errorf("aggregateWindow() every must be a duration")
+	}
+	span := every.value.Nanoseconds() / tickNanos()
+	if span <= 0 {
+		return fmt.Errorf("aggregateWindow() every must be positive")
+	}
+
+	fn, ok := call.args["fn"].(*identExpr)
+	if !ok {
+		return fmt.Errorf("aggregateWindow() fn must be an aggregate function name, like mean")
+	}
+	bucketizer, ok := bucketizers[fn.name]
+	if !ok {
+		return fmt.Errorf("unsupported aggregateWindow() function %s", fn.name)
+	}
+
+	createEmpty := true
+	if arg, ok := call.args["createEmpty"]; ok {
+		ident, ok := arg.(*identExpr)
+		if !ok || (ident.name != "true" && ident.name != "false") {
+			return fmt.Errorf("aggregateWindow() createEmpty must be a boolean")
+		}
+		createEmpty = ident.name == "true"
+	}
+
+	count := "0"
+	if createEmpty {
+		count = fmt.Sprintf("$stop 1 - %d / $start %d / - 1 +", span, span)
+	}
+
+	mc2 := fmt.Sprintf("[ SWAP %s $stop 1 - %d / 1 + %d * 1 - %d %s ] BUCKETIZE\n", bucketizer, span, span, span, count)
+	if createEmpty {
+		// Empty windows are null, except for count
+		fill := "NaN"
+		if fn.name == "count" {
+			fill = "0"
+		}
+		mc2 += fmt.Sprintf("[ NaN NaN NaN %s ] FILLVALUE\n", fill)
+	}
+	mc2 += "1 TIMESHIFT"
+	p.add(mc2)
+	return nil
+}
+
+// group translate a group() call: the series are merged by the group columns
+// values, and only keep them as labels
+func (p *pipeline) group(call *callExpr) error {
+	mode, err := stringArg(call, "mode", "by")
+	if err != nil {
+		return err
+	}
+	if mode != "by" {
+		return fmt.Errorf("unsupported group() mode %s", mode)
+	}
+
+	columns := make([]string, 0)
+	if arg, ok := call.args["columns"]; ok {
+		array, ok := arg.(*arrayExpr)
+		if !ok {
+			return fmt.Errorf("group() columns must be an array of strings")
+		}
+		for _, element := range array.elements {
+			column, ok := element.(*stringExpr)
+			if !ok {
+				return fmt.Errorf("group() columns must be an array of strings")
+			}
+			switch column.value {
+			case "_start", "_stop":
+				// The range bounds are always part of the group key
+				continue
+			case "_time", "_value":
+				return fmt.Errorf("group() by %s is not supported", column.value)
+			}
+			columns = append(columns, quote(column.value))
+		}
+	}
+
+	partition := "[]"
+	if len(columns) > 0 {
+		partition = "[ " + strings.Join(columns, " ") + " ]"
+	}
+	p.add(fmt.Sprintf("%s PARTITION [] SWAP <%% MERGE SWAP 'group' STORE { NULL NULL } RELABEL $group RELABEL +! %%> FOREACH", partition))
+	return nil
+}
+
+// output convert the series into tables maps, with null values in place of
+// the empty windows NaN
+func (p *pipeline) output() {
+	mc2 := "<% DROP SORT 'gts' STORE { "
+	mc2 += fmt.Sprintf("'result' %s 'start' $start 'stop' $stop ", quote(p.result))
+	mc2 += "'labels' $gts LABELS 'ticks' $gts TICKLIST "
+	mc2 += "'values' $gts VALUES <% DROP DUP TYPEOF 'DOUBLE' == <% DUP ISNaN %> <% false %> IFTE <% DROP NULL %> IFT %> LMAP"
+	mc2 += " } %> LMAP"
+	p.add(mc2)
+}
@@ -0,0 +1,97 @@
+package flux
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToWarpScript(t *testing.T) {
+	var tests = []struct {
+		q        string
+		expected []string
+		err      bool
+	}{
+		{
+			`from(bucket: "cpu") |> range(start: -1h) |> filter(fn: (r) => r._measurement == "cpu" and r._field == "usage" and r.host == "a")`,
+			[]string{
+				"$now -3600000000 + 'start' STORE $now 'stop' STORE",
+				`[ $token '~cpu\.(usage)' { 'host' '=a' } $stop 1 - $stop $start - ] FETCH`,
+				"{ '_measurement' 'cpu' '_field' $field } RELABEL",
+				"$labels '_measurement' GET 'cpu' == <% $gts +! %> IFT",
+				"'result' '_result'",
+			},
+			false,
+		},
+		{
+			`from(bucket: "cpu") |> range(start: -1h) |> filter(fn: (r) => r._field == "a" or r._field == "b") |> filter(fn: (r) => r._value > 10)`,
+			[]string{
+				`'~cpu\.(a|b)' {}`,
+				"$value 10 > <% $value %> <% NULL %> IFTE",
+				"MACROMAPPER 0 0 0 ] MAP 0 GET",
+			},
+			false,
+		},
+		{
+			`from(bucket: "cpu") |> range(start: -1h) |> aggregateWindow(every: 1m, fn: mean, createEmpty: false) |> yield(name: "mean")`,
+			[]string{
+				"[ SWAP bucketizer.mean $stop 1 - 60000000 / 1 + 60000000 * 1 - 60000000 0 ] BUCKETIZE",
+				"1 TIMESHIFT",
+				"'result' 'mean'",
+			},
+			false,
+		},
+		{
+			`from(bucket: "cpu") |> range(start: -1h) |> aggregateWindow(every: 1m, fn: count)`,
+			[]string{
+				"60000000 $stop 1 - 60000000 / $start 60000000 / - 1 + ] BUCKETIZE",
+				"[ NaN NaN NaN 0 ] FILLVALUE",
+			},
+			false,
+		},
+		{
+			`from(bucket: "cpu") |> range(start: -1h) |> group(columns: ["_start", "host"])`,
+			[]string{"[ 'host' ] PARTITION"},
+			false,
+		},
+		{
+			`from(bucket: "cpu") |> range(start: -1h) |> map(fn: (r) => ({ r with _value: float(v: r._value) * 2.0, unit: "%" }))`,
+			[]string{
+				"$gts { 'unit' '%25' TOSTRING } RELABEL 'gts' STORE",
+				"$value TODOUBLE 2.0 * 5 ->LIST",
+			},
+			false,
+		},
+		{`from(bucket: "cpu") |> filter(fn: (r) => r.host == "a")`, nil, true},
+		{`range(start: -1h)`, nil, true},
+		{`from(bucket: "cpu") |> range(start: -1h) |> pivot(rowKey: ["_time"])`, nil, true},
+		{`from(bucket: "cpu") |> range(start: -1h) |> aggregateWindow(every: 1m, fn: mode)`, nil, true},
+		{`from(bucket: "cpu") |> range(start: -1h) |> group(columns: ["host"], mode: "except")`, nil, true},
+		{`from(bucket: "cpu") |> range(start: -1h) |> map(fn: (r) => ({ r with host: r._value }))`, nil, true},
+	}
+
+	for _, test := range tests {
+		exprs, err := parseScript(test.q)
+		if err != nil {
+			t.Errorf("Expected nil parsing %s, got %v", test.q, err)
+			continue
+		}
+
+		mc2, err := toWarpScript(exprs, "T")
+		if test.err {
+			if err == nil {
+				t.Errorf("Expected an error for %s", test.q)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected nil for %s, got %v", test.q, err)
+			continue
+		}
+
+		for _, expected := range test.expected {
+			if !strings.Contains(mc2, expected) {
+				t.Errorf("Expected %s in the script of %s, got %s", expected, test.q, mc2)
+			}
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ovh/erlenmeyer/core"
+)
+
+const (
+	// mapSeriesLabel is the hidden label used to carry the mapSeries group of a series
+	mapSeriesLabel = ".mapSeries"
+
+	// applyByNodeMarker replaces the '%' character of an applyByNode template
+	applyByNodeMarker = "__applyByNode__"
+
+	mapSeriesLmap = `
+<%%
+	DROP
+	'mapSeries' STORE
+	$mapSeries NAME '.' SPLIT 'mapSeriesNodes' STORE
+	[ %s ] '.' JOIN 'mapSeriesKey' STORE
+	$mapSeries { '%s' $mapSeriesKey } RELABEL
+%%> LMAP`
+
+	reduceSeriesLmap = `
+[ '%[1]s' ] PARTITION VALUES
+<%%
+	DROP
+	'reduceSeriesGroup' STORE
+
+	// Collect, for each matcher, the series of the group having this node value
+	[ %[2]s ]
+	<%%
+		DROP
+		'reduceSeriesMatcher' STORE
+		[] 'reduceSeriesMatched' STORE
+		$reduceSeriesGroup
+		<%%
+			'reduceSeriesItem' STORE
+			$reduceSeriesItem NAME '.' SPLIT 'reduceSeriesNodes' STORE
+			<%% $reduceSeriesNodes SIZE %[3]d > %%>
+			<%% $reduceSeriesNodes %[3]d GET $reduceSeriesMatcher == %%>
+			<%% false %%>
+			IFTE
+			<%% $reduceSeriesMatched $reduceSeriesItem +! DROP %%>
+			IFT
+		%%>
+		FOREACH
+		$reduceSeriesMatched
+	%%>
+	LMAP
+	'reduceSeriesArgs' STORE
+
+	// Skip groups where a matcher has no series
+	true 'reduceSeriesComplete' STORE
+	$reduceSeriesArgs
+	<%%
+		SIZE 0 ==
+		<%% false 'reduceSeriesComplete' STORE %%>
+		IFT
+	%%>
+	FOREACH
+
+	<%% $reduceSeriesComplete %%>
+	<%%
+		$reduceSeriesArgs 0 GET 0 GET NAME '.' SPLIT '%[4]s' %[3]d SET '.' JOIN 'reduceSeriesKey' STORE
+		$reduceSeriesArgs %[5]s
+		%[6]s
+		DUP TYPEOF <%% 'GTS' == %%> <%% 1 ->LIST %%> IFT
+		<%% DUP SIZE 0 > %%>
+		<%% [ SWAP 0 GET $reduceSeriesKey RENAME { '%[1]s' '' } RELABEL ] %%>
+		IFT
+	%%>
+	<%% [] %%>
+	IFTE
+%%>
+LMAP
+FLATTEN`
+
+	applyByNodeScript = `
+[] 'applyByNodePrefixes' STORE
+<%%
+	NAME '.' SPLIT 'applyByNodeNodes' STORE
+	<%% $applyByNodeNodes SIZE %[1]d > %%>
+	<%% $applyByNodePrefixes $applyByNodeNodes [ 0 %[1]d ] SUBLIST '.' JOIN +! DROP %%>
+	IFT
+%%>
+FOREACH
+$applyByNodePrefixes UNIQUE
+<%%
+	DROP
+	'applyByNodePrefix' STORE
+	%[2]s '%[3]s' $applyByNodePrefix '\.' '[.]' REPLACEALL REPLACEALL EVAL
+	DUP TYPEOF <%% 'GTS' == %%> <%% 1 ->LIST %%> IFT
+	%[4]s
+%%>
+LMAP
+FLATTEN`
+
+	applyByNodeRename = `<%% DROP %s '%%25' $applyByNodePrefix REPLACEALL RENAME %%> LMAP`
+
+	groupByTagsRelabel = `
+<%%
+	DROP
+	'groupByTags' STORE
+	{}
+	[ %s ]
+	<%%
+		'groupByTagsTag' STORE
+		$groupByTags LABELS $groupByTagsTag GET
+		<%% DUP ISNULL %%> <%% DROP '' %%> IFT
+		$groupByTagsTag PUT
+	%%>
+	FOREACH
+	'groupByTagsLabels' STORE
+	$groupByTags %s RENAME { NULL NULL } RELABEL $groupByTagsLabels RELABEL
+%%> LMAP`
+)
+
+var (
+	// seriesListsFunctions are functions expecting one series list per
+	// argument when called back by reduceSeries, others receive a single
+	// merged series list
+	seriesListsFunctions = map[string]bool{
+		"asPercent":         true,
+		"divideSeries":      true,
+		"divideSeriesLists": true,
+	}
+)
+
+// ----------------------------------------------------------------------------
+// helper functions
+
+// nodeValue return the WarpScript pushing the value of a node position or a
+// tag of the series stored in the variable named series, whose name split by
+// dots is stored in the variable named nodes
+func nodeValue(item, series, nodes string) string {
+	if item == "name" {
+		return fmt.Sprintf("$%s NAME", series)
+	}
+
+	if position, err := strconv.Atoi(item); err == nil {
+		return fmt.Sprintf("<%% $%[1]s SIZE %[2]d > %%> <%% $%[1]s %[2]d GET %%> <%% '' %%> IFTE", nodes, position)
+	}
+
+	return fmt.Sprintf("$%s LABELS '%s' GET <%% DUP ISNULL %%> <%% DROP '' %%> IFT", series, item)
+}
+
+// toWarpScriptString quote a string to be used as a WarpScript string
+// constant, WarpScript strings are URL decoded
+func toWarpScriptString(str string) string {
+	return "'" + strings.Replace(url.QueryEscape(str), "+", "%20", -1) + "'"
+}
+
+// callback generate the WarpScript of a graphite function applied on series
+// lists which are already on the stack
+func callback(fnName string, arity int, kwargs map[string]string) (string, error) {
+	f, err := GetFunction(fnName)
+	if err != nil {
+		return "", err
+	}
+
+	args := make([]string, arity)
+	for i := range args {
+		args[i] = swap
+	}
+
+	params := make(map[string]string)
+	for k, v := range kwargs {
+		params[k] = v
+	}
+	params["func"] = fnName
+	delete(params, "node")
+
+	root := core.NewEmptyNode()
+	if _, err = f(root, args, params); err != nil {
+		return "", err
+	}
+
+	return root.InternalToWarpScript(""), nil
+}
+
+// ----------------------------------------------------------------------------
+// graphite functions implementations
+
+func mapSeries(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 2 {
+		return nil, errors.New("The mapSeries function take at least two parameters which are a list of series and node positions or tags")
+	}
+
+	keys := make([]string, 0)
+	for _, item := range args[1:] {
+		keys = append(keys, nodeValue(item, "mapSeries", "mapSeriesNodes"))
+	}
+
+	node.Left = core.NewNode(core.WarpScriptPayload{
+		WarpScript: fmt.Sprintf(mapSeriesLmap, strings.Join(keys, " "), mapSeriesLabel),
+	})
+
+	if args[0] != swap {
+		return fetch(node.Left, []string{args[0], kwargs["from"], kwargs["until"]}, kwargs)
+	}
+
+	return node.Left, nil
+}
+
+func reduceSeries(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 4 {
+		return nil, errors.New("The reduceSeries function take at least four parameters which are a list of series, a reduce function, a node position and matchers")
+	}
+
+	position, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, fmt.Errorf("Expect the reduceNode %s parameter to be a number", args[2])
+	}
+
+	matchers := make([]string, 0)
+	for _, matcher := range args[3:] {
+		matchers = append(matchers, toWarpScriptString(matcher))
+	}
+
+	arity := 1
+	push := "FLATTEN"
+	if seriesListsFunctions[args[1]] {
+		arity = len(matchers)
+		push = "LIST-> DROP"
+	}
+
+	ws, err := callback(args[1], arity, kwargs)
+	if err != nil {
+		return nil, err
+	}
+
+	node.Left = core.NewNode(core.WarpScriptPayload{
+		WarpScript: fmt.Sprintf(reduceSeriesLmap, mapSeriesLabel, strings.Join(matchers, " "), position, args[1], push, ws),
+	})
+
+	// Without mapSeries, all series belong to the same group
+	if args[0] != swap {
+		return fetch(node.Left, []string{args[0], kwargs["from"], kwargs["until"]}, kwargs)
+	}
+
+	return node.Left, nil
+}
+
+func applyByNode(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 3 {
+		return nil, errors.New("The applyByNode function take at least three parameters which are a list of series, a node position and a template function")
+	}
+
+	position, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("Expect the nodeNum %s parameter to be a number", args[1])
+	}
+
+	template := core.NewEmptyNode()
+	if _, err = Parse(strings.Replace(args[2], "%", applyByNodeMarker, -1), kwargs["from"], kwargs["until"], template); err != nil {
+		return nil, err
+	}
+
+	rename := ""
+	if len(args) > 3 {
+		rename = fmt.Sprintf(applyByNodeRename, toWarpScriptString(args[3]))
+	}
+
+	node.Left = core.NewNode(core.WarpScriptPayload{
+		WarpScript: fmt.Sprintf(applyByNodeScript, position, toWarpScriptString(template.InternalToWarpScript("")), applyByNodeMarker, rename),
+	})
+
+	if args[0] != swap {
+		return fetch(node.Left, []string{args[0], kwargs["from"], kwargs["until"]}, kwargs)
+	}
+
+	return node.Left, nil
+}
+
+func groupByTags(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 3 {
+		return nil, errors.New("The groupByTags function take at least three parameters which are a list of series, an aggregator operator and tags")
+	}
+
+	op, ok := aggregateOperator[args[1]]
+	if !ok {
+		return nil, fmt.Errorf("The aggregator operator %s is not supported", args[1])
+	}
+
+	switch op {
+	case "mean":
+		op = "mean.exclude-nulls"
+	case "median", "count", "sum", "min", "max", "product", "sd":
+	default:
+		return nil, fmt.Errorf("The aggregator operator %s is not supported by groupByTags", args[1])
+	}
+
+	byName := false
+	tags := make([]string, 0)
+	for _, tag := range args[2:] {
+		if tag == "name" {
+			byName = true
+			continue
+		}
+
+		tags = append(tags, toWarpScriptString(tag))
+	}
+
+	classes := tags
+	newName := toWarpScriptString(args[1])
+	if byName {
+		classes = append(classes, "'.name'")
+		newName = "$groupByTags LABELS '.name' GET"
+	}
+
+	// Post treatment: name each group and keep only the grouping tags
+	node.Left = core.NewNode(core.WarpScriptPayload{
+		WarpScript: fmt.Sprintf(groupByTagsRelabel, strings.Join(tags, " "), newName),
+	})
+
+	value := ""
+	if op == "sd" {
+		value = "true"
+	}
+
+	node.Left.Left = core.NewNode(core.ReducerPayload{
+		Reducer: op,
+		Value:   value,
+		Labels:  classes,
+	})
+
+	node = node.Left.Left
+
+	// Pre treatment: expose series names as a label to group on it
+	if byName {
+		node.Left = core.NewNode(core.WarpScriptPayload{
+			WarpScript: "<% DROP DUP NAME '.name' SWAP 2 ->MAP RELABEL %> LMAP",
+		})
+
+		node = node.Left
+	}
+
+	if args[0] != swap {
+		return fetch(node, []string{args[0], kwargs["from"], kwargs["until"]}, kwargs)
+	}
+
+	return node, nil
+}
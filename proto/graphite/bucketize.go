@@ -3,6 +3,7 @@ package graphite
 import (
 	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/ovh/erlenmeyer/core"
 )
@@ -116,11 +117,37 @@ func consolidateBy(node *core.Node, args []string, kwargs map[string]string) (*c
 		return nil, fmt.Errorf("The aggregator operator %s is not supported", args[1])
 	}
 
+	// Keep the consolidation function to honor maxDataPoints at render time
+	node.Left = core.NewNode(core.WarpScriptPayload{
+		WarpScript: fmt.Sprintf("{ '%s' '%s' } SETATTRIBUTES", consolidateByAttribute, op),
+	})
+
 	if args[0] != swap {
-		return fetch(node, []string{args[0], kwargs["from"], kwargs["until"]}, kwargs)
+		return fetch(node.Left, []string{args[0], kwargs["from"], kwargs["until"]}, kwargs)
 	}
 
-	return node, nil
+	return node.Left, nil
+}
+
+func setXFilesFactor(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 2 {
+		return nil, errors.New("The setXFilesFactor function take two parameters which are a list of series and the xFilesFactor")
+	}
+
+	xff, err := strconv.ParseFloat(args[1], 64)
+	if err != nil || xff < 0 || xff > 1 {
+		return nil, fmt.Errorf("Expect the xFilesFactor %s parameter to be a number between 0 and 1", args[1])
+	}
+
+	node.Left = core.NewNode(core.WarpScriptPayload{
+		WarpScript: fmt.Sprintf("{ '%s' '%s' } SETATTRIBUTES", xFilesFactorAttribute, strconv.FormatFloat(xff, 'f', -1, 64)),
+	})
+
+	if args[0] != swap {
+		return fetch(node.Left, []string{args[0], kwargs["from"], kwargs["until"]}, kwargs)
+	}
+
+	return node.Left, nil
 }
 
 func summarize(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
@@ -0,0 +1,249 @@
+package graphite
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	anchorStart  = "start"
+	anchorMiddle = "middle"
+	anchorEnd    = "end"
+)
+
+// point of a canvas, in pixels from the top left corner
+type point struct {
+	X float64
+	Y float64
+}
+
+// canvas is the drawing surface of a graph
+type canvas interface {
+	// line draw a polyline, dash is the length of dashes or 0 for a solid line
+	line(points []point, c color.RGBA, width, dash float64)
+	// fill draw a filled polygon
+	fill(points []point, c color.RGBA)
+	// text draw a single line text, y is the baseline of the text
+	text(x, y float64, s string, c color.RGBA, anchor string)
+	// encode the canvas into its output format
+	encode() ([]byte, error)
+}
+
+// textWidth return the width in pixels of a text drawn on a canvas
+func textWidth(s string) float64 {
+	return float64(len(s) * fontAdvance)
+}
+
+func anchorOffset(s, anchor string) float64 {
+	switch anchor {
+	case anchorMiddle:
+		return -textWidth(s) / 2
+	case anchorEnd:
+		return -textWidth(s)
+	}
+
+	return 0
+}
+
+// ----------------------------------------------------------------------------
+// png
+
+type pngCanvas struct {
+	img *image.RGBA
+}
+
+func newPNGCanvas(width, height int, background color.RGBA) *pngCanvas {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = background.R, background.G, background.B, background.A
+	}
+
+	return &pngCanvas{img: img}
+}
+
+// set blend a pixel of the given color with the canvas
+func (c *pngCanvas) set(x, y int, col color.RGBA) {
+	if !(image.Point{X: x, Y: y}).In(c.img.Rect) {
+		return
+	}
+
+	if col.A == 0xff {
+		c.img.SetRGBA(x, y, col)
+		return
+	}
+
+	bg := c.img.RGBAAt(x, y)
+	alpha := float64(col.A) / 0xff
+	blend := func(fg, bg uint8) uint8 {
+		return uint8(float64(fg)*alpha + float64(bg)*(1-alpha))
+	}
+
+	c.img.SetRGBA(x, y, color.RGBA{R: blend(col.R, bg.R), G: blend(col.G, bg.G), B: blend(col.B, bg.B), A: 0xff})
+}
+
+// dot draw a square of width pixels centered on x, y
+func (c *pngCanvas) dot(x, y float64, col color.RGBA, width float64) {
+	half := math.Max(width, 1) / 2
+	for i := int(math.Round(x - half)); i < int(math.Round(x+half)); i++ {
+		for j := int(math.Round(y - half)); j < int(math.Round(y+half)); j++ {
+			c.set(i, j, col)
+		}
+	}
+}
+
+func (c *pngCanvas) line(points []point, col color.RGBA, width, dash float64) {
+	distance := 0.0
+	for i := 1; i < len(points); i++ {
+		from, to := points[i-1], points[i]
+		length := math.Hypot(to.X-from.X, to.Y-from.Y)
+		steps := int(math.Ceil(length*2)) + 1
+
+		for s := 0; s < steps; s++ {
+			ratio := float64(s) / float64(steps)
+			if dash > 0 && int((distance+ratio*length)/dash)%2 == 1 {
+				continue
+			}
+
+			c.dot(from.X+ratio*(to.X-from.X), from.Y+ratio*(to.Y-from.Y), col, width)
+		}
+
+		distance += length
+	}
+
+	if len(points) > 0 && dash == 0 {
+		last := points[len(points)-1]
+		c.dot(last.X, last.Y, col, width)
+	}
+}
+
+// fill use a scanline algorithm with the even-odd rule
+func (c *pngCanvas) fill(points []point, col color.RGBA) {
+	if len(points) < 3 {
+		return
+	}
+
+	minY, maxY := points[0].Y, points[0].Y
+	for _, p := range points {
+		minY = math.Min(minY, p.Y)
+		maxY = math.Max(maxY, p.Y)
+	}
+
+	for y := int(math.Floor(minY)); y <= int(math.Ceil(maxY)); y++ {
+		scan := float64(y) + 0.5
+		nodes := make([]float64, 0)
+
+		for i := range points {
+			a, b := points[i], points[(i+1)%len(points)]
+			if (a.Y < scan && b.Y >= scan) || (b.Y < scan && a.Y >= scan) {
+				nodes = append(nodes, a.X+(scan-a.Y)/(b.Y-a.Y)*(b.X-a.X))
+			}
+		}
+
+		sort.Float64s(nodes)
+		for i := 0; i+1 < len(nodes); i += 2 {
+			for x := int(math.Round(nodes[i])); x < int(math.Round(nodes[i+1])); x++ {
+				c.set(x, y, col)
+			}
+		}
+	}
+}
+
+func (c *pngCanvas) text(x, y float64, s string, col color.RGBA, anchor string) {
+	left := int(math.Round(x + anchorOffset(s, anchor)))
+	top := int(math.Round(y)) - fontHeight + 1
+
+	for i, r := range s {
+		for column, bits := range glyph(r) {
+			for row := 0; row < fontHeight; row++ {
+				if bits&(1<<uint(row)) != 0 {
+					c.set(left+i*fontAdvance+column, top+row, col)
+				}
+			}
+		}
+	}
+}
+
+func (c *pngCanvas) encode() ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	if err := png.Encode(buffer, c.img); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// ----------------------------------------------------------------------------
+// svg
+
+type svgCanvas struct {
+	width  int
+	height int
+	body   *bytes.Buffer
+}
+
+func newSVGCanvas(width, height int, background color.RGBA) *svgCanvas {
+	c := &svgCanvas{
+		width:  width,
+		height: height,
+		body:   new(bytes.Buffer),
+	}
+
+	fmt.Fprintf(c.body, `<rect width="%d" height="%d" fill="%s"/>`+"\n", width, height, svgColor(background))
+
+	return c
+}
+
+func svgColor(c color.RGBA) string {
+	if c.A == 0xff {
+		return fmt.Sprintf("rgb(%d,%d,%d)", c.R, c.G, c.B)
+	}
+
+	return fmt.Sprintf("rgba(%d,%d,%d,%.2f)", c.R, c.G, c.B, float64(c.A)/0xff)
+}
+
+func svgPoints(points []point) string {
+	coords := make([]string, 0)
+	for _, p := range points {
+		coords = append(coords, fmt.Sprintf("%.1f,%.1f", p.X, p.Y))
+	}
+
+	return strings.Join(coords, " ")
+}
+
+func (c *svgCanvas) line(points []point, col color.RGBA, width, dash float64) {
+	dasharray := ""
+	if dash > 0 {
+		dasharray = fmt.Sprintf(` stroke-dasharray="%g,%g"`, dash, dash)
+	}
+
+	fmt.Fprintf(c.body, `<polyline points="%s" fill="none" stroke="%s" stroke-width="%g"%s/>`+"\n", svgPoints(points), svgColor(col), width, dasharray)
+}
+
+func (c *svgCanvas) fill(points []point, col color.RGBA) {
+	fmt.Fprintf(c.body, `<polygon points="%s" fill="%s" stroke="none"/>`+"\n", svgPoints(points), svgColor(col))
+}
+
+func (c *svgCanvas) text(x, y float64, s string, col color.RGBA, anchor string) {
+	escaped := new(bytes.Buffer)
+	xml.EscapeText(escaped, []byte(s)) // nolint: gas, errcheck
+
+	fmt.Fprintf(c.body, `<text x="%.1f" y="%.1f" fill="%s" text-anchor="%s" font-family="monospace" font-size="10">%s</text>`+"\n", x, y, svgColor(col), anchor, escaped.String())
+}
+
+func (c *svgCanvas) encode() ([]byte, error) {
+	buffer := new(bytes.Buffer)
+
+	fmt.Fprintf(buffer, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(buffer, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", c.width, c.height, c.width, c.height)
+	buffer.Write(c.body.Bytes()) // nolint: gas
+	fmt.Fprintf(buffer, "</svg>\n")
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,193 @@
+package graphite
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+const (
+	// consolidateByAttribute is the attribute used to carry the consolidation function of a series
+	consolidateByAttribute = ".consolidateBy"
+
+	// xFilesFactorAttribute is the attribute used to carry the xFilesFactor of a series
+	xFilesFactorAttribute = ".xFilesFactor"
+)
+
+var (
+	// consolidateFunctions is the reverse of consolidateOperator which give
+	// back the graphite name of a consolidation function
+	consolidateFunctions = map[string]string{
+		"sum":     "sum",
+		"mean":    "average",
+		"median":  "median",
+		"count":   "count",
+		"product": "multiply",
+		"min":     "min",
+		"max":     "max",
+		"first":   "first",
+		"last":    "last",
+	}
+)
+
+// ----------------------------------------------------------------------------
+// helper functions
+
+// sortValues sort the datapoints of the series by ascending timestamps
+func (s *GTS) sortValues() {
+	sort.Slice(s.Values, func(i, j int) bool {
+		return s.Values[i][0] < s.Values[j][0]
+	})
+}
+
+// step return the interval in microseconds between two datapoints of the
+// series, the smallest gap between two datapoints is used as datapoints
+// which are not finite are removed
+func (s *GTS) step() int64 {
+	step := int64(0)
+	for i := 1; i < len(s.Values); i++ {
+		gap := int64(s.Values[i][0] - s.Values[i-1][0])
+		if gap > 0 && (step == 0 || gap < step) {
+			step = gap
+		}
+	}
+
+	if step == 0 {
+		step = 60 * 1000000
+	}
+
+	return step
+}
+
+// consolidationFunc return the warp 10 operator used to consolidate the series
+func (s *GTS) consolidationFunc() string {
+	if op, ok := s.Attributes[consolidateByAttribute]; ok {
+		return op
+	}
+
+	return "mean"
+}
+
+// xFilesFactor return the xFilesFactor of the series, 0 if not set
+func (s *GTS) xFilesFactor() float64 {
+	xff, err := strconv.ParseFloat(s.Attributes[xFilesFactorAttribute], 64)
+	if err != nil {
+		return 0
+	}
+
+	return xff
+}
+
+// setDefaultXFilesFactor set the xFilesFactor of the series if it has not
+// been set by the setXFilesFactor function
+func (s *GTS) setDefaultXFilesFactor(xFilesFactor string) {
+	if _, ok := s.Attributes[xFilesFactorAttribute]; ok {
+		return
+	}
+
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+
+	s.Attributes[xFilesFactorAttribute] = xFilesFactor
+}
+
+func consolidateValues(op string, values []float64) float64 {
+	result := values[0]
+
+	switch op {
+	case "sum", "mean":
+		for _, value := range values[1:] {
+			result += value
+		}
+
+		if op == "mean" {
+			result /= float64(len(values))
+		}
+	case "product":
+		for _, value := range values[1:] {
+			result *= value
+		}
+	case "min":
+		for _, value := range values[1:] {
+			result = math.Min(result, value)
+		}
+	case "max":
+		for _, value := range values[1:] {
+			result = math.Max(result, value)
+		}
+	case "count":
+		result = float64(len(values))
+	case "last":
+		result = values[len(values)-1]
+	case "median":
+		sorted := append([]float64{}, values...)
+		sort.Float64s(sorted)
+
+		result = sorted[len(sorted)/2]
+		if len(sorted)%2 == 0 {
+			result = (sorted[len(sorted)/2-1] + result) / 2
+		}
+	}
+
+	return result
+}
+
+// ----------------------------------------------------------------------------
+// consolidation
+
+// Consolidate reduce the number of datapoints of the series to at most
+// maxDataPoints using the consolidation function and the xFilesFactor of the
+// series
+// https://graphite.readthedocs.io/en/latest/render_api.html#maxdatapoints
+func (s *GTS) Consolidate(maxDataPoints int) {
+	if maxDataPoints <= 0 || len(s.Values) <= 1 {
+		return
+	}
+
+	s.sortValues()
+
+	step := s.step()
+	first := int64(s.Values[0][0])
+	last := int64(s.Values[len(s.Values)-1][0])
+
+	// the number of slots includes missing datapoints
+	slots := (last-first)/step + 1
+	valuesPerPoint := int64(math.Ceil(float64(slots) / float64(maxDataPoints)))
+	if valuesPerPoint <= 1 {
+		return
+	}
+
+	op := s.consolidationFunc()
+	xff := s.xFilesFactor()
+	span := step * valuesPerPoint
+
+	values := make([][]float64, 0)
+	bucket := make([]float64, 0)
+	index := int64(0)
+
+	flush := func() {
+		if len(bucket) == 0 {
+			return
+		}
+
+		if float64(len(bucket))/float64(valuesPerPoint) >= xff {
+			values = append(values, []float64{float64(first + index*span), consolidateValues(op, bucket)})
+		}
+
+		bucket = bucket[:0]
+	}
+
+	for _, value := range s.Values {
+		if i := (int64(value[0]) - first) / span; i != index {
+			flush()
+			index = i
+		}
+
+		bucket = append(bucket, value[1])
+	}
+
+	flush()
+
+	s.Values = values
+}
@@ -0,0 +1,419 @@
+package graphite
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ovh/erlenmeyer/core"
+)
+
+const (
+	// graphiteVersion is the graphite-web version erlenmeyer is compatible with
+	graphiteVersion = "1.1.3"
+
+	// functionsModule is the module reported for every function, like graphite-web does
+	functionsModule = "graphite.render.functions"
+)
+
+// Graphite function groups, used by Grafana to build its function editor
+const (
+	groupAlias     = "Alias"
+	groupCalc      = "Calculate"
+	groupCombine   = "Combine"
+	groupData      = "Filter Data"
+	groupFilter    = "Filter Series"
+	groupGraph     = "Graph"
+	groupSorting   = "Sorting"
+	groupSpecial   = "Special"
+	groupTransform = "Transform"
+)
+
+// Graphite function parameter types
+const (
+	paramAggFunc       = "aggFunc"
+	paramAny           = "any"
+	paramBoolean       = "boolean"
+	paramDate          = "date"
+	paramFloat         = "float"
+	paramInteger       = "integer"
+	paramInterval      = "interval"
+	paramIntOrInf      = "intOrInf"
+	paramIntOrInterval = "intOrInterval"
+	paramNode          = "node"
+	paramNodeOrTag     = "nodeOrTag"
+	paramSeriesList    = "seriesList"
+	paramSeriesLists   = "seriesLists"
+	paramString        = "string"
+	paramTag           = "tag"
+	paramTagExpression = "tagExpression"
+)
+
+// FunctionParam structure definition
+type FunctionParam struct {
+	Name     string      `json:"name"`
+	Type     string      `json:"type"`
+	Required bool        `json:"required,omitempty"`
+	Multiple bool        `json:"multiple,omitempty"`
+	Default  interface{} `json:"default,omitempty"`
+	Options  []string    `json:"options,omitempty"`
+}
+
+// FunctionDescription structure definition
+type FunctionDescription struct {
+	Name        string          `json:"name"`
+	Function    string          `json:"function"`
+	Description string          `json:"description"`
+	Module      string          `json:"module"`
+	Group       string          `json:"group"`
+	Params      []FunctionParam `json:"params"`
+}
+
+var (
+	seriesListParam  = FunctionParam{Name: "seriesList", Type: paramSeriesList, Required: true}
+	seriesListsParam = FunctionParam{Name: "seriesLists", Type: paramSeriesLists, Required: true, Multiple: true}
+	nParam           = FunctionParam{Name: "n", Type: paramInteger, Required: true}
+	nameParam        = FunctionParam{Name: "name", Type: paramString, Required: true}
+	stepParam        = FunctionParam{Name: "step", Type: paramInteger, Default: 60}
+
+	// aliases are functions names registered twice in the functions table
+	aliases = map[string]string{
+		"avg":          "averageSeries",
+		"log":          "logarithm",
+		"randomWalk":   "randomWalkFunction",
+		"sin":          "sinFunction",
+		"time":         "timeFunction",
+		"xFilesFactor": "setXFilesFactor",
+	}
+
+	// descriptions of the implemented graphite functions, noOp functions are
+	// not described as they would be advertised to clients
+	// see https://github.com/graphite-project/graphite-web/blob/master/webapp/graphite/render/functions.py
+	descriptions = map[string]FunctionDescription{
+		"absolute": {Group: groupTransform, Description: "Takes one metric or a wildcard seriesList and applies the mathematical abs function to each datapoint.",
+			Params: []FunctionParam{seriesListParam}},
+		"aggregate": {Group: groupCombine, Description: "Aggregate series using the specified function.",
+			Params: []FunctionParam{seriesListParam, aggFuncParam("func", true, nil), {Name: "xFilesFactor", Type: paramFloat}}},
+		"aggregateLine": {Group: groupCalc, Description: "Takes a metric or wildcard seriesList and draws a horizontal line based on the function applied to each series.",
+			Params: []FunctionParam{seriesListParam, aggFuncParam("func", false, "average"), {Name: "keepStep", Type: paramBoolean, Default: false}}},
+		"aggregateWithWildcards": {Group: groupCombine, Description: "Call aggregator after inserting wildcards at the given position(s).",
+			Params: []FunctionParam{seriesListParam, aggFuncParam("func", true, nil), {Name: "positions", Type: paramNode, Multiple: true}}},
+		"alias": {Group: groupAlias, Description: "Takes one metric or a wildcard seriesList and a string in quotes. Prints the string instead of the metric name in the legend.",
+			Params: []FunctionParam{seriesListParam, {Name: "newName", Type: paramString, Required: true}}},
+		"aliasByMetric": {Group: groupAlias, Description: "Takes a seriesList and applies an alias derived from the base metric name.",
+			Params: []FunctionParam{seriesListParam}},
+		"aliasByNode": {Group: groupAlias, Description: "Takes a seriesList and applies an alias derived from one or more node portions or tags of the target name.",
+			Params: []FunctionParam{seriesListParam, {Name: "nodes", Type: paramNodeOrTag, Required: true, Multiple: true}}},
+		"aliasByTags": {Group: groupAlias, Description: "Takes a seriesList and applies an alias derived from one or more tags and/or nodes.",
+			Params: []FunctionParam{seriesListParam, {Name: "tags", Type: paramNodeOrTag, Required: true, Multiple: true}}},
+		"aliasSub": {Group: groupAlias, Description: "Runs series names through a regex search/replace.",
+			Params: []FunctionParam{seriesListParam, {Name: "search", Type: paramString, Required: true}, {Name: "replace", Type: paramString, Required: true}}},
+		"applyByNode": {Group: groupCombine, Description: "Takes a seriesList and applies some complicated function (described by a string), replacing templates with unique prefixes of keys from the seriesList.",
+			Params: []FunctionParam{seriesListParam, {Name: "nodeNum", Type: paramNode, Required: true}, {Name: "templateFunction", Type: paramString, Required: true}, {Name: "newName", Type: paramString}}},
+		"asPercent": {Group: groupCombine, Description: "Calculates a percentage of the total of a wildcard series.",
+			Params: []FunctionParam{seriesListParam, {Name: "total", Type: paramAny}}},
+		"averageAbove": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList followed by an integer N. Out of all metrics passed, draws only the metrics with an average value above N for the time period specified.",
+			Params: []FunctionParam{seriesListParam, nParam}},
+		"averageBelow": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList followed by an integer N. Out of all metrics passed, draws only the metrics with an average value below N for the time period specified.",
+			Params: []FunctionParam{seriesListParam, nParam}},
+		"averageSeries": {Group: groupCombine, Description: "Short Alias: avg(). Takes one metric or a wildcard seriesList. Draws the average value of all metrics passed at each time.",
+			Params: []FunctionParam{seriesListsParam}},
+		"averageSeriesWithWildcards": {Group: groupCombine, Description: "Call averageSeries after inserting wildcards at the given position(s).",
+			Params: []FunctionParam{seriesListParam, {Name: "position", Type: paramNode, Multiple: true}}},
+		"color": {Group: groupGraph, Description: "Assigns the given color to the seriesList.",
+			Params: []FunctionParam{seriesListParam, {Name: "theColor", Type: paramString, Required: true}}},
+		"consolidateBy": {Group: groupSpecial, Description: "Takes one metric or a wildcard seriesList and a consolidation function name.",
+			Params: []FunctionParam{seriesListParam, {Name: "consolidationFunc", Type: paramString, Required: true, Options: []string{"average", "first", "last", "max", "min", "sum"}}}},
+		"constantLine": {Group: groupSpecial, Description: "Takes a float F. Draws a horizontal line at value F across the graph.",
+			Params: []FunctionParam{{Name: "value", Type: paramFloat, Required: true}}},
+		"countSeries": {Group: groupCombine, Description: "Draws a horizontal line representing the number of nodes found in the seriesList.",
+			Params: []FunctionParam{{Name: "seriesLists", Type: paramSeriesLists, Multiple: true}}},
+		"cumulative": {Group: groupSpecial, Description: "Takes one metric or a wildcard seriesList and sets the consolidation function to sum.",
+			Params: []FunctionParam{seriesListParam}},
+		"currentAbove": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList followed by an integer N. Out of all metrics passed, draws only the metrics whose value is above N at the end of the time period specified.",
+			Params: []FunctionParam{seriesListParam, nParam}},
+		"currentBelow": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList followed by an integer N. Out of all metrics passed, draws only the metrics whose value is below N at the end of the time period specified.",
+			Params: []FunctionParam{seriesListParam, nParam}},
+		"dashed": {Group: groupGraph, Description: "Takes one metric or a wildcard seriesList, followed by a float F. Draw the selected metrics with a dotted line with segments of length F.",
+			Params: []FunctionParam{seriesListParam, {Name: "dashLength", Type: paramFloat, Default: 5}}},
+		"delay": {Group: groupTransform, Description: "This shifts all samples later by an integer number of steps.",
+			Params: []FunctionParam{seriesListParam, {Name: "steps", Type: paramInteger, Required: true}}},
+		"derivative": {Group: groupTransform, Description: "This is the opposite of the integral function.",
+			Params: []FunctionParam{seriesListParam}},
+		"diffSeries": {Group: groupCombine, Description: "Subtracts series 2 through n from series 1.",
+			Params: []FunctionParam{seriesListsParam}},
+		"divideSeries": {Group: groupCombine, Description: "Takes a dividend metric and a divisor metric and draws the division result.",
+			Params: []FunctionParam{{Name: "dividendSeriesList", Type: paramSeriesList, Required: true}, {Name: "divisorSeries", Type: paramSeriesList, Required: true}}},
+		"divideSeriesLists": {Group: groupCombine, Description: "Iterates over a two lists and divides list1[0] by list2[0], list1[1] by list2[1] and so on.",
+			Params: []FunctionParam{{Name: "dividendSeriesList", Type: paramSeriesList, Required: true}, {Name: "divisorSeriesList", Type: paramSeriesList, Required: true}}},
+		"drawAsInfinite": {Group: groupGraph, Description: "Takes one metric or a wildcard seriesList. If the value is zero, draw the line at 0. If the value is above zero, draw the line at infinity.",
+			Params: []FunctionParam{seriesListParam}},
+		"exclude": {Group: groupFilter, Description: "Takes a metric or a wildcard seriesList, followed by a regular expression in double quotes. Excludes metrics that match the regular expression.",
+			Params: []FunctionParam{seriesListParam, {Name: "pattern", Type: paramString, Required: true}}},
+		"grep": {Group: groupFilter, Description: "Takes a metric or a wildcard seriesList, followed by a regular expression in double quotes. Excludes metrics that don't match the regular expression.",
+			Params: []FunctionParam{seriesListParam, {Name: "pattern", Type: paramString, Required: true}}},
+		"groupByNode": {Group: groupCombine, Description: "Takes a serieslist and maps a callback to subgroups within as defined by a common node.",
+			Params: []FunctionParam{seriesListParam, {Name: "nodeNum", Type: paramNodeOrTag, Required: true}, aggFuncParam("callback", false, "average")}},
+		"groupByNodes": {Group: groupCombine, Description: "Takes a serieslist and maps a callback to subgroups within as defined by multiple nodes.",
+			Params: []FunctionParam{seriesListParam, aggFuncParam("callback", true, nil), {Name: "nodes", Type: paramNodeOrTag, Multiple: true}}},
+		"groupByTags": {Group: groupCombine, Description: "Takes a serieslist and maps a callback to subgroups within as defined by multiple tags.",
+			Params: []FunctionParam{seriesListParam, aggFuncParam("callback", true, nil), {Name: "tags", Type: paramTag, Required: true, Multiple: true}}},
+		"highestAverage": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList followed by an integer N. Out of all metrics passed, draws only the top N metrics with the highest average value for the time period specified.",
+			Params: []FunctionParam{seriesListParam, {Name: "n", Type: paramInteger, Default: 1}}},
+		"highestCurrent": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList followed by an integer N. Out of all metrics passed, draws only the N metrics with the highest value at the end of the time period specified.",
+			Params: []FunctionParam{seriesListParam, {Name: "n", Type: paramInteger, Default: 1}}},
+		"highestMax": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList followed by an integer N. Out of all metrics passed, draws only the N metrics with the highest maximum value in the time period specified.",
+			Params: []FunctionParam{seriesListParam, {Name: "n", Type: paramInteger, Default: 1}}},
+		"hitcount": {Group: groupTransform, Description: "Estimate hit counts from a list of time series.",
+			Params: []FunctionParam{seriesListParam, {Name: "intervalString", Type: paramInterval, Required: true}, {Name: "alignToInterval", Type: paramBoolean, Default: false}}},
+		"identity": {Group: groupCalc, Description: "Identity function: returns datapoints where the value equals the timestamp of the datapoint.",
+			Params: []FunctionParam{nameParam, stepParam}},
+		"integral": {Group: groupTransform, Description: "This will show the sum over time, sort of like a continuous addition function.",
+			Params: []FunctionParam{seriesListParam}},
+		"interpolate": {Group: groupTransform, Description: "Takes one metric or a wildcard seriesList, and optionally a limit to the number of 'None' values to skip over.",
+			Params: []FunctionParam{seriesListParam, {Name: "limit", Type: paramIntOrInf, Default: "INF"}}},
+		"invert": {Group: groupTransform, Description: "Takes one metric or a wildcard seriesList, and inverts each datapoint (i.e. 1/x).",
+			Params: []FunctionParam{seriesListParam}},
+		"keepLastValue": {Group: groupTransform, Description: "Takes one metric or a wildcard seriesList, and optionally a limit to the number of 'None' values to skip over.",
+			Params: []FunctionParam{seriesListParam, {Name: "limit", Type: paramIntOrInf, Default: "INF"}}},
+		"limit": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList followed by an integer N. Only draw the first N metrics.",
+			Params: []FunctionParam{seriesListParam, nParam}},
+		"lineWidth": {Group: groupGraph, Description: "Takes one metric or a wildcard seriesList, followed by a float F. Draw the selected metrics with a line width of F.",
+			Params: []FunctionParam{seriesListParam, {Name: "width", Type: paramFloat, Required: true}}},
+		"logarithm": {Group: groupTransform, Description: "Takes one metric or a wildcard seriesList, a base, and draws the y-axis in logarithmic format.",
+			Params: []FunctionParam{seriesListParam, {Name: "base", Type: paramInteger, Default: 10}}},
+		"lowestAverage": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList followed by an integer N. Out of all metrics passed, draws only the bottom N metrics with the lowest average value for the time period specified.",
+			Params: []FunctionParam{seriesListParam, {Name: "n", Type: paramInteger, Default: 1}}},
+		"lowestCurrent": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList followed by an integer N. Out of all metrics passed, draws only the N metrics with the lowest value at the end of the time period specified.",
+			Params: []FunctionParam{seriesListParam, {Name: "n", Type: paramInteger, Default: 1}}},
+		"mapSeries": {Group: groupCombine, Description: "Short form: map(). Takes a seriesList and maps it to a list of seriesList.",
+			Params: []FunctionParam{seriesListParam, {Name: "mapNodes", Type: paramNodeOrTag, Required: true, Multiple: true}}},
+		"maxSeries": {Group: groupCombine, Description: "Takes one metric or a wildcard seriesList. For each datapoint from each metric passed in, pick the maximum value and graph it.",
+			Params: []FunctionParam{seriesListsParam}},
+		"maximumAbove": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList followed by a constant n. Draws only the metrics with a maximum value above n.",
+			Params: []FunctionParam{seriesListParam, nParam}},
+		"maximumBelow": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList followed by a constant n. Draws only the metrics with a maximum value below n.",
+			Params: []FunctionParam{seriesListParam, nParam}},
+		"minMax": {Group: groupTransform, Description: "Applies the popular min max normalization technique, which takes each point and applies the following normalization transformation to it: normalized = (point - min) / (max - min).",
+			Params: []FunctionParam{seriesListParam}},
+		"minSeries": {Group: groupCombine, Description: "Takes one metric or a wildcard seriesList. For each datapoint from each metric passed in, pick the minimum value and graph it.",
+			Params: []FunctionParam{seriesListsParam}},
+		"minimumAbove": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList followed by a constant n. Draws only the metrics with a minimum value above n.",
+			Params: []FunctionParam{seriesListParam, nParam}},
+		"minimumBelow": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList followed by a constant n. Draws only the metrics with a minimum value below n.",
+			Params: []FunctionParam{seriesListParam, nParam}},
+		"movingAverage": {Group: groupCalc, Description: "Graphs the average of a metric (or metrics) over a fixed number of past points, or a time interval.",
+			Params: []FunctionParam{seriesListParam, {Name: "windowSize", Type: paramIntOrInterval, Required: true}, {Name: "xFilesFactor", Type: paramFloat}}},
+		"movingMax": {Group: groupCalc, Description: "Graphs the maximum of a metric (or metrics) over a fixed number of past points, or a time interval.",
+			Params: []FunctionParam{seriesListParam, {Name: "windowSize", Type: paramIntOrInterval, Required: true}, {Name: "xFilesFactor", Type: paramFloat}}},
+		"movingMedian": {Group: groupCalc, Description: "Graphs the median of a metric (or metrics) over a fixed number of past points, or a time interval.",
+			Params: []FunctionParam{seriesListParam, {Name: "windowSize", Type: paramIntOrInterval, Required: true}, {Name: "xFilesFactor", Type: paramFloat}}},
+		"movingMin": {Group: groupCalc, Description: "Graphs the minimum of a metric (or metrics) over a fixed number of past points, or a time interval.",
+			Params: []FunctionParam{seriesListParam, {Name: "windowSize", Type: paramIntOrInterval, Required: true}, {Name: "xFilesFactor", Type: paramFloat}}},
+		"movingSum": {Group: groupCalc, Description: "Graphs the sum of a metric (or metrics) over a fixed number of past points, or a time interval.",
+			Params: []FunctionParam{seriesListParam, {Name: "windowSize", Type: paramIntOrInterval, Required: true}, {Name: "xFilesFactor", Type: paramFloat}}},
+		"multiplySeries": {Group: groupCombine, Description: "Takes two or more series and multiplies their points.",
+			Params: []FunctionParam{seriesListsParam}},
+		"multiplySeriesWithWildcards": {Group: groupCombine, Description: "Call multiplySeries after inserting wildcards at the given position(s).",
+			Params: []FunctionParam{seriesListParam, {Name: "position", Type: paramNode, Multiple: true}}},
+		"offset": {Group: groupTransform, Description: "Takes one metric or a wildcard seriesList followed by a constant, and adds the constant to each datapoint.",
+			Params: []FunctionParam{seriesListParam, {Name: "factor", Type: paramFloat, Required: true}}},
+		"perSecond": {Group: groupTransform, Description: "NonNegativeDerivative adjusted for the series time interval.",
+			Params: []FunctionParam{seriesListParam, {Name: "maxValue", Type: paramFloat}}},
+		"pow": {Group: groupTransform, Description: "Takes one metric or a wildcard seriesList followed by a constant, and raises the datapoint by the power of the constant provided at each point.",
+			Params: []FunctionParam{seriesListParam, {Name: "factor", Type: paramFloat, Required: true}}},
+		"randomWalkFunction": {Group: groupSpecial, Description: "Short Alias: randomWalk(). Returns a random walk starting at 0.",
+			Params: []FunctionParam{nameParam, stepParam}},
+		"rangeOfSeries": {Group: groupCombine, Description: "Takes a wildcard seriesList. Distills down a set of inputs into the range of the series.",
+			Params: []FunctionParam{seriesListsParam}},
+		"reduceSeries": {Group: groupCombine, Description: "Short form: reduce(). Takes a list of seriesLists and reduces it to a list of series by means of the reduceFunction.",
+			Params: []FunctionParam{{Name: "seriesList", Type: paramSeriesLists, Required: true}, {Name: "reduceFunction", Type: paramString, Required: true}, {Name: "reduceNode", Type: paramNode, Required: true}, {Name: "reduceMatchers", Type: paramString, Required: true, Multiple: true}}},
+		"removeAboveValue": {Group: groupData, Description: "Removes data above the given threshold from the series or list of series provided.",
+			Params: []FunctionParam{seriesListParam, nParam}},
+		"removeBelowValue": {Group: groupData, Description: "Removes data below the given threshold from the series or list of series provided.",
+			Params: []FunctionParam{seriesListParam, nParam}},
+		"removeEmptySeries": {Group: groupFilter, Description: "Takes one metric or a wildcard seriesList. Out of all metrics passed, draws only the metrics with not empty data.",
+			Params: []FunctionParam{seriesListParam, {Name: "xFilesFactor", Type: paramFloat}}},
+		"scale": {Group: groupTransform, Description: "Takes one metric or a wildcard seriesList followed by a constant, and multiplies the datapoint by the constant provided at each point.",
+			Params: []FunctionParam{seriesListParam, {Name: "factor", Type: paramFloat, Required: true}}},
+		"scaleToSeconds": {Group: groupTransform, Description: "Takes one metric or a wildcard seriesList and returns \"value per seconds\" where seconds is a last argument to this functions.",
+			Params: []FunctionParam{seriesListParam, {Name: "seconds", Type: paramFloat, Required: true}}},
+		"secondYAxis": {Group: groupGraph, Description: "Graph the series on the secondary Y axis.",
+			Params: []FunctionParam{seriesListParam}},
+		"seriesByTag": {Group: groupSpecial, Description: "Returns a SeriesList of series matching all the specified tag expressions.",
+			Params: []FunctionParam{{Name: "tagExpressions", Type: paramTagExpression, Required: true, Multiple: true}}},
+		"setXFilesFactor": {Group: groupSpecial, Description: "Short form: xFilesFactor(). Takes one metric or a wildcard seriesList and an xFilesFactor value between 0 and 1.",
+			Params: []FunctionParam{seriesListParam, {Name: "xFilesFactor", Type: paramFloat, Required: true}}},
+		"sinFunction": {Group: groupSpecial, Description: "Short Alias: sin(). Just returns the sine of the current time. The optional amplitude parameter changes the amplitude of the wave.",
+			Params: []FunctionParam{nameParam, {Name: "amplitude", Type: paramInteger, Default: 1}, stepParam}},
+		"sortByMaxima": {Group: groupSorting, Description: "Takes one metric or a wildcard seriesList. Sorts the list of metrics in descending order by the maximum value across the time period specified.",
+			Params: []FunctionParam{seriesListParam}},
+		"sortByMinima": {Group: groupSorting, Description: "Takes one metric or a wildcard seriesList. Sorts the list of metrics by the lowest value across the time period specified.",
+			Params: []FunctionParam{seriesListParam}},
+		"sortByName": {Group: groupSorting, Description: "Takes one metric or a wildcard seriesList. Sorts the list of metrics by the metric name.",
+			Params: []FunctionParam{seriesListParam, {Name: "natural", Type: paramBoolean, Default: false}, {Name: "reverse", Type: paramBoolean, Default: false}}},
+		"sortByTotal": {Group: groupSorting, Description: "Takes one metric or a wildcard seriesList. Sorts the list of metrics in descending order by the sum of values across the time period specified.",
+			Params: []FunctionParam{seriesListParam}},
+		"squareRoot": {Group: groupTransform, Description: "Takes one metric or a wildcard seriesList, and computes the square root of each datapoint.",
+			Params: []FunctionParam{seriesListParam}},
+		"stacked": {Group: groupGraph, Description: "Takes one metric or a wildcard seriesList and change them so they are stacked.",
+			Params: []FunctionParam{{Name: "seriesLists", Type: paramSeriesList, Required: true}, {Name: "stack", Type: paramString}}},
+		"stddevSeries": {Group: groupCombine, Description: "Takes one metric or a wildcard seriesList. Draws the standard deviation of all metrics passed at each time.",
+			Params: []FunctionParam{seriesListsParam}},
+		"stdev": {Group: groupCalc, Description: "Takes one metric or a wildcard seriesList followed by an integer N. Draw the Standard Deviation of all metrics passed for the past N datapoints.",
+			Params: []FunctionParam{seriesListParam, {Name: "points", Type: paramInteger, Required: true}, {Name: "windowTolerance", Type: paramFloat, Default: 0.1}}},
+		"substr": {Group: groupSpecial, Description: "Takes one metric or a wildcard seriesList followed by 1 or 2 integers. Prints only the metric name between the given integers.",
+			Params: []FunctionParam{seriesListParam, {Name: "start", Type: paramNode, Default: 0}, {Name: "stop", Type: paramNode, Default: 0}}},
+		"sumSeries": {Group: groupCombine, Description: "Short form: sum(). Adds metrics together and returns the sum at each datapoint.",
+			Params: []FunctionParam{seriesListsParam}},
+		"sumSeriesWithWildcards": {Group: groupCombine, Description: "Call sumSeries after inserting wildcards at the given position(s).",
+			Params: []FunctionParam{seriesListParam, {Name: "position", Type: paramNode, Multiple: true}}},
+		"summarize": {Group: groupTransform, Description: "Summarize the data into interval buckets of a certain size.",
+			Params: []FunctionParam{seriesListParam, {Name: "intervalString", Type: paramInterval, Required: true}, aggFuncParam("func", false, "sum"), {Name: "alignToFrom", Type: paramBoolean, Default: false}}},
+		"threshold": {Group: groupGraph, Description: "Takes a float F, followed by a label (in double quotes) and a color. Draws a horizontal line at value F across the graph.",
+			Params: []FunctionParam{{Name: "value", Type: paramFloat, Required: true}, {Name: "label", Type: paramString}, {Name: "color", Type: paramString}}},
+		"timeFunction": {Group: groupTransform, Description: "Short Alias: time(). Just returns the timestamp for each X value.",
+			Params: []FunctionParam{nameParam, stepParam}},
+		"timeShift": {Group: groupTransform, Description: "Takes one metric or a wildcard seriesList, followed by a quoted string with the length of time, and draws the selected metrics shifted in time.",
+			Params: []FunctionParam{seriesListParam, {Name: "timeShift", Type: paramInterval, Required: true}, {Name: "resetEnd", Type: paramBoolean, Default: true}, {Name: "alignDST", Type: paramBoolean, Default: false}}},
+		"timeSlice": {Group: groupTransform, Description: "Takes one metric or a wildcard metric, followed by a quoted string with the time to start the line and another quoted string with the time to end the line.",
+			Params: []FunctionParam{seriesListParam, {Name: "startSliceAt", Type: paramDate, Required: true}, {Name: "endSliceAt", Type: paramDate, Default: "now"}}},
+		"transformNull": {Group: groupTransform, Description: "Takes a metric or wildcard seriesList and replaces null values with the value specified by default.",
+			Params: []FunctionParam{seriesListParam, {Name: "default", Type: paramFloat, Default: 0}, {Name: "referenceSeries", Type: paramSeriesList}}},
+		"unique": {Group: groupFilter, Description: "Takes an arbitrary number of seriesLists and returns unique series, filtered by name.",
+			Params: []FunctionParam{seriesListsParam}},
+	}
+)
+
+// ----------------------------------------------------------------------------
+// helper functions
+
+func aggFuncParam(name string, required bool, def interface{}) FunctionParam {
+	options := make([]string, 0)
+	for op := range aggregateOperator {
+		options = append(options, op)
+	}
+
+	sort.Strings(options)
+
+	return FunctionParam{
+		Name:     name,
+		Type:     paramAggFunc,
+		Required: required,
+		Default:  def,
+		Options:  options,
+	}
+}
+
+// signature return the python like signature of a function
+func signature(name string, params []FunctionParam) string {
+	items := make([]string, 0)
+	for _, param := range params {
+		switch {
+		case param.Multiple:
+			items = append(items, "*"+param.Name)
+		case param.Default != nil:
+			items = append(items, fmt.Sprintf("%s=%v", param.Name, param.Default))
+		case !param.Required:
+			items = append(items, param.Name+"=None")
+		default:
+			items = append(items, param.Name)
+		}
+	}
+
+	return fmt.Sprintf("%s(%s)", name, strings.Join(items, ", "))
+}
+
+// isImplemented tell if a graphite function is registered with an implementation
+func isImplemented(fn func(*core.Node, []string, map[string]string) (*core.Node, error)) bool {
+	return reflect.ValueOf(fn).Pointer() != reflect.ValueOf(noOp).Pointer()
+}
+
+// ListFunctions return the description of the implemented graphite functions
+func ListFunctions() map[string]FunctionDescription {
+	result := make(map[string]FunctionDescription)
+	for name, fn := range functions {
+		if !isImplemented(fn) {
+			continue
+		}
+
+		key := name
+		if alias, ok := aliases[name]; ok {
+			key = alias
+		}
+
+		description, ok := descriptions[key]
+		if !ok {
+			// internal functions such as fetch or bucketize are not exposed
+			continue
+		}
+
+		description.Name = name
+		description.Function = signature(name, description.Params)
+		description.Module = functionsModule
+		result[name] = description
+	}
+
+	return result
+}
+
+// ----------------------------------------------------------------------------
+// handlers
+
+// Functions graphite handler (/functions and /functions/<name>)
+// https://graphite.readthedocs.io/en/latest/functions.html#function-api
+func Functions(w http.ResponseWriter, r *http.Request) {
+	q := new(FunctionsQuery)
+	if err := q.Parse(r); err != nil {
+		logWarn(r, http.StatusBadRequest, err)
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	list := ListFunctions()
+
+	var body interface{} = list
+	if name := path.Base(r.URL.Path); name != "functions" {
+		description, ok := list[name]
+		if !ok {
+			err := fmt.Errorf("Function %s not found", name)
+			logWarn(r, http.StatusNotFound, err)
+			respondWithError(w, http.StatusNotFound, err)
+			return
+		}
+
+		body = description
+	}
+
+	var result []byte
+	var err error
+	if q.Pretty {
+		result, err = json.MarshalIndent(body, "", "  ")
+	} else {
+		result, err = json.Marshal(body)
+	}
+
+	if err != nil {
+		logErr(r, http.StatusInternalServerError, err)
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if len(q.JSONP) != 0 {
+		respondWithJsonp(w, http.StatusOK, result, q.JSONP)
+	} else {
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		respond(w, http.StatusOK, result)
+	}
+}
+
+// Version graphite handler (/version)
+// https://github.com/graphite-project/graphite-web/blob/master/webapp/graphite/views.py
+func Version(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain;charset=utf-8")
+	respond(w, http.StatusOK, []byte(graphiteVersion))
+}
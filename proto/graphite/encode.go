@@ -0,0 +1,262 @@
+package graphite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ovh/erlenmeyer/core"
+)
+
+// ----------------------------------------------------------------------------
+// graphite-web federation formats
+//
+// graphite-web and carbonapi read remote series as a list of dictionaries
+// serialized with pickle or msgpack, datapoints are regular values between
+// start and end with None for missing values
+// https://github.com/graphite-project/graphite-web/blob/master/webapp/graphite/render/views.py
+
+// field is an ordered dictionary entry
+type field struct {
+	Key   string
+	Value interface{}
+}
+
+// dict is an ordered dictionary
+type dict []field
+
+// toSeriesData convert GTS to the graphite-web series dictionary
+func (s *GTS) toSeriesData() dict {
+	name := s.ClassName
+	if labels := s.toGraphiteLabels(); len(labels) > 0 {
+		name = fmt.Sprintf("%s;%s", name, labels)
+	}
+
+	// Warp 10 reserved labels such as .app are not graphite tags
+	graphiteTags := s.tags()
+	tags := dict{{Key: "name", Value: graphiteTags["name"]}}
+	for _, key := range sortedKeys(graphiteTags) {
+		if key != "name" {
+			tags = append(tags, field{Key: key, Value: graphiteTags[key]})
+		}
+	}
+
+	pathExpression := s.pathExpression
+	if len(pathExpression) == 0 {
+		pathExpression = name
+	}
+
+	s.sortValues()
+
+	// graphite steps are whole seconds, clients divide by the step: sub-second
+	// datapoints are consolidated using the series consolidation function
+	step := s.step()
+	if step%1000000 != 0 {
+		step = (step/1000000 + 1) * 1000000
+	}
+
+	start, end := int64(0), int64(0)
+	values := make([]interface{}, 0)
+	if len(s.Values) > 0 {
+		first := int64(s.Values[0][0])
+		last := int64(s.Values[len(s.Values)-1][0])
+
+		start = first / 1000000
+		end = (last + step) / 1000000
+
+		slots := make([][]float64, (last-first)/step+1)
+		for _, value := range s.Values {
+			slot := (int64(value[0]) - first) / step
+			slots[slot] = append(slots[slot], value[1])
+		}
+
+		op := s.consolidationFunc()
+		values = make([]interface{}, len(slots))
+		for i, slot := range slots {
+			if len(slot) > 0 {
+				values[i] = consolidateValues(op, slot)
+			}
+		}
+	}
+
+	return dict{
+		{Key: "name", Value: name},
+		{Key: "pathExpression", Value: pathExpression},
+		{Key: "start", Value: start},
+		{Key: "end", Value: end},
+		{Key: "step", Value: step / 1000000},
+		{Key: "values", Value: values},
+		{Key: "consolidationFunc", Value: consolidateFunctions[s.consolidationFunc()]},
+		{Key: "xFilesFactor", Value: s.xFilesFactor()},
+		{Key: "tags", Value: tags},
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0)
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// ----------------------------------------------------------------------------
+// pickle
+
+// Pickle opcodes of the protocol 2
+// https://github.com/python/cpython/blob/master/Lib/pickletools.py
+const (
+	pickleProto      = 0x80
+	pickleStop       = '.'
+	pickleNone       = 'N'
+	pickleTrue       = 0x88
+	pickleFalse      = 0x89
+	pickleBinInt     = 'J'
+	pickleLong1      = 0x8a
+	pickleBinFloat   = 'G'
+	pickleBinUnicode = 'X'
+	pickleEmptyList  = ']'
+	pickleEmptyDict  = '}'
+	pickleMark       = '('
+	pickleAppends    = 'e'
+	pickleSetItems   = 'u'
+)
+
+// toPickle serialize a value using the pickle protocol 2
+func toPickle(value interface{}) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	buffer.Write([]byte{pickleProto, 2}) // nolint: gas
+
+	if err := writePickle(buffer, value); err != nil {
+		return nil, err
+	}
+
+	buffer.WriteByte(pickleStop) // nolint: gas
+
+	return buffer.Bytes(), nil
+}
+
+// nolint: gocyclo
+func writePickle(buffer *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buffer.WriteByte(pickleNone) // nolint: gas
+	case bool:
+		if v {
+			buffer.WriteByte(pickleTrue) // nolint: gas
+		} else {
+			buffer.WriteByte(pickleFalse) // nolint: gas
+		}
+	case int64:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			buffer.WriteByte(pickleBinInt)                      // nolint: gas
+			binary.Write(buffer, binary.LittleEndian, int32(v)) // nolint: gas, errcheck
+			return nil
+		}
+
+		// LONG1 is a little endian two's complement of 8 bytes at most
+		buffer.Write([]byte{pickleLong1, 8})         // nolint: gas
+		binary.Write(buffer, binary.LittleEndian, v) // nolint: gas, errcheck
+	case float64:
+		buffer.WriteByte(pickleBinFloat)                            // nolint: gas
+		binary.Write(buffer, binary.BigEndian, math.Float64bits(v)) // nolint: gas, errcheck
+	case string:
+		buffer.WriteByte(pickleBinUnicode)                        // nolint: gas
+		binary.Write(buffer, binary.LittleEndian, uint32(len(v))) // nolint: gas, errcheck
+		buffer.WriteString(v)                                     // nolint: gas
+	case []interface{}:
+		buffer.WriteByte(pickleEmptyList) // nolint: gas
+		if len(v) == 0 {
+			return nil
+		}
+
+		buffer.WriteByte(pickleMark) // nolint: gas
+		for _, item := range v {
+			if err := writePickle(buffer, item); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte(pickleAppends) // nolint: gas
+	case dict:
+		buffer.WriteByte(pickleEmptyDict) // nolint: gas
+		if len(v) == 0 {
+			return nil
+		}
+
+		buffer.WriteByte(pickleMark) // nolint: gas
+		for _, f := range v {
+			if err := writePickle(buffer, f.Key); err != nil {
+				return err
+			}
+
+			if err := writePickle(buffer, f.Value); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte(pickleSetItems) // nolint: gas
+	default:
+		return fmt.Errorf("Cannot pickle value of type %T", value)
+	}
+
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// msgpack
+
+// toMsgpack serialize a value using msgpack
+func toMsgpack(value interface{}) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	enc := core.NewMsgpackWriter(buffer)
+	if err := writeMsgpack(enc, value); err != nil {
+		return nil, err
+	}
+
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func writeMsgpack(enc *core.MsgpackWriter, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		enc.WriteNil()
+	case bool:
+		enc.WriteBool(v)
+	case int64:
+		enc.WriteInt(v)
+	case float64:
+		enc.WriteFloat(v)
+	case string:
+		enc.WriteString(v)
+	case []interface{}:
+		enc.WriteArrayHeader(len(v))
+		for _, item := range v {
+			if err := writeMsgpack(enc, item); err != nil {
+				return err
+			}
+		}
+	case dict:
+		enc.WriteMapHeader(len(v))
+		for _, f := range v {
+			if err := writeMsgpack(enc, f.Key); err != nil {
+				return err
+			}
+
+			if err := writeMsgpack(enc, f.Value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("Cannot serialize value of type %T with msgpack", value)
+	}
+
+	return nil
+}
@@ -21,9 +21,13 @@ type TreeJSON struct {
 
 // GTS is the format which is returned by warp10
 type GTS struct {
-	ClassName string            `json:"c"`
-	Labels    map[string]string `json:"l"`
-	Values    [][]float64       `json:"v"`
+	ClassName  string            `json:"c"`
+	Labels     map[string]string `json:"l"`
+	Attributes map[string]string `json:"a"`
+	Values     [][]float64       `json:"v"`
+
+	// pathExpression is the target which has produced the series
+	pathExpression string
 }
 
 // JSON structure definition
@@ -194,6 +198,17 @@ func Format(gtss []GTS, format string) ([]byte, error) {
 		}
 
 		return json.Marshal(r)
+	case "pickle", "msgpack":
+		series := make([]interface{}, 0)
+		for _, gts := range gtss {
+			series = append(series, gts.toSeriesData())
+		}
+
+		if format == "pickle" {
+			return toPickle(series)
+		}
+
+		return toMsgpack(series)
 	}
 
 	return nil, errors.New("The output format is not supported")
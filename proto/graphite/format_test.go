@@ -0,0 +1,181 @@
+package graphite_test
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ovh/erlenmeyer/proto/graphite"
+)
+
+func TestConsolidate(t *testing.T) {
+	gts := graphite.GTS{
+		ClassName: "os.cpu",
+		Values:    [][]float64{{0, 1}, {60e6, 2}, {120e6, 3}, {180e6, 4}, {300e6, 6}},
+	}
+
+	gts.Consolidate(3)
+
+	expected := [][]float64{{0, 1.5}, {120e6, 3.5}, {240e6, 6}}
+	if !reflect.DeepEqual(gts.Values, expected) {
+		t.Errorf("Expect %v but got %v", expected, gts.Values)
+	}
+
+	gts = graphite.GTS{
+		ClassName:  "os.cpu",
+		Attributes: map[string]string{".consolidateBy": "max", ".xFilesFactor": "1"},
+		Values:     [][]float64{{0, 1}, {60e6, 2}, {120e6, 3}, {180e6, 4}, {300e6, 6}},
+	}
+
+	gts.Consolidate(3)
+
+	// the last bucket has a missing datapoint
+	expected = [][]float64{{0, 2}, {120e6, 4}}
+	if !reflect.DeepEqual(gts.Values, expected) {
+		t.Errorf("Expect %v but got %v", expected, gts.Values)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	gtss := []graphite.GTS{
+		{
+			ClassName: "os.cpu",
+			Labels:    map[string]string{"host": "a"},
+			Values:    [][]float64{{60e6, 2.5}, {120e6, 1}, {240e6, 4}},
+		},
+	}
+
+	pickle, err := graphite.Format(gtss, "pickle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(pickle, []byte{0x80, 2, ']'}) || !bytes.HasSuffix(pickle, []byte{'e', '.'}) {
+		t.Errorf("Unexpected pickle %q", pickle)
+	}
+
+	// values are regular with None for missing datapoints
+	values := []byte("X\x06\x00\x00\x00values](G@\x04\x00\x00\x00\x00\x00\x00G?\xf0\x00\x00\x00\x00\x00\x00NG@\x10\x00\x00\x00\x00\x00\x00e")
+	if !bytes.Contains(pickle, values) {
+		t.Errorf("Pickle %q does not contain values %q", pickle, values)
+	}
+
+	msgpack, err := graphite.Format(gtss, "msgpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values = []byte("\xa6values\x94\xcb@\x04\x00\x00\x00\x00\x00\x00\xcb?\xf0\x00\x00\x00\x00\x00\x00\xc0\xcb@\x10\x00\x00\x00\x00\x00\x00")
+	if !bytes.HasPrefix(msgpack, []byte{0x91, 0x89}) || !bytes.Contains(msgpack, values) {
+		t.Errorf("Unexpected msgpack %q", msgpack)
+	}
+}
+
+func TestFormatSubSecond(t *testing.T) {
+	gtss := []graphite.GTS{
+		{
+			ClassName: "os.cpu",
+			Labels:    map[string]string{"host": "a", ".app": "internal"},
+			Values:    [][]float64{{0, 1}, {500e3, 3}, {1e6, 4}},
+		},
+	}
+
+	msgpack, err := graphite.Format(gtss, "msgpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the step is at least one second, sub-second datapoints are averaged
+	step := []byte("\xa4step\x01")
+	values := []byte("\xa6values\x92\xcb@\x00\x00\x00\x00\x00\x00\x00\xcb@\x10\x00\x00\x00\x00\x00\x00")
+	if !bytes.Contains(msgpack, step) || !bytes.Contains(msgpack, values) {
+		t.Errorf("Unexpected msgpack %q", msgpack)
+	}
+
+	// reserved labels are not graphite tags
+	tags := []byte("\xa4tags\x82\xa4name\xa6os.cpu\xa4host\xa1a")
+	if !bytes.HasSuffix(msgpack, tags) {
+		t.Errorf("Unexpected tags in msgpack %q", msgpack)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	gtss := []graphite.GTS{
+		{
+			ClassName: "os.cpu",
+			Values:    [][]float64{{60e6, 2.5}, {120e6, 1}, {240e6, 4}},
+		},
+		{
+			ClassName:  "os.mem",
+			Attributes: map[string]string{".color": "red", ".secondYAxis": "true", ".dashed": "5"},
+			Values:     [][]float64{{60e6, 2000}, {120e6, 1000}, {180e6, 4000}},
+		},
+	}
+
+	options := graphite.GraphOptions{
+		Width:    400,
+		Height:   200,
+		Title:    "cpu & mem",
+		AreaMode: "first",
+	}
+
+	out, err := graphite.Graph(gtss, "png", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size := img.Bounds().Size(); size.X != 400 || size.Y != 200 {
+		t.Errorf("Unexpected graph size %v", size)
+	}
+
+	out, err = graphite.Graph(gtss, "svg", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svg := string(out)
+	for _, shouldContain := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg" width="400" height="200"`,
+		">cpu &amp; mem</text>",
+		">os.mem</text>",
+		`stroke="rgb(200,0,50)" stroke-width="1" stroke-dasharray="5,5"`,
+		">4K</text>",
+	} {
+		if !strings.Contains(svg, shouldContain) {
+			t.Errorf("Graph does not contain %s\n%s", shouldContain, svg)
+		}
+	}
+
+	if _, err = graphite.Graph(gtss, "svg", graphite.GraphOptions{AreaMode: "unknown"}); err == nil {
+		t.Error("Graph should fail with an unknown areaMode")
+	}
+}
+
+func TestGraphBounds(t *testing.T) {
+	gtss := []graphite.GTS{{ClassName: "os.cpu", Values: [][]float64{{60e6, 1}, {120e6, 2}}}}
+
+	// a step below the float64 precision of the bounds must not loop forever
+	options := graphite.GraphOptions{YMin: "100000000000000000", YMax: "100000000000000016"}
+	if _, err := graphite.Graph(gtss, "svg", options); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := graphite.Graph(gtss, "svg", graphite.GraphOptions{YMax: "+Inf"}); err == nil {
+		t.Error("Graph should fail with an infinite yMax")
+	}
+
+	q := graphite.RenderQuery{}
+	req := httptest.NewRequest(http.MethodGet, "/render?target=os.cpu&format=png&width=100000&height=100000", nil)
+	if err := q.Parse(req); err == nil {
+		t.Error("Render should reject a graph larger than the maximum size")
+	}
+}
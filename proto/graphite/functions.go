@@ -42,9 +42,8 @@ var (
 		"aliasQuery":                  noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.aliasQuery
 		"aliasSub":                    aliasSub,                    // name.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.aliasSub
 		"alpha":                       noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.alpha
-		"applyByNode":                 noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.applyByNode
 		"areaBetween":                 noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.areaBetween
-		"asPercent":                   noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.asPercent
+		"asPercent":                   asPercent,                   // mapper.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.asPercent
 		"averageAbove":                averageAbove,                // filter.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.averageAbove
 		"averageBelow":                averageBelow,                // filter.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.averageBelow
 		"averageOutsidePercentile":    noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.averageOutsidePercentile
@@ -52,14 +51,14 @@ var (
 		"averageSeriesWithWildcards":  averageSeriesWithWildcards,  // aggregate.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.averageSeriesWithWildcards
 		"cactiStyle":                  noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.cactiStyle
 		"changed":                     noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.changed
-		"color":                       noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.color
+		"color":                       colorFunction,               // style.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.color
 		"consolidateBy":               consolidateBy,               // bucketize.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.consolidateBy
 		"constantLine":                constantLine,                // yield.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.constantLine
 		"countSeries":                 countSeries,                 // reduce.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.countSeries
 		"cumulative":                  cumulative,                  // bucketize.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.cumulative
 		"currentAbove":                currentAbove,                // filter.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.currentAbove
 		"currentBelow":                currentBelow,                // filter.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.currentBelow
-		"dashed":                      noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.dashed
+		"dashed":                      dashed,                      // style.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.dashed
 		"delay":                       delay,                       // time.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.delay
 		"derivative":                  derivative,                  // mapper.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.derivative
 		"diffSeries":                  diffSeries,                  // aggregate.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.diffSeries
@@ -74,7 +73,7 @@ var (
 		"group":                       noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.group
 		"groupByNode":                 groupByNode,                 // aggregate.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.groupByNode
 		"groupByNodes":                aggregateWithWildcards,      // aggregate.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.groupByNodes
-		"groupByTags":                 noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.groupByTags
+		"groupByTags":                 groupByTags,                 // apply.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.groupByTags
 		"highestAverage":              highestAverage,              // filter.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.highestAverage
 		"highestCurrent":              highestCurrent,              // filter.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.highestCurrent
 		"highestMax":                  highestMax,                  // filter.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.highestMax
@@ -92,14 +91,14 @@ var (
 		"keepLastValue":               keepLastValue,               // operate.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.keepLastValue
 		"legendValue":                 noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.legendValue
 		"limit":                       limit,                       // filter.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.limit
-		"lineWidth":                   noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.lineWidth
+		"lineWidth":                   lineWidth,                   // style.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.lineWidth
 		"linearRegression":            noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.linearRegression
 		"linearRegressionAnalysis":    noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.linearRegressionAnalysis
 		"logarithm":                   logarithm,                   // math.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.logarithm
 		"log":                         logarithm,                   // math.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.logarithm
 		"lowestAverage":               lowestAverage,               // filter.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.lowestAverage
 		"lowestCurrent":               lowestCurrent,               // filter.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.lowestCurrent
-		"mapSeries":                   noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.mapSeries
+		"mapSeries":                   mapSeries,                   // apply.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.mapSeries
 		"maxSeries":                   maxSeries,                   // aggregate.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.maxSeries
 		"maximumAbove":                maximumAbove,                // filter.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.maximumAbove
 		"maximumBelow":                maximumBelow,                // filter.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.maximumBelow
@@ -108,11 +107,11 @@ var (
 		"minimumAbove":                minimumAbove,                // filter.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.minimumAbove
 		"minimumBelow":                minimumBelow,                // filter.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.minimumBelow
 		"mostDeviant":                 noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.mostDeviant
-		"movingAverage":               noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.movingAverage
-		"movingMax":                   noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.movingMax
-		"movingMedian":                noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.movingMedian
-		"movingMin":                   noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.movingMin
-		"movingSum":                   noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.movingSum
+		"movingAverage":               movingAverage,               // mapper.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.movingAverage
+		"movingMax":                   movingMax,                   // mapper.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.movingMax
+		"movingMedian":                movingMedian,                // mapper.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.movingMedian
+		"movingMin":                   movingMin,                   // mapper.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.movingMin
+		"movingSum":                   movingSum,                   // mapper.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.movingSum
 		"movingWindow":                noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.movingWindow
 		"multiplySeries":              multiplySeries,              // aggregate.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.multiplySeries
 		"multiplySeriesWithWildcards": multiplySeriesWithWildcards, // aggregate.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.multiplySeriesWithWildcards
@@ -127,7 +126,6 @@ var (
 		"randomWalkFunction":          randomWalkFunction,          // yield.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.randomWalkFunction
 		"randomWalk":                  randomWalkFunction,          // yield.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.randomWalkFunction
 		"rangeOfSeries":               rangeOfSeries,               // aggregate.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.rangeOfSeries
-		"reduceSeries":                noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.reduceSeries
 		"removeAbovePercentile":       noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.removeAbovePercentile
 		"removeAboveValue":            removeAboveValue,            // mapper.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.removeAboveValue
 		"removeBelowPercentile":       noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.removeBelowPercentile
@@ -137,9 +135,9 @@ var (
 		"roundFunction":               noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.roundFunction
 		"scale":                       scale,                       // mapper.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.scale
 		"scaleToSeconds":              scaleToSeconds,              // mapper.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.scaleToSeconds
-		"secondYAxis":                 noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.secondYAxis
+		"secondYAxis":                 secondYAxis,                 // style.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.secondYAxis
 		"seriesByTag":                 seriesByTag,                 // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.seriesByTag
-		"setXFilesFactor":             noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.setXFilesFactor
+		"setXFilesFactor":             setXFilesFactor,             // bucketize.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.setXFilesFactor
 		"sinFunction":                 sinFunction,                 // yield.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.sinFunction
 		"sin":                         sinFunction,                 // yield.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.sinFunction
 		"smartSummarize":              noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.smartSummarize
@@ -148,7 +146,7 @@ var (
 		"sortByName":                  sortByName,                  // sort.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.sortByName
 		"sortByTotal":                 sortByTotal,                 // sort.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.sortByTotal
 		"squareRoot":                  squareRoot,                  // math.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.squareRoot
-		"stacked":                     noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.stacked
+		"stacked":                     stacked,                     // style.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.stacked
 		"stddevSeries":                stddevSeries,                // aggregate.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.stddevSeries
 		"stdev":                       stdev,                       // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.stdev
 		"substr":                      substr,                      // name.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.substr
@@ -166,9 +164,17 @@ var (
 		"useSeriesAbove":              noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.useSeriesAbove
 		"verticalLine":                noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.verticalLine
 		"weightedAverage":             noOp,                        // http://graphite.readthedocs.io/en/latest/functions.html#render.functions.weightedAverage
+		"xFilesFactor":                setXFilesFactor,             // bucketize.go - http://graphite.readthedocs.io/en/latest/functions.html#render.functions.setXFilesFactor
 	}
 )
 
+func init() {
+	// Higher-order functions call back GetFunction, they are registered once
+	// the functions table is built to avoid an initialization cycle
+	functions["applyByNode"] = applyByNode
+	functions["reduceSeries"] = reduceSeries
+}
+
 // ----------------------------------------------------------------------------
 // export all functions across an unique interface
 
@@ -193,6 +199,15 @@ func fetch(node *core.Node, args []string, kwargs map[string]string) (*core.Node
 		return nil, errors.New("Missing arguments")
 	}
 
+	// Series selected by another protocol, see ParseSelections
+	if selection, ok := kwargs[selectionParameter+args[0]]; ok {
+		node.Left = core.NewNode(core.WarpScriptPayload{
+			WarpScript: selection,
+		})
+
+		return node.Left, nil
+	}
+
 	serie, labels, err := ParseSerie(args[0])
 	if err != nil {
 		return nil, err
@@ -47,6 +47,33 @@ func TestFunction(t *testing.T) {
 	}
 }
 
+func TestListFunctions(t *testing.T) {
+	descriptions := graphite.ListFunctions()
+
+	for _, name := range []string{"sumSeries", "avg", "aliasByNode", "summarize", "reduceSeries"} {
+		description, ok := descriptions[name]
+		if !ok {
+			t.Errorf("%s should be described", name)
+			continue
+		}
+
+		if description.Name != name || !strings.HasPrefix(description.Function, name+"(") || len(description.Params) == 0 {
+			t.Errorf("%s is not well described: %+v", name, description)
+		}
+	}
+
+	// internal and not implemented functions are not advertised
+	for _, name := range []string{"fetch", "bucketize", "noOp", "areaBetween", "movingWindow"} {
+		if _, ok := descriptions[name]; ok {
+			t.Errorf("%s should not be described", name)
+		}
+	}
+
+	if fn := descriptions["summarize"].Function; fn != "summarize(seriesList, intervalString, func=sum, alignToFrom=false)" {
+		t.Errorf("Unexpected summarize signature %s", fn)
+	}
+}
+
 var functionsTest = []functionTest{
 	{
 		Function: graphite.Function{
@@ -308,6 +335,26 @@ var functionsTest = []functionTest{
 			"$newName $series LABELS $item GET +",
 		},
 	},
+	{
+		Function: graphite.Function{
+			Name:       "movingAverage",
+			Arguments:  []string{swap, "5"},
+			Parameters: make(map[string]string),
+		},
+		ShouldContains: []string{
+			"[ SWAP  mapper.mean 4 0 0 ] MAP",
+		},
+	},
+	{
+		Function: graphite.Function{
+			Name:       "movingMax",
+			Arguments:  []string{swap, "10min"},
+			Parameters: make(map[string]string),
+		},
+		ShouldContains: []string{
+			"[ SWAP  mapper.max 10 m -1 * 0 0 ] MAP",
+		},
+	},
 	{
 		Function: graphite.Function{
 			Name:       "timeShift",
@@ -368,4 +415,131 @@ var functionsTest = []functionTest{
 			"[ $token '~os\\.cpu' {}   ISO8601  ISO8601 ] FETCH",
 		},
 	},
+	{
+		Function: graphite.Function{
+			Name:       "asPercent",
+			Arguments:  []string{swap, "200"},
+			Parameters: make(map[string]string),
+		},
+		ShouldContains: []string{
+			"[ SWAP 100.0 200 TODOUBLE / mapper.mul 0 0 0 ] MAP",
+		},
+	},
+	{
+		Function: graphite.Function{
+			Name:       "asPercent",
+			Arguments:  []string{swap},
+			Parameters: make(map[string]string),
+		},
+		ShouldContains: []string{
+			"[ SWAP [] reducer.sum ] REDUCE 'right' STORE",
+			"[ SWAP 100.0 mapper.mul 0 0 0 ] MAP",
+		},
+	},
+	{
+		Function: graphite.Function{
+			Name:       "setXFilesFactor",
+			Arguments:  []string{swap, "0.5"},
+			Parameters: make(map[string]string),
+		},
+		ShouldContains: []string{
+			"{ '.xFilesFactor' '0.5' } SETATTRIBUTES",
+		},
+	},
+	{
+		Function: graphite.Function{
+			Name:       "color",
+			Arguments:  []string{swap, "#ff0000"},
+			Parameters: make(map[string]string),
+		},
+		ShouldContains: []string{
+			"{ '.color' '%23ff0000' } SETATTRIBUTES",
+		},
+	},
+	{
+		Function: graphite.Function{
+			Name:       "secondYAxis",
+			Arguments:  []string{swap},
+			Parameters: make(map[string]string),
+		},
+		ShouldContains: []string{
+			"{ '.secondYAxis' 'true' } SETATTRIBUTES",
+		},
+	},
+	{
+		Function: graphite.Function{
+			Name:       "mapSeries",
+			Arguments:  []string{swap, "1", "dc"},
+			Parameters: make(map[string]string),
+		},
+		ShouldContains: []string{
+			"[ <% $mapSeriesNodes SIZE 1 > %> <% $mapSeriesNodes 1 GET %> <% '' %> IFTE $mapSeries LABELS 'dc' GET <% DUP ISNULL %> <% DROP '' %> IFT ] '.' JOIN 'mapSeriesKey' STORE",
+			"$mapSeries { '.mapSeries' $mapSeriesKey } RELABEL",
+		},
+	},
+	{
+		Function: graphite.Function{
+			Name:       "reduceSeries",
+			Arguments:  []string{swap, "asPercent", "2", "used", "total"},
+			Parameters: make(map[string]string),
+		},
+		ShouldContains: []string{
+			"[ '.mapSeries' ] PARTITION VALUES",
+			"[ 'used' 'total' ]",
+			"NAME '.' SPLIT 'asPercent' 2 SET '.' JOIN 'reduceSeriesKey' STORE",
+			"$reduceSeriesArgs LIST-> DROP",
+			"'right' STORE",
+		},
+	},
+	{
+		Function: graphite.Function{
+			Name:       "reduceSeries",
+			Arguments:  []string{swap, "sumSeries", "2", "used"},
+			Parameters: make(map[string]string),
+		},
+		ShouldContains: []string{
+			"$reduceSeriesArgs FLATTEN",
+			"[ SWAP $equivalenceClass reducer.sum ] REDUCE",
+		},
+	},
+	{
+		Function: graphite.Function{
+			Name:      "applyByNode",
+			Arguments: []string{swap, "1", "sumSeries(%.disk.*)", "%.total"},
+			Parameters: map[string]string{
+				"from":  "0",
+				"until": "60000000",
+			},
+		},
+		ShouldContains: []string{
+			"$applyByNodeNodes [ 0 1 ] SUBLIST '.' JOIN",
+			"%27~__applyByNode__%5C.disk%5C..%2A%3F%27",
+			"'__applyByNode__' $applyByNodePrefix '\\.' '[.]' REPLACEALL REPLACEALL EVAL",
+			"<% DROP '%25.total' '%25' $applyByNodePrefix REPLACEALL RENAME %> LMAP",
+		},
+	},
+	{
+		Function: graphite.Function{
+			Name:       "groupByTags",
+			Arguments:  []string{swap, "sum", "dc", "name"},
+			Parameters: make(map[string]string),
+		},
+		ShouldContains: []string{
+			"<% DROP DUP NAME '.name' SWAP 2 ->MAP RELABEL %> LMAP",
+			"'dc' '.name'  COUNTTOMARK ->LIST SWAP DROP 'equivalenceClass' CSTORE",
+			"[ SWAP $equivalenceClass reducer.sum ] REDUCE",
+			"$groupByTags $groupByTags LABELS '.name' GET RENAME { NULL NULL } RELABEL $groupByTagsLabels RELABEL",
+		},
+	},
+	{
+		Function: graphite.Function{
+			Name:       "groupByTags",
+			Arguments:  []string{swap, "max", "it's"},
+			Parameters: make(map[string]string),
+		},
+		ShouldContains: []string{
+			"'it%27s'  COUNTTOMARK ->LIST SWAP DROP 'equivalenceClass' CSTORE",
+			"$groupByTags 'max' RENAME { NULL NULL } RELABEL $groupByTagsLabels RELABEL",
+		},
+	},
 }
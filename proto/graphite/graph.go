@@ -0,0 +1,597 @@
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Series styles set by the color, lineWidth, dashed, secondYAxis and stacked functions
+const (
+	colorAttribute       = ".color"
+	lineWidthAttribute   = ".lineWidth"
+	dashedAttribute      = ".dashed"
+	secondYAxisAttribute = ".secondYAxis"
+	stackedAttribute     = ".stacked"
+)
+
+const (
+	areaModeNone    = "none"
+	areaModeFirst   = "first"
+	areaModeAll     = "all"
+	areaModeStacked = "stacked"
+
+	lineModeSlope     = "slope"
+	lineModeStaircase = "staircase"
+	lineModeConnected = "connected"
+
+	defaultGraphWidth  = 330
+	defaultGraphHeight = 250
+	maxGraphSize       = 10000
+
+	maxAxisTicks = 100
+
+	graphPadding = 10
+	legendHeight = 12
+	tickLength   = 4
+)
+
+var (
+	// colorAliases are the graphite-web named colors
+	colorAliases = map[string]color.RGBA{
+		"black":     {R: 0, G: 0, B: 0, A: 0xff},
+		"white":     {R: 255, G: 255, B: 255, A: 0xff},
+		"blue":      {R: 100, G: 100, B: 255, A: 0xff},
+		"green":     {R: 0, G: 200, B: 0, A: 0xff},
+		"red":       {R: 200, G: 0, B: 50, A: 0xff},
+		"yellow":    {R: 255, G: 255, B: 0, A: 0xff},
+		"orange":    {R: 255, G: 165, B: 0, A: 0xff},
+		"purple":    {R: 200, G: 100, B: 255, A: 0xff},
+		"brown":     {R: 150, G: 100, B: 50, A: 0xff},
+		"cyan":      {R: 0, G: 255, B: 255, A: 0xff},
+		"aqua":      {R: 0, G: 150, B: 150, A: 0xff},
+		"gray":      {R: 175, G: 175, B: 175, A: 0xff},
+		"grey":      {R: 175, G: 175, B: 175, A: 0xff},
+		"magenta":   {R: 255, G: 0, B: 255, A: 0xff},
+		"pink":      {R: 255, G: 100, B: 100, A: 0xff},
+		"gold":      {R: 200, G: 200, B: 0, A: 0xff},
+		"rose":      {R: 200, G: 150, B: 200, A: 0xff},
+		"darkblue":  {R: 0, G: 0, B: 255, A: 0xff},
+		"darkgreen": {R: 0, G: 255, B: 0, A: 0xff},
+		"darkred":   {R: 255, G: 0, B: 0, A: 0xff},
+		"darkgray":  {R: 111, G: 111, B: 111, A: 0xff},
+		"darkgrey":  {R: 111, G: 111, B: 111, A: 0xff},
+	}
+
+	// defaultColorList is the graphite-web default colorList
+	defaultColorList = []string{"blue", "green", "red", "purple", "brown", "yellow", "aqua", "grey", "magenta", "pink", "gold", "rose"}
+
+	// timeIntervals are the candidates intervals between two x axis ticks
+	timeIntervals = []time.Duration{
+		time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+		time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+		24 * time.Hour, 2 * 24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour,
+	}
+)
+
+// GraphOptions are the render parameters used to draw png and svg graphs
+// https://graphite.readthedocs.io/en/latest/render_api.html#graph-parameters
+type GraphOptions struct {
+	Width     int
+	Height    int
+	Title     string
+	YMin      string
+	YMax      string
+	AreaMode  string
+	LineMode  string
+	ColorList string
+	BgColor   string
+	FgColor   string
+}
+
+// graphSeries is a series ready to be drawn
+type graphSeries struct {
+	name        string
+	points      [][]float64
+	color       color.RGBA
+	lineWidth   float64
+	dash        float64
+	secondYAxis bool
+	stacked     bool
+}
+
+// axis is a linear scale between min and max
+type axis struct {
+	min   float64
+	max   float64
+	ticks []float64
+}
+
+// ----------------------------------------------------------------------------
+// helper functions
+
+// parseColor parse a graphite color which is either a named color or an
+// hexadecimal RRGGBB or RRGGBBAA value
+func parseColor(value string) (color.RGBA, error) {
+	if c, ok := colorAliases[strings.ToLower(value)]; ok {
+		return c, nil
+	}
+
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return color.RGBA{}, fmt.Errorf("Unknown color %s", value)
+	}
+
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	rgba, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("Unknown color %s", value)
+	}
+
+	return color.RGBA{R: uint8(rgba >> 24), G: uint8(rgba >> 16), B: uint8(rgba >> 8), A: uint8(rgba)}, nil
+}
+
+// niceStep return a round step to split a range in about count intervals
+func niceStep(span float64, count int) float64 {
+	if span <= 0 {
+		return 1
+	}
+
+	raw := span / float64(count)
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, factor := range []float64{1, 2, 2.5, 5, 10} {
+		if raw <= factor*magnitude {
+			return factor * magnitude
+		}
+	}
+
+	return 10 * magnitude
+}
+
+// newAxis build a y axis containing all values, bounds may be forced
+func newAxis(values []float64, yMin, yMax string) (*axis, error) {
+	a := &axis{min: math.Inf(1), max: math.Inf(-1)}
+	for _, value := range values {
+		a.min = math.Min(a.min, value)
+		a.max = math.Max(a.max, value)
+	}
+
+	if math.IsInf(a.min, 1) {
+		a.min, a.max = 0, 1
+	}
+
+	// graphite draws the y axis from zero for positive values
+	if a.min > 0 {
+		a.min = 0
+	}
+
+	if a.min == a.max {
+		a.max = a.min + 1
+	}
+
+	step := niceStep(a.max-a.min, 5)
+	a.min = math.Floor(a.min/step) * step
+	a.max = math.Ceil(a.max/step) * step
+
+	if len(yMin) != 0 {
+		min, err := strconv.ParseFloat(yMin, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Expect yMin %s to be a number", yMin)
+		}
+
+		a.min = min
+	}
+
+	if len(yMax) != 0 {
+		max, err := strconv.ParseFloat(yMax, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Expect yMax %s to be a number", yMax)
+		}
+
+		a.max = max
+	}
+
+	if a.max <= a.min {
+		return nil, errors.New("yMax has to be greater than yMin")
+	}
+
+	if math.IsInf(a.min, 0) || math.IsNaN(a.min) || math.IsInf(a.max, 0) || math.IsNaN(a.max) {
+		return nil, errors.New("yMin and yMax have to be finite numbers")
+	}
+
+	// Ticks are computed from their index, as a step below the float64
+	// precision of the bounds would never move an accumulated tick
+	step = niceStep(a.max-a.min, 5)
+	start := math.Ceil(a.min/step) * step
+	for i := 0; i < maxAxisTicks; i++ {
+		tick := start + float64(i)*step
+		if tick > a.max+step/1e6 || (i > 0 && tick == a.ticks[len(a.ticks)-1]) {
+			break
+		}
+
+		a.ticks = append(a.ticks, tick)
+	}
+
+	return a, nil
+}
+
+// formatValue return a short label of a value, using SI prefixes
+func formatValue(value float64) string {
+	abs := math.Abs(value)
+	for _, unit := range []struct {
+		factor float64
+		prefix string
+	}{{1e12, "T"}, {1e9, "G"}, {1e6, "M"}, {1e3, "K"}} {
+		if abs >= unit.factor {
+			return strconv.FormatFloat(value/unit.factor, 'f', -1, 64) + unit.prefix
+		}
+	}
+
+	return strconv.FormatFloat(value, 'g', 6, 64)
+}
+
+// toGraphSeries resolve the style of the series to draw
+func toGraphSeries(gtss []GTS, colors []string) ([]graphSeries, error) {
+	series := make([]graphSeries, 0)
+	for i, gts := range gtss {
+		gts.sortValues()
+
+		name := gts.ClassName
+		if labels := gts.toGraphiteLabels(); len(labels) > 0 {
+			name = fmt.Sprintf("%s;%s", name, labels)
+		}
+
+		s := graphSeries{
+			name:        name,
+			points:      gts.Values,
+			lineWidth:   1,
+			secondYAxis: gts.Attributes[secondYAxisAttribute] == "true",
+			stacked:     gts.Attributes[stackedAttribute] == "true",
+		}
+
+		colorName := colors[i%len(colors)]
+		if c, ok := gts.Attributes[colorAttribute]; ok {
+			colorName = c
+		}
+
+		c, err := parseColor(colorName)
+		if err != nil {
+			return nil, err
+		}
+		s.color = c
+
+		if width, err := strconv.ParseFloat(gts.Attributes[lineWidthAttribute], 64); err == nil {
+			s.lineWidth = width
+		}
+
+		if dash, err := strconv.ParseFloat(gts.Attributes[dashedAttribute], 64); err == nil {
+			s.dash = dash
+		}
+
+		series = append(series, s)
+	}
+
+	return series, nil
+}
+
+// stack add to each stacked series the values of the previous stacked ones
+// and return the bottom of each stacked series
+func stack(series []graphSeries, areaMode string) map[int][][]float64 {
+	bottoms := make(map[int][][]float64)
+	totals := map[bool]map[float64]float64{false: {}, true: {}}
+
+	for i, s := range series {
+		if !s.stacked && areaMode != areaModeStacked {
+			continue
+		}
+
+		total := totals[s.secondYAxis]
+		bottom := make([][]float64, 0)
+		points := make([][]float64, 0)
+		for _, p := range s.points {
+			bottom = append(bottom, []float64{p[0], total[p[0]]})
+			total[p[0]] += p[1]
+			points = append(points, []float64{p[0], total[p[0]]})
+		}
+
+		series[i].points = points
+		bottoms[i] = bottom
+	}
+
+	return bottoms
+}
+
+// segments split the points of a series in continuous lines, datapoints
+// separated by more than a step are not connected unless in connected mode
+func segments(points [][]float64, lineMode string) [][][]float64 {
+	result := make([][][]float64, 0)
+	if len(points) == 0 {
+		return result
+	}
+
+	step := math.Inf(1)
+	for i := 1; i < len(points); i++ {
+		if gap := points[i][0] - points[i-1][0]; gap > 0 {
+			step = math.Min(step, gap)
+		}
+	}
+
+	current := [][]float64{points[0]}
+	for i := 1; i < len(points); i++ {
+		if lineMode != lineModeConnected && points[i][0]-points[i-1][0] > step {
+			result = append(result, current)
+			current = make([][]float64, 0)
+		}
+
+		current = append(current, points[i])
+	}
+
+	return append(result, current)
+}
+
+// ----------------------------------------------------------------------------
+// rendering
+
+// Graph draw series as a png or svg image
+// nolint: gocyclo
+func Graph(gtss []GTS, format string, options GraphOptions) ([]byte, error) {
+	if options.Width <= 0 {
+		options.Width = defaultGraphWidth
+	}
+
+	if options.Height <= 0 {
+		options.Height = defaultGraphHeight
+	}
+
+	if len(options.AreaMode) == 0 {
+		options.AreaMode = areaModeNone
+	}
+
+	if len(options.LineMode) == 0 {
+		options.LineMode = lineModeSlope
+	}
+
+	switch options.AreaMode {
+	case areaModeNone, areaModeFirst, areaModeAll, areaModeStacked:
+	default:
+		return nil, fmt.Errorf("The areaMode %s is not supported", options.AreaMode)
+	}
+
+	switch options.LineMode {
+	case lineModeSlope, lineModeStaircase, lineModeConnected:
+	default:
+		return nil, fmt.Errorf("The lineMode %s is not supported", options.LineMode)
+	}
+
+	if len(options.BgColor) == 0 {
+		options.BgColor = "black"
+	}
+
+	if len(options.FgColor) == 0 {
+		options.FgColor = "white"
+	}
+
+	colors := defaultColorList
+	if len(options.ColorList) != 0 {
+		colors = strings.Split(options.ColorList, ",")
+	}
+
+	background, err := parseColor(options.BgColor)
+	if err != nil {
+		return nil, err
+	}
+
+	foreground, err := parseColor(options.FgColor)
+	if err != nil {
+		return nil, err
+	}
+
+	grid := color.RGBA{R: foreground.R, G: foreground.G, B: foreground.B, A: 0x40}
+
+	var c canvas
+	switch format {
+	case "png":
+		c = newPNGCanvas(options.Width, options.Height, background)
+	case "svg":
+		c = newSVGCanvas(options.Width, options.Height, background)
+	default:
+		return nil, fmt.Errorf("The graph format %s is not supported", format)
+	}
+
+	series, err := toGraphSeries(gtss, colors)
+	if err != nil {
+		return nil, err
+	}
+
+	bottoms := stack(series, options.AreaMode)
+
+	// Layout: title on top, legend at the bottom
+	top := float64(graphPadding)
+	if len(options.Title) != 0 {
+		c.text(float64(options.Width)/2, top+fontHeight, options.Title, foreground, anchorMiddle)
+		top += fontHeight + graphPadding
+	}
+
+	bottom := float64(options.Height - graphPadding)
+	legend := float64(len(series) * legendHeight)
+	if legend < float64(options.Height)/2 {
+		for i, s := range series {
+			y := bottom - legend + float64(i*legendHeight) + fontHeight
+			c.fill([]point{{X: graphPadding, Y: y - 7}, {X: graphPadding + 8, Y: y - 7}, {X: graphPadding + 8, Y: y + 1}, {X: graphPadding, Y: y + 1}}, s.color)
+			c.text(graphPadding+12, y, s.name, foreground, anchorStart)
+		}
+
+		bottom -= legend + graphPadding/2
+	}
+
+	// x axis labels are drawn under the plot
+	bottom -= fontHeight + tickLength
+
+	hasData := false
+	var start, end float64
+	values := map[bool][]float64{false: {}, true: {}}
+	for i, s := range series {
+		for _, p := range s.points {
+			if !hasData || p[0] < start {
+				start = p[0]
+			}
+
+			if !hasData || p[0] > end {
+				end = p[0]
+			}
+
+			hasData = true
+			values[s.secondYAxis] = append(values[s.secondYAxis], p[1])
+		}
+
+		for _, p := range bottoms[i] {
+			values[s.secondYAxis] = append(values[s.secondYAxis], p[1])
+		}
+	}
+
+	if !hasData {
+		c.text(float64(options.Width)/2, (top+bottom)/2, "No Data", foreground, anchorMiddle)
+		return c.encode()
+	}
+
+	if end == start {
+		end = start + 60*1e6
+	}
+
+	axes := make(map[bool]*axis)
+	for _, second := range []bool{false, true} {
+		if second && len(values[second]) == 0 {
+			continue
+		}
+
+		// yMin and yMax only apply to the left axis
+		yMin, yMax := options.YMin, options.YMax
+		if second {
+			yMin, yMax = "", ""
+		}
+
+		axes[second], err = newAxis(values[second], yMin, yMax)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	labelWidth := func(a *axis) float64 {
+		width := 0.0
+		for _, tick := range a.ticks {
+			width = math.Max(width, textWidth(formatValue(tick)))
+		}
+
+		return width + tickLength + 2
+	}
+
+	left := graphPadding + labelWidth(axes[false])
+	right := float64(options.Width - graphPadding)
+	if a, ok := axes[true]; ok {
+		right -= labelWidth(a)
+	}
+
+	if right-left < 1 || bottom-top < 1 {
+		return nil, errors.New("The graph is too small to be drawn")
+	}
+
+	x := func(ts float64) float64 {
+		return left + (ts-start)/(end-start)*(right-left)
+	}
+
+	y := func(a *axis, value float64) float64 {
+		value = math.Max(math.Min(value, a.max), a.min)
+		return bottom - (value-a.min)/(a.max-a.min)*(bottom-top)
+	}
+
+	// y axes and horizontal grid
+	for second, a := range axes {
+		for _, tick := range a.ticks {
+			ty := y(a, tick)
+			if second {
+				c.line([]point{{X: right, Y: ty}, {X: right + tickLength, Y: ty}}, foreground, 1, 0)
+				c.text(right+tickLength+2, ty+fontHeight/2-1, formatValue(tick), foreground, anchorStart)
+				continue
+			}
+
+			c.line([]point{{X: left, Y: ty}, {X: right, Y: ty}}, grid, 1, 0)
+			c.text(left-tickLength-2, ty+fontHeight/2-1, formatValue(tick), foreground, anchorEnd)
+		}
+	}
+
+	// x axis and vertical grid
+	duration := time.Duration(end-start) * time.Microsecond
+	interval := timeIntervals[len(timeIntervals)-1]
+	for _, candidate := range timeIntervals {
+		if float64(duration/candidate) <= (right-left)/60 {
+			interval = candidate
+			break
+		}
+	}
+
+	layout := "15:04"
+	if duration > 2*24*time.Hour {
+		layout = "01/02"
+	}
+
+	for tick := time.Unix(0, int64(start)*1000).UTC().Truncate(interval); !tick.After(time.Unix(0, int64(end)*1000)); tick = tick.Add(interval) {
+		ts := float64(tick.UnixNano() / 1000)
+		if ts < start {
+			continue
+		}
+
+		tx := x(ts)
+		c.line([]point{{X: tx, Y: top}, {X: tx, Y: bottom}}, grid, 1, 0)
+		c.line([]point{{X: tx, Y: bottom}, {X: tx, Y: bottom + tickLength}}, foreground, 1, 0)
+		c.text(tx, bottom+tickLength+fontHeight, tick.Format(layout), foreground, anchorMiddle)
+	}
+
+	c.line([]point{{X: left, Y: top}, {X: left, Y: bottom}, {X: right, Y: bottom}}, foreground, 1, 0)
+	if _, ok := axes[true]; ok {
+		c.line([]point{{X: right, Y: top}, {X: right, Y: bottom}}, foreground, 1, 0)
+	}
+
+	// series
+	for i, s := range series {
+		a := axes[s.secondYAxis]
+		for _, segment := range segments(s.points, options.LineMode) {
+			line := make([]point, 0)
+			for j, p := range segment {
+				if options.LineMode == lineModeStaircase && j > 0 {
+					line = append(line, point{X: x(p[0]), Y: y(a, segment[j-1][1])})
+				}
+
+				line = append(line, point{X: x(p[0]), Y: y(a, p[1])})
+			}
+
+			filled := s.stacked || options.AreaMode == areaModeAll || options.AreaMode == areaModeStacked || (options.AreaMode == areaModeFirst && i == 0)
+			if filled {
+				area := append([]point{}, line...)
+				if base, ok := bottoms[i]; ok {
+					// the area of a stacked series lies on the previous ones
+					for j := len(base) - 1; j >= 0; j-- {
+						if base[j][0] >= segment[0][0] && base[j][0] <= segment[len(segment)-1][0] {
+							area = append(area, point{X: x(base[j][0]), Y: y(a, base[j][1])})
+						}
+					}
+				} else {
+					zero := y(a, 0)
+					area = append(area, point{X: line[len(line)-1].X, Y: zero}, point{X: line[0].X, Y: zero})
+				}
+
+				c.fill(area, s.color)
+			}
+
+			c.line(line, s.color, s.lineWidth, s.dash)
+		}
+	}
+
+	return c.encode()
+}
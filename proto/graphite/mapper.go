@@ -2,6 +2,8 @@ package graphite
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
 
 	"github.com/ovh/erlenmeyer/core"
 )
@@ -183,6 +185,80 @@ func scale(node *core.Node, args []string, kwargs map[string]string) (*core.Node
 	return node.Left, nil
 }
 
+// moving apply a mapper over a sliding window, the window is either a number
+// of datapoints or a time interval
+func moving(node *core.Node, args []string, kwargs map[string]string, mapper string) (*core.Node, error) {
+	preWindow := ""
+	if points, err := strconv.Atoi(args[1]); err == nil {
+		if points < 1 {
+			return nil, fmt.Errorf("The window size of %s must be a positive number of points", kwargs["func"])
+		}
+
+		preWindow = strconv.Itoa(points - 1)
+	} else {
+		t, err := convertTimeToWarpScript(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		// A negative pre window is a time span
+		preWindow = fmt.Sprintf("%s -1 *", *t)
+	}
+
+	node.Left = core.NewNode(core.MapperPayload{
+		Mapper:      mapper,
+		Occurrences: "0",
+		PostWindow:  "0",
+		PreWindow:   preWindow,
+	})
+
+	if args[0] != swap {
+		return fetch(node.Left, []string{args[0], kwargs["from"], kwargs["until"]}, kwargs)
+	}
+
+	return node.Left, nil
+}
+
+func movingAverage(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 2 {
+		return nil, errors.New("The movingAverage function take two parameters which are a list of series and a window size")
+	}
+
+	return moving(node, args, kwargs, "mean")
+}
+
+func movingMax(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 2 {
+		return nil, errors.New("The movingMax function take two parameters which are a list of series and a window size")
+	}
+
+	return moving(node, args, kwargs, "max")
+}
+
+func movingMedian(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 2 {
+		return nil, errors.New("The movingMedian function take two parameters which are a list of series and a window size")
+	}
+
+	return moving(node, args, kwargs, "median")
+}
+
+func movingMin(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 2 {
+		return nil, errors.New("The movingMin function take two parameters which are a list of series and a window size")
+	}
+
+	return moving(node, args, kwargs, "min")
+}
+
+func movingSum(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 2 {
+		return nil, errors.New("The movingSum function take two parameters which are a list of series and a window size")
+	}
+
+	return moving(node, args, kwargs, "sum")
+}
+
 func scaleToSeconds(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
 	if len(args) < 1 {
 		return nil, errors.New("The scaleToSeconds function take at least one parameter which is a list of series and optionally a number")
@@ -306,6 +382,79 @@ func divideSeriesLists(node *core.Node, args []string, kwargs map[string]string)
 	return divideCore(node, args, kwargs, warpScript)
 }
 
+func asPercent(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 1 {
+		return nil, errors.New("The asPercent function take at least one parameter which is a list of series and optionally a total")
+	}
+	if len(args) > 2 {
+		return nil, errors.New("The asPercent function does not support grouping by nodes")
+	}
+
+	// Total is a number
+	if len(args) >= 2 {
+		if _, err := strconv.ParseFloat(args[1], 64); err == nil {
+			node.Left = core.NewNode(core.MapperPayload{
+				Mapper:      "mul",
+				Constant:    "100.0 " + args[1] + " TODOUBLE /",
+				Occurrences: "0",
+				PostWindow:  "0",
+				PreWindow:   "0",
+			})
+
+			if args[0] != swap {
+				return fetch(node.Left, []string{args[0], kwargs["from"], kwargs["until"]}, kwargs)
+			}
+
+			return node.Left, nil
+		}
+	}
+
+	warpScript := `
+		// A singleton total is used for each series, otherwise totals are matched by index
+		<% $right SIZE 1 == %>
+		<% [] 0 $left SIZE 1 - <% DROP $right 0 GET +! %> FOR 'right' STORE %>
+		IFT
+
+		<% $right SIZE $left SIZE != %>
+		<% 'asPercent need totalSeries to be a singleton or to have the same length as seriesList' MSGFAIL %>
+		IFT
+
+		$left
+		<%
+			'index' STORE
+			'series' STORE
+			[ $series CLONEEMPTY ]
+			[
+				[ $series ]
+				[ $right $index GET '%2B.totalSeries' RENAME ]
+				[]
+				op.div
+			]
+			APPLY
+			APPEND
+			MERGE
+		%>
+		LMAP
+		[ SWAP 100.0 mapper.mul 0 0 0 ] MAP`
+
+	// Total is the sum of all series
+	if len(args) == 1 {
+		node.Left = core.NewNode(core.WarpScriptPayload{
+			WarpScript: `
+		DUP 'left' STORE
+		[ SWAP [] reducer.sum ] REDUCE 'right' STORE` + warpScript,
+		})
+
+		if args[0] != swap {
+			return fetch(node.Left, []string{args[0], kwargs["from"], kwargs["until"]}, kwargs)
+		}
+
+		return node.Left, nil
+	}
+
+	return divideCore(node, args, kwargs, warpScript)
+}
+
 // divideCore manages all possible cases for args 0 (resp 1) being a fetch or intermediary query result
 func divideCore(node *core.Node, args []string, kwargs map[string]string, warpScript string) (*core.Node, error) {
 	var err error
@@ -10,6 +10,9 @@ import (
 )
 
 const (
+	// selectionParameter prefix the parameters holding the WarpScript of a selection
+	selectionParameter = "selection:"
+
 	opEq        = "="
 	opRegExp    = "=~"
 	opNotEq     = "!="
@@ -40,6 +43,22 @@ type Function struct {
 
 // Parse a graphite query
 func Parse(target, from, until string, node *core.Node) (*core.Node, error) {
+	return parse(target, from, until, map[string]string{}, node)
+}
+
+// ParseSelections parse a graphite query whose series are names of
+// selections, a selection is a WarpScript pushing a list of series. It allows
+// other protocols to apply graphite functions to their own series
+func ParseSelections(target string, selections map[string]string, node *core.Node) (*core.Node, error) {
+	parameters := make(map[string]string)
+	for name, selection := range selections {
+		parameters[selectionParameter+name] = selection
+	}
+
+	return parse(target, "", "", parameters, node)
+}
+
+func parse(target, from, until string, parameters map[string]string, node *core.Node) (*core.Node, error) {
 	var err error
 
 	stack := make([]Function, 0)
@@ -57,6 +76,10 @@ func Parse(target, from, until string, node *core.Node) (*core.Node, error) {
 	}
 
 	for _, element := range stack {
+		for key, value := range parameters {
+			element.Parameters[key] = value
+		}
+
 		element.Parameters["target"] = target
 		element.Parameters["from"] = from
 		element.Parameters["until"] = until
@@ -218,6 +241,63 @@ func parseLabels(args []string) (map[string]string, error) {
 	return labels, nil
 }
 
+// parseTagExpressions transform graphite tag expressions into a Warp 10 selector
+func parseTagExpressions(exprs []string) (string, map[string]string, error) {
+	serie := "~.*"
+	labels := make(map[string]string)
+	for _, expr := range exprs {
+		name, op, value, err := splitTagExpression(expr)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if name == "name" {
+			serie = tagSelector(op, value)
+		} else {
+			labels[name] = tagSelector(op, value)
+		}
+	}
+
+	return serie, labels, nil
+}
+
+// splitTagExpression split a graphite tag expression on its first operator, as
+// values may contain '='
+func splitTagExpression(expr string) (string, string, string, error) {
+	index := strings.Index(expr, opEq)
+	if index <= 0 {
+		return "", "", "", fmt.Errorf("Tag expression %s is not well formatted", expr)
+	}
+
+	name, op, rest := expr[:index], opEq, expr[index+len(opEq):]
+	if strings.HasSuffix(name, "!") {
+		name, op = name[:len(name)-1], opNotEq
+	}
+	if strings.HasPrefix(rest, "~") {
+		op, rest = op+"~", rest[1:]
+	}
+	if len(name) == 0 {
+		return "", "", "", fmt.Errorf("Tag expression %s is not well formatted", expr)
+	}
+
+	return name, op, rest, nil
+}
+
+// tagSelector return the Warp 10 selector of a graphite tag expression. Graphite
+// regular expressions match from the start of the value whereas Warp 10 ones match
+// the whole value, and negations are anchored so tag!=foo still matches foobar
+func tagSelector(op, value string) string {
+	switch op {
+	case opNotRegExp:
+		return fmt.Sprintf("~(?!(?:%s)).*", value)
+	case opNotEq:
+		return fmt.Sprintf("~(?!%s$).*", regexp.QuoteMeta(value))
+	case opRegExp:
+		return fmt.Sprintf("~(?:%s).*", value)
+	}
+	return value
+}
+
 func toWarpScriptRegExp(serie string) string {
 	serie = strings.Replace(serie, ".", "\\.", -1)
 	serie = strings.Replace(serie, "*", ".*?", -1)
@@ -1,8 +1,10 @@
 package graphite_test
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/ovh/erlenmeyer/core"
 	"github.com/ovh/erlenmeyer/proto/graphite"
 )
 
@@ -42,6 +44,29 @@ func TestParseSerie(t *testing.T) {
 	}
 }
 
+func TestParseSelections(t *testing.T) {
+	selections := map[string]string{
+		"first":  "$first",
+		"second": "$second",
+	}
+
+	root := core.NewEmptyNode()
+	if _, err := graphite.ParseSelections("divideSeries(scale(first, 2), second)", selections, root); err != nil {
+		t.Fatal(err)
+	}
+
+	ws := root.ToWarpScript("token", "", "")
+	for _, shouldContain := range []string{"$first", "$second", "[ SWAP 2 mapper.mul 0 0 0 ] MAP"} {
+		if !strings.Contains(ws, shouldContain) {
+			t.Errorf("selections does not contain this warpscript: %s but\n %s", shouldContain, ws)
+		}
+	}
+
+	if strings.Contains(ws, "FETCH") {
+		t.Errorf("selections should not be fetched:\n %s", ws)
+	}
+}
+
 var seriesTest = []serieTest{
 	{
 		Is:       "*",
@@ -96,6 +121,86 @@ var seriesTest = []serieTest{
 	},
 }
 
+type queryTest struct {
+	Query     string
+	Functions []graphite.Function
+}
+
+func TestParseQuery(t *testing.T) {
+	for _, test := range queriesTest {
+		functions, err := graphite.ParseQuery(test.Query)
+		if err != nil {
+			t.Error(err)
+
+			continue
+		}
+
+		if len(functions) != len(test.Functions) {
+			t.Errorf("%s: functions have not the same length", test.Query)
+
+			continue
+		}
+
+		for i, function := range test.Functions {
+			if function.Name != functions[i].Name {
+				t.Errorf("%s - %d: function has not the same name", function.Name, i)
+
+				continue
+			}
+
+			if len(function.Arguments) != len(functions[i].Arguments) {
+				t.Errorf("%s - %d: %s: function has not the same argument length", function.Name, i, test.Query)
+
+				continue
+			}
+
+			for j, argument := range function.Arguments {
+				if argument != functions[i].Arguments[j] {
+					t.Errorf("%s - %d - %d: argument is not the good one: %s != %s", function.Name, i, j, argument, functions[i].Arguments[j])
+				}
+			}
+		}
+	}
+}
+
+var queriesTest = []queryTest{
+	{
+		Query: `reduceSeries(mapSeries(servers.*.disk.*, 1), "asPercent", 3, "used", "total")`,
+		Functions: []graphite.Function{
+			{
+				Name:      "mapSeries",
+				Arguments: []string{"servers.*.disk.*", "1"},
+			},
+			{
+				Name:      "reduceSeries",
+				Arguments: []string{swap, "asPercent", "3", "used", "total"},
+			},
+		},
+	},
+	{
+		Query: `applyByNode(servers.*.disk.used, 1, "divideSeries(%.disk.used, %.disk.total)", "%.disk.ratio")`,
+		Functions: []graphite.Function{
+			{
+				Name:      "applyByNode",
+				Arguments: []string{"servers.*.disk.used", "1", "divideSeries(%.disk.used, %.disk.total)", "%.disk.ratio"},
+			},
+		},
+	},
+	{
+		Query: `groupByTags(seriesByTag('name=os.cpu'), 'sum', 'dc')`,
+		Functions: []graphite.Function{
+			{
+				Name:      "seriesByTag",
+				Arguments: []string{"name=os.cpu"},
+			},
+			{
+				Name:      "groupByTags",
+				Arguments: []string{swap, "sum", "dc"},
+			},
+		},
+	},
+}
+
 // type test struct {
 // 	Query     string
 // 	Functions []graphite.Function
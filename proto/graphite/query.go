@@ -2,8 +2,10 @@ package graphite
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -236,6 +238,139 @@ func (s *IndexQuery) Parse(req *http.Request) error {
 	return nil
 }
 
+// FunctionsQuery which is used by the /functions path
+// https://graphite.readthedocs.io/en/latest/functions.html#function-api
+type FunctionsQuery struct {
+	Pretty bool   `json:"pretty" description:"Indent the JSON response"`
+	JSONP  string `json:"jsonp" description:"Wraps the response in a JSONP callback"`
+}
+
+// Parse method is an implementation of Parser
+func (s *FunctionsQuery) Parse(req *http.Request) error {
+	switch req.Header.Get(contentType) {
+	case mimeJSON:
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(body, s); err != nil {
+			return err
+		}
+	case mimeForm:
+		if err := req.ParseForm(); err != nil {
+			return err
+		}
+
+		for key, val := range req.Form {
+			switch key {
+			case "pretty":
+				s.Pretty = val[0] != "0" && val[0] != "false"
+			case "jsonp":
+				s.JSONP = val[0]
+			}
+		}
+	}
+
+	params := req.URL.Query()
+	if len(params.Get("pretty")) != 0 {
+		s.Pretty = params.Get("pretty") != "0" && params.Get("pretty") != "false"
+	}
+
+	if len(params.Get("jsonp")) != 0 {
+		s.JSONP = params.Get("jsonp")
+	}
+
+	return nil
+}
+
+// TagsQuery which is used by the /tags paths
+// https://graphite.readthedocs.io/en/latest/tags.html#exploring-tags
+type TagsQuery struct {
+	Expr        []string `json:"expr" description:"Tag expressions series have to match. Can be specified multiple times."`
+	Tag         string   `json:"tag" description:"The tag to autocomplete values of."`
+	TagPrefix   string   `json:"tagPrefix" description:"Prefix of the tags to autocomplete."`
+	ValuePrefix string   `json:"valuePrefix" description:"Prefix of the values to autocomplete."`
+	Filter      string   `json:"filter" description:"Regular expression the tags or values have to match."`
+	Limit       int      `json:"limit" description:"Maximum number of results."`
+	JSONP       string   `json:"jsonp" description:"Wraps the response in a JSONP callback"`
+}
+
+// Parse method is an implementation of Parser
+// nolint: gocyclo
+func (s *TagsQuery) Parse(req *http.Request) error {
+	var err error
+
+	switch req.Header.Get(contentType) {
+	case mimeJSON:
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+
+		if err = json.Unmarshal(body, s); err != nil {
+			return err
+		}
+	case mimeForm:
+		if err = req.ParseForm(); err != nil {
+			return err
+		}
+
+		for key, val := range req.Form {
+			switch key {
+			case "expr":
+				s.Expr = val
+			case "tag":
+				s.Tag = val[0]
+			case "tagPrefix":
+				s.TagPrefix = val[0]
+			case "valuePrefix":
+				s.ValuePrefix = val[0]
+			case "filter":
+				s.Filter = val[0]
+			case "jsonp":
+				s.JSONP = val[0]
+			case "limit":
+				s.Limit, err = strconv.Atoi(val[0])
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	params := req.URL.Query()
+	s.Expr = append(s.Expr, params["expr"]...)
+	if len(params.Get("tag")) != 0 {
+		s.Tag = params.Get("tag")
+	}
+
+	if len(params.Get("tagPrefix")) != 0 {
+		s.TagPrefix = params.Get("tagPrefix")
+	}
+
+	if len(params.Get("valuePrefix")) != 0 {
+		s.ValuePrefix = params.Get("valuePrefix")
+	}
+
+	if len(params.Get("filter")) != 0 {
+		s.Filter = params.Get("filter")
+	}
+
+	if len(params.Get("jsonp")) != 0 {
+		s.JSONP = params.Get("jsonp")
+	}
+
+	if len(params.Get("limit")) != 0 {
+		s.Limit, err = strconv.Atoi(params.Get("limit"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // RenderQuery which is used by the /render path
 // http://graphite-api.readthedocs.io/en/latest/api.html#the-render-api-render
 type RenderQuery struct {
@@ -244,11 +379,78 @@ type RenderQuery struct {
 	Until  string   `json:"until" description:"... until specifies the end"`
 	Format string   `json:"format" description:"Controls the format of data returned Affects all targets passed in the URL."`
 	JSONP  string   `json:"jsonp" description:"Wraps the response in a JSONP callback"`
+
+	MaxDataPoints int    `json:"maxDataPoints" description:"Consolidate series to return at most this number of datapoints"`
+	NoNullPoints  bool   `json:"noNullPoints" description:"Omit series without datapoints"`
+	XFilesFactor  string `json:"xFilesFactor" description:"Ratio of known datapoints required to consolidate a datapoint"`
+
+	Width     int    `json:"width" description:"Width of the png and svg graphs in pixels"`
+	Height    int    `json:"height" description:"Height of the png and svg graphs in pixels"`
+	Title     string `json:"title" description:"Title of the graph"`
+	YMin      string `json:"yMin" description:"Lower bound of the y axis"`
+	YMax      string `json:"yMax" description:"Upper bound of the y axis"`
+	AreaMode  string `json:"areaMode" description:"Fill the area under series: none, first, all or stacked"`
+	LineMode  string `json:"lineMode" description:"Draw series as slope, staircase or connected lines"`
+	ColorList string `json:"colorList" description:"Comma separated colors used to draw series"`
+	BgColor   string `json:"bgcolor" description:"Background color of the graph"`
+	FgColor   string `json:"fgcolor" description:"Foreground color of the graph"`
+}
+
+// graphOptions return the graph parameters of the query
+func (s *RenderQuery) graphOptions() GraphOptions {
+	return GraphOptions{
+		Width:     s.Width,
+		Height:    s.Height,
+		Title:     s.Title,
+		YMin:      s.YMin,
+		YMax:      s.YMax,
+		AreaMode:  s.AreaMode,
+		LineMode:  s.LineMode,
+		ColorList: s.ColorList,
+		BgColor:   s.BgColor,
+		FgColor:   s.FgColor,
+	}
+}
+
+// parseGraphParams parse the graph parameters from form or url values
+func (s *RenderQuery) parseGraphParams(values url.Values) error {
+	var err error
+
+	if len(values.Get("width")) != 0 {
+		if s.Width, err = strconv.Atoi(values.Get("width")); err != nil {
+			return err
+		}
+	}
+
+	if len(values.Get("height")) != 0 {
+		if s.Height, err = strconv.Atoi(values.Get("height")); err != nil {
+			return err
+		}
+	}
+
+	for key, field := range map[string]*string{
+		"title":     &s.Title,
+		"yMin":      &s.YMin,
+		"yMax":      &s.YMax,
+		"areaMode":  &s.AreaMode,
+		"lineMode":  &s.LineMode,
+		"colorList": &s.ColorList,
+		"bgcolor":   &s.BgColor,
+		"fgcolor":   &s.FgColor,
+	} {
+		if len(values.Get(key)) != 0 {
+			*field = values.Get(key)
+		}
+	}
+
+	return nil
 }
 
 // Parse method is an implementation of Parser
 // nolint: gocyclo
 func (s *RenderQuery) Parse(req *http.Request) error {
+	var err error
+
 	template := make(map[string]string)
 	switch req.Header.Get(contentType) {
 	case mimeJSON:
@@ -277,6 +479,15 @@ func (s *RenderQuery) Parse(req *http.Request) error {
 				s.From = val[0]
 			case "until":
 				s.Until = val[0]
+			case "maxDataPoints":
+				s.MaxDataPoints, err = strconv.Atoi(val[0])
+				if err != nil {
+					return err
+				}
+			case "noNullPoints":
+				s.NoNullPoints = val[0] != "0" && val[0] != "false"
+			case "xFilesFactor":
+				s.XFilesFactor = val[0]
 			}
 
 			if templateMatcher.MatchString(key) {
@@ -285,14 +496,48 @@ func (s *RenderQuery) Parse(req *http.Request) error {
 				template[name[1]] = val[0]
 			}
 		}
+
+		if err = s.parseGraphParams(req.Form); err != nil {
+			return err
+		}
 	}
 
 	params := req.URL.Query()
 	s.Target = append(s.Target, params["target"]...)
-	if len(s.Format) != 0 {
+	if err = s.parseGraphParams(params); err != nil {
+		return err
+	}
+
+	if len(params.Get("format")) != 0 {
 		s.Format = params.Get("format")
 	}
 
+	if len(params.Get("maxDataPoints")) != 0 {
+		s.MaxDataPoints, err = strconv.Atoi(params.Get("maxDataPoints"))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(params.Get("noNullPoints")) != 0 {
+		s.NoNullPoints = params.Get("noNullPoints") != "0" && params.Get("noNullPoints") != "false"
+	}
+
+	if len(params.Get("xFilesFactor")) != 0 {
+		s.XFilesFactor = params.Get("xFilesFactor")
+	}
+
+	if len(s.XFilesFactor) != 0 {
+		if _, err = strconv.ParseFloat(s.XFilesFactor, 64); err != nil {
+			return err
+		}
+	}
+
+	// bound the graph size, as the png canvas is allocated upfront
+	if s.Width < 0 || s.Width > maxGraphSize || s.Height < 0 || s.Height > maxGraphSize {
+		return fmt.Errorf("Expect width and height to be between 1 and %d", maxGraphSize)
+	}
+
 	if len(params.Get("jsonp")) != 0 {
 		s.JSONP = params.Get("jsonp")
 	}
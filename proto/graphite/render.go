@@ -9,6 +9,16 @@ import (
 	"github.com/ovh/erlenmeyer/middlewares"
 )
 
+var (
+	// formatContentTypes are the content types of the binary render formats
+	formatContentTypes = map[string]string{
+		"pickle":  "application/pickle",
+		"msgpack": "application/x-msgpack",
+		"png":     "image/png",
+		"svg":     "image/svg+xml",
+	}
+)
+
 // Render graphite handler (/render)
 // http://graphite-api.readthedocs.io/en/latest/api.html#the-render-api-render
 func Render(w http.ResponseWriter, r *http.Request) {
@@ -49,10 +59,45 @@ func Render(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		for i := range gtss[0] {
+			gtss[0][i].pathExpression = target
+		}
+
 		gts = append(gts, gtss[0]...)
 	}
 
-	result, err := Format(gts, q.Format)
+	// graphs are consolidated to one datapoint per pixel like graphite-web does
+	maxDataPoints := q.MaxDataPoints
+	if maxDataPoints == 0 && (q.Format == "png" || q.Format == "svg") {
+		maxDataPoints = q.graphOptions().Width
+		if maxDataPoints <= 0 {
+			maxDataPoints = defaultGraphWidth
+		}
+	}
+
+	series := make([]GTS, 0)
+	for _, s := range gts {
+		if len(q.XFilesFactor) != 0 {
+			s.setDefaultXFilesFactor(q.XFilesFactor)
+		}
+
+		s.Consolidate(maxDataPoints)
+
+		if q.NoNullPoints && len(s.Values) == 0 {
+			continue
+		}
+
+		series = append(series, s)
+	}
+
+	var result []byte
+	switch q.Format {
+	case "png", "svg":
+		result, err = Graph(series, q.Format, q.graphOptions())
+	default:
+		result, err = Format(series, q.Format)
+	}
+
 	if err != nil {
 		logErr(r, http.StatusInternalServerError, err)
 		respondWithError(w, http.StatusInternalServerError, err)
@@ -62,6 +107,10 @@ func Render(w http.ResponseWriter, r *http.Request) {
 	if len(q.JSONP) != 0 {
 		respondWithJsonp(w, http.StatusOK, result, q.JSONP)
 	} else {
+		if mime, ok := formatContentTypes[q.Format]; ok {
+			w.Header().Set("Content-Type", mime)
+		}
+
 		respond(w, http.StatusOK, result)
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"github.com/ovh/erlenmeyer/core"
+	"github.com/spf13/viper"
 )
 
 const findQueryWarpScript = `
@@ -44,6 +45,11 @@ $query '.' SPLIT SIZE 1 - 'level' STORE
 <%% DROP '.' SPLIT [ 0 $level ] SUBLIST LIST-> '.' SWAP JOIN %%> LMAP UNIQUE
 `
 
+const tagsQueryWarpScript = `
+<% DROP DUP NAME 'c' STORE LABELS 'l' STORE { 'c' $c 'l' $l } %> LMAP
+STOP
+`
+
 // CreateFindRequest return children of a serie given in parameter as mc2 tree
 func CreateFindRequest(query string, wildcards bool) (*core.Node, error) {
 	if wildcards {
@@ -76,6 +82,32 @@ func CreateExpandRequest(query string) (*core.Node, error) {
 	return root, nil
 }
 
+// CreateTagsRequest return series matching graphite tag expressions as mc2 tree
+func CreateTagsRequest(exprs []string) (*core.Node, error) {
+	serie, labels, err := parseTagExpressions(exprs)
+	if err != nil {
+		return nil, err
+	}
+
+	root := core.NewNode(core.WarpScriptPayload{
+		WarpScript: tagsQueryWarpScript,
+	})
+
+	find := core.FindPayload{
+		ClassName: serie,
+		Labels:    labels,
+	}
+
+	// without expression, all the series are listed
+	if len(exprs) == 0 {
+		find.GCount = viper.GetInt("graphite.tags.gcount")
+	}
+
+	root.Left = core.NewNode(find)
+
+	return root, nil
+}
+
 // CreateRenderRequest return what you ask for as mc2 tree
 func CreateRenderRequest(target, from, until string) (*core.Node, error) {
 	// default time values
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/ovh/erlenmeyer/proto/graphite"
+	"github.com/spf13/viper"
 )
 
 type findRequestTest struct {
@@ -80,3 +81,87 @@ var findRequestsTest = []findRequestTest{
 		},
 	},
 }
+
+type tagsRequestTest struct {
+	Expr           []string
+	ShouldContains []string
+}
+
+func TestCreateTagsRequest(t *testing.T) {
+	for _, request := range tagsRequestsTest {
+		tree, err := graphite.CreateTagsRequest(request.Expr)
+		if err != nil {
+			t.Error(err)
+
+			continue
+		}
+
+		ws := tree.ToWarpScript("", "", "")
+
+		for _, shouldContain := range request.ShouldContains {
+			if !strings.Contains(ws, shouldContain) {
+				t.Errorf("Query does not contain '%s'", shouldContain)
+				t.Errorf("WarpScript %s", ws)
+				t.Fail()
+			}
+		}
+	}
+}
+
+var tagsRequestsTest = []tagsRequestTest{
+	{
+		Expr: []string{},
+		ShouldContains: []string{
+			"[ $token '~.*' {} ] FIND",
+			"LMAP",
+		},
+	},
+	{
+		Expr: []string{"name=disk.used", "dc=gra"},
+		ShouldContains: []string{
+			"[ $token 'disk.used' { 'dc'  'gra' } ] FIND",
+		},
+	},
+	{
+		Expr: []string{"name=~disk.*", "dc!=gra"},
+		ShouldContains: []string{
+			"[ $token '~(?:disk.*).*' { 'dc'  '~(?!gra$).*' } ] FIND",
+		},
+	},
+	{
+		Expr: []string{"name!=disk.used"},
+		ShouldContains: []string{
+			`[ $token '~(?!disk\.used$).*' {} ] FIND`,
+		},
+	},
+	{
+		Expr: []string{"name!=~disk|cpu"},
+		ShouldContains: []string{
+			"[ $token '~(?!(?:disk|cpu)).*' {} ] FIND",
+		},
+	},
+	{
+		Expr: []string{"name=~disk", "dc=~gra.*", "rack!=~a|b", "query=a=b"},
+		ShouldContains: []string{
+			"[ $token '~(?:disk).*' { ",
+			"'dc'  '~(?:gra.*).*'",
+			"'rack'  '~(?!(?:a|b)).*'",
+			"'query'  'a=b'",
+		},
+	},
+}
+
+func TestCreateTagsRequestGCount(t *testing.T) {
+	viper.Set("graphite.tags.gcount", 10)
+	defer viper.Set("graphite.tags.gcount", 0)
+
+	tree, err := graphite.CreateTagsRequest([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws := tree.ToWarpScript("", "", "")
+	if !strings.Contains(ws, "{ 'token' $token 'class' '~.*' 'labels' {} 'gcount' 10 } FIND") {
+		t.Errorf("Query is not bounded: %s", ws)
+	}
+}
@@ -0,0 +1,86 @@
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ovh/erlenmeyer/core"
+)
+
+// ----------------------------------------------------------------------------
+// helper functions
+
+// setStyle store a graph style of the series as an attribute, it is used
+// when rendering png or svg graphs
+func setStyle(node *core.Node, args []string, kwargs map[string]string, attribute, value string) (*core.Node, error) {
+	node.Left = core.NewNode(core.WarpScriptPayload{
+		WarpScript: fmt.Sprintf("{ '%s' %s } SETATTRIBUTES", attribute, toWarpScriptString(value)),
+	})
+
+	if args[0] != swap {
+		return fetch(node.Left, []string{args[0], kwargs["from"], kwargs["until"]}, kwargs)
+	}
+
+	return node.Left, nil
+}
+
+// ----------------------------------------------------------------------------
+// graphite functions implementations
+
+func colorFunction(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 2 {
+		return nil, errors.New("The color function take two parameters which are a list of series and a color")
+	}
+
+	if _, err := parseColor(args[1]); err != nil {
+		return nil, err
+	}
+
+	return setStyle(node, args, kwargs, colorAttribute, args[1])
+}
+
+func lineWidth(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 2 {
+		return nil, errors.New("The lineWidth function take two parameters which are a list of series and a width")
+	}
+
+	if width, err := strconv.ParseFloat(args[1], 64); err != nil || width <= 0 {
+		return nil, fmt.Errorf("Expect the width %s parameter to be a positive number", args[1])
+	}
+
+	return setStyle(node, args, kwargs, lineWidthAttribute, args[1])
+}
+
+func dashed(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 1 {
+		return nil, errors.New("The dashed function take at least one parameter which is a list of series")
+	}
+
+	length := "5"
+	if len(args) > 1 {
+		length = args[1]
+	}
+
+	if dash, err := strconv.ParseFloat(length, 64); err != nil || dash <= 0 {
+		return nil, fmt.Errorf("Expect the dashLength %s parameter to be a positive number", length)
+	}
+
+	return setStyle(node, args, kwargs, dashedAttribute, length)
+}
+
+func secondYAxis(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 1 {
+		return nil, errors.New("The secondYAxis function take one parameter which is a list of series")
+	}
+
+	return setStyle(node, args, kwargs, secondYAxisAttribute, "true")
+}
+
+func stacked(node *core.Node, args []string, kwargs map[string]string) (*core.Node, error) {
+	if len(args) < 1 {
+		return nil, errors.New("The stacked function take at least one parameter which is a list of series")
+	}
+
+	return setStyle(node, args, kwargs, stackedAttribute, "true")
+}
@@ -0,0 +1,342 @@
+package graphite
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ovh/erlenmeyer/middlewares"
+)
+
+const (
+	// autoCompleteLimit is the default number of autocomplete results
+	// see TAGDB_AUTOCOMPLETE_LIMIT in graphite-web settings
+	autoCompleteLimit = 100
+)
+
+// Tag structure definition
+type Tag struct {
+	Tag string `json:"tag"`
+}
+
+// TagValues structure definition
+type TagValues struct {
+	Tag    string     `json:"tag"`
+	Values []TagValue `json:"values"`
+}
+
+// TagValue structure definition
+type TagValue struct {
+	Count int    `json:"count"`
+	Value string `json:"value"`
+}
+
+// ----------------------------------------------------------------------------
+// helper functions
+
+// tags return graphite tags of a series, including its name
+func (s *GTS) tags() map[string]string {
+	tags := map[string]string{
+		"name": s.ClassName,
+	}
+
+	for k, v := range s.Labels {
+		// skip Warp 10 reserved labels such as .app
+		if strings.HasPrefix(k, ".") {
+			continue
+		}
+
+		tags[k] = v
+	}
+
+	return tags
+}
+
+// exprTag return the tag name of a tag expression
+func exprTag(expr string) string {
+	if i := strings.IndexAny(expr, "!="); i >= 0 {
+		return expr[:i]
+	}
+
+	return expr
+}
+
+func compileFilter(filter string) (*regexp.Regexp, error) {
+	if len(filter) == 0 {
+		return nil, nil
+	}
+
+	// graphite filters match from the beginning of the string
+	return regexp.Compile("^(?:" + filter + ")")
+}
+
+func limitStrings(items []string, limit int) []string {
+	if limit > 0 && len(items) > limit {
+		return items[:limit]
+	}
+
+	return items
+}
+
+// findTaggedSeries parse and check the tags query then fetch the matching
+// series metadata, errors are already written to the response
+func findTaggedSeries(w http.ResponseWriter, r *http.Request, check func(*TagsQuery) error) (*TagsQuery, []GTS, bool) {
+	token, err := getToken(r)
+	if err != nil {
+		logWarn(r, http.StatusUnauthorized, err)
+		respondWithError(w, http.StatusUnauthorized, err)
+		return nil, nil, false
+	}
+
+	q := new(TagsQuery)
+	if err = q.Parse(r); err != nil {
+		logWarn(r, http.StatusBadRequest, err)
+		respondWithError(w, http.StatusBadRequest, err)
+		return nil, nil, false
+	}
+
+	if check != nil {
+		if err = check(q); err != nil {
+			logWarn(r, http.StatusBadRequest, err)
+			respondWithError(w, http.StatusBadRequest, err)
+			return nil, nil, false
+		}
+	}
+
+	ws, err := CreateTagsRequest(q.Expr)
+	if err != nil {
+		logWarn(r, http.StatusBadRequest, err)
+		respondWithError(w, http.StatusBadRequest, err)
+		return nil, nil, false
+	}
+
+	resp, err := execute(token, w.Header().Get(middlewares.TxnHeader), ws)
+	if err != nil {
+		logErr(r, http.StatusInternalServerError, errors.Wrap(err, "WarpScript request failed"))
+		respondWithError(w, http.StatusInternalServerError, err)
+		return nil, nil, false
+	}
+
+	stack := make([][]GTS, 0)
+	if err = json.Unmarshal(resp, &stack); err != nil || len(stack) == 0 {
+		logErr(r, http.StatusInternalServerError, errors.New("Query result parsing error"))
+		respondWithError(w, http.StatusInternalServerError, errors.New("Query response is invalid - something went wrong with this request"))
+		return nil, nil, false
+	}
+
+	return q, stack[0], true
+}
+
+func respondTags(w http.ResponseWriter, r *http.Request, q *TagsQuery, body interface{}) {
+	result, err := json.Marshal(body)
+	if err != nil {
+		logErr(r, http.StatusInternalServerError, err)
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if len(q.JSONP) != 0 {
+		respondWithJsonp(w, http.StatusOK, result, q.JSONP)
+	} else {
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		respond(w, http.StatusOK, result)
+	}
+}
+
+// ----------------------------------------------------------------------------
+// handlers
+
+// Tags graphite handler (/tags)
+// https://graphite.readthedocs.io/en/latest/tags.html#exploring-tags
+func Tags(w http.ResponseWriter, r *http.Request) {
+	var filter *regexp.Regexp
+	q, gtss, ok := findTaggedSeries(w, r, func(q *TagsQuery) (err error) {
+		filter, err = compileFilter(q.Filter)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	set := make(map[string]bool)
+	for _, gts := range gtss {
+		for tag := range gts.tags() {
+			if filter == nil || filter.MatchString(tag) {
+				set[tag] = true
+			}
+		}
+	}
+
+	names := make([]string, 0)
+	for tag := range set {
+		names = append(names, tag)
+	}
+
+	sort.Strings(names)
+
+	tags := make([]Tag, 0)
+	for _, tag := range limitStrings(names, q.Limit) {
+		tags = append(tags, Tag{Tag: tag})
+	}
+
+	respondTags(w, r, q, tags)
+}
+
+// TagDetails graphite handler (/tags/<tag>)
+// https://graphite.readthedocs.io/en/latest/tags.html#exploring-tags
+func TagDetails(w http.ResponseWriter, r *http.Request) {
+	var filter *regexp.Regexp
+	q, gtss, ok := findTaggedSeries(w, r, func(q *TagsQuery) (err error) {
+		filter, err = compileFilter(q.Filter)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	tag := path.Base(r.URL.Path)
+	counts := make(map[string]int)
+	for _, gts := range gtss {
+		value, ok := gts.tags()[tag]
+		if !ok || (filter != nil && !filter.MatchString(value)) {
+			continue
+		}
+
+		counts[value]++
+	}
+
+	values := make([]string, 0)
+	for value := range counts {
+		values = append(values, value)
+	}
+
+	sort.Strings(values)
+
+	details := TagValues{
+		Tag:    tag,
+		Values: make([]TagValue, 0),
+	}
+
+	for _, value := range limitStrings(values, q.Limit) {
+		details.Values = append(details.Values, TagValue{
+			Count: counts[value],
+			Value: value,
+		})
+	}
+
+	respondTags(w, r, q, details)
+}
+
+// TagsFindSeries graphite handler (/tags/findSeries)
+// https://graphite.readthedocs.io/en/latest/tags.html#exploring-tags
+func TagsFindSeries(w http.ResponseWriter, r *http.Request) {
+	q, gtss, ok := findTaggedSeries(w, r, func(q *TagsQuery) error {
+		if len(q.Expr) == 0 {
+			return errors.New("at least one expr is required")
+		}
+
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	set := make(map[string]bool)
+	for _, gts := range gtss {
+		serie := gts.ClassName
+		if labels := gts.toGraphiteLabels(); len(labels) > 0 {
+			serie = serie + ";" + labels
+		}
+
+		set[serie] = true
+	}
+
+	series := make([]string, 0)
+	for serie := range set {
+		series = append(series, serie)
+	}
+
+	sort.Strings(series)
+
+	respondTags(w, r, q, limitStrings(series, q.Limit))
+}
+
+// TagsAutoCompleteTags graphite handler (/tags/autoComplete/tags)
+// https://graphite.readthedocs.io/en/latest/tags.html#auto-complete-support
+func TagsAutoCompleteTags(w http.ResponseWriter, r *http.Request) {
+	q, gtss, ok := findTaggedSeries(w, r, nil)
+	if !ok {
+		return
+	}
+
+	// tags already used in expressions are not suggested
+	used := make(map[string]bool)
+	for _, expr := range q.Expr {
+		used[exprTag(expr)] = true
+	}
+
+	set := make(map[string]bool)
+	for _, gts := range gtss {
+		for tag := range gts.tags() {
+			if !used[tag] && strings.HasPrefix(tag, q.TagPrefix) {
+				set[tag] = true
+			}
+		}
+	}
+
+	tags := make([]string, 0)
+	for tag := range set {
+		tags = append(tags, tag)
+	}
+
+	sort.Strings(tags)
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = autoCompleteLimit
+	}
+
+	respondTags(w, r, q, limitStrings(tags, limit))
+}
+
+// TagsAutoCompleteValues graphite handler (/tags/autoComplete/values)
+// https://graphite.readthedocs.io/en/latest/tags.html#auto-complete-support
+func TagsAutoCompleteValues(w http.ResponseWriter, r *http.Request) {
+	q, gtss, ok := findTaggedSeries(w, r, func(q *TagsQuery) error {
+		if len(q.Tag) == 0 {
+			return errors.New("tag parameter is required")
+		}
+
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	set := make(map[string]bool)
+	for _, gts := range gtss {
+		value, ok := gts.tags()[q.Tag]
+		if ok && strings.HasPrefix(value, q.ValuePrefix) {
+			set[value] = true
+		}
+	}
+
+	values := make([]string, 0)
+	for value := range set {
+		values = append(values, value)
+	}
+
+	sort.Strings(values)
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = autoCompleteLimit
+	}
+
+	respondTags(w, r, q, limitStrings(values, limit))
+}
@@ -0,0 +1,299 @@
+package influxdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/influxdata/influxql"
+	"github.com/ovh/erlenmeyer/core"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// selectQuery is a SELECT statement of a request and its WarpScript
+type selectQuery struct {
+	statement   *influxql.SelectStatement
+	statementid int
+	parser      *InfluxParser
+	result      *Result
+}
+
+// batchError is the entry of a statement failing in the batch WarpScript
+type batchError struct {
+	Err string `json:"error"`
+}
+
+// parseInfluxSelects execute consecutive SELECT statements of a request in
+// two Warp 10 round trips: one finding the series of all the WHERE clauses,
+// sub-queries included, and one executing all the statements. A statement
+// failing to translate or in Warp 10 yields an error result without failing
+// the others. The statements share the execution limits of the WarpScript
+func parseInfluxSelects(statements []*influxql.SelectStatement, statementids []int, txn string, token string, timePrecision string) ([]*Result, error) {
+	warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "influxql")
+
+	finds := prefetchFinds(statements, warpServer, txn, token)
+
+	authenticate := fmt.Sprintf("'3' MINREV <%% '%s' CAPADD %%> <%% '%s' AUTHENTICATE EVAL %%> IFTE\n", token, token)
+
+	mc2 := authenticate + `
+	// keys of STACKATTRIBUTE can be found here: https://github.com/cityzendata/warp10-platform/blob/master/warp10/src/main/java/io/warp10/script/WarpScriptStack.java
+	'stack.maxops.hard' STACKATTRIBUTE DUP <% ISNULL ! %> <% MAXOPS %> <% DROP %> IFTE
+	'fetch.limit.hard' STACKATTRIBUTE DUP <% ISNULL ! %> <% LIMIT %> <% DROP %> IFTE
+	'gts.limit.hard' STACKATTRIBUTE DUP <% ISNULL ! %> <% MAXGTS %> <% DROP %> IFTE
+	`
+
+	queries := make([]*selectQuery, len(statements))
+	executed := make([]*selectQuery, 0, len(statements))
+	for index, statement := range statements {
+		keepTopLabels := make([]string, 0)
+
+		p := &InfluxParser{Classnames: make([]string, 0), Token: token, End: "$end", BucketTime: "0", BucketCount: "1", Separator: ".", KeepTopLabels: keepTopLabels, Finds: finds}
+		query := &selectQuery{statement: statement, statementid: statementids[index], parser: p}
+		queries[index] = query
+
+		statementMc2, respResult, _, _, err := p.getSelectStatementScript(statement, warpServer, txn, 0, query.statementid)
+
+		if respResult != nil {
+			query.result = respResult
+			continue
+		}
+
+		// A statement that can't be translated fails alone, as in Warp 10
+		if err != nil {
+			query.result = &Result{StatementID: query.statementid, Err: err.Error()}
+			continue
+		}
+
+		mc2 += batchStatementScript(statementMc2)
+		executed = append(executed, query)
+	}
+
+	if len(executed) > 0 {
+		if err := executeSelects(mc2+"DEPTH ->LIST\n", executed, warpServer, txn, timePrecision); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]*Result, len(queries))
+	for index, query := range queries {
+		results[index] = query.result
+	}
+	return results, nil
+}
+
+// batchStatementScript isolate a statement script: it starts from empty
+// variables and leaves on the stack either the list of its results, top of
+// the stack first, or an error entry
+func batchStatementScript(mc2 string) string {
+	return `
+	CLEARSYMBOLS
+	DEPTH 'influxql.depth' STORE
+	<%
+		[
+		` + mc2 + `
+		]
+		REVERSE
+	%>
+	<%
+		DEPTH $influxql.depth - DROPN
+		{ 'error' ERROR 0 GET 'message' GET }
+	%>
+	<% %>
+	TRY
+	`
+}
+
+// executeSelects run the batch WarpScript, setting the result of each
+// executed statement
+func executeSelects(mc2 string, queries []*selectQuery, warpServer *core.HTTPWarp10Server, txn string, timePrecision string) error {
+	queryRes, err := warpServer.Query(mc2, txn)
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+			"proto": "influxQL",
+		}).Error("Bad response from Egress")
+		return err
+	}
+	buffer, err := ioutil.ReadAll(queryRes.Body)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+			"proto": "influxQL",
+		}).Error("can't fully read Egress response")
+		return err
+	}
+
+	// HACK : replace NaN values from Warp to 0
+	s := strings.Replace(string(buffer), "NaN", "0", -1)
+	buffer = []byte(s)
+
+	if queryRes.StatusCode != http.StatusOK {
+		for _, query := range queries {
+			query.result = &Result{StatementID: query.statementid, Err: "Invalid generated query: returned error is - " + string(buffer)}
+		}
+		return nil
+	}
+
+	stack := [][]json.RawMessage{}
+	err = json.Unmarshal(buffer, &stack)
+	if err == nil && (len(stack) != 1 || len(stack[0]) != len(queries)) {
+		err = fmt.Errorf("expected %d statements results", len(queries))
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+			"proto": "influxQL",
+		}).Error("Cannot unmarshal egress response")
+		return err
+	}
+
+	for index, query := range queries {
+		raw := stack[0][index]
+
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+			statementErr := &batchError{}
+			if err = json.Unmarshal(raw, statementErr); err != nil {
+				return err
+			}
+			query.result = &Result{StatementID: query.statementid, Err: "Invalid generated query: returned error is - " + statementErr.Err}
+			continue
+		}
+
+		responses := [][]core.GeoTimeSeries{}
+		if err = json.Unmarshal(raw, &responses); err != nil {
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+				"proto": "influxQL",
+			}).Error("Cannot unmarshal egress response")
+			return err
+		}
+
+		if query.result, err = query.influxResult(responses, timePrecision); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// influxResult translate the Warp 10 series of a statement into its result
+func (query *selectQuery) influxResult(responses [][]core.GeoTimeSeries, timePrecision string) (*Result, error) {
+	p := query.parser
+	statement := query.statement
+
+	// Since it's a range_query, we can enforce the matrix resultType
+	influxResponse := &Result{StatementID: query.statementid, Series: make([]*Row, 0)}
+
+	for _, series := range responses {
+		if len(series) == 0 {
+			continue
+		}
+
+		if p.HasGroupBy {
+			_, tags := statement.Dimensions.Normalize()
+			resp, err := splitPerTagsResult(series, query.statementid, p.TimeColumn, p.Measurement, timePrecision, statement.Location, tags, statement.Fields.AliasNames())
+			if err != nil {
+				return nil, err
+			}
+			influxResponse.Series = append(influxResponse.Series, resp...)
+		} else {
+			resp, err := warpToInfluxResponse(series, query.statementid, p.TimeColumn, p.Measurement, timePrecision, statement.Location)
+			if err != nil {
+				return nil, err
+			}
+			influxResponse.Series = append(influxResponse.Series, resp)
+		}
+	}
+
+	return influxResponse, nil
+}
+
+// prefetchFinds run in a single Warp 10 request the FIND of the WHERE
+// clauses of all the statements, sub-queries included. It can't be inlined in
+// the batch WarpScript: the WHERE clauses translation depends on the found
+// tag keys, a condition on a key that is not a tag being a field filter. It
+// replaces the FIND request each statement with a WHERE clause made. Finds
+// are left to the statements when the request fails, each reporting its own
+// error
+func prefetchFinds(statements []*influxql.SelectStatement, warpServer *core.HTTPWarp10Server, txn string, token string) map[string][][]core.GeoTimeSeries {
+	finds := make(map[string][][]core.GeoTimeSeries)
+
+	selectors := make([]string, 0)
+	for _, statement := range statements {
+		// Finding rewrite the statement time fields, as its execution
+		selectors = appendFindSelectors(selectors, statement.Clone())
+	}
+	if len(selectors) == 0 {
+		return finds
+	}
+
+	mc2 := ""
+	for _, selector := range selectors {
+		mc2 += "[\n" + findScript(token, selector) + "]\n"
+	}
+	mc2 += "DEPTH ->LIST\n"
+
+	queryRes, err := warpServer.Query(mc2, txn)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+			"proto": "influxQL",
+		}).Warn("Bad finds response from Egress")
+		return finds
+	}
+	buffer, err := ioutil.ReadAll(queryRes.Body)
+	if err != nil || queryRes.StatusCode != http.StatusOK {
+		log.WithFields(log.Fields{
+			"status": queryRes.StatusCode,
+			"proto":  "influxQL",
+		}).Warn("Bad finds response from Egress")
+		return finds
+	}
+
+	stack := [][][][]core.GeoTimeSeries{}
+	if err = json.Unmarshal(buffer, &stack); err != nil || len(stack) != 1 || len(stack[0]) != len(selectors) {
+		log.WithFields(log.Fields{
+			"proto": "influxQL",
+		}).Warn("Cannot unmarshal the egress finds response")
+		return finds
+	}
+
+	for index, selector := range selectors {
+		finds[selector] = stack[0][index]
+	}
+	return finds
+}
+
+// appendFindSelectors append the FIND selectors of a statement with a WHERE
+// clause and of its sub-queries, as generated by getSelectStatementScript
+func appendFindSelectors(selectors []string, statement *influxql.SelectStatement) []string {
+	classnames, subQueries, err := sourceClassnames(statement.Sources)
+	if err != nil {
+		return selectors
+	}
+	for _, subQuery := range subQueries {
+		selectors = appendFindSelectors(selectors, subQuery)
+	}
+	if statement.Condition == nil {
+		return selectors
+	}
+
+	p := &InfluxParser{Classnames: classnames}
+	p.Separator, _ = parseSeparatorCondition(statement.Condition)
+	statement.RewriteTimeFields()
+
+	where, err := p.parseWhere(statement.Condition)
+	if err != nil || len(where) == 0 {
+		return selectors
+	}
+
+	selector, err := p.findSelector(statement.Fields)
+	if err != nil || containsString(selectors, selector) {
+		return selectors
+	}
+	return append(selectors, selector)
+}
@@ -0,0 +1,134 @@
+package influxdb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/influxql"
+	"github.com/ovh/erlenmeyer/core"
+	"github.com/spf13/viper"
+)
+
+func TestAppendFindSelectors(t *testing.T) {
+	q, err := influxql.ParseQuery(`SELECT v FROM cpu WHERE host = 'a'; SELECT v FROM cpu WHERE host = 'b'; SELECT v FROM mem; SELECT max(v) FROM (SELECT v FROM disk WHERE host = 'a')`)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	selectors := make([]string, 0)
+	for _, statement := range q.Statements {
+		selectors = appendFindSelectors(selectors, statement.(*influxql.SelectStatement).Clone())
+	}
+
+	expected := []string{`~(cpu)\.(v)|`, `~(disk)\.(v)|`}
+	if strings.Join(selectors, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected %v, got %v", expected, selectors)
+	}
+}
+
+func TestPrefetchedFinds(t *testing.T) {
+	stmt, err := influxql.ParseStatement(`SELECT time AS t, v FROM cpu WHERE host = 'a' AND time > now() - 1h`)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	statement := stmt.(*influxql.SelectStatement)
+
+	selectors := appendFindSelectors(make([]string, 0), statement.Clone())
+	if len(selectors) != 1 {
+		t.Fatalf("Expected a selector, got %v", selectors)
+	}
+
+	// A prefetched find is used without querying Warp 10
+	finds := map[string][][]core.GeoTimeSeries{
+		selectors[0]: {{{Class: "cpu.v", Labels: map[string]string{"host": "true"}}}},
+	}
+	p := &InfluxParser{Token: "T", End: "$end", BucketTime: "0", BucketCount: "1", Separator: ".", Finds: finds}
+	mc2, _, _, _, err := p.getSelectStatementScript(statement, nil, "", 0, 0)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if !strings.Contains(mc2, "host=a") {
+		t.Errorf("Expected the host tag selector, got %s", mc2)
+	}
+	if p.TimeColumn.TimeAlias != "t" {
+		t.Errorf("Expected the t time alias, got %s", p.TimeColumn.TimeAlias)
+	}
+}
+
+func TestBatchStatementScript(t *testing.T) {
+	mc2 := batchStatementScript("1 2")
+
+	if strings.Count(mc2, "<%") != strings.Count(mc2, "%>") || strings.Count(mc2, "[") != strings.Count(mc2, "]") {
+		t.Errorf("Expected a balanced script, got %s", mc2)
+	}
+	if !strings.Contains(mc2, "1 2") || !strings.HasSuffix(strings.TrimSpace(mc2), "TRY") {
+		t.Errorf("Expected the statement in a TRY, got %s", mc2)
+	}
+}
+
+func TestParseInfluxSelectsTranslationErrors(t *testing.T) {
+	q, err := influxql.ParseQuery(`SELECT v FROM cpu; SELECT v FROM mem`)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	// Statements failing to translate are not sent to Warp 10
+	statements := make([]*influxql.SelectStatement, 0)
+	for _, statement := range q.Statements {
+		selectStatement := statement.(*influxql.SelectStatement)
+		selectStatement.SortFields = influxql.SortFields{{Name: "host", Ascending: true}}
+		statements = append(statements, selectStatement)
+	}
+
+	results, err := parseInfluxSelects(statements, []int{0, 1}, "", "T", "")
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	for index, result := range results {
+		if result.StatementID != index || result.Err == "" {
+			t.Errorf("Expected an error result for statement %d, got %+v", index, result)
+		}
+	}
+}
+
+func TestParseInfluxSelectsWarpErrors(t *testing.T) {
+	// The second statement fails in Warp 10, the batch still answers the first one
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[[
+			[[{"c":"cpu.v","l":{"host":"a"},"a":{},"v":[[60000000,1.5]]}]],
+			{"error":"Exceeded the maximum number of operations"}
+		]]`))
+	}))
+	defer server.Close()
+
+	viper.Set("warp_endpoint", server.URL)
+	defer viper.Set("warp_endpoint", nil)
+
+	q, err := influxql.ParseQuery(`SELECT v FROM cpu; SELECT v FROM mem`)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	statements := make([]*influxql.SelectStatement, 0)
+	for _, statement := range q.Statements {
+		statements = append(statements, statement.(*influxql.SelectStatement))
+	}
+
+	results, err := parseInfluxSelects(statements, []int{0, 1}, "", "T", "ms")
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].Err != "" || len(results[0].Series) != 1 || len(results[0].Series[0].Values) != 1 {
+		t.Errorf("Expected the cpu series, got %+v", results[0])
+	}
+	if results[1].StatementID != 1 || !strings.Contains(results[1].Err, "Exceeded the maximum number of operations") {
+		t.Errorf("Expected the Warp 10 error of the mem statement, got %+v", results[1])
+	}
+}
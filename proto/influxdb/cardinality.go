@@ -0,0 +1,144 @@
+package influxdb
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/influxdata/influxql"
+	"github.com/ovh/erlenmeyer/core"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// cardinalityEstimation is the column of the estimated cardinalities
+const cardinalityEstimation = "cardinality estimation"
+
+// parseInfluxCardinality answer SHOW SERIES, MEASUREMENT and FIELD KEY
+// CARDINALITY statements by counting the series of a Warp 10 FIND, bounded
+// to influxdb.cardinality.gcount series. Estimated and exact cardinalities
+// are both exact counts
+func parseInfluxCardinality(stmt influxql.Statement, statementid int, token string) (*Result, error) {
+	var sources influxql.Sources
+	var condition influxql.Expr
+	var limit, offset int
+
+	switch stmt := stmt.(type) {
+	case *influxql.ShowSeriesCardinalityStatement:
+		sources, condition, limit, offset = stmt.Sources, stmt.Condition, stmt.Limit, stmt.Offset
+	case *influxql.ShowMeasurementCardinalityStatement:
+		sources, condition, limit, offset = stmt.Sources, stmt.Condition, stmt.Limit, stmt.Offset
+	case *influxql.ShowFieldKeyCardinalityStatement:
+		sources, condition, limit, offset = stmt.Sources, stmt.Condition, stmt.Limit, stmt.Offset
+	default:
+		return nil, fmt.Errorf("Statement not implemented yet: %T", stmt)
+	}
+
+	selector, timeRange, err := buildSeriesSelector(sources, condition)
+	if err != nil {
+		return nil, err
+	}
+
+	params := core.FindParameters{GCount: viper.GetInt("influxdb.cardinality.gcount")}
+	if !timeRange.Min.IsZero() {
+		params.ActiveAfter = timeRange.MinTime()
+	}
+
+	warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "influxql-cardinality")
+	found, err := warpServer.FindGTS(token, url.QueryEscape(selector), params)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"selector": selector,
+			"proto":    "influxQL",
+			"error":    err.Error(),
+		}).Error("Error finding some GTS")
+		return nil, err
+	}
+
+	separator := "."
+	if condition != nil {
+		separator, _ = parseSeparatorCondition(condition)
+	}
+
+	result := &Result{StatementID: statementid, Series: cardinalityRows(stmt, found.GTS, separator)}
+	if params.GCount > 0 && len(found.GTS) >= params.GCount {
+		result.Messages = append(result.Messages, &Message{
+			Level: "warning",
+			Text:  fmt.Sprintf("cardinality computed on the first %d series", params.GCount),
+		})
+	}
+
+	// LIMIT and OFFSET apply to the per measurement rows
+	if offset > len(result.Series) {
+		offset = len(result.Series)
+	}
+	result.Series = result.Series[offset:]
+	if limit > 0 && limit < len(result.Series) {
+		result.Series = result.Series[:limit]
+	}
+	return result, nil
+}
+
+// cardinalityRows count the found series per measurement. A Warp 10 series
+// is the field of an InfluxDB series: the InfluxDB series are the distinct
+// measurements and labels
+func cardinalityRows(stmt influxql.Statement, gtss []core.GeoTimeSeries, separator string) []*Row {
+	series := make(map[string]map[string]bool)
+	fields := make(map[string]map[string]bool)
+
+	for _, gts := range gtss {
+		names := strings.SplitN(gts.Class, separator, 2)
+		measurement, field := names[0], ""
+		if len(names) > 1 {
+			field = names[1]
+		}
+
+		if _, ok := series[measurement]; !ok {
+			series[measurement] = make(map[string]bool)
+			fields[measurement] = make(map[string]bool)
+		}
+		series[measurement][labelsKey(gts.Labels)] = true
+		fields[measurement][field] = true
+	}
+
+	measurements := make([]string, 0, len(series))
+	total := 0
+	for measurement, keys := range series {
+		measurements = append(measurements, measurement)
+		total += len(keys)
+	}
+	sort.Strings(measurements)
+
+	rows := make([]*Row, 0)
+	switch stmt := stmt.(type) {
+	case *influxql.ShowSeriesCardinalityStatement:
+		if !stmt.Exact {
+			return append(rows, &Row{Columns: []string{cardinalityEstimation}, Values: [][]interface{}{{total}}})
+		}
+		for _, measurement := range measurements {
+			rows = append(rows, &Row{Name: measurement, Columns: []string{"count"}, Values: [][]interface{}{{len(series[measurement])}}})
+		}
+	case *influxql.ShowMeasurementCardinalityStatement:
+		column := "count"
+		if !stmt.Exact {
+			column = cardinalityEstimation
+		}
+		rows = append(rows, &Row{Columns: []string{column}, Values: [][]interface{}{{len(measurements)}}})
+	case *influxql.ShowFieldKeyCardinalityStatement:
+		for _, measurement := range measurements {
+			rows = append(rows, &Row{Name: measurement, Columns: []string{"count"}, Values: [][]interface{}{{len(fields[measurement])}}})
+		}
+	}
+	return rows
+}
+
+// labelsKey return a key identifying a labels set
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key, value := range labels {
+		keys = append(keys, url.QueryEscape(key)+"="+url.QueryEscape(value))
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
@@ -0,0 +1,48 @@
+package influxdb
+
+import (
+	"testing"
+
+	"github.com/influxdata/influxql"
+	"github.com/ovh/erlenmeyer/core"
+)
+
+func TestCardinalityRows(t *testing.T) {
+	gtss := []core.GeoTimeSeries{
+		{Class: "cpu.usage", Labels: map[string]string{"host": "a"}},
+		{Class: "cpu.idle", Labels: map[string]string{"host": "a"}},
+		{Class: "cpu.usage", Labels: map[string]string{"host": "b"}},
+		{Class: "mem.free", Labels: map[string]string{"host": "a"}},
+	}
+
+	var tests = []struct {
+		q      string
+		names  []string
+		column string
+		counts []int
+	}{
+		{"SHOW SERIES CARDINALITY", []string{""}, "cardinality estimation", []int{3}},
+		{"SHOW SERIES EXACT CARDINALITY", []string{"cpu", "mem"}, "count", []int{2, 1}},
+		{"SHOW MEASUREMENT CARDINALITY", []string{""}, "cardinality estimation", []int{2}},
+		{"SHOW MEASUREMENT EXACT CARDINALITY", []string{""}, "count", []int{2}},
+		{"SHOW FIELD KEY CARDINALITY", []string{"cpu", "mem"}, "count", []int{2, 1}},
+	}
+
+	for _, test := range tests {
+		stmt, err := influxql.ParseStatement(test.q)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", test.q, err)
+		}
+
+		rows := cardinalityRows(stmt, gtss, ".")
+		if len(rows) != len(test.names) {
+			t.Errorf("Expected %d rows for %s, got %d", len(test.names), test.q, len(rows))
+			continue
+		}
+		for index, row := range rows {
+			if row.Name != test.names[index] || row.Columns[0] != test.column || row.Values[0][0] != test.counts[index] {
+				t.Errorf("Expected %s %s %d for %s, got %+v", test.names[index], test.column, test.counts[index], test.q, row)
+			}
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package influxdb
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxql"
+	"github.com/ovh/erlenmeyer/core"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// isWriteStatement return true when the statement modifies the stored series
+func isWriteStatement(stmt influxql.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *influxql.DeleteSeriesStatement, *influxql.DropSeriesStatement, *influxql.DropMeasurementStatement:
+		return true
+	case *influxql.SelectStatement:
+		return stmt.Target != nil
+	}
+	return false
+}
+
+// parseInfluxDelete translate DELETE, DROP SERIES and DROP MEASUREMENT
+// statements into a Warp 10 delete request, made with the write token or,
+// without one, with the request token
+func parseInfluxDelete(stmt influxql.Statement, statementID int, token string, writeToken string, dryRun bool) (*Result, error) {
+	if writeToken == "" {
+		writeToken = token
+	}
+	if writeToken == "" {
+		return nil, errors.New("DELETE, DROP SERIES and DROP MEASUREMENT require a WRITE token")
+	}
+
+	var sources influxql.Sources
+	var condition influxql.Expr
+	allowTime := false
+
+	switch stmt := stmt.(type) {
+	case *influxql.DeleteSeriesStatement:
+		sources = stmt.Sources
+		condition = stmt.Condition
+		allowTime = true
+	case *influxql.DropSeriesStatement:
+		sources = stmt.Sources
+		condition = stmt.Condition
+	case *influxql.DropMeasurementStatement:
+		sources = influxql.Sources{&influxql.Measurement{Name: stmt.Name}}
+	default:
+		return nil, fmt.Errorf("Statement not implemented yet: %T", stmt)
+	}
+
+	query, err := buildDeleteQuery(sources, condition, allowTime)
+	if err != nil {
+		return nil, err
+	}
+
+	warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "influxql-delete")
+
+	if dryRun {
+		count, err := warpServer.DeleteDryRun(writeToken, query)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{
+			StatementID: statementID,
+			Series:      []*Row{{Name: "series", Columns: []string{"count"}, Values: [][]interface{}{{count}}}},
+		}, nil
+	}
+
+	if err = warpServer.Delete(writeToken, query); err != nil {
+		log.WithFields(log.Fields{
+			"query": query,
+			"proto": "influxQL",
+			"error": err.Error(),
+		}).Error("Error deleting some GTS")
+		return nil, err
+	}
+	return &Result{StatementID: statementID}, nil
+}
+
+// buildDeleteQuery return the Warp 10 delete query parameters matching the
+// statement sources and condition
+func buildDeleteQuery(sources influxql.Sources, condition influxql.Expr, allowTime bool) (string, error) {
+	selector, timeRange, err := buildSeriesSelector(sources, condition)
+	if err != nil {
+		return "", err
+	}
+	query := "selector=" + url.QueryEscape(selector)
+
+	if timeRange.IsZero() {
+		return query + "&deleteall", nil
+	}
+	if !allowTime {
+		return "", fmt.Errorf("DROP SERIES doesn't support time in WHERE clause")
+	}
+
+	end := timeRange.MaxTime()
+	if timeRange.Max.IsZero() {
+		end = time.Now()
+	}
+	return fmt.Sprintf("%s&start=%s&end=%s", query, url.QueryEscape(core.IsoTime(timeRange.MinTime())), url.QueryEscape(core.IsoTime(end))), nil
+}
+
+// buildSeriesSelector return the Warp 10 selector of the series matching the
+// statement sources and tags condition, and the condition time range
+func buildSeriesSelector(sources influxql.Sources, condition influxql.Expr) (string, influxql.TimeRange, error) {
+	separator := "."
+	if condition != nil {
+		separator, _ = parseSeparatorCondition(condition)
+	}
+
+	labels, timeRange, err := parseDeleteCondition(condition)
+	if err != nil {
+		return "", influxql.TimeRange{}, err
+	}
+
+	classnames := make([]string, 0)
+	for _, source := range sources {
+		switch source := source.(type) {
+		case *influxql.Measurement:
+			if source.Regex != nil {
+				classname, err := javaRegex(source.Regex.Val.String())
+				if err != nil {
+					return "", influxql.TimeRange{}, err
+				}
+				classnames = append(classnames, classname)
+			} else {
+				classnames = append(classnames, regexp.QuoteMeta(source.Name))
+			}
+		default:
+			return "", influxql.TimeRange{}, fmt.Errorf("Unsupported source %s in statement", source.String())
+		}
+	}
+	if len(classnames) == 0 {
+		classnames = append(classnames, ".*")
+	}
+
+	separatorSelector := regexp.QuoteMeta(separator)
+	selector := fmt.Sprintf("~(%s)%s.*{%s}", strings.Join(classnames, "|"), separatorSelector, strings.Join(labels, ","))
+	return selector, timeRange, nil
+}
+
+// parseDeleteCondition split a delete condition into Warp 10 labels selectors
+// and a time range
+func parseDeleteCondition(condition influxql.Expr) ([]string, influxql.TimeRange, error) {
+	labels := make([]string, 0)
+	if condition == nil {
+		return labels, influxql.TimeRange{}, nil
+	}
+
+	expr, timeRange, err := influxql.ConditionExpr(condition, &influxql.NowValuer{Now: time.Now().UTC()})
+	if err != nil {
+		return nil, influxql.TimeRange{}, err
+	}
+
+	if err = appendDeleteLabels(expr, &labels); err != nil {
+		return nil, influxql.TimeRange{}, err
+	}
+	return labels, timeRange, nil
+}
+
+// appendDeleteLabels append to labels the selectors of a tags condition
+func appendDeleteLabels(expr influxql.Expr, labels *[]string) error {
+	switch expr := expr.(type) {
+	case nil:
+		return nil
+	case *influxql.ParenExpr:
+		return appendDeleteLabels(expr.Expr, labels)
+	case *influxql.BinaryExpr:
+		switch expr.Op {
+		case influxql.AND:
+			if err := appendDeleteLabels(expr.LHS, labels); err != nil {
+				return err
+			}
+			return appendDeleteLabels(expr.RHS, labels)
+		case influxql.OR:
+			return fmt.Errorf("OR operator is not supported in delete conditions")
+		}
+
+		key, ok := expr.LHS.(*influxql.VarRef)
+		value := expr.RHS
+		if !ok {
+			if key, ok = expr.RHS.(*influxql.VarRef); !ok {
+				return fmt.Errorf("Unsupported delete condition: %s", expr.String())
+			}
+			value = expr.LHS
+		}
+		if key.Val == "_separator" {
+			return nil
+		}
+
+		var selector string
+		switch value := value.(type) {
+		case *influxql.StringLiteral:
+			switch expr.Op {
+			case influxql.EQ:
+				selector = "=" + url.QueryEscape(value.Val)
+			case influxql.NEQ:
+				selector = "~" + url.QueryEscape(fmt.Sprintf("(?!%s$).*", regexp.QuoteMeta(value.Val)))
+			default:
+				return fmt.Errorf("Unsupported %s operator on tag key: %s", expr.Op.String(), key.Val)
+			}
+		case *influxql.RegexLiteral:
+			var regex string
+			var err error
+			switch expr.Op {
+			case influxql.EQREGEX:
+				regex, err = javaRegex(value.Val.String())
+			case influxql.NEQREGEX:
+				regex, err = javaNotRegex(value.Val.String())
+			default:
+				return fmt.Errorf("Unsupported %s operator on tag key: %s", expr.Op.String(), key.Val)
+			}
+			if err != nil {
+				return err
+			}
+			selector = "~" + url.QueryEscape(regex)
+		default:
+			return fmt.Errorf("fields not supported in WHERE clause during deletion")
+		}
+		*labels = append(*labels, url.QueryEscape(key.Val)+selector)
+		return nil
+	default:
+		return fmt.Errorf("Unsupported delete condition: %s", expr.String())
+	}
+}
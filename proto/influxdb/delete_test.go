@@ -0,0 +1,86 @@
+package influxdb
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/influxql"
+)
+
+func TestBuildDeleteQuery(t *testing.T) {
+	var tests = []struct {
+		q          string
+		selector   string
+		deleteAll  bool
+		shouldFail bool
+	}{
+		{"DELETE FROM cpu", `~(cpu)\..*{}`, true, false},
+		{"DELETE FROM cpu WHERE host = 'a' AND region =~ /^eu.*/", `~(cpu)\..*{host=a,region~eu[^\n]*(?s:.*)}`, true, false},
+		{"DELETE FROM cpu WHERE region !~ /^eu$/", `~(cpu)\..*{region~(?!(?:eu)\z)(?s:.*)}`, true, false},
+		{"DROP SERIES FROM /^cpu$/ WHERE host = 'a'", `~(cpu)\..*{host=a}`, true, false},
+		{"DELETE FROM cpu WHERE host = 'a' AND time < '2019-01-01T00:00:00Z'", `~(cpu)\..*{host=a}`, false, false},
+		{"DELETE FROM cpu WHERE host = 'a' AND _separator = '_'", `~(cpu)_.*{host=a}`, true, false},
+		{"DELETE WHERE host != 'a'", `~(.*)\..*{host~(?!a$).*}`, true, false},
+		{"DELETE FROM cpu WHERE host = 'a' OR host = 'b'", "", false, true},
+		{"DELETE FROM cpu WHERE value > 1", "", false, true},
+		{"DROP SERIES FROM cpu, mem WHERE host = 'a'", `~(cpu|mem)\..*{host=a}`, true, false},
+		{"DROP SERIES FROM cpu WHERE time < now()", "", false, true},
+		{"DROP MEASUREMENT cpu", `~(cpu)\..*{}`, true, false},
+	}
+
+	for _, test := range tests {
+		stmt, err := influxql.ParseStatement(test.q)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", test.q, err)
+		}
+
+		var query string
+		switch stmt := stmt.(type) {
+		case *influxql.DeleteSeriesStatement:
+			query, err = buildDeleteQuery(stmt.Sources, stmt.Condition, true)
+		case *influxql.DropSeriesStatement:
+			query, err = buildDeleteQuery(stmt.Sources, stmt.Condition, false)
+		case *influxql.DropMeasurementStatement:
+			query, err = buildDeleteQuery(influxql.Sources{&influxql.Measurement{Name: stmt.Name}}, nil, false)
+		}
+
+		if test.shouldFail {
+			if err == nil {
+				t.Errorf("Expected an error for %s, got nil", test.q)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected nil for %s, got %v", test.q, err)
+			continue
+		}
+
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			t.Errorf("Unparsable query %s: %v", query, err)
+			continue
+		}
+		selector, _ := url.QueryUnescape(values.Get("selector"))
+		if selector != test.selector {
+			t.Errorf("Expected selector %s for %s, got %s", test.selector, test.q, selector)
+		}
+		if strings.HasSuffix(query, "&deleteall") != test.deleteAll {
+			t.Errorf("Expected deleteall %t for %s, got %s", test.deleteAll, test.q, query)
+		}
+		if !test.deleteAll && (values.Get("start") == "" || values.Get("end") == "") {
+			t.Errorf("Expected a time range for %s, got %s", test.q, query)
+		}
+	}
+}
+
+func TestParseInfluxDeleteRequiresWriteToken(t *testing.T) {
+	stmt, err := influxql.ParseStatement("DELETE FROM cpu WHERE host = 'a'")
+	if err != nil {
+		t.Fatalf("Failed to parse statement: %v", err)
+	}
+
+	if _, err := parseInfluxDelete(stmt, 0, "", "", false); err == nil {
+		t.Errorf("Expected an error without any token, got nil")
+	}
+}
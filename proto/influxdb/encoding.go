@@ -0,0 +1,345 @@
+package influxdb
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ovh/erlenmeyer/core"
+)
+
+const (
+	// defaultChunkSize is the InfluxDB default number of values per chunk
+	defaultChunkSize = 10000
+)
+
+// responseEncoder write Influx responses in a given format, it's called once
+// per chunk on chunked responses
+type responseEncoder interface {
+	ContentType() string
+	Encode(w io.Writer, resp *Response) error
+}
+
+// newResponseEncoder return the encoder matching an Accept header value,
+// like InfluxDB it defaults to JSON
+func newResponseEncoder(accept string) responseEncoder {
+	for _, mediaType := range strings.Split(accept, ",") {
+		mediaType = strings.TrimSpace(strings.SplitN(mediaType, ";", 2)[0])
+		switch mediaType {
+		case "application/csv", "text/csv":
+			return &csvEncoder{statementID: -1}
+		case "application/x-msgpack":
+			return &msgpackEncoder{}
+		case "application/json":
+			return &jsonEncoder{}
+		}
+	}
+	return &jsonEncoder{}
+}
+
+// chunkResponse split a response into responses of at most size values per
+// series, flagging as partial the series and results which continue in the
+// next chunk. The response is complete, chunks only follow the InfluxDB format
+func chunkResponse(resp *Response, size int) []*Response {
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+
+	chunks := make([]*Response, 0)
+	for _, result := range resp.Results {
+		if len(result.Series) == 0 {
+			chunks = append(chunks, &Response{Results: []Result{result}})
+			continue
+		}
+
+		for seriesIndex, row := range result.Series {
+			for start := 0; start == 0 || start < len(row.Values); start += size {
+				end := start + size
+				if end > len(row.Values) {
+					end = len(row.Values)
+				}
+
+				chunk := *row
+				chunk.Values = row.Values[start:end]
+				chunk.Partial = row.Partial || end < len(row.Values)
+
+				chunkResult := Result{StatementID: result.StatementID, Series: []*Row{&chunk}, Err: result.Err}
+				chunkResult.Partial = result.Partial || chunk.Partial || seriesIndex < len(result.Series)-1
+				if !chunkResult.Partial {
+					chunkResult.Messages = result.Messages
+				}
+
+				chunks = append(chunks, &Response{Results: []Result{chunkResult}})
+				if end == len(row.Values) {
+					break
+				}
+			}
+		}
+	}
+	return chunks
+}
+
+// jsonEncoder write a JSON document per response
+type jsonEncoder struct{}
+
+// ContentType is the implementation of ContentType for jsonEncoder
+func (e *jsonEncoder) ContentType() string {
+	return "application/json"
+}
+
+// Encode is the implementation of Encode for jsonEncoder
+func (e *jsonEncoder) Encode(w io.Writer, resp *Response) error {
+	return json.NewEncoder(w).Encode(resp)
+}
+
+// csvEncoder write responses as InfluxDB CSV, a header line is written each
+// time the columns change
+type csvEncoder struct {
+	statementID int
+	columns     []string
+}
+
+// ContentType is the implementation of ContentType for csvEncoder
+func (e *csvEncoder) ContentType() string {
+	return "text/csv"
+}
+
+// Encode is the implementation of Encode for csvEncoder
+func (e *csvEncoder) Encode(w io.Writer, resp *Response) error {
+	writer := csv.NewWriter(w)
+	if resp.Err != "" {
+		writer.Write([]string{"error"})
+		writer.Write([]string{resp.Err})
+		writer.Flush()
+		return writer.Error()
+	}
+
+	for _, result := range resp.Results {
+		if result.StatementID != e.statementID {
+			// Skip past results without series
+			if len(result.Series) == 0 {
+				continue
+			}
+
+			// Separate the statements with a blank line
+			if e.statementID >= 0 {
+				writer.Flush()
+				if _, err := io.WriteString(w, "\n"); err != nil {
+					return err
+				}
+			}
+			e.statementID = result.StatementID
+			e.columns = nil
+		}
+
+		for _, row := range result.Series {
+			if !stringSliceEqual(e.columns, row.Columns) {
+				if e.columns != nil {
+					writer.Flush()
+					if _, err := io.WriteString(w, "\n"); err != nil {
+						return err
+					}
+				}
+				e.columns = row.Columns
+				writer.Write(append([]string{"name", "tags"}, row.Columns...))
+			}
+
+			tags := make([]string, 0, len(row.Tags))
+			for key, value := range row.Tags {
+				tags = append(tags, key+"="+value)
+			}
+			sort.Strings(tags)
+
+			for _, values := range row.Values {
+				record := make([]string, 0, len(values)+2)
+				record = append(record, row.Name, strings.Join(tags, ","))
+				for _, value := range values {
+					record = append(record, csvValue(value))
+				}
+				writer.Write(record)
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvValue format a value as InfluxDB does in CSV responses
+func csvValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case bool:
+		return strconv.FormatBool(value)
+	case string:
+		return value
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// stringSliceEqual return true when both slices have the same items
+func stringSliceEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+	return true
+}
+
+// msgpackEncoder write responses in the InfluxDB MessagePack format
+type msgpackEncoder struct{}
+
+// ContentType is the implementation of ContentType for msgpackEncoder
+func (e *msgpackEncoder) ContentType() string {
+	return "application/x-msgpack"
+}
+
+// Encode is the implementation of Encode for msgpackEncoder
+func (e *msgpackEncoder) Encode(w io.Writer, resp *Response) error {
+	enc := core.NewMsgpackWriter(w)
+
+	if resp.Err != "" {
+		enc.WriteMapHeader(1)
+		enc.WriteString("error")
+		enc.WriteString(resp.Err)
+		return enc.Flush()
+	}
+
+	enc.WriteMapHeader(1)
+	enc.WriteString("results")
+	enc.WriteArrayHeader(len(resp.Results))
+	for _, result := range resp.Results {
+		size := 2
+		if result.Err != "" {
+			size++
+		}
+		if len(result.Messages) > 0 {
+			size++
+		}
+		if result.Partial {
+			size++
+		}
+
+		enc.WriteMapHeader(size)
+		enc.WriteString("statement_id")
+		enc.WriteInt(int64(result.StatementID))
+		if result.Err != "" {
+			enc.WriteString("error")
+			enc.WriteString(result.Err)
+		}
+
+		enc.WriteString("series")
+		enc.WriteArrayHeader(len(result.Series))
+		for _, row := range result.Series {
+			e.encodeRow(enc, row)
+		}
+
+		if len(result.Messages) > 0 {
+			enc.WriteString("messages")
+			enc.WriteArrayHeader(len(result.Messages))
+			for _, message := range result.Messages {
+				enc.WriteMapHeader(2)
+				enc.WriteString("level")
+				enc.WriteString(message.Level)
+				enc.WriteString("text")
+				enc.WriteString(message.Text)
+			}
+		}
+
+		if result.Partial {
+			enc.WriteString("partial")
+			enc.WriteBool(true)
+		}
+	}
+	return enc.Flush()
+}
+
+// encodeRow write a series in the InfluxDB MessagePack format
+func (e *msgpackEncoder) encodeRow(enc *core.MsgpackWriter, row *Row) {
+	size := 3
+	if len(row.Tags) > 0 {
+		size++
+	}
+	if row.Partial {
+		size++
+	}
+
+	enc.WriteMapHeader(size)
+	enc.WriteString("name")
+	enc.WriteString(row.Name)
+
+	if len(row.Tags) > 0 {
+		keys := make([]string, 0, len(row.Tags))
+		for key := range row.Tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		enc.WriteString("tags")
+		enc.WriteMapHeader(len(keys))
+		for _, key := range keys {
+			enc.WriteString(key)
+			enc.WriteString(row.Tags[key])
+		}
+	}
+
+	enc.WriteString("columns")
+	enc.WriteArrayHeader(len(row.Columns))
+	for _, column := range row.Columns {
+		enc.WriteString(column)
+	}
+
+	enc.WriteString("values")
+	enc.WriteArrayHeader(len(row.Values))
+	for _, values := range row.Values {
+		enc.WriteArrayHeader(len(values))
+		for _, value := range values {
+			writeMsgpackValue(enc, value)
+		}
+	}
+
+	if row.Partial {
+		enc.WriteString("partial")
+		enc.WriteBool(true)
+	}
+}
+
+// writeMsgpackValue write a row value, unsupported types as strings
+func writeMsgpackValue(enc *core.MsgpackWriter, value interface{}) {
+	switch value := value.(type) {
+	case nil:
+		enc.WriteNil()
+	case float64:
+		enc.WriteFloat(value)
+	case int:
+		enc.WriteInt(int64(value))
+	case int64:
+		enc.WriteInt(value)
+	case bool:
+		enc.WriteBool(value)
+	case string:
+		enc.WriteString(value)
+	case time.Time:
+		enc.WriteTime(value)
+	default:
+		enc.WriteString(fmt.Sprintf("%v", value))
+	}
+}
@@ -0,0 +1,102 @@
+package influxdb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testResponse() *Response {
+	return &Response{Results: []Result{
+		{
+			StatementID: 0,
+			Series: []*Row{
+				{Name: "cpu", Tags: map[string]string{"host": "a", "dc": "gra"}, Columns: []string{"time", "mean"}, Values: [][]interface{}{{"2019-01-01T00:00:00Z", 1.5}, {"2019-01-01T01:00:00Z", nil}}},
+				{Name: "cpu", Tags: map[string]string{"host": "b"}, Columns: []string{"time", "mean"}, Values: [][]interface{}{{"2019-01-01T00:00:00Z", 2.0}}},
+			},
+		},
+		{StatementID: 1},
+		{
+			StatementID: 2,
+			Series:      []*Row{{Name: "databases", Columns: []string{"name"}, Values: [][]interface{}{{"metrics"}}}},
+		},
+	}}
+}
+
+func TestCSVEncoder(t *testing.T) {
+	expected := "name,tags,time,mean\n" +
+		"cpu,\"dc=gra,host=a\",2019-01-01T00:00:00Z,1.5\n" +
+		"cpu,\"dc=gra,host=a\",2019-01-01T01:00:00Z,\n" +
+		"cpu,host=b,2019-01-01T00:00:00Z,2\n" +
+		"\n" +
+		"name,tags,name\n" +
+		"databases,,metrics\n"
+
+	buffer := &bytes.Buffer{}
+	encoder := newResponseEncoder("application/csv")
+	for _, chunk := range chunkResponse(testResponse(), 1) {
+		if err := encoder.Encode(buffer, chunk); err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+	}
+	if buffer.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buffer.String())
+	}
+}
+
+func TestChunkResponse(t *testing.T) {
+	chunks := chunkResponse(testResponse(), 1)
+	if len(chunks) != 5 {
+		t.Fatalf("Expected 5 chunks, got %d", len(chunks))
+	}
+
+	var tests = []struct {
+		statementID   int
+		values        int
+		rowPartial    bool
+		resultPartial bool
+	}{
+		{0, 1, true, true},
+		{0, 1, false, true},
+		{0, 1, false, false},
+		{1, 0, false, false},
+		{2, 1, false, false},
+	}
+
+	for index, test := range tests {
+		result := chunks[index].Results[0]
+		if result.StatementID != test.statementID || result.Partial != test.resultPartial {
+			t.Errorf("Chunk %d: expected statement %d partial %t, got %d %t", index, test.statementID, test.resultPartial, result.StatementID, result.Partial)
+		}
+		if len(result.Series) == 0 {
+			if test.values != 0 {
+				t.Errorf("Chunk %d: expected %d values, got no series", index, test.values)
+			}
+			continue
+		}
+		if len(result.Series[0].Values) != test.values || result.Series[0].Partial != test.rowPartial {
+			t.Errorf("Chunk %d: expected %d values partial %t, got %d %t", index, test.values, test.rowPartial, len(result.Series[0].Values), result.Series[0].Partial)
+		}
+	}
+}
+
+func TestMsgpackEncoder(t *testing.T) {
+	resp := &Response{Results: []Result{
+		{StatementID: 0, Series: []*Row{{Name: "m", Columns: []string{"time"}, Values: [][]interface{}{{1.0}}}}},
+	}}
+	expected := []byte{
+		0x81, 0xa7, 'r', 'e', 's', 'u', 'l', 't', 's', 0x91,
+		0x82, 0xac, 's', 't', 'a', 't', 'e', 'm', 'e', 'n', 't', '_', 'i', 'd', 0x00,
+		0xa6, 's', 'e', 'r', 'i', 'e', 's', 0x91,
+		0x83, 0xa4, 'n', 'a', 'm', 'e', 0xa1, 'm',
+		0xa7, 'c', 'o', 'l', 'u', 'm', 'n', 's', 0x91, 0xa4, 't', 'i', 'm', 'e',
+		0xa6, 'v', 'a', 'l', 'u', 'e', 's', 0x91, 0x91, 0xcb, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0,
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := newResponseEncoder("application/x-msgpack").Encode(buffer, resp); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if !bytes.Equal(buffer.Bytes(), expected) {
+		t.Errorf("Expected %x, got %x", expected, buffer.Bytes())
+	}
+}
@@ -571,7 +571,7 @@ func (p *InfluxParser) genAggregationFunction(bucket string, appliedFunctions st
 
 		res += `
 			MERGE
-			$end $bucket / $bucket * $bucket 0 0 ".chunkid" false CHUNK
+			` + p.End + ` $bucket / $bucket * $bucket 0 0 ".chunkid" false CHUNK
 			<%
                 DROP
                 DUP LABELS ".chunkid" GET TOLONG 'endTick' STORE
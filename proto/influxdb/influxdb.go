@@ -7,6 +7,8 @@ type InfluxDB struct {
 	ReqCounter  prometheus.Counter
 	ErrCounter  prometheus.Counter
 	WarnCounter prometheus.Counter
+	queries     *queryRegistry
+	health      healthCache
 }
 
 // GetReqCounter satisfies the protocol interface
@@ -16,7 +18,7 @@ func (p *InfluxDB) GetReqCounter() prometheus.Counter {
 
 // NewInfluxDB is creating a new influxDB query handler
 func NewInfluxDB() *InfluxDB {
-	c := &InfluxDB{}
+	c := &InfluxDB{queries: newQueryRegistry()}
 
 	// metrics
 	c.ReqCounter = prometheus.NewCounter(prometheus.CounterOpts{
@@ -430,8 +430,11 @@ func (p *InfluxParser) parseFetch(name string, fetchType influxql.DataType, sele
 	if name == "*" {
 		valueName = ".*"
 	} else if strings.HasPrefix(name, "/") && strings.HasSuffix(name, "/") {
-		valueName = strings.TrimPrefix(valueName, "/")
-		valueName = strings.TrimSuffix(valueName, "/")
+		fieldRegex, err := javaRegex(strings.TrimSuffix(strings.TrimPrefix(valueName, "/"), "/"))
+		if err != nil {
+			return "", Unknown, err
+		}
+		valueName = fieldRegex
 	} else {
 		valueName = regexp.QuoteMeta(valueName)
 	}
@@ -467,8 +470,8 @@ func (p *InfluxParser) parseFetch(name string, fetchType influxql.DataType, sele
 						op = "~"
 						value = fmt.Sprintf("(?!%s).*?", whereCond.value)
 					} else if whereCond.op == influxql.NEQREGEX {
+						// Negated regular expressions are already translated
 						op = "~"
-						value = fmt.Sprintf("(?!%s)?", whereCond.value)
 					}
 					filterTags = append(filterTags, fmt.Sprintf(" '%s' '%s%s' ", whereCond.key, op, value))
 				}
@@ -477,6 +480,9 @@ func (p *InfluxParser) parseFetch(name string, fetchType influxql.DataType, sele
 			computeTags.WriteString(fmt.Sprintf("[ SWAP [] { %s } filter.bylabels ] FILTER \n", strings.Join(filterTags, " ")))
 			for _, whereCond := range wheres {
 				if !whereCond.isTag {
+					if whereCond.op == influxql.EQREGEX || whereCond.op == influxql.NEQREGEX {
+						return "", Unknown, fmt.Errorf("regular expressions are only supported on tags, not on the %s field", whereCond.key)
+					}
 					hasFilter = true
 					selectFields = append(selectFields, whereCond.key)
 					value := whereCond.value.Val
@@ -541,6 +547,7 @@ func (p *InfluxParser) parseFetch(name string, fetchType influxql.DataType, sele
 		mc2 += " <% DROP DUP ATTRIBUTES RELABEL [ [ $start $end ] ] CLIP %> LMAP APPEND %> IFT FLATTEN \n"
 
 	}
+	mc2 += p.toLocalTime()
 	if hasFilter {
 		filter := `
 		'set' STORE
@@ -750,6 +757,16 @@ func (p *InfluxParser) parseCall(expr *influxql.Call, selectors []string, where
 			FLATTEN
 			`
 		}
+	case "holt_winters", "holt_winters_with_fit",
+		"exponential_moving_average", "double_exponential_moving_average", "triple_exponential_moving_average",
+		"triple_exponential_derivative", "relative_strength_index",
+		"kaufmans_efficiency_ratio", "kaufmans_adaptive_moving_average", "chande_momentum_oscillator":
+		ta, err := p.parseTechnicalAnalysis(expr, selectors, where)
+		if err != nil {
+			return "", Unknown, err
+		}
+		mc2 += ta
+
 	case "histogram":
 		errorString := "undefined function histogram()"
 		return errorString, Unknown, fmt.Errorf(errorString)
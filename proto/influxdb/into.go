@@ -0,0 +1,152 @@
+package influxdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxql"
+	"github.com/ovh/erlenmeyer/core"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// parseInfluxSelectInto execute a SELECT INTO statement: the select result
+// rows are written back in Warp 10 under the target measurement
+func parseInfluxSelectInto(statement *influxql.SelectStatement, statementid int, txn string, token string, writeToken string, timePrecision string) (*Result, error) {
+	if writeToken == "" {
+		return nil, errors.New("SELECT INTO requires a WRITE token")
+	}
+
+	// Select with a millisecond precision: the times are then the Warp 10
+	// ticks divided by 1000, that are rounded back to whole ticks
+	result, err := parseInfluxSelect(statement, statementid, txn, token, "ms")
+	if err != nil {
+		return nil, err
+	}
+	if result.Err != "" {
+		return result, nil
+	}
+
+	separator, _ := parseSeparatorCondition(statement.Condition)
+
+	lines, err := intoGTSInput(result.Series, statement.Target, separator)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) > 0 {
+		warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "influxql-into")
+		if err = warpServer.Update(writeToken, strings.Join(lines, "\n")); err != nil {
+			log.WithFields(log.Fields{
+				"target": statement.Target.String(),
+				"proto":  "influxQL",
+				"error":  err.Error(),
+			}).Error("Error writing some GTS")
+			return nil, err
+		}
+	}
+
+	// InfluxDB answers the number of written points at epoch 0
+	return &Result{
+		StatementID: statementid,
+		Series: []*Row{{
+			Name:    "result",
+			Columns: []string{"time", "written"},
+			Values:  [][]interface{}{{getFormatedTime(0, timePrecision, time.UTC), len(lines)}},
+		}},
+	}, nil
+}
+
+// intoGTSInput convert the select result rows into Warp 10 input format
+// lines, one line per non null value
+func intoGTSInput(rows []*Row, target *influxql.Target, separator string) ([]string, error) {
+	lines := make([]string, 0)
+
+	for _, row := range rows {
+		measurement := target.Measurement.Name
+		if measurement == "" {
+			// INTO :MEASUREMENT back reference
+			measurement = row.Name
+		}
+
+		labels := make([]string, 0, len(row.Tags))
+		for key, value := range row.Tags {
+			labels = append(labels, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+		sort.Strings(labels)
+
+		timeIndex := -1
+		for index, column := range row.Columns {
+			if column == "time" {
+				timeIndex = index
+			}
+		}
+		if timeIndex < 0 {
+			return nil, errors.New("SELECT INTO requires a time column in the select result")
+		}
+
+		for _, values := range row.Values {
+			tick, err := intoTick(values[timeIndex])
+			if err != nil {
+				return nil, err
+			}
+
+			for index, column := range row.Columns {
+				if index == timeIndex || values[index] == nil {
+					continue
+				}
+
+				value, err := intoValue(values[index])
+				if err != nil {
+					return nil, err
+				}
+
+				classname := url.QueryEscape(measurement + separator + column)
+				lines = append(lines, fmt.Sprintf("%d// %s{%s} %s", tick, classname, strings.Join(labels, ","), value))
+			}
+		}
+	}
+	return lines, nil
+}
+
+// intoTick convert a millisecond select result time into a Warp 10 tick
+func intoTick(value interface{}) (int64, error) {
+	switch value := value.(type) {
+	case float64:
+		return int64(math.Round(value * float64(time.Millisecond) / float64(getNanoSeconds()))), nil
+	case time.Time:
+		return value.UnixNano() / int64(getNanoSeconds()), nil
+	}
+	return 0, fmt.Errorf("Unsupported time value %v in SELECT INTO", value)
+}
+
+// intoValue format a select result value in Warp 10 input format
+func intoValue(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case float64:
+		// Keep a decimal point to store the value as a double
+		formatted := strconv.FormatFloat(value, 'f', -1, 64)
+		if !strings.Contains(formatted, ".") {
+			formatted += ".0"
+		}
+		return formatted, nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case int:
+		return strconv.Itoa(value), nil
+	case bool:
+		if value {
+			return "T", nil
+		}
+		return "F", nil
+	case string:
+		return "'" + url.QueryEscape(value) + "'", nil
+	}
+	return "", fmt.Errorf("Unsupported value %v in SELECT INTO", value)
+}
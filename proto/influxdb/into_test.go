@@ -0,0 +1,73 @@
+package influxdb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/influxql"
+)
+
+func TestIntoGTSInput(t *testing.T) {
+	rows := []*Row{
+		{
+			Name:    "cpu",
+			Tags:    map[string]string{"host": "a b", "dc": "gra"},
+			Columns: []string{"time", "mean", "status"},
+			Values: [][]interface{}{
+				{float64(3600000), 1.5, "ok"},
+				{float64(7200000), float64(2), nil},
+			},
+		},
+	}
+
+	var tests = []struct {
+		target    *influxql.Target
+		separator string
+		expected  []string
+	}{
+		{
+			&influxql.Target{Measurement: &influxql.Measurement{Name: "cpu_1h"}},
+			".",
+			[]string{
+				"3600000000// cpu_1h.mean{dc=gra,host=a+b} 1.5",
+				"3600000000// cpu_1h.status{dc=gra,host=a+b} 'ok'",
+				"7200000000// cpu_1h.mean{dc=gra,host=a+b} 2.0",
+			},
+		},
+		{
+			&influxql.Target{Measurement: &influxql.Measurement{IsTarget: true}},
+			"_",
+			[]string{
+				"3600000000// cpu_mean{dc=gra,host=a+b} 1.5",
+				"3600000000// cpu_status{dc=gra,host=a+b} 'ok'",
+				"7200000000// cpu_mean{dc=gra,host=a+b} 2.0",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		lines, err := intoGTSInput(rows, test.target, test.separator)
+		if err != nil {
+			t.Errorf("Expected nil for %s, got %v", test.target.String(), err)
+			continue
+		}
+		if !reflect.DeepEqual(lines, test.expected) {
+			t.Errorf("Expected %v for %s, got %v", test.expected, test.target.String(), lines)
+		}
+	}
+}
+
+func TestIntoTick(t *testing.T) {
+	// Times are the microsecond ticks divided by 1000, ticks that are not
+	// whole seconds must be rounded back rather than truncated
+	for _, tick := range []int64{1600000000001000, 1600000000123456, 1599999999999999} {
+		got, err := intoTick(float64(tick) / 1000)
+		if err != nil {
+			t.Errorf("Expected nil for %d, got %v", tick, err)
+			continue
+		}
+		if got != tick {
+			t.Errorf("Expected %d, got %d", tick, got)
+		}
+	}
+}
@@ -1,10 +1,121 @@
 package influxdb
 
 import (
+	"encoding/json"
 	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ovh/erlenmeyer/core"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	// influxDBVersion is the InfluxDB version erlenmeyer is compatible with
+	influxDBVersion = "1.8.10"
+	// influxDBBuild is the InfluxDB build type
+	influxDBBuild = "OSS"
 )
 
+// Health an InfluxDB health response
+// https://docs.influxdata.com/influxdb/v1.8/tools/api/#health-http-endpoint
+type Health struct {
+	Name    string   `json:"name"`
+	Message string   `json:"message"`
+	Status  string   `json:"status"`
+	Checks  []string `json:"checks"`
+	Version string   `json:"version"`
+}
+
+// healthCache keep the last Warp 10 backend check, so that health probes
+// don't each hit the backend
+type healthCache struct {
+	mutex   sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// check return the last backend check result, running it again once older
+// than ttl. Concurrent calls wait for the running check
+func (c *healthCache) check(ttl time.Duration, run func() error) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.checked.IsZero() || time.Since(c.checked) >= ttl {
+		c.err = run()
+		c.checked = time.Now()
+	}
+	return c.err
+}
+
+// setVersionHeaders set the InfluxDB version headers expected by the clients
+func setVersionHeaders(w http.ResponseWriter) {
+	w.Header().Set("X-Influxdb-Version", influxDBVersion)
+	w.Header().Set("X-Influxdb-Build", influxDBBuild)
+}
+
 // Ping returns a simple response to let the client know the server is running.
+// https://docs.influxdata.com/influxdb/v1.8/tools/api/#ping-http-endpoint
 func (i *InfluxDB) Ping(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNoContent)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		i.WarnCounter.Inc()
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	setVersionHeaders(w)
+
+	verbose := r.URL.Query().Get("verbose")
+	if verbose == "" || verbose == "0" || verbose == "false" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"version": influxDBVersion})
+}
+
+// Health returns the erlenmeyer health, failing when the Warp 10 backend is
+// not reachable. The backend check is cached for influxdb.health.cache
+func (i *InfluxDB) Health(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		i.WarnCounter.Inc()
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	setVersionHeaders(w)
+
+	health := &Health{
+		Name:    "influxdb",
+		Message: "ready for queries and writes",
+		Status:  "pass",
+		Checks:  []string{},
+		Version: influxDBVersion,
+	}
+	status := http.StatusOK
+
+	err := i.health.check(viper.GetDuration("influxdb.health.cache"), func() error {
+		warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "influxdb-health")
+		return warpServer.Check(viper.GetDuration("influxdb.health.timeout"))
+	})
+	if err != nil {
+		// The error details the backend endpoint, it is only logged
+		i.ErrCounter.Inc()
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+			"proto": "influxdb",
+		}).Error("Warp 10 backend health check failed")
+		health.Message = "backend unavailable"
+		health.Status = "fail"
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(health)
 }
@@ -0,0 +1,90 @@
+package influxdb
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+func newTestInfluxDB() *InfluxDB {
+	return &InfluxDB{
+		ReqCounter:  prometheus.NewCounter(prometheus.CounterOpts{Name: "request"}),
+		ErrCounter:  prometheus.NewCounter(prometheus.CounterOpts{Name: "errors"}),
+		WarnCounter: prometheus.NewCounter(prometheus.CounterOpts{Name: "warning"}),
+	}
+}
+
+func TestPing(t *testing.T) {
+	var tests = []struct {
+		method string
+		url    string
+		status int
+		body   string
+	}{
+		{http.MethodGet, "/influxdb/ping", http.StatusNoContent, ""},
+		{http.MethodHead, "/influxdb/ping", http.StatusNoContent, ""},
+		{http.MethodGet, "/influxdb/ping?verbose=false", http.StatusNoContent, ""},
+		{http.MethodGet, "/influxdb/ping?verbose=true", http.StatusOK, "{\"version\":\"" + influxDBVersion + "\"}\n"},
+		{http.MethodPost, "/influxdb/ping", http.StatusMethodNotAllowed, "Method Not Allowed\n"},
+	}
+
+	i := newTestInfluxDB()
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		i.Ping(w, httptest.NewRequest(test.method, test.url, nil))
+
+		if w.Code != test.status {
+			t.Errorf("Expected status %d for %s %s, got %d", test.status, test.method, test.url, w.Code)
+		}
+		if w.Body.String() != test.body {
+			t.Errorf("Expected body %q for %s %s, got %q", test.body, test.method, test.url, w.Body.String())
+		}
+		if test.status != http.StatusMethodNotAllowed && w.Header().Get("X-Influxdb-Version") != influxDBVersion {
+			t.Errorf("Expected X-Influxdb-Version header for %s %s", test.method, test.url)
+		}
+	}
+}
+
+func TestHealthUnreachableBackend(t *testing.T) {
+	viper.Set("warp_endpoint", "http://127.0.0.1:1")
+	defer viper.Set("warp_endpoint", nil)
+
+	w := httptest.NewRecorder()
+	newTestInfluxDB().Health(w, httptest.NewRequest(http.MethodGet, "/influxdb/health", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if strings.Contains(w.Body.String(), "127.0.0.1") {
+		t.Errorf("Expected the backend endpoint to be hidden, got %s", w.Body.String())
+	}
+}
+
+func TestHealthCache(t *testing.T) {
+	runs := 0
+	run := func() error {
+		runs++
+		return errors.New("unreachable")
+	}
+
+	cache := &healthCache{}
+	for index := 0; index < 3; index++ {
+		if err := cache.check(time.Minute, run); err == nil {
+			t.Errorf("Expected the cached error, got nil")
+		}
+	}
+	if runs != 1 {
+		t.Errorf("Expected a single check within the cache duration, got %d", runs)
+	}
+
+	cache.check(0, run) // nolint: errcheck
+	if runs != 2 {
+		t.Errorf("Expected a new check once the cache expired, got %d checks", runs)
+	}
+}
@@ -0,0 +1,136 @@
+package influxdb
+
+import (
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxql"
+)
+
+// started is the process start time, shown in the diagnostics
+var started = time.Now()
+
+// runningQuery is an InfluxQL query in progress
+type runningQuery struct {
+	id       uint64
+	query    string
+	database string
+	token    string
+	start    time.Time
+}
+
+// queryRegistry track the in-flight queries, listed by SHOW QUERIES
+type queryRegistry struct {
+	mutex   sync.Mutex
+	nextID  uint64
+	queries map[uint64]*runningQuery
+}
+
+// newQueryRegistry return an empty registry
+func newQueryRegistry() *queryRegistry {
+	return &queryRegistry{nextID: 1, queries: make(map[uint64]*runningQuery)}
+}
+
+// register add a query in progress and return its id
+func (r *queryRegistry) register(query, database, token string) uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	id := r.nextID
+	r.nextID++
+	r.queries[id] = &runningQuery{id: id, query: query, database: database, token: token, start: time.Now()}
+	return id
+}
+
+// unregister remove a finished query
+func (r *queryRegistry) unregister(id uint64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.queries, id)
+}
+
+// showQueries answer the SHOW QUERIES statement with the queries in
+// progress of a token
+func (r *queryRegistry) showQueries(statementid int, token string) Result {
+	r.mutex.Lock()
+	queries := make([]runningQuery, 0, len(r.queries))
+	for _, query := range r.queries {
+		if query.token == token {
+			queries = append(queries, *query)
+		}
+	}
+	r.mutex.Unlock()
+
+	sort.Slice(queries, func(i, j int) bool { return queries[i].id < queries[j].id })
+
+	row := &Row{Columns: []string{"qid", "query", "database", "duration", "status"}, Values: make([][]interface{}, 0, len(queries))}
+	for _, query := range queries {
+		duration := influxql.FormatDuration(time.Since(query.start).Truncate(time.Microsecond))
+		row.Values = append(row.Values, []interface{}{int64(query.id), query.query, query.database, duration, "running"})
+	}
+	return Result{StatementID: statementid, Series: []*Row{row}}
+}
+
+// showDiagnostics answer the SHOW DIAGNOSTICS statement with the erlenmeyer
+// build, runtime and system diagnostics, filtered by module
+func showDiagnostics(statementid int, module string) Result {
+	now := time.Now().UTC()
+	rows := []*Row{
+		{
+			Name:    "build",
+			Columns: []string{"Branch", "Build Time", "Commit", "Version"},
+			Values:  [][]interface{}{{"", "", "", influxDBVersion}},
+		},
+		{
+			Name:    "runtime",
+			Columns: []string{"GOARCH", "GOMAXPROCS", "GOOS", "version"},
+			Values:  [][]interface{}{{runtime.GOARCH, runtime.GOMAXPROCS(0), runtime.GOOS, runtime.Version()}},
+		},
+		{
+			Name:    "system",
+			Columns: []string{"PID", "currentTime", "started", "uptime"},
+			Values:  [][]interface{}{{os.Getpid(), now.Format(time.RFC3339Nano), started.UTC().Format(time.RFC3339Nano), now.Sub(started).Truncate(time.Second).String()}},
+		},
+	}
+	return Result{StatementID: statementid, Series: filterModule(rows, module)}
+}
+
+// showStats answer the SHOW STATS statement with the erlenmeyer runtime
+// statistics, filtered by module
+func showStats(statementid int, module string) Result {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	// Values are converted to int64, as unsigned values would be encoded as strings
+	rows := []*Row{
+		{
+			Name:    "runtime",
+			Columns: []string{"Alloc", "Frees", "HeapAlloc", "HeapIdle", "HeapInUse", "HeapObjects", "HeapReleased", "HeapSys", "Lookups", "Mallocs", "NumGC", "NumGoroutine", "PauseTotalNs", "Sys", "TotalAlloc"},
+			Values: [][]interface{}{{
+				int64(stats.Alloc), int64(stats.Frees), int64(stats.HeapAlloc), int64(stats.HeapIdle), int64(stats.HeapInuse), int64(stats.HeapObjects),
+				int64(stats.HeapReleased), int64(stats.HeapSys), int64(stats.Lookups), int64(stats.Mallocs), int64(stats.NumGC), int64(runtime.NumGoroutine()),
+				int64(stats.PauseTotalNs), int64(stats.Sys), int64(stats.TotalAlloc),
+			}},
+		},
+	}
+	return Result{StatementID: statementid, Series: filterModule(rows, module)}
+}
+
+// filterModule keep the rows of a module, all of them without module
+func filterModule(rows []*Row, module string) []*Row {
+	if module == "" {
+		return rows
+	}
+
+	filtered := make([]*Row, 0)
+	for _, row := range rows {
+		if row.Name == module {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,45 @@
+package influxdb
+
+import "testing"
+
+func TestQueryRegistry(t *testing.T) {
+	registry := newQueryRegistry()
+
+	first := registry.register("SELECT v FROM cpu", "db", "T")
+	registry.register("SHOW QUERIES", "db", "T")
+	registry.register("SELECT v FROM mem", "db", "U")
+
+	result := registry.showQueries(0, "T")
+	if len(result.Series) != 1 || len(result.Series[0].Values) != 2 {
+		t.Fatalf("Expected the 2 queries of the token, got %+v", result.Series)
+	}
+	if _, ok := result.Series[0].Values[0][0].(int64); !ok {
+		t.Errorf("Expected an int64 qid, got %T", result.Series[0].Values[0][0])
+	}
+	if result.Series[0].Values[0][1] != "SELECT v FROM cpu" || result.Series[0].Values[0][4] != "running" {
+		t.Errorf("Expected the first query, got %v", result.Series[0].Values[0])
+	}
+
+	registry.unregister(first)
+	result = registry.showQueries(0, "T")
+	if len(result.Series[0].Values) != 1 || result.Series[0].Values[0][1] != "SHOW QUERIES" {
+		t.Errorf("Expected the remaining query, got %v", result.Series[0].Values)
+	}
+}
+
+func TestShowDiagnostics(t *testing.T) {
+	if rows := showDiagnostics(0, "").Series; len(rows) != 3 {
+		t.Errorf("Expected all the diagnostics, got %d rows", len(rows))
+	}
+	if rows := showDiagnostics(0, "build").Series; len(rows) != 1 || rows[0].Values[0][3] != influxDBVersion {
+		t.Errorf("Expected the build diagnostics, got %+v", rows)
+	}
+	for _, value := range showStats(0, "runtime").Series[0].Values[0] {
+		if _, ok := value.(int64); !ok {
+			t.Errorf("Expected int64 runtime stats, got %T", value)
+		}
+	}
+	if rows := showStats(0, "unknown").Series; len(rows) != 0 {
+		t.Errorf("Expected no stats, got %+v", rows)
+	}
+}
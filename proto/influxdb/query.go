@@ -11,6 +11,7 @@ import (
 	"net/http/httputil"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -157,7 +158,22 @@ func (i *InfluxDB) Query(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body, err := handleQuery(q, epoch, db, w.Header().Get(middlewares.TxnHeader), token, timePrecision)
+	// Statements deleting series are only allowed with a POST request
+	for _, statement := range q.Statements {
+		if isWriteStatement(statement) && r.Method != http.MethodPost {
+			i.WarnCounter.Inc()
+			errorString, _ := json.Marshal(&SimpleErrorResult{Err: fmt.Sprintf("%s requires a POST request and a WRITE token", statement.String())})
+			http.Error(w, string(errorString), http.StatusMethodNotAllowed)
+			return
+		}
+	}
+
+	dryRun := r.FormValue("dryrun") == "true"
+	writeToken := core.RetrieveWriteToken(r)
+
+	queryID := i.queries.register(q.String(), db, token)
+	resp, err := handleQuery(q, epoch, db, w.Header().Get(middlewares.TxnHeader), token, writeToken, timePrecision, dryRun, i.queries)
+	i.queries.unregister(queryID)
 	if err != nil {
 
 		influxParsing := &SimpleErrorResult{Err: "error executing query: " + err.Error()}
@@ -176,32 +192,66 @@ func (i *InfluxDB) Query(w http.ResponseWriter, r *http.Request) {
 
 	i.ReqCounter.Inc()
 
-	if acceptHeader, ok := r.Header["Accept"]; ok && len(acceptHeader) > 0 && acceptHeader[0] != "*/*" {
-		w.Header().Set("Content-Type", strings.Join(acceptHeader, "; "))
-	} else {
-		w.Header().Set("Content-Type", "application/json")
-	}
-
+	encoder := newResponseEncoder(r.Header.Get("Accept"))
+	w.Header().Set("Content-Type", encoder.ContentType())
 	w.WriteHeader(http.StatusOK)
 
-	if body != nil {
-		if _, err = w.Write(body); err != nil {
+	chunks := []*Response{resp}
+	if r.FormValue("chunked") == "true" {
+		chunkSize, _ := strconv.Atoi(r.FormValue("chunk_size"))
+		chunks = chunkResponse(resp, chunkSize)
+	}
+
+	for _, chunk := range chunks {
+		if err = encoder.Encode(w, chunk); err != nil {
 			log.WithError(err).Error("Could not awnser to the influx request")
+			return
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
 		}
 	}
 }
 
-func handleQuery(q *influxql.Query, epoch string, db string, txn string, token string, timePrecision string) ([]byte, error) {
+func handleQuery(q *influxql.Query, epoch string, db string, txn string, token string, writeToken string, timePrecision string, dryRun bool, queries *queryRegistry) (*Response, error) {
 
 	// Use the copied Response of InfluxQL:
 	// https://github.com/influxdata/influxdb/blob/master/query/influxql/go
 	influx := &Response{}
 
+	// Consecutive SELECT statements are executed in a single WarpScript
+	selects := make([]*influxql.SelectStatement, 0)
+	selectids := make([]int, 0)
+	flushSelects := func() error {
+		if len(selects) == 0 {
+			return nil
+		}
+		results, err := parseInfluxSelects(selects, selectids, txn, token, timePrecision)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			influx.Results = append(influx.Results, *result)
+		}
+		selects = selects[:0]
+		selectids = selectids[:0]
+		return nil
+	}
+
 	// Support for Select ans some needed statements
 	for i, statement := range q.Statements {
+		if stmt, isSelect := statement.(*influxql.SelectStatement); isSelect && stmt.Target == nil {
+			selects = append(selects, stmt)
+			selectids = append(selectids, i)
+			continue
+		}
+		if err := flushSelects(); err != nil {
+			return nil, err
+		}
+
 		switch stmt := statement.(type) {
 		case *influxql.SelectStatement:
-			result, err := parseInfluxSelect(stmt, i, txn, token, timePrecision)
+			result, err := parseInfluxSelectInto(stmt, i, txn, token, writeToken, timePrecision)
 			if err != nil {
 				return nil, err
 			}
@@ -244,6 +294,12 @@ func handleQuery(q *influxql.Query, epoch string, db string, txn string, token s
 			influx.Results = append(influx.Results, *result)
 		case *influxql.DropDatabaseStatement:
 			return nil, errors.New("Please delete series to drop your account")
+		case *influxql.DeleteSeriesStatement, *influxql.DropSeriesStatement, *influxql.DropMeasurementStatement:
+			result, err := parseInfluxDelete(stmt, i, token, writeToken, dryRun)
+			if err != nil {
+				return nil, err
+			}
+			influx.Results = append(influx.Results, *result)
 		case *influxql.ShowRetentionPoliciesStatement:
 			influx.Results = append(influx.Results, defaultShowRetentionPoliciesStatement(i))
 		case *influxql.ShowMeasurementsStatement:
@@ -265,12 +321,27 @@ func handleQuery(q *influxql.Query, epoch string, db string, txn string, token s
 				return nil, err
 			}
 			influx.Results = append(influx.Results, *result)
+		case *influxql.ShowSeriesCardinalityStatement, *influxql.ShowMeasurementCardinalityStatement, *influxql.ShowFieldKeyCardinalityStatement:
+			result, err := parseInfluxCardinality(stmt, i, token)
+			if err != nil {
+				return nil, err
+			}
+			influx.Results = append(influx.Results, *result)
+		case *influxql.ShowQueriesStatement:
+			influx.Results = append(influx.Results, queries.showQueries(i, token))
+		case *influxql.ShowDiagnosticsStatement:
+			influx.Results = append(influx.Results, showDiagnostics(i, stmt.Module))
+		case *influxql.ShowStatsStatement:
+			influx.Results = append(influx.Results, showStats(i, stmt.Module))
 		default:
 			log.Warnf("handleQuery - Default %s %T", stmt.String(), stmt)
 			return nil, fmt.Errorf("Statement not implemented yet: %T", stmt)
 		}
 	}
-	return json.Marshal(influx)
+	if err := flushSelects(); err != nil {
+		return nil, err
+	}
+	return influx, nil
 }
 
 // parseInfluxSeries parse ALL SHOW META Influx statements kind
@@ -289,7 +360,11 @@ func (showStatement *InfluxShowStatement) parseInfluxSeries(statementid int, txn
 		switch source := source.(type) {
 		case *influxql.Measurement:
 			if source.Regex != nil {
-				classnames = append(classnames, source.Regex.Val.String()+".*")
+				classname, err := javaRegex(source.Regex.Val.String())
+				if err != nil {
+					return nil, err
+				}
+				classnames = append(classnames, classname)
 			} else {
 				classnames = append(classnames, regexp.QuoteMeta(source.Name))
 			}
@@ -343,7 +418,10 @@ func (showStatement *InfluxShowStatement) parseInfluxSeries(statementid int, txn
 					op = "~"
 				case influxql.EQ:
 					op = "="
-				case influxql.NEQREGEX, influxql.NEQ:
+				case influxql.NEQREGEX:
+					// Negated regular expressions are already translated
+					op = "~"
+				case influxql.NEQ:
 					op = "~"
 					value = fmt.Sprintf("(?!%s).*?", rhsValue)
 				default:
@@ -391,11 +469,13 @@ func (showStatement *InfluxShowStatement) parseInfluxSeries(statementid int, txn
 	case ShowTagValues, ShowTagValuesCardinality:
 		switch showStatement.TagKeyExpr.(type) {
 		case *influxql.RegexLiteral:
-			regExp := showStatement.TagKeyExpr.String()
-			regExp = strings.TrimLeft(regExp, "/")
-			regExp = strings.TrimRight(regExp, "/")
+			regExp, err := javaRegex(showStatement.TagKeyExpr.(*influxql.RegexLiteral).Val.String())
+			if err != nil {
+				return nil, err
+			}
 			mc2 += "[] 'labelsKeys' STORE\n"
-			mc2 += fmt.Sprintf("[ '%s' ] 'regExp' STORE\n", regExp)
+			// MATCH returns the matched groups, the group makes it not empty on match
+			mc2 += fmt.Sprintf("[ '(%s)' ] 'regExp' STORE\n", regExp)
 		case *influxql.StringLiteral:
 			labelsKey := showStatement.TagKeyExpr.String()
 			labelsKey = strings.TrimLeft(labelsKey, "'")
@@ -824,92 +904,11 @@ func getShowTagValuesWarpScript(token, findString, labelsFilter string, offset,
 
 // parseInfluxSelect function used to Create Warp 10 query based on an Influx SELECT statement
 func parseInfluxSelect(statement *influxql.SelectStatement, statementid int, txn string, token string, timePrecision string) (*Result, error) {
-
-	warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "influxql")
-
-	keepTopLabels := make([]string, 0)
-
-	p := &InfluxParser{Classnames: make([]string, 0), Token: token, End: "$end", BucketTime: "0", BucketCount: "1", Separator: ".", KeepTopLabels: keepTopLabels}
-
-	mc2, respResult, _, _, err := p.getSelectStatementScript(statement, warpServer, txn, 0, statementid)
-
-	if respResult != nil {
-		return respResult, nil
-	}
-
-	if err != nil {
-		return nil, err
-	}
-
-	authenticate := fmt.Sprintf("'3' MINREV <%% '%s' CAPADD %%> <%% '%s' AUTHENTICATE EVAL %%> IFTE\n", token, token)
-
-	mc2 = authenticate + `
-	// keys of STACKATTRIBUTE can be found here: https://github.com/cityzendata/warp10-platform/blob/master/warp10/src/main/java/io/warp10/script/WarpScriptStack.java
-	'stack.maxops.hard' STACKATTRIBUTE DUP <% ISNULL ! %> <% MAXOPS %> <% DROP %> IFTE
-	'fetch.limit.hard' STACKATTRIBUTE DUP <% ISNULL ! %> <% LIMIT %> <% DROP %> IFTE
-	'gts.limit.hard' STACKATTRIBUTE DUP <% ISNULL ! %> <% MAXGTS %> <% DROP %> IFTE
-	` + mc2
-
-	queryRes, err := warpServer.Query(mc2, txn)
-
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err.Error(),
-			"proto": "influxQL",
-		}).Error("Bad response from Egress")
-		return nil, err
-	}
-	buffer, err := ioutil.ReadAll(queryRes.Body)
+	results, err := parseInfluxSelects([]*influxql.SelectStatement{statement}, []int{statementid}, txn, token, timePrecision)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err.Error(),
-			"proto": "influxQL",
-		}).Error("can't fully read Egress response")
 		return nil, err
 	}
-
-	// HACK : replace NaN values from Warp to 0
-	s := strings.Replace(string(buffer), "NaN", "0", -1)
-	buffer = []byte(s)
-
-	if queryRes.StatusCode != http.StatusOK {
-		return &Result{Err: "Invalid generated query: returned error is - " + string(buffer)}, nil
-	}
-
-	responses := [][]core.GeoTimeSeries{}
-	err = json.Unmarshal(buffer, &responses)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err.Error(),
-			"proto": "influxQL",
-		}).Error("Cannot unmarshal egress response")
-		return nil, err
-	}
-	// Since it's a range_query, we can enforce the matrix resultType
-	influxResponse := &Result{StatementID: statementid, Series: make([]*Row, 0)}
-
-	for _, series := range responses {
-		if len(series) == 0 {
-			continue
-		}
-
-		if p.HasGroupBy {
-			_, tags := statement.Dimensions.Normalize()
-			resp, err := splitPerTagsResult(series, statementid, p.TimeColumn, p.Measurement, timePrecision, statement.Location, tags, statement.Fields.AliasNames())
-			if err != nil {
-				return nil, err
-			}
-			influxResponse.Series = append(influxResponse.Series, resp...)
-		} else {
-			resp, err := warpToInfluxResponse(series, statementid, p.TimeColumn, p.Measurement, timePrecision, statement.Location)
-			if err != nil {
-				return nil, err
-			}
-			influxResponse.Series = append(influxResponse.Series, resp)
-		}
-	}
-
-	return influxResponse, nil
+	return results[0], nil
 }
 
 // invalidNumberOfArgs: generate generic invalidNumberOfArgs strings
@@ -1170,6 +1169,10 @@ func getFormatedTime(tick float64, timePrecision string, location *time.Location
 	switch timePrecision {
 	case "rfc3339":
 		unixTimeUTC := time.Unix(0, int64(tick)*int64(time.Millisecond)).UTC()
+		if location != nil {
+			// Apply the tz() clause offset
+			return unixTimeUTC.In(location).Format(time.RFC3339)
+		}
 		return unixTimeUTC.Format(time.RFC3339)
 	case "ms":
 		return tick
@@ -1271,3 +1274,26 @@ func defaultShowRetentionPoliciesStatement(statementid int) Result {
 	series[0] = defaultRow
 	return Result{StatementID: statementid, Series: series}
 }
+
+// Measurements return the measurements names as listed by SHOW MEASUREMENTS,
+// it's used by the protocols exposing the measurements as buckets
+func Measurements(txn string, token string) ([]string, error) {
+	showStatement := &InfluxShowStatement{QueryType: ShowMeasurements, Name: "measurements", Columns: []string{"name"}, Separator: "."}
+	result, err := showStatement.parseInfluxSeries(0, txn, token, 0, 0, influxql.Sources{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	measurements := make([]string, 0)
+	for _, row := range result.Series {
+		for _, values := range row.Values {
+			for _, value := range values {
+				if name, ok := value.(string); ok {
+					measurements = append(measurements, name)
+				}
+			}
+		}
+	}
+	sort.Strings(measurements)
+	return measurements, nil
+}
@@ -0,0 +1,225 @@
+package influxdb
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// javaRegex translate an InfluxQL regular expression, in Go RE2 syntax and
+// matching any part of a string, into the Java regular expression fully
+// matching the same strings, as used in Warp 10 selectors and filters.
+// Literals are escaped so the result can be used as is in a selector or a
+// WarpScript string: templated values (a Grafana $host) can't break them.
+// https://docs.influxdata.com/influxdb/v1.7/query_language/data_exploration/#regular-expressions
+func javaRegex(pattern string) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", fmt.Errorf("invalid regular expression /%s/: %s", pattern, err.Error())
+	}
+	re = re.Simplify()
+
+	// InfluxQL matches any part of the string, unless anchored
+	subs := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		subs = re.Sub
+	}
+	prefix, suffix := "(?s:.*)", "(?s:.*)"
+	if len(subs) > 0 && subs[0].Op == syntax.OpBeginText {
+		prefix = ""
+		subs = subs[1:]
+	}
+	if len(subs) > 0 && subs[len(subs)-1].Op == syntax.OpEndText {
+		suffix = ""
+		subs = subs[:len(subs)-1]
+	}
+
+	var b strings.Builder
+	for _, sub := range subs {
+		if err = writeJavaRegex(&b, sub, len(subs) > 1 || prefix != "" || suffix != ""); err != nil {
+			return "", fmt.Errorf("unsupported regular expression /%s/: %s", pattern, err.Error())
+		}
+	}
+	return prefix + b.String() + suffix, nil
+}
+
+// javaNotRegex return the Java regular expression fully matching the strings
+// not matched by an InfluxQL regular expression
+func javaNotRegex(pattern string) (string, error) {
+	re, err := javaRegex(pattern)
+	if err != nil {
+		return "", err
+	}
+	return "(?!(?:" + re + ")\\z)(?s:.*)", nil
+}
+
+// writeJavaRegex write a RE2 syntax tree in Java syntax, alternations are
+// grouped when the expression is part of a sequence
+// nolint: gocyclo
+func writeJavaRegex(b *strings.Builder, re *syntax.Regexp, inSequence bool) error {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		b.WriteString("(?!)")
+	case syntax.OpEmptyMatch:
+		// Nothing to match
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			b.WriteString("(?iu:")
+		}
+		for _, r := range re.Rune {
+			writeJavaRune(b, r)
+		}
+		if re.Flags&syntax.FoldCase != 0 {
+			b.WriteString(")")
+		}
+	case syntax.OpCharClass:
+		writeJavaCharClass(b, re.Rune)
+	case syntax.OpAnyCharNotNL:
+		b.WriteString(`[^\n]`)
+	case syntax.OpAnyChar:
+		b.WriteString("(?s:.)")
+	case syntax.OpBeginLine:
+		b.WriteString("(?md:^)")
+	case syntax.OpEndLine:
+		b.WriteString("(?md:$)")
+	case syntax.OpBeginText:
+		b.WriteString(`\A`)
+	case syntax.OpEndText:
+		b.WriteString(`\z`)
+	case syntax.OpWordBoundary:
+		// RE2 word boundaries are ASCII ones, as the Java \w class
+		b.WriteString(`(?:(?<=\w)(?!\w)|(?<!\w)(?=\w))`)
+	case syntax.OpNoWordBoundary:
+		b.WriteString(`(?:(?<=\w)(?=\w)|(?<!\w)(?!\w))`)
+	case syntax.OpCapture:
+		b.WriteString("(")
+		if err := writeJavaRegex(b, re.Sub[0], false); err != nil {
+			return err
+		}
+		b.WriteString(")")
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		if err := writeJavaRepeat(b, re); err != nil {
+			return err
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if err := writeJavaRegex(b, sub, true); err != nil {
+				return err
+			}
+		}
+	case syntax.OpAlternate:
+		if inSequence {
+			b.WriteString("(?:")
+		}
+		for index, sub := range re.Sub {
+			if index > 0 {
+				b.WriteString("|")
+			}
+			if err := writeJavaRegex(b, sub, false); err != nil {
+				return err
+			}
+		}
+		if inSequence {
+			b.WriteString(")")
+		}
+	default:
+		return fmt.Errorf("%s has no Warp 10 equivalent", re.String())
+	}
+	return nil
+}
+
+// writeJavaRepeat write a repetition, grouping its expression unless it's a
+// single item
+func writeJavaRepeat(b *strings.Builder, re *syntax.Regexp) error {
+	sub := re.Sub[0]
+	single := sub.Op == syntax.OpCharClass || sub.Op == syntax.OpAnyChar || sub.Op == syntax.OpAnyCharNotNL ||
+		sub.Op == syntax.OpCapture || (sub.Op == syntax.OpLiteral && len(sub.Rune) == 1 && sub.Flags&syntax.FoldCase == 0)
+
+	if !single {
+		b.WriteString("(?:")
+	}
+	if err := writeJavaRegex(b, sub, false); err != nil {
+		return err
+	}
+	if !single {
+		b.WriteString(")")
+	}
+
+	switch re.Op {
+	case syntax.OpStar:
+		b.WriteString("*")
+	case syntax.OpPlus:
+		b.WriteString("+")
+	case syntax.OpQuest:
+		b.WriteString("?")
+	case syntax.OpRepeat:
+		// Simplify expand the repetitions, kept for completeness
+		if re.Max < 0 {
+			b.WriteString(fmt.Sprintf("{%d,}", re.Min))
+		} else if re.Min == re.Max {
+			b.WriteString(fmt.Sprintf("{%d}", re.Min))
+		} else {
+			b.WriteString(fmt.Sprintf("{%d,%d}", re.Min, re.Max))
+		}
+	}
+	if re.Flags&syntax.NonGreedy != 0 {
+		b.WriteString("?")
+	}
+	return nil
+}
+
+// writeJavaCharClass write a character class from its ranges, a class
+// containing both the first and last code points is written negated
+func writeJavaCharClass(b *strings.Builder, ranges []rune) {
+	negated := len(ranges) > 0 && ranges[0] == 0 && ranges[len(ranges)-1] == unicode.MaxRune
+	if negated {
+		complement := make([]rune, 0, len(ranges))
+		for index := 1; index+1 < len(ranges); index += 2 {
+			complement = append(complement, ranges[index]+1, ranges[index+1]-1)
+		}
+		ranges = complement
+		if len(ranges) == 0 {
+			// Any character
+			b.WriteString("(?s:.)")
+			return
+		}
+	}
+
+	b.WriteString("[")
+	if negated {
+		b.WriteString("^")
+	}
+	for index := 0; index+1 < len(ranges); index += 2 {
+		writeJavaRune(b, ranges[index])
+		if ranges[index+1] != ranges[index] {
+			b.WriteString("-")
+			writeJavaRune(b, ranges[index+1])
+		}
+	}
+	b.WriteString("]")
+}
+
+// writeJavaRune write a literal character: letters and digits as is, ASCII
+// punctuation escaped by a backslash, the other characters and those with a
+// meaning in selectors, WarpScript strings or URLs as \u escapes
+func writeJavaRune(b *strings.Builder, r rune) {
+	switch {
+	case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'):
+		b.WriteRune(r)
+	case r < unicode.MaxASCII && unicode.IsPunct(r) || unicode.IsSymbol(r) && r < unicode.MaxASCII:
+		if strings.ContainsRune(`'",{}%+`, r) {
+			b.WriteString(fmt.Sprintf(`\u%04X`, r))
+			return
+		}
+		b.WriteRune('\\')
+		b.WriteRune(r)
+	case r > 0xFFFF:
+		// Java regular expressions read supplementary characters from their
+		// surrogate pair
+		r -= 0x10000
+		b.WriteString(fmt.Sprintf(`\u%04X\u%04X`, 0xD800+(r>>10), 0xDC00+(r&0x3FF)))
+	default:
+		b.WriteString(fmt.Sprintf(`\u%04X`, r))
+	}
+}
@@ -0,0 +1,47 @@
+package influxdb
+
+import "testing"
+
+func TestJavaRegex(t *testing.T) {
+	var tests = []struct {
+		pattern  string
+		regex    string
+		notRegex string
+		err      bool
+	}{
+		{`^web1$`, `web1`, `(?!(?:web1)\z)(?s:.*)`, false},
+		{`web`, `(?s:.*)web(?s:.*)`, `(?!(?:(?s:.*)web(?s:.*))\z)(?s:.*)`, false},
+		{`^(a|b)$`, `([a-b])`, `(?!(?:([a-b]))\z)(?s:.*)`, false},
+		{`^10\.0\.0\.1$`, `10\.0\.0\.1`, `(?!(?:10\.0\.0\.1)\z)(?s:.*)`, false},
+		{`^it's,{}$`, `it\u0027s\u002C\u007B\u007D`, `(?!(?:it\u0027s\u002C\u007B\u007D)\z)(?s:.*)`, false},
+		{`(?i)^web`, `(?iu:WEB)(?s:.*)`, `(?!(?:(?iu:WEB)(?s:.*))\z)(?s:.*)`, false},
+		{`^eu.*`, `eu[^\n]*(?s:.*)`, `(?!(?:eu[^\n]*(?s:.*))\z)(?s:.*)`, false},
+		{`^[^a-c]+$`, `[^a-c]+`, `(?!(?:[^a-c]+)\z)(?s:.*)`, false},
+		{`^\d{2,}$`, `[0-9][0-9]+`, `(?!(?:[0-9][0-9]+)\z)(?s:.*)`, false},
+		{`(?m)^a$`, `(?s:.*)(?md:^)a(?md:$)(?s:.*)`, `(?!(?:(?s:.*)(?md:^)a(?md:$)(?s:.*))\z)(?s:.*)`, false},
+		{`^é😀$`, `\u00E9\uD83D\uDE00`, `(?!(?:\u00E9\uD83D\uDE00)\z)(?s:.*)`, false},
+		{`(a`, "", "", true},
+	}
+
+	for _, test := range tests {
+		regex, err := javaRegex(test.pattern)
+		if test.err {
+			if err == nil {
+				t.Errorf("Expected an error for /%s/", test.pattern)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected nil for /%s/, got %v", test.pattern, err)
+			continue
+		}
+		if regex != test.regex {
+			t.Errorf("Expected %s for /%s/, got %s", test.regex, test.pattern, regex)
+		}
+
+		notRegex, err := javaNotRegex(test.pattern)
+		if err != nil || notRegex != test.notRegex {
+			t.Errorf("Expected %s for !~ /%s/, got %s (%v)", test.notRegex, test.pattern, notRegex, err)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/influxdata/influxql"
 	"github.com/ovh/erlenmeyer/core"
@@ -37,6 +38,8 @@ type InfluxParser struct {
 	HasWildCard   bool
 	Separator     string
 	KeepTopLabels []string
+	Location      *time.Location
+	Finds         map[string][][]core.GeoTimeSeries
 }
 
 // Parse a select Statement
@@ -45,28 +48,17 @@ func (p *InfluxParser) getSelectStatementScript(statement *influxql.SelectStatem
 	selectTagsField := make(map[string]bool)
 	subselectFields := make(map[string]bool)
 
-	subQueries := make([]*influxql.SelectStatement, 0)
-
-	p.Classnames = make([]string, 0)
-
-	for _, source := range statement.Sources {
-		switch source := source.(type) {
-		case *influxql.Measurement:
-			if source.Regex != nil {
-				p.Classnames = append(p.Classnames, source.Regex.Val.String())
-			} else {
-				p.Classnames = append(p.Classnames, regexp.QuoteMeta(source.Name))
-			}
-		case *influxql.SubQuery:
-			subQueries = append(subQueries, source.Statement)
-		}
+	classnames, subQueries, err := sourceClassnames(statement.Sources)
+	if err != nil {
+		return "", nil, selectValidField, selectTagsField, err
 	}
+	p.Classnames = classnames
 
 	selectSubMc2 := make([]string, len(subQueries))
 	duration, tags := statement.Dimensions.Normalize()
 	hasSubQueries := len(subQueries) > 0
 	for index, subQuery := range subQueries {
-		subQueryParser := &InfluxParser{Classnames: make([]string, 0), Token: p.Token, End: "$end", BucketTime: "0", BucketCount: "1", Separator: p.Separator, KeepTopLabels: p.KeepTopLabels}
+		subQueryParser := &InfluxParser{Classnames: make([]string, 0), Token: p.Token, End: "$end", BucketTime: "0", BucketCount: "1", Separator: p.Separator, KeepTopLabels: p.KeepTopLabels, Finds: p.Finds}
 
 		prefix, resResp, subselectValidField, subselectTagsField, err := subQueryParser.getSelectStatementScript(subQuery, warpServer, txn, subqueryLevel+1, statementid)
 
@@ -138,6 +130,9 @@ func (p *InfluxParser) getSelectStatementScript(statement *influxql.SelectStatem
 		p.BucketCount = fmt.Sprintf("$interval %s / 1 +", groupByDuration)
 	}
 
+	p.Location = statement.Location
+	mc2 += p.timezoneScript()
+
 	if p.HasSubQuery && start == "0" {
 
 	} else {
@@ -150,8 +145,6 @@ func (p *InfluxParser) getSelectStatementScript(statement *influxql.SelectStatem
 	}
 	selectedField := statement.Fields.AliasNames()
 
-	findClass := "~"
-	classname := fmt.Sprintf("(%s", strings.Join(p.Classnames, "|"))
 	findResponses := [][]core.GeoTimeSeries{}
 	where := make([][]*WhereCond, 0)
 	if statement.Condition != nil {
@@ -163,37 +156,10 @@ func (p *InfluxParser) getSelectStatementScript(statement *influxql.SelectStatem
 		where = whereCond
 	}
 
-	for _, field := range statement.Fields {
-		separator := "\\."
-		if p.Separator != "." {
-			separator = p.Separator
-		}
-
-		if strings.Contains(field.String(), "*") {
-			if !p.StarQuery {
-				findClass += classname + ")" + separator + "(.*)|"
-				p.StarQuery = true
-			}
-			continue
-		}
-		varRefNames := influxql.ExprNames(field.Expr)
-		for _, ref := range varRefNames {
-			valueName := ref.Val
-			if strings.HasPrefix(valueName, "/") && strings.HasSuffix(valueName, "/") {
-				valueName = strings.TrimPrefix(valueName, "/")
-				valueName = strings.TrimSuffix(valueName, "/")
-			} else {
-				valueName = regexp.QuoteMeta(valueName)
-			}
-			findClass += classname + ")" + separator + "(" + valueName + ")|"
-		}
-
-		// Handle case of misformed varref returned by influx library
-		if len(varRefNames) == 0 {
-			findClass += classname + ")" + separator + "(.*)|"
-		}
+	findClass, err := p.findSelector(statement.Fields)
+	if err != nil {
+		return "", nil, selectValidField, selectTagsField, err
 	}
-	findClass += ""
 
 	// Check if an error exists in ParseExpr prior to run any queries
 	selectors := make([]string, 0)
@@ -204,26 +170,10 @@ func (p *InfluxParser) getSelectStatementScript(statement *influxql.SelectStatem
 		}
 	}
 
-	if len(where) > 0 {
-		findmc2 := fmt.Sprintf("[ '%s' '%s' {} ] \n", p.Token, findClass)
-		findmc2 += `
-		FINDSETS KEYLIST SWAP KEYLIST APPEND UNIQUE 'tags' STORE 
-		<%
-			DROP
-			NEWGTS SWAP RENAME
-			$tags
-			<%
-				{ 
-				SWAP
-				'true'
-				}
-				RELABEL
-			%>
-			FOREACH
-		%>
-		LMAP
-		`
-		findQuery, err := warpServer.Query(findmc2, txn)
+	if cached, isCached := p.Finds[findClass]; len(where) > 0 && isCached {
+		findResponses = cached
+	} else if len(where) > 0 {
+		findQuery, err := warpServer.Query(findScript(p.Token, findClass), txn)
 
 		if err != nil {
 			log.WithFields(log.Fields{
@@ -303,9 +253,10 @@ func (p *InfluxParser) getSelectStatementScript(statement *influxql.SelectStatem
 					whereItem.isTag = true
 				} else if whereItem.op == influxql.NEQREGEX || whereItem.op == influxql.NEQ {
 
+					// Negated regular expressions are already translated
 					value := fmt.Sprintf("(?!%s).*?", rhsValue)
 					if whereItem.op == influxql.NEQREGEX {
-						value = fmt.Sprintf("(?!%s).*?", rhsValue)
+						value = rhsValue
 					}
 
 					op = "~"
@@ -393,6 +344,7 @@ func (p *InfluxParser) getSelectStatementScript(statement *influxql.SelectStatem
 			mc2 += p.renameAndSetInfluxStarLabels()
 		}
 		mc2 += p.shiftSeries()
+		mc2 += p.toUTCTime()
 
 		fieldName := field.Name()
 		idField, containsField := renameField[fieldName]
@@ -433,3 +385,94 @@ func (p *InfluxParser) getSelectStatementScript(statement *influxql.SelectStatem
 
 	return mc2, nil, selectValidField, selectTagsField, nil
 }
+
+// sourceClassnames return the classnames selectors of the measurements
+// sources, and the sub-queries sources
+func sourceClassnames(sources influxql.Sources) ([]string, []*influxql.SelectStatement, error) {
+	classnames := make([]string, 0)
+	subQueries := make([]*influxql.SelectStatement, 0)
+
+	for _, source := range sources {
+		switch source := source.(type) {
+		case *influxql.Measurement:
+			if source.Regex != nil {
+				classname, err := javaRegex(source.Regex.Val.String())
+				if err != nil {
+					return nil, nil, err
+				}
+				classnames = append(classnames, classname)
+			} else {
+				classnames = append(classnames, regexp.QuoteMeta(source.Name))
+			}
+		case *influxql.SubQuery:
+			subQueries = append(subQueries, source.Statement)
+		}
+	}
+	return classnames, subQueries, nil
+}
+
+// findSelector return the classname selector used to find the selected
+// fields of the parser measurements
+func (p *InfluxParser) findSelector(fields influxql.Fields) (string, error) {
+	findClass := "~"
+	classname := fmt.Sprintf("(%s", strings.Join(p.Classnames, "|"))
+
+	for _, field := range fields {
+		separator := "\\."
+		if p.Separator != "." {
+			separator = p.Separator
+		}
+
+		if strings.Contains(field.String(), "*") {
+			if !p.StarQuery {
+				findClass += classname + ")" + separator + "(.*)|"
+				p.StarQuery = true
+			}
+			continue
+		}
+		varRefNames := influxql.ExprNames(field.Expr)
+		for _, ref := range varRefNames {
+			valueName := ref.Val
+			if strings.HasPrefix(valueName, "/") && strings.HasSuffix(valueName, "/") {
+				fieldRegex, err := javaRegex(strings.TrimSuffix(strings.TrimPrefix(valueName, "/"), "/"))
+				if err != nil {
+					return "", err
+				}
+				valueName = fieldRegex
+			} else {
+				valueName = regexp.QuoteMeta(valueName)
+			}
+			findClass += classname + ")" + separator + "(" + valueName + ")|"
+		}
+
+		// Handle case of misformed varref returned by influx library
+		if len(varRefNames) == 0 {
+			findClass += classname + ")" + separator + "(.*)|"
+		}
+	}
+	return findClass, nil
+}
+
+// findScript return the WarpScript listing the series matching a FIND
+// selector, labelled with all the tag keys found
+func findScript(token, findClass string) string {
+	findmc2 := fmt.Sprintf("[ '%s' '%s' {} ] \n", token, findClass)
+	findmc2 += `
+		FINDSETS KEYLIST SWAP KEYLIST APPEND UNIQUE 'tags' STORE 
+		<%
+			DROP
+			NEWGTS SWAP RENAME
+			$tags
+			<%
+				{ 
+				SWAP
+				'true'
+				}
+				RELABEL
+			%>
+			FOREACH
+		%>
+		LMAP
+		`
+	return findmc2
+}
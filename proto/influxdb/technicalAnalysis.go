@@ -0,0 +1,873 @@
+package influxdb
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/influxql"
+)
+
+// Technical analysis functions are translated from the algorithms InfluxDB 1.x uses
+// (github.com/influxdata/influxdb/query/internal/gota and query/neldermead), state is
+// kept in WarpScript variables and each series is processed point by point.
+// https://docs.influxdata.com/influxdb/v1.7/query_language/functions/#technical-analysis
+
+const (
+	// Warmup types of the exponential moving averages
+	warmupExponential = "exponential"
+	warmupSimple      = "simple"
+	warmupNone        = "none"
+
+	// Holt-Winters initial guesses weight, grid and optimization settings
+	hwWeight         = 0.5
+	hwDefaultEpsilon = 1.0e-4
+	hwGuessLower     = 0.3
+	hwGuessUpper     = 1.0
+	hwGuessStep      = 0.4
+
+	// Nelder-Mead optimizer settings
+	nmMaxIterations = 1000
+	nmAlpha         = 1.0
+	nmBeta          = 0.5
+	nmGamma         = 2.0
+
+	// Kaufman's adaptive moving average fastest and slowest smoothing constants
+	kamaFast = 2.0/(2.0+1.0) - 2.0/(30.0+1.0)
+	kamaSlow = 2.0 / (30.0 + 1.0)
+)
+
+// TechnicalAnalysisWarpScript return the WarpScript applying an InfluxQL technical analysis
+// or Holt-Winters call, as moving_average(v, 3), to the series list on top of the stack,
+// bucketized every bucketTime ticks. It is used by the Warp 10 backed tests.
+func TechnicalAnalysisWarpScript(call string, bucketTime int64) (string, error) {
+	expr, err := influxql.ParseExpr(call)
+	if err != nil {
+		return "", err
+	}
+	c, ok := expr.(*influxql.Call)
+	if !ok {
+		return "", fmt.Errorf("%s is not a function call", call)
+	}
+
+	p := &InfluxParser{BucketTime: strconv.FormatInt(bucketTime, 10)}
+	switch c.Name {
+	case "holt_winters", "holt_winters_with_fit":
+		n, s, err := p.validateHoltWinters(c)
+		if err != nil {
+			return "", err
+		}
+		return p.holtWinters(n, s, c.Name == "holt_winters_with_fit"), nil
+	}
+
+	ta, err := p.validateTechnicalAnalysis(c)
+	if err != nil {
+		return "", err
+	}
+	return ta.warpScript(), nil
+}
+
+// technicalAnalysis is a technical analysis function call
+type technicalAnalysis struct {
+	name       string
+	period     int64
+	holdPeriod int64
+	warmupType string
+}
+
+// validateHoltWinters check Holt-Winters arguments as InfluxDB does
+func (p *InfluxParser) validateHoltWinters(expr *influxql.Call) (int64, int64, error) {
+	if exp, got := 3, len(expr.Args); got != exp {
+		return 0, 0, fmt.Errorf("invalid number of arguments for %s, expected %d, got %d", expr.Name, exp, got)
+	}
+
+	n, ok := expr.Args[1].(*influxql.IntegerLiteral)
+	if !ok {
+		return 0, 0, fmt.Errorf("expected integer argument as second arg in %s", expr.Name)
+	} else if n.Val <= 0 {
+		return 0, 0, fmt.Errorf("second arg to %s must be greater than 0, got %d", expr.Name, n.Val)
+	}
+
+	s, ok := expr.Args[2].(*influxql.IntegerLiteral)
+	if !ok {
+		return 0, 0, fmt.Errorf("expected integer argument as third arg in %s", expr.Name)
+	} else if s.Val < 0 {
+		return 0, 0, fmt.Errorf("third arg to %s cannot be negative, got %d", expr.Name, s.Val)
+	}
+
+	if _, ok := expr.Args[0].(*influxql.Call); !ok {
+		return 0, 0, fmt.Errorf("must use aggregate function with %s", expr.Name)
+	} else if p.BucketTime == "0" {
+		return 0, 0, fmt.Errorf("%s aggregate requires a GROUP BY interval", expr.Name)
+	}
+
+	return n.Val, s.Val, nil
+}
+
+// validateTechnicalAnalysis check moving averages and oscillators arguments as InfluxDB does
+func (p *InfluxParser) validateTechnicalAnalysis(expr *influxql.Call) (*technicalAnalysis, error) {
+	name := expr.Name
+
+	maxArgs := 4
+	warmupTypes := []string{warmupExponential, warmupSimple}
+	ta := &technicalAnalysis{name: name, holdPeriod: -1, warmupType: warmupExponential}
+
+	switch name {
+	case "kaufmans_efficiency_ratio", "kaufmans_adaptive_moving_average":
+		maxArgs = 3
+		ta.warmupType = warmupNone
+	case "chande_momentum_oscillator":
+		warmupTypes = []string{warmupNone, warmupExponential, warmupSimple}
+		ta.warmupType = warmupNone
+	}
+
+	if got := len(expr.Args); got < 2 || got > maxArgs {
+		return nil, fmt.Errorf("invalid number of arguments for %s, expected at least 2 but no more than %d, got %d", name, maxArgs, got)
+	}
+
+	period, ok := expr.Args[1].(*influxql.IntegerLiteral)
+	if !ok {
+		return nil, fmt.Errorf("%s period must be an integer", name)
+	} else if period.Val < 1 {
+		return nil, fmt.Errorf("%s period must be greater than or equal to 1", name)
+	}
+	ta.period = period.Val
+
+	if len(expr.Args) >= 3 {
+		holdPeriod, ok := expr.Args[2].(*influxql.IntegerLiteral)
+		if !ok {
+			return nil, fmt.Errorf("%s hold period must be an integer", name)
+		}
+		if name == "triple_exponential_derivative" && holdPeriod.Val < 1 && holdPeriod.Val != -1 {
+			return nil, fmt.Errorf("%s hold period must be greater than or equal to 1", name)
+		}
+		if holdPeriod.Val < 0 && holdPeriod.Val != -1 {
+			return nil, fmt.Errorf("%s hold period must be greater than or equal to 0", name)
+		}
+		ta.holdPeriod = holdPeriod.Val
+	}
+
+	if len(expr.Args) >= 4 {
+		warmupType, ok := expr.Args[3].(*influxql.StringLiteral)
+		if !ok {
+			return nil, fmt.Errorf("%s warmup type must be a string", name)
+		}
+		if !containsString(warmupTypes, warmupType.Val) {
+			return nil, fmt.Errorf("%s warmup type must be one of: '%s'", name, strings.Join(warmupTypes, "' '"))
+		}
+		ta.warmupType = warmupType.Val
+	}
+
+	switch expr.Args[0].(type) {
+	case *influxql.Call:
+		if p.BucketTime == "0" {
+			return nil, fmt.Errorf("%s aggregate requires a GROUP BY interval", name)
+		}
+	default:
+		if p.BucketTime != "0" && !p.HasSubQuery {
+			return nil, fmt.Errorf("aggregate function required inside the call to %s", name)
+		}
+	}
+
+	return ta, nil
+}
+
+// parseTechnicalAnalysis Parse Influx technical analysis methods
+func (p *InfluxParser) parseTechnicalAnalysis(expr *influxql.Call, selectors []string, where [][]*WhereCond) (string, error) {
+	mc2 := ""
+
+	var curFun string
+	switch expr.Name {
+	case "holt_winters", "holt_winters_with_fit":
+		n, s, err := p.validateHoltWinters(expr)
+		if err != nil {
+			return "", err
+		}
+		curFun = p.holtWinters(n, s, expr.Name == "holt_winters_with_fit")
+	default:
+		ta, err := p.validateTechnicalAnalysis(expr)
+		if err != nil {
+			return "", err
+		}
+		curFun = ta.warpScript()
+	}
+
+	fetch, _, err := p.parseComplementaryArgument(expr.Name, expr.Args[0], []string{}, false, selectors, where, false)
+	if err != nil {
+		return "", err
+	}
+	mc2 += fetch
+
+	if p.HasGroupBy {
+		p.GroupByTags = append(p.GroupByTags, "'.InfluxDBName'")
+		mc2 += p.startPartition()
+	}
+
+	mc2 += curFun
+
+	if len(p.GroupByTags) > 0 {
+		mc2 += `
+			+
+		%>
+		FOREACH
+		FLATTEN
+		`
+	}
+	return mc2, nil
+}
+
+// formatFloat format a float as a WarpScript double
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s
+}
+
+// warpScript of the technical analysis call
+func (ta *technicalAnalysis) warpScript() string {
+	simple := ta.warmupType == warmupSimple
+	warmCount := ta.period - 1
+
+	init := ""
+	step := ""
+
+	switch ta.name {
+	case "exponential_moving_average":
+		init = emaInit("ema", fmt.Sprintf("2.0 %d 1 + /", ta.period))
+		step = emaAdd("ema", ta.period, simple)
+
+	case "double_exponential_moving_average":
+		if simple {
+			warmCount = 2 * (ta.period - 1)
+		}
+		init = emaInit("ema1", fmt.Sprintf("2.0 %d 1 + /", ta.period))
+		init += emaInit("ema2", fmt.Sprintf("2.0 %d 1 + /", ta.period))
+		step = emaAdd("ema1", ta.period, simple) + "DUP 'dema_avg1' STORE\n"
+		step += emaChain("ema1", "ema2", ta.period, simple) + "'dema_avg2' STORE\n"
+		step += "2.0 $dema_avg1 * $dema_avg2 -\n"
+
+	case "triple_exponential_moving_average":
+		if simple {
+			warmCount = 3 * (ta.period - 1)
+		}
+		init = emaInit("ema1", fmt.Sprintf("2.0 %d 1 + /", ta.period))
+		init += emaInit("ema2", fmt.Sprintf("2.0 %d 1 + /", ta.period))
+		init += emaInit("ema3", fmt.Sprintf("2.0 %d 1 + /", ta.period))
+		step = emaAdd("ema1", ta.period, simple) + "DUP 'tema_avg1' STORE\n"
+		step += emaChain("ema1", "ema2", ta.period, simple) + "DUP 'tema_avg2' STORE\n"
+		step += emaChain("ema2", "ema3", ta.period, simple) + "'tema_avg3' STORE\n"
+		step += "3.0 $tema_avg1 * 3.0 $tema_avg2 * - $tema_avg3 +\n"
+
+	case "triple_exponential_derivative":
+		warmCount = ta.period
+		if simple {
+			warmCount = 3*(ta.period-1) + 1
+		}
+		init = emaInit("ema1", fmt.Sprintf("2.0 %d 1 + /", ta.period))
+		init += emaInit("ema2", fmt.Sprintf("2.0 %d 1 + /", ta.period))
+		init += emaInit("ema3", fmt.Sprintf("2.0 %d 1 + /", ta.period))
+		init += "0.0 'trix_last' STORE\n"
+		step = emaAdd("ema1", ta.period, simple)
+		if simple {
+			step += fmt.Sprintf("<%% $ema1_count %d == %%>\n<%%\n", ta.period)
+			step += emaAdd("ema2", ta.period, simple)
+			step += fmt.Sprintf("<%% $ema2_count %d == %%> <%% %s %%> IFT\n", ta.period, emaAdd("ema3", ta.period, simple))
+			step += "%>\nIFT\n"
+		} else {
+			step += emaAdd("ema2", ta.period, simple)
+			step += emaAdd("ema3", ta.period, simple)
+		}
+		step += "DUP $trix_last / 1.0 - 100.0 * SWAP 'trix_last' STORE\n"
+
+	case "relative_strength_index":
+		warmCount = ta.period
+		init = emaInit("up", fmt.Sprintf("1.0 %d /", ta.period))
+		init += emaInit("down", fmt.Sprintf("1.0 %d /", ta.period))
+		init += "0.0 'rsi_lastv' STORE\n"
+		step = upDown("rsi_lastv", ta.period+1, simple)
+		step += "100.0 100.0 1.0 $up_last $down_last / + / -\n"
+
+	case "chande_momentum_oscillator":
+		if ta.warmupType != warmupNone {
+			warmCount = ta.period
+			init = emaInit("up", fmt.Sprintf("1.0 %d /", ta.period))
+			init += emaInit("down", fmt.Sprintf("1.0 %d /", ta.period))
+			init += "0.0 'cmo_lastv' STORE\n"
+			step = upDown("cmo_lastv", ta.period+1, simple)
+			step += "100.0 $up_last $down_last - $up_last $down_last + / *\n"
+			break
+		}
+
+		warmCount = ta.period
+		init = "[] 'cmo_prices' STORE [] 'cmo_diffs' STORE 0.0 'cmo_up' STORE 0.0 'cmo_down' STORE\n"
+		step = fmt.Sprintf(`
+		'cmo_v' STORE
+		0.0 'cmo_diff' STORE
+		<%% $ta_index 0 != %%>
+		<%%
+			$cmo_v $cmo_prices $ta_index 1 - GET - 'cmo_diff' STORE
+			<%% $cmo_diff 0.0 > %%>
+			<%% $cmo_up $cmo_diff + 'cmo_up' STORE %%>
+			<%% <%% $cmo_diff 0.0 < %%> <%% $cmo_down $cmo_diff - 'cmo_down' STORE %%> IFT %%>
+			IFTE
+		%%>
+		IFT
+		0.0
+		<%% $cmo_up 0.0 != $cmo_down 0.0 != || %%>
+		<%% DROP 100.0 $cmo_up $cmo_down - $cmo_up $cmo_down + / * %%>
+		IFT
+		<%% $ta_index %[1]d >= %%>
+		<%%
+			$cmo_diffs $ta_index %[1]d - GET 'cmo_oldest' STORE
+			<%% $cmo_oldest 0.0 > %%>
+			<%% $cmo_up $cmo_oldest - 'cmo_up' STORE %%>
+			<%% <%% $cmo_oldest 0.0 < %%> <%% $cmo_down $cmo_oldest + 'cmo_down' STORE %%> IFT %%>
+			IFTE
+		%%>
+		IFT
+		$cmo_prices $cmo_v +! DROP
+		$cmo_diffs $cmo_diff +! DROP
+		`, ta.period)
+
+	case "kaufmans_efficiency_ratio":
+		warmCount = ta.period
+		init = kerInit()
+		step = kerAdd(ta.period)
+
+	case "kaufmans_adaptive_moving_average":
+		warmCount = ta.period
+		init = kerInit() + "0.0 'kama_last' STORE\n"
+		step = fmt.Sprintf(`
+		DUP 'kama_v' STORE
+		<%% $ta_index %[1]d <= %%>
+		<%% <%% $ta_index 0 > %%> <%% $ker_prices $ta_index 1 - GET %%> <%% 0.0 %%> IFTE 'kama_last' STORE %%>
+		IFT
+		`, ta.period)
+		step += kerAdd(ta.period)
+		step += fmt.Sprintf("%s * %s + DUP * 'kama_sc' STORE\n", formatFloat(kamaFast), formatFloat(kamaSlow))
+		step += "$kama_last $kama_sc $kama_v $kama_last - * + DUP 'kama_last' STORE\n"
+	}
+
+	holdPeriod := ta.holdPeriod
+	if holdPeriod == -1 {
+		holdPeriod = warmCount
+	}
+
+	return taSeries(init, step, holdPeriod)
+}
+
+// taSeries apply a technical analysis algorithm on each series of the list on top of the stack.
+// init is executed once per series, step consumes a value and pushes the computed one, which is
+// kept once more than holdPeriod values were processed.
+func taSeries(init, step string, holdPeriod int64) string {
+	mc2 := `
+	<%
+		DROP
+		SORT
+		DUP CLONEEMPTY 'ta_out' STORE
+		DUP TICKLIST 'ta_ticks' STORE
+		VALUES 'ta_values' STORE
+	`
+	mc2 += init
+	mc2 += `
+		0 $ta_values SIZE 1 -
+		<%
+			'ta_index' STORE
+			$ta_values $ta_index GET TODOUBLE
+	`
+	mc2 += step
+	mc2 += "'ta_result' STORE\n"
+	mc2 += fmt.Sprintf("<%% $ta_index 1 + %d > $ta_result DUP - ISNaN ! && %%>\n", holdPeriod)
+	mc2 += `
+			<% $ta_out $ta_ticks $ta_index GET NaN NaN NaN $ta_result ADDVALUE DROP %>
+			IFT
+		%>
+		FOR
+		$ta_out
+	%>
+	LMAP
+	`
+	return mc2
+}
+
+// emaInit initialize the state of an exponential moving average
+func emaInit(name string, alpha string) string {
+	return fmt.Sprintf("0 '%[1]s_count' STORE 0.0 '%[1]s_last' STORE %[2]s '%[1]s_alpha' STORE\n", name, alpha)
+}
+
+// emaAdd add the value on top of the stack to an exponential moving average of period
+// values and push the average. Until the average is warmed it is either a simple average
+// or an exponential one with an alpha scaled on the number of values.
+func emaAdd(name string, period int64, simple bool) string {
+	warmup := "$%[1]s_v $%[1]s_last - 2.0 $%[1]s_count 2 + TODOUBLE / * $%[1]s_last +"
+	if simple {
+		warmup = "$%[1]s_last $%[1]s_count TODOUBLE * $%[1]s_v + $%[1]s_count 1 + TODOUBLE /"
+	}
+
+	return fmt.Sprintf(`
+	TODOUBLE '%[1]s_v' STORE
+	<%% $%[1]s_count 0 == %%>
+	<%% $%[1]s_v %%>
+	<%%
+		<%% $%[1]s_count %[2]d < %%>
+		<%% `+warmup+` %%>
+		<%% $%[1]s_v $%[1]s_last - $%[1]s_alpha * $%[1]s_last + %%>
+		IFTE
+	%%>
+	IFTE
+	DUP '%[1]s_last' STORE
+	<%% $%[1]s_count %[2]d < %%> <%% $%[1]s_count 1 + '%[1]s_count' STORE %%> IFT
+	`, name, period)
+}
+
+// emaChain add the average of previous to next, unless previous is not warmed with a simple warmup:
+// the average of previous is then kept as is
+func emaChain(previous, next string, period int64, simple bool) string {
+	if !simple {
+		return emaAdd(next, period, simple)
+	}
+	return fmt.Sprintf("<%% $%s_count %d == %%> <%% %s %%> IFT\n", previous, period, emaAdd(next, period, simple))
+}
+
+// upDown add the gain and the loss of the value on top of the stack to the up and down
+// exponential moving averages of period values
+func upDown(last string, period int64, simple bool) string {
+	mc2 := fmt.Sprintf(`
+	TODOUBLE 'ta_v' STORE
+	0.0 'ta_up' STORE
+	0.0 'ta_down' STORE
+	<%% $ta_v $%[1]s > %%>
+	<%% $ta_v $%[1]s - 'ta_up' STORE %%>
+	<%% <%% $ta_v $%[1]s < %%> <%% $%[1]s $ta_v - 'ta_down' STORE %%> IFT %%>
+	IFTE
+	`, last)
+	mc2 += "$ta_up" + emaAdd("up", period, simple) + "DROP\n"
+	mc2 += "$ta_down" + emaAdd("down", period, simple) + "DROP\n"
+	mc2 += fmt.Sprintf("$ta_v '%s' STORE\n", last)
+	return mc2
+}
+
+// kerInit initialize the state of a Kaufman's efficiency ratio
+func kerInit() string {
+	return "[] 'ker_prices' STORE [] 'ker_diffs' STORE 0.0 'ker_noise' STORE\n"
+}
+
+// kerAdd add the value on top of the stack to a Kaufman's efficiency ratio of period values
+// and push the ratio
+func kerAdd(period int64) string {
+	return fmt.Sprintf(`
+	TODOUBLE 'ker_v' STORE
+	<%% $ta_index %[1]d >= %%> <%% $ker_prices $ta_index %[1]d - GET %%> <%% 0.0 %%> IFTE
+	$ker_v SWAP - ABS 'ker_signal' STORE
+	<%% $ta_index 0 > %%> <%% $ker_prices $ta_index 1 - GET %%> <%% 0.0 %%> IFTE
+	$ker_v SWAP - ABS 'ker_diff' STORE
+	<%% $ta_index %[1]d >= %%> <%% $ker_noise $ker_diffs $ta_index %[1]d - GET - 'ker_noise' STORE %%> IFT
+	$ker_noise $ker_diff + 'ker_noise' STORE
+	$ker_prices $ker_v +! DROP
+	$ker_diffs $ker_diff +! DROP
+	<%% $ker_signal 0.0 == $ker_noise 0.0 == || %%>
+	<%% 0.0 %%>
+	<%% $ker_signal $ker_noise / %%>
+	IFTE
+	`, period)
+}
+
+// holtWinters predict n values of each series with seasonal pattern s. The level, trend and
+// seasonal components are fitted with a Nelder-Mead minimization of the squared errors,
+// started from a grid of 16 initial guesses. Each minimization runs up to nmMaxIterations
+// evaluations of the model over all the points, within the MAXOPS limit of the token.
+func (p *InfluxParser) holtWinters(n, s int64, withFit bool) string {
+	interval := p.BucketTime
+	seasonal := s >= 2
+
+	// Number of parameters: alpha, beta, gamma, phi, level, trend and the seasonal components
+	params := int64(6)
+	if seasonal {
+		params += s
+	}
+
+	mc2 := ""
+
+	// Forecast the values of y and h values further, constraining alpha, beta, gamma and phi in [0, 1].
+	// The updated parameters are returned as the seasonal components are updated in place by InfluxDB.
+	mc2 += `
+	<%
+		'hw_h' STORE
+		<% 'hw_k' STORE <% $hw_k 4 < %> <% 1.0 MIN 0.0 MAX %> IFT %> LMAP 'hw_fp' STORE
+		$hw_y 0 GET 'hw_yT' STORE
+		$hw_fp 0 GET 'hw_alpha' STORE
+		$hw_fp 1 GET 'hw_beta' STORE
+		$hw_fp 2 GET 'hw_gamma' STORE
+		$hw_fp 3 GET DUP 'hw_phi' STORE 'hw_phiH' STORE
+		$hw_fp 4 GET 'hw_lT' STORE
+		$hw_fp 5 GET 'hw_bT' STORE
+		1.0 'hw_stm' STORE
+		1.0 'hw_stmh' STORE
+	`
+	if seasonal {
+		mc2 += fmt.Sprintf(`
+		{} 0 %[1]d 1 - <%% 'hw_i' STORE $hw_fp 6 $hw_i + GET $hw_i PUT %%> FOR 'hw_season' STORE
+		%[1]d 1 - 'hw_so' STORE
+		`, s)
+	}
+	mc2 += `
+		[ $hw_yT ] 'hw_forecasted' STORE
+		1 $hw_l $hw_h + 1 -
+		<%
+			'hw_t' STORE
+	`
+	if seasonal {
+		mc2 += fmt.Sprintf(`
+			$hw_t %[1]d %% 'hw_hm' STORE
+			$hw_season $hw_t %[1]d - $hw_so + %[1]d %% GET 'hw_stm' STORE
+			$hw_season $hw_t %[1]d - $hw_hm + $hw_so + %[1]d %% GET 'hw_stmh' STORE
+			$hw_gamma $hw_yT $hw_lT $hw_phi $hw_bT * + / * 1.0 $hw_gamma - $hw_stm * + 'hw_sT' STORE
+		`, s)
+	}
+	mc2 += `
+			$hw_alpha $hw_yT $hw_stm / * 1.0 $hw_alpha - $hw_lT $hw_phi $hw_bT * + * + 'hw_nextlT' STORE
+			$hw_beta $hw_nextlT $hw_lT - * 1.0 $hw_beta - $hw_phi * $hw_bT * + 'hw_bT' STORE
+			$hw_nextlT 'hw_lT' STORE
+			$hw_lT $hw_phiH $hw_bT * + $hw_stmh * 'hw_yT' STORE
+			$hw_phiH $hw_phi $hw_t TODOUBLE POW + 'hw_phiH' STORE
+	`
+	if seasonal {
+		mc2 += fmt.Sprintf(`
+			$hw_season $hw_sT $hw_t $hw_so + %d %% PUT 'hw_season' STORE
+			$hw_so 1 + 'hw_so' STORE
+		`, s)
+	}
+	mc2 += `
+			$hw_forecasted $hw_yT +! DROP
+		%>
+		FOR
+		$hw_forecasted
+		$hw_fp
+	`
+	if seasonal {
+		mc2 += "<% 'hw_k' STORE <% $hw_k 6 >= %> <% DROP $hw_season $hw_k 6 - GET %> IFT %> LMAP\n"
+	}
+	mc2 += `
+	%>
+	'hw_forecast' STORE
+	`
+
+	// Sum of the squared errors of the forecast, infinite when a known value can't be forecasted
+	mc2 += `
+	<%
+		0 @hw_forecast 'hw_sp' STORE 'hw_sf' STORE
+		0.0 'hw_sse' STORE
+		0 $hw_l 1 -
+		<%
+			'hw_i' STORE
+			$hw_y $hw_i GET 'hw_yi' STORE
+			<% $hw_yi ISNaN ! %>
+			<%
+				$hw_sf $hw_i GET 'hw_fi' STORE
+				<% $hw_fi ISNaN %>
+				<% 1.0 0.0 / 'hw_sse' STORE BREAK %>
+				<% $hw_fi $hw_yi - DUP * $hw_sse SWAP + 'hw_sse' STORE %>
+				IFTE
+			%>
+			IFT
+		%>
+		FOR
+		$hw_sse $hw_sp
+	%>
+	'hw_objective' STORE
+	`
+
+	// Nelder-Mead helpers: x + c * (y - z) and the replacement of a list element
+	mc2 += fmt.Sprintf(`
+	<%%
+		'nm_cc' STORE 'nm_cz' STORE 'nm_cy' STORE 'nm_cx' STORE
+		[] 0 %[1]d 1 -
+		<%% 'nm_ci' STORE $nm_cx $nm_ci GET $nm_cc $nm_cy $nm_ci GET $nm_cz $nm_ci GET - * + +! %%>
+		FOR
+	%%>
+	'nm_combine' STORE
+	<%%
+		'nm_si' STORE 'nm_sv' STORE
+		<%% <%% $nm_si == %%> <%% DROP $nm_sv %%> IFT %%> LMAP
+	%%>
+	'nm_set' STORE
+	`, params)
+
+	// Nelder-Mead minimization of the objective, starting from the parameters on top of the stack
+	pn := 1.0 * (math.Sqrt(float64(params+1)) - 1 + float64(params)) / (float64(params) * math.Sqrt(2))
+	qn := 1.0 * (math.Sqrt(float64(params+1)) - 1) / (float64(params) * math.Sqrt(2))
+	mc2 += fmt.Sprintf(`
+	<%%
+		'nm_start' STORE
+		[ $nm_start ]
+		1 %[1]d
+		<%%
+			'nm_i' STORE
+			[] 0 %[1]d 1 -
+			<%% 'nm_j' STORE $nm_start $nm_j GET <%% $nm_i 1 - $nm_j == %%> <%% %[2]s %%> <%% %[3]s %%> IFTE + +! %%>
+			FOR
+			+!
+		%%>
+		FOR
+		[] 'nm_f' STORE
+		<%% DROP @hw_objective 'nm_x' STORE $nm_f SWAP +! DROP $nm_x %%> LMAP 'nm_v' STORE
+
+		1 %[4]d
+		<%%
+			DROP
+			0 'nm_vg' STORE
+			0 'nm_vs' STORE
+			0 %[1]d
+			<%%
+				'nm_i' STORE
+				<%% $nm_f $nm_i GET $nm_f $nm_vg GET > %%> <%% $nm_i 'nm_vg' STORE %%> IFT
+				<%% $nm_f $nm_i GET $nm_f $nm_vs GET < %%> <%% $nm_i 'nm_vs' STORE %%> IFT
+			%%>
+			FOR
+			$nm_vs 'nm_vh' STORE
+			0 %[1]d
+			<%%
+				'nm_i' STORE
+				<%% $nm_f $nm_i GET $nm_f $nm_vh GET > $nm_f $nm_i GET $nm_f $nm_vg GET < && %%> <%% $nm_i 'nm_vh' STORE %%> IFT
+			%%>
+			FOR
+
+			[] 0 %[1]d 1 -
+			<%%
+				'nm_i' STORE
+				0.0 0 %[1]d <%% 'nm_m' STORE <%% $nm_m $nm_vg != %%> <%% $nm_v $nm_m GET $nm_i GET + %%> IFT %%> FOR
+				%[1]d TODOUBLE / +!
+			%%>
+			FOR
+			'nm_vm' STORE
+
+			$nm_vm $nm_vm $nm_v $nm_vg GET %[5]s @nm_combine @hw_objective 'nm_vr' STORE 'nm_fr' STORE
+
+			<%% $nm_fr $nm_f $nm_vh GET < $nm_fr $nm_f $nm_vs GET >= && %%>
+			<%% $nm_v $nm_vr $nm_vg @nm_set 'nm_v' STORE $nm_f $nm_fr $nm_vg @nm_set 'nm_f' STORE %%>
+			IFT
+
+			<%% $nm_fr $nm_f $nm_vs GET < %%>
+			<%%
+				$nm_vm $nm_vr $nm_vm %[6]s @nm_combine @hw_objective 'nm_ve' STORE 'nm_fe' STORE
+				<%% $nm_fe $nm_fr < %%>
+				<%% $nm_v $nm_ve $nm_vg @nm_set 'nm_v' STORE $nm_f $nm_fe $nm_vg @nm_set 'nm_f' STORE %%>
+				<%% $nm_v $nm_vr $nm_vg @nm_set 'nm_v' STORE $nm_f $nm_fr $nm_vg @nm_set 'nm_f' STORE %%>
+				IFTE
+			%%>
+			IFT
+
+			<%% $nm_fr $nm_f $nm_vh GET >= %%>
+			<%%
+				<%% $nm_fr $nm_f $nm_vg GET < $nm_fr $nm_f $nm_vh GET >= && %%>
+				<%% $nm_vm $nm_vr $nm_vm %[7]s @nm_combine %%>
+				<%% $nm_vm $nm_vm $nm_v $nm_vg GET -%[7]s @nm_combine %%>
+				IFTE
+				@hw_objective 'nm_vc' STORE 'nm_fc' STORE
+				<%% $nm_fc $nm_f $nm_vg GET < %%>
+				<%% $nm_v $nm_vc $nm_vg @nm_set 'nm_v' STORE $nm_f $nm_fc $nm_vg @nm_set 'nm_f' STORE %%>
+				<%%
+					$nm_v $nm_vs GET 'nm_best' STORE
+					$nm_v
+					<%%
+						'nm_row' STORE 'nm_vertex' STORE
+						<%% $nm_row $nm_vs != %%>
+						<%%
+							[] 0 %[1]d 1 -
+							<%% 'nm_i' STORE $nm_best $nm_i GET $nm_vertex $nm_i GET $nm_best $nm_i GET - 2.0 / + +! %%>
+							FOR
+						%%>
+						<%% $nm_vertex %%>
+						IFTE
+					%%>
+					LMAP
+					'nm_v' STORE
+					$nm_v $nm_vg GET @hw_objective 'nm_x' STORE 'nm_fx' STORE
+					$nm_v $nm_x $nm_vg @nm_set 'nm_v' STORE $nm_f $nm_fx $nm_vg @nm_set 'nm_f' STORE
+					$nm_v $nm_vh GET @hw_objective 'nm_x' STORE 'nm_fx' STORE
+					$nm_v $nm_x $nm_vh @nm_set 'nm_v' STORE $nm_f $nm_fx $nm_vh @nm_set 'nm_f' STORE
+				%%>
+				IFTE
+			%%>
+			IFT
+
+			0.0 $nm_f <%% + %%> FOREACH %[1]d 1 + TODOUBLE / 'nm_favg' STORE
+			0.0 $nm_f <%% $nm_favg - DUP * %[1]d TODOUBLE / + %%> FOREACH SQRT
+			<%% %[8]s < %%> <%% BREAK %%> IFT
+		%%>
+		FOR
+
+		0 'nm_vs' STORE
+		0 %[1]d <%% 'nm_i' STORE <%% $nm_f $nm_i GET $nm_f $nm_vs GET < %%> <%% $nm_i 'nm_vs' STORE %%> IFT %%> FOR
+		$nm_v $nm_vs GET 'nm_x' STORE
+		$nm_x @hw_objective DROP
+		$nm_x
+	%%>
+	'hw_optimize' STORE
+	`, params, formatFloat(pn), formatFloat(qn), nmMaxIterations, formatFloat(nmAlpha), formatFloat(nmGamma), formatFloat(nmBeta), formatFloat(hwDefaultEpsilon))
+
+	// Round a tick to the closest interval
+	mc2 += fmt.Sprintf(`
+	<%%
+		'hw_tick' STORE
+		<%% $hw_tick %[1]s %% %[1]s 2 / > %%>
+		<%% $hw_tick %[1]s / 1 + %[1]s * %%>
+		<%% $hw_tick %[1]s / %[1]s * %%>
+		IFTE
+	%%>
+	'hw_round' STORE
+	`, interval)
+
+	// Fit and forecast each series
+	guard := "$hw_ticks SIZE 2 <"
+	if seasonal {
+		guard = fmt.Sprintf("$hw_ticks SIZE 2 < $hw_ticks SIZE %d < ||", s)
+	}
+
+	mc2 += fmt.Sprintf(`
+	<%%
+		DROP
+		SORT
+		DUP CLONEEMPTY 'hw_out' STORE
+		DUP TICKLIST 'hw_ticks' STORE
+		VALUES <%% DROP TODOUBLE %%> LMAP 'hw_values' STORE
+		<%% %[2]s %%>
+		<%% %%>
+		<%%
+			$hw_ticks 0 GET @hw_round 'hw_t' STORE
+			<%% $hw_ticks DUP SIZE 1 - GET @hw_round $hw_t - %[1]s / 0 > %%>
+			<%%
+				[ $hw_values 0 GET ] 'hw_y' STORE
+				1 $hw_ticks SIZE 1 -
+				<%%
+					'hw_i' STORE
+					$hw_ticks $hw_i GET @hw_round 'hw_rounded' STORE
+					<%% $hw_rounded $hw_t > %%>
+					<%%
+						$hw_t %[1]s + 'hw_t' STORE
+						<%% $hw_rounded $hw_t != %%> <%% $hw_y NaN +! DROP $hw_t %[1]s + 'hw_t' STORE %%> WHILE
+						$hw_y $hw_values $hw_i GET +! DROP
+					%%>
+					IFT
+				%%>
+				FOR
+				$hw_y SIZE 'hw_l' STORE
+	`, interval, guard)
+
+	if seasonal {
+		mc2 += fmt.Sprintf(`
+				0.0 'hw_l0' STORE
+				0 %[1]d 1 -
+				<%%
+					'hw_i' STORE
+					$hw_y $hw_i GET 'hw_yi' STORE
+					<%% $hw_yi ISNaN ! %%> <%% $hw_l0 1.0 %[1]d TODOUBLE / $hw_yi * + 'hw_l0' STORE %%> IFT
+				%%>
+				FOR
+				0.0 'hw_b0' STORE
+				0 %[1]d 1 -
+				<%%
+					'hw_i' STORE
+					<%% %[1]d $hw_i + $hw_l < %%>
+					<%%
+						$hw_y $hw_i GET 'hw_yi' STORE
+						$hw_y %[1]d $hw_i + GET 'hw_ym' STORE
+						<%% $hw_yi ISNaN ! $hw_ym ISNaN ! && %%>
+						<%% $hw_b0 1.0 %[1]d %[1]d * TODOUBLE / $hw_ym $hw_yi - * + 'hw_b0' STORE %%>
+						IFT
+					%%>
+					IFT
+				%%>
+				FOR
+				[] 0 %[1]d 1 -
+				<%%
+					'hw_i' STORE
+					$hw_y $hw_i GET 'hw_yi' STORE
+					<%% $hw_yi ISNaN %%> <%% 0.0 %%> <%% $hw_yi $hw_l0 / %%> IFTE +!
+				%%>
+				FOR
+				'hw_s' STORE
+		`, s)
+	} else {
+		mc2 += fmt.Sprintf(`
+				%[1]s $hw_y 0 GET * 'hw_l0' STORE
+				0.0 'hw_b0' STORE
+				<%% $hw_y 1 GET ISNaN ! %%> <%% %[1]s $hw_y 1 GET $hw_y 0 GET - * 'hw_b0' STORE %%> IFT
+				[] 'hw_s' STORE
+		`, formatFloat(hwWeight))
+	}
+
+	mc2 += fmt.Sprintf(`
+				NULL 'hw_minsse' STORE
+				NULL 'hw_best' STORE
+				%[1]s 'hw_ga' STORE
+				<%% $hw_ga %[2]s < %%>
+				<%%
+					%[1]s 'hw_gb' STORE
+					<%% $hw_gb %[2]s < %%>
+					<%%
+						%[1]s 'hw_gg' STORE
+						<%% $hw_gg %[2]s < %%>
+						<%%
+							%[1]s 'hw_gp' STORE
+							<%% $hw_gp %[2]s < %%>
+							<%%
+								[ $hw_ga $hw_gb $hw_gg $hw_gp $hw_l0 $hw_b0 ] $hw_s APPEND
+								@hw_optimize 'hw_p' STORE 'hw_psse' STORE
+								<%% $hw_best ISNULL %%> <%% true %%> <%% $hw_psse $hw_minsse < %%> IFTE
+								<%% $hw_psse 'hw_minsse' STORE $hw_p 'hw_best' STORE %%>
+								IFT
+								$hw_gp %[3]s + 'hw_gp' STORE
+							%%>
+							WHILE
+							$hw_gg %[3]s + 'hw_gg' STORE
+						%%>
+						WHILE
+						$hw_gb %[3]s + 'hw_gb' STORE
+					%%>
+					WHILE
+					$hw_ga %[3]s + 'hw_ga' STORE
+				%%>
+				WHILE
+
+				$hw_best %[4]d @hw_forecast DROP 'hw_result' STORE
+	`, formatFloat(hwGuessLower), formatFloat(hwGuessUpper), formatFloat(hwGuessStep), n)
+
+	if withFit {
+		mc2 += fmt.Sprintf(`
+				0 $hw_result SIZE 1 -
+				<%%
+					'hw_i' STORE
+					$hw_result $hw_i GET 'hw_v' STORE
+					<%% $hw_v ISNaN ! %%> <%% $hw_out $hw_ticks 0 GET %[1]s $hw_i * + NaN NaN NaN $hw_v ADDVALUE DROP %%> IFT
+				%%>
+				FOR
+		`, interval)
+	} else {
+		mc2 += fmt.Sprintf(`
+				$hw_l $hw_result SIZE 1 -
+				<%%
+					'hw_i' STORE
+					$hw_result $hw_i GET 'hw_v' STORE
+					<%% $hw_v ISNaN ! %%>
+					<%% $hw_out $hw_ticks DUP SIZE 1 - GET %[1]s $hw_i $hw_l - 1 + * + NaN NaN NaN $hw_v ADDVALUE DROP %%>
+					IFT
+				%%>
+				FOR
+		`, interval)
+	}
+
+	mc2 += `
+			%>
+			IFT
+		%>
+		IFTE
+		$hw_out
+	%>
+	LMAP
+	`
+	return mc2
+}
@@ -0,0 +1,97 @@
+package influxdb
+
+import (
+	"testing"
+
+	"github.com/influxdata/influxql"
+)
+
+func TestValidateTechnicalAnalysis(t *testing.T) {
+	var tests = []struct {
+		expr       string
+		bucketTime string
+		period     int64
+		holdPeriod int64
+		warmupType string
+		shouldFail bool
+	}{
+		{"exponential_moving_average(value, 3)", "0", 3, -1, warmupExponential, false},
+		{"exponential_moving_average(value, 3, 2, 'simple')", "0", 3, 2, warmupSimple, false},
+		{"exponential_moving_average(value, 3, 2, 'none')", "0", 0, 0, "", true},
+		{"exponential_moving_average(value, 0)", "0", 0, 0, "", true},
+		{"exponential_moving_average(value, 3, -2)", "0", 0, 0, "", true},
+		{"exponential_moving_average(value)", "0", 0, 0, "", true},
+		{"exponential_moving_average(mean(value), 3)", "60000000", 3, -1, warmupExponential, false},
+		{"exponential_moving_average(mean(value), 3)", "0", 0, 0, "", true},
+		{"exponential_moving_average(value, 3)", "60000000", 0, 0, "", true},
+		{"triple_exponential_derivative(value, 3, 0)", "0", 0, 0, "", true},
+		{"chande_momentum_oscillator(value, 3)", "0", 3, -1, warmupNone, false},
+		{"chande_momentum_oscillator(value, 3, 0, 'none')", "0", 3, 0, warmupNone, false},
+		{"kaufmans_efficiency_ratio(value, 3, 1)", "0", 3, 1, warmupNone, false},
+		{"kaufmans_efficiency_ratio(value, 3, 1, 'simple')", "0", 0, 0, "", true},
+	}
+
+	for _, test := range tests {
+		expr, err := influxql.ParseExpr(test.expr)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", test.expr, err)
+		}
+
+		p := &InfluxParser{BucketTime: test.bucketTime}
+		ta, err := p.validateTechnicalAnalysis(expr.(*influxql.Call))
+		if test.shouldFail {
+			if err == nil {
+				t.Errorf("Expected an error for %s, got nil", test.expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected nil for %s, got %v", test.expr, err)
+			continue
+		}
+		if ta.period != test.period || ta.holdPeriod != test.holdPeriod || ta.warmupType != test.warmupType {
+			t.Errorf("Expected %d %d %s for %s, got %d %d %s", test.period, test.holdPeriod, test.warmupType, test.expr, ta.period, ta.holdPeriod, ta.warmupType)
+		}
+	}
+}
+
+func TestValidateHoltWinters(t *testing.T) {
+	var tests = []struct {
+		expr       string
+		bucketTime string
+		n          int64
+		s          int64
+		shouldFail bool
+	}{
+		{"holt_winters(mean(value), 10, 4)", "60000000", 10, 4, false},
+		{"holt_winters_with_fit(mean(value), 10, 0)", "60000000", 10, 0, false},
+		{"holt_winters(mean(value), 10, 4)", "0", 0, 0, true},
+		{"holt_winters(value, 10, 4)", "60000000", 0, 0, true},
+		{"holt_winters(mean(value), 0, 4)", "60000000", 0, 0, true},
+		{"holt_winters(mean(value), 10, -1)", "60000000", 0, 0, true},
+		{"holt_winters(mean(value), 10)", "60000000", 0, 0, true},
+	}
+
+	for _, test := range tests {
+		expr, err := influxql.ParseExpr(test.expr)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", test.expr, err)
+		}
+
+		p := &InfluxParser{BucketTime: test.bucketTime}
+		n, s, err := p.validateHoltWinters(expr.(*influxql.Call))
+		if test.shouldFail {
+			if err == nil {
+				t.Errorf("Expected an error for %s, got nil", test.expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected nil for %s, got %v", test.expr, err)
+			continue
+		}
+		if n != test.n || s != test.s {
+			t.Errorf("Expected %d %d for %s, got %d %d", test.n, test.s, test.expr, n, s)
+		}
+	}
+}
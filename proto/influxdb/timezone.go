@@ -0,0 +1,72 @@
+package influxdb
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// LocalBucketizeWarpScript return the WarpScript bucketizing the series list on top of
+// the stack every bucketTime ticks, aligned on the local time of location, up to the
+// bucket holding the $end tick. It is used by the Warp 10 backed tests.
+func LocalBucketizeWarpScript(location *time.Location, bucketizer string, bucketTime int64) string {
+	p := &InfluxParser{Location: location, End: "$end", BucketTime: strconv.FormatInt(bucketTime, 10)}
+
+	mc2 := p.timezoneScript()
+	mc2 += p.toLocalTime()
+	mc2 += fmt.Sprintf("[ SWAP %s %s %s 0 ] BUCKETIZE\n", bucketizer, p.End, p.BucketTime)
+	return mc2 + p.toUTCTime()
+}
+
+// hasTimezone return true when the GROUP BY time buckets have to be aligned
+// on a tz() clause location
+func (p *InfluxParser) hasTimezone() bool {
+	return p.Location != nil && p.Location.String() != "UTC" && p.BucketTime != "0"
+}
+
+// timezoneScript define the timezone conversion macros and the local end of
+// the last bucket. Series are converted to local wall clock ticks after
+// FETCH, so fixed span buckets follow the location days (DST included), and
+// converted back once computed.
+// https://docs.influxdata.com/influxdb/v1.7/query_language/data_exploration/#the-time-zone-clause
+func (p *InfluxParser) timezoneScript() string {
+	if !p.hasTimezone() {
+		return ""
+	}
+
+	mc2 := fmt.Sprintf("'%s' 'tz' STORE\n", p.Location.String())
+	mc2 += `
+	<% $tz ->TSELEMENTS [ 0 6 ] SUBLIST TSELEMENTS-> %> 'tz_local' STORE
+	<% ->TSELEMENTS [ 0 6 ] SUBLIST $tz TSELEMENTS-> %> 'tz_utc' STORE
+	<%
+		'tz_tick' STORE
+		<%
+			DROP 'tz_gts' STORE
+			$tz_gts TICKLIST <% DROP $tz_tick EVAL %> LMAP
+			$tz_gts LOCATIONS $tz_gts ELEVATIONS $tz_gts VALUES MAKEGTS
+			$tz_gts NAME RENAME $tz_gts LABELS RELABEL $tz_gts ATTRIBUTES SETATTRIBUTES
+		%>
+		LMAP
+	%>
+	'tz_shift' STORE
+	`
+	mc2 += fmt.Sprintf("$end @tz_local DUP %s %% DUP 0 > <%% %s SWAP - + %%> <%% DROP %%> IFTE 'tzend' STORE\n", p.BucketTime, p.BucketTime)
+	p.End = "$tzend"
+	return mc2
+}
+
+// toLocalTime convert the fetched series ticks to the location wall clock
+func (p *InfluxParser) toLocalTime() string {
+	if !p.hasTimezone() {
+		return ""
+	}
+	return "$tz_local @tz_shift\n"
+}
+
+// toUTCTime convert the computed series ticks back to UTC
+func (p *InfluxParser) toUTCTime() string {
+	if !p.hasTimezone() {
+		return ""
+	}
+	return "$tz_utc @tz_shift\n"
+}
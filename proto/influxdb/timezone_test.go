@@ -0,0 +1,72 @@
+package influxdb
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxql"
+)
+
+func TestTimezoneScript(t *testing.T) {
+	var tests = []struct {
+		q          string
+		hasTZ      bool
+		bucketizer string
+	}{
+		{"SELECT mean(v) FROM m WHERE time > now() - 7d GROUP BY time(1d) tz('Europe/Paris')", true, "bucketizer.mean $tzend 86400000000"},
+		{"SELECT mean(v) FROM m WHERE time > now() - 7d GROUP BY time(1d)", false, "bucketizer.mean $end 86400000000"},
+		{"SELECT mean(v) FROM m WHERE time > now() - 7d GROUP BY time(1d) tz('UTC')", false, "bucketizer.mean $end 86400000000"},
+		{"SELECT v FROM m WHERE time > now() - 7d tz('Europe/Paris')", false, ""},
+	}
+
+	for _, test := range tests {
+		stmt, err := influxql.ParseStatement(test.q)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", test.q, err)
+		}
+
+		p := &InfluxParser{Token: "T", End: "$end", BucketTime: "0", BucketCount: "1", Separator: "."}
+		mc2, _, _, _, err := p.getSelectStatementScript(stmt.(*influxql.SelectStatement), nil, "", 0, 0)
+		if err != nil {
+			t.Errorf("Expected nil for %s, got %v", test.q, err)
+			continue
+		}
+
+		for _, expected := range []string{"'Europe/Paris' 'tz' STORE", "$tz_local @tz_shift", "$tz_utc @tz_shift"} {
+			if strings.Contains(mc2, expected) != test.hasTZ {
+				t.Errorf("Expected %s presence to be %t for %s", expected, test.hasTZ, test.q)
+			}
+		}
+		if !strings.Contains(mc2, test.bucketizer) {
+			t.Errorf("Expected %s in the script of %s", test.bucketizer, test.q)
+		}
+	}
+}
+
+func TestGetFormatedTimeLocation(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("Timezone database unavailable")
+	}
+
+	var tests = []struct {
+		tick     float64
+		location *time.Location
+		expected string
+	}{
+		{1546300800000, nil, "2019-01-01T00:00:00Z"},
+		{1546300800000, paris, "2019-01-01T01:00:00+01:00"},
+		{1561939200000, paris, "2019-07-01T02:00:00+02:00"},
+	}
+
+	for _, test := range tests {
+		if res := getFormatedTime(test.tick, "rfc3339", test.location); res != test.expected {
+			t.Errorf("Expected %s, got %v", test.expected, res)
+		}
+	}
+}
+
+// TestTimezoneDST bucketize hourly points by day in Europe/Paris across the DST
+// changes: the spring forward day has 23 hours, the fall back one 25. It requires
+// a Warp 10 instance, set in WARP_TEST_ENDPOINT as for the prototests.
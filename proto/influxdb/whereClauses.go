@@ -324,7 +324,18 @@ func (p *InfluxParser) parseOperator(lhs influxql.Expr, op influxql.Token, rhs i
 			eqTag[0] = &WhereCond{key: lhs.String(), op: op, value: rhsValue}
 			eqTags = append(eqTags, eqTag)
 		case *influxql.RegexLiteral:
-			rhsValue := &influxql.VarRef{Type: influxql.String, Val: strings.Trim(rhsExpr.String(), "/")}
+			regex := strings.Trim(rhsExpr.String(), "/")
+			var err error
+			switch op {
+			case influxql.EQREGEX:
+				regex, err = javaRegex(rhsExpr.Val.String())
+			case influxql.NEQREGEX:
+				regex, err = javaNotRegex(rhsExpr.Val.String())
+			}
+			if err != nil {
+				return nil, err
+			}
+			rhsValue := &influxql.VarRef{Type: influxql.String, Val: regex}
 			eqTag := make([]*WhereCond, 1)
 			eqTag[0] = &WhereCond{key: lhs.String(), op: op, value: rhsValue}
 			eqTags = append(eqTags, eqTag)
@@ -1,7 +1,9 @@
 package opentsdb
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/ovh/erlenmeyer/core"
@@ -27,12 +29,71 @@ var aggregatorToReduce = map[string]string{
 	"count":  "reducer.count.exclude-nulls",
 }
 
+// Quantiles of the estimated percentile aggregators, epXXrY
+var estimatedPercentiles = map[string]float64{
+	"50":  0.5,
+	"75":  0.75,
+	"90":  0.9,
+	"95":  0.95,
+	"99":  0.99,
+	"999": 0.999,
+}
+
+func init() {
+	for name, quantile := range estimatedPercentiles {
+		aggregatorToReduce["ep"+name+"r3"] = estimatedPercentileReducer(quantile, 3)
+		aggregatorToReduce["ep"+name+"r7"] = estimatedPercentileReducer(quantile, 7)
+	}
+}
+
+// estimatedPercentileReducer return a WarpScript reducer estimating the quantile p of the
+// values of the grouped series, with the R3 or R7 estimation of Apache Commons Math as OpenTSDB does
+func estimatedPercentileReducer(p float64, estimation int) string {
+	out := &bytes.Buffer{}
+
+	out.WriteString("<%\n")
+	out.WriteString("\t'reducer_window' STORE\n")
+	// Values of the missing series are null
+	out.WriteString("\t[ $reducer_window 7 GET <% DUP ISNULL <% DROP %> IFT %> FOREACH ] LSORT 'reducer_values' STORE\n")
+	out.WriteString("\t$reducer_values SIZE 'reducer_n' STORE\n")
+
+	// 1-based position of the percentile in the sorted values
+	if estimation == 3 {
+		fmt.Fprintf(out, "\t<%% %g 0.5 $reducer_n TODOUBLE / <= %%> <%% 0.0 %%> <%% $reducer_n %g * RINT %%> IFTE 'reducer_pos' STORE\n", p, p)
+	} else {
+		fmt.Fprintf(out, "\t$reducer_n 1 - %g * 1.0 + 'reducer_pos' STORE\n", p)
+	}
+
+	out.WriteString("\t<% $reducer_n 0 == %>\n")
+	out.WriteString("\t<% NULL %>\n")
+	out.WriteString("\t<%\n")
+	out.WriteString("\t\t<% $reducer_pos 1.0 < %> <% $reducer_values 0 GET %>\n")
+	out.WriteString("\t\t<%\n")
+	out.WriteString("\t\t\t<% $reducer_pos $reducer_n >= %> <% $reducer_values $reducer_n 1 - GET %>\n")
+	out.WriteString("\t\t\t<%\n")
+	// Linear interpolation between the surrounding values
+	out.WriteString("\t\t\t\t$reducer_pos FLOOR TOLONG 'reducer_floor' STORE\n")
+	out.WriteString("\t\t\t\t$reducer_values $reducer_floor 1 - GET 'reducer_lower' STORE\n")
+	out.WriteString("\t\t\t\t$reducer_values $reducer_floor GET $reducer_lower -\n")
+	out.WriteString("\t\t\t\t$reducer_pos $reducer_floor - *\n")
+	out.WriteString("\t\t\t\t$reducer_lower +\n")
+	out.WriteString("\t\t\t%> IFTE\n")
+	out.WriteString("\t\t%> IFTE\n")
+	out.WriteString("\t%> IFTE\n")
+	out.WriteString("\t'reducer_value' STORE\n")
+	out.WriteString("\t[ $reducer_window 0 GET NaN NaN NaN $reducer_value ]\n")
+	out.WriteString("%>\n")
+	out.WriteString("MACROREDUCER")
+
+	return out.String()
+}
+
 // HandleAggregators Handle OpenTSDB aggregators
 func (c *OpenTSDB) HandleAggregators(responseWriter http.ResponseWriter, request *http.Request) {
 	token := core.RetrieveToken(request)
 	if len(token) == 0 {
 		c.WarnCounter.Inc()
-		http.Error(responseWriter, "Not authorized", 401)
+		writeError(responseWriter, 401, "Not authorized")
 		return
 	}
 	responseWriter.Header().Add("Content-Type", "application/json")
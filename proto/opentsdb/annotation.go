@@ -0,0 +1,506 @@
+package opentsdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/ovh/erlenmeyer/core"
+	"github.com/ovh/erlenmeyer/middlewares"
+)
+
+const (
+	annotationScopeGlobal = "global"
+	annotationScopeSeries = "series"
+)
+
+var tsuidRe = regexp.MustCompile("^[0-9A-Fa-f]*$")
+
+// Annotation an OpenTSDB annotation, stored in Warp10 as a string series
+// http://opentsdb.net/docs/build/html/api_http/annotation/index.html
+type Annotation struct {
+	TSUID       string            `schema:"tsuid"       json:"tsuid,omitempty"`
+	Description string            `schema:"description" json:"description"`
+	Notes       string            `schema:"notes"       json:"notes"`
+	Custom      map[string]string `schema:"-"           json:"custom"`
+	StartTime   int64             `schema:"startTime"   json:"startTime"`
+	EndTime     int64             `schema:"endTime"     json:"endTime"`
+}
+
+// annotationValue is the JSON value of an annotation datapoint
+type annotationValue struct {
+	Description string            `json:"description"`
+	Notes       string            `json:"notes"`
+	Custom      map[string]string `json:"custom"`
+	EndTime     int64             `json:"endTime"`
+}
+
+// AnnotationBulkDelete an OpenTSDB bulk annotations deletion
+type AnnotationBulkDelete struct {
+	TSUIDs       []string `json:"tsuids"`
+	Global       bool     `json:"global"`
+	StartTime    int64    `json:"startTime"`
+	EndTime      int64    `json:"endTime"`
+	TotalDeleted int      `json:"totalDeleted"`
+}
+
+// Validate is the implementation of Validate for Annotation
+func (a *Annotation) Validate() error {
+	if a.StartTime <= 0 {
+		return errors.New("Missing start time")
+	}
+	if !tsuidRe.MatchString(a.TSUID) {
+		return fmt.Errorf("Invalid TSUID %s", a.TSUID)
+	}
+	if a.EndTime != 0 && a.EndTime < a.StartTime {
+		return errors.New("End time is before start time")
+	}
+	return nil
+}
+
+// Validate is the implementation of Validate for AnnotationBulkDelete
+func (b *AnnotationBulkDelete) Validate() error {
+	if b.StartTime <= 0 {
+		return errors.New("Missing start time")
+	}
+	if !b.Global && len(b.TSUIDs) == 0 {
+		return errors.New("Missing TSUIDs or global annotations flag")
+	}
+	for _, tsuid := range b.TSUIDs {
+		if tsuid == "" || !tsuidRe.MatchString(tsuid) {
+			return fmt.Errorf("Invalid TSUID %s", tsuid)
+		}
+	}
+	if b.EndTime == 0 {
+		b.EndTime = time.Now().Unix()
+	}
+	if b.EndTime < b.StartTime {
+		return errors.New("End time is before start time")
+	}
+	return nil
+}
+
+// annotationClass is the classname of the annotation series
+func annotationClass() string {
+	return viper.GetString("opentsdb.annotations.classname")
+}
+
+// annotationLabels return the labels of the series of the annotations of a TSUID, or of the global ones
+func annotationLabels(tsuid string) map[string]string {
+	if tsuid == "" {
+		return map[string]string{"scope": annotationScopeGlobal}
+	}
+	return map[string]string{"scope": annotationScopeSeries, "tsuid": tsuid}
+}
+
+// annotationSelector return the Warp10 selector of the annotations of a TSUID, or of the global ones,
+// with its class and labels escaped by escape
+func annotationSelector(tsuid string, escape func(string) string) string {
+	labels := annotationLabels(tsuid)
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	selectors := make([]string, 0, len(keys))
+	for _, key := range keys {
+		selectors = append(selectors, escape(key)+"="+escape(labels[key]))
+	}
+	return escape(annotationClass()) + "{" + strings.Join(selectors, ",") + "}"
+}
+
+// gtsInput return the annotation in the GTS input format
+func (a *Annotation) gtsInput() (string, error) {
+	value, err := json.Marshal(&annotationValue{
+		Description: a.Description,
+		Notes:       a.Notes,
+		Custom:      a.Custom,
+		EndTime:     a.EndTime,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d// %s '%s'", int64toMicroSec(a.StartTime), annotationSelector(a.TSUID, url.QueryEscape), url.QueryEscape(string(value))), nil
+}
+
+// writeAnnotations store annotations in Warp10
+func writeAnnotations(token string, annotations []*Annotation) error {
+	lines := make([]string, 0, len(annotations))
+	for _, annotation := range annotations {
+		line, err := annotation.gtsInput()
+		if err != nil {
+			return err
+		}
+		lines = append(lines, line)
+	}
+
+	warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "opentsdb-annotation")
+	return warpServer.Update(token, strings.Join(lines, "\n"))
+}
+
+// deleteAnnotations remove the annotations of a TSUID, or the global ones, between start and end seconds
+func deleteAnnotations(token, tsuid string, start, end int64) error {
+	selector := annotationSelector(tsuid, func(s string) string { return s })
+	query := fmt.Sprintf("selector=%s&start=%s&end=%s", url.QueryEscape(selector),
+		core.IsoTime(time.Unix(0, int64toMicroSec(start)*1000)), core.IsoTime(time.Unix(0, int64toMicroSec(end)*1000)))
+
+	warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "opentsdb-annotation")
+	return warpServer.Delete(token, query)
+}
+
+// fetchAnnotations read the annotations selected by labels between start and end,
+// or the last one at or before end when start is nil
+func fetchAnnotations(token, txn string, labels map[string]string, start *time.Time, end time.Time) ([]*Annotation, error) {
+	out := &bytes.Buffer{}
+	fmt.Fprint(out, "JSONSTRICT\n")
+	fmt.Fprintf(out, "'3' MINREV <%% '%s' CAPADD %%> <%% '%s' AUTHENTICATE %%> IFTE\n", token, token)
+	fmt.Fprintf(out, "[ '%s' '%s' {", token, annotationClass())
+	for key, value := range labels {
+		fmt.Fprintf(out, " '%s' '=%s'", key, value)
+	}
+	fmt.Fprint(out, " }")
+	if start == nil {
+		fmt.Fprintf(out, " %d -1", end.UnixNano()/1000)
+	} else {
+		fmt.Fprintf(out, " '%s' '%s'", core.IsoTime(*start), core.IsoTime(end))
+	}
+	fmt.Fprint(out, " ] FETCH 'gts' STORE\n")
+	fmt.Fprint(out, "{ 'gts' $gts }\n")
+
+	warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "opentsdb-annotation")
+	result, err := warpServer.QueryGTS(out.String(), txn)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := []*Annotation{}
+	for _, gts := range result.GTS {
+		for _, reading := range gts.Values {
+			tick, ok := reading[0].(float64)
+			if !ok {
+				continue
+			}
+			text, ok := reading[len(reading)-1].(string)
+			if !ok {
+				continue
+			}
+
+			value := annotationValue{}
+			if err := json.Unmarshal([]byte(text), &value); err != nil {
+				log.WithFields(log.Fields{
+					"error": err.Error(),
+					"proto": "opentsdb",
+				}).Warn("Invalid annotation value")
+				continue
+			}
+
+			annotations = append(annotations, &Annotation{
+				TSUID:       gts.Labels["tsuid"],
+				Description: value.Description,
+				Notes:       value.Notes,
+				Custom:      value.Custom,
+				StartTime:   int64(tick) / 1000000,
+				EndTime:     value.EndTime,
+			})
+		}
+	}
+
+	sort.Slice(annotations, func(i, j int) bool {
+		return annotations[i].StartTime < annotations[j].StartTime
+	})
+
+	return annotations, nil
+}
+
+// fetchAnnotation read the annotation of a TSUID, or a global one, starting at startTime
+func fetchAnnotation(token, txn string, tsuid string, startTime int64) (*Annotation, error) {
+	annotations, err := fetchAnnotations(token, txn, annotationLabels(tsuid), nil, time.Unix(0, int64toMicroSec(startTime)*1000))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, annotation := range annotations {
+		if annotation.StartTime == int64toMicroSec(startTime)/1000000 {
+			return annotation, nil
+		}
+	}
+	return nil, nil
+}
+
+// HandleAnnotation is the handler for /api/annotation
+func (o *OpenTSDB) HandleAnnotation(w http.ResponseWriter, r *http.Request) {
+
+	token := core.RetrieveToken(r)
+	if len(token) == 0 {
+		o.WarnCounter.Inc()
+		writeError(w, 401, "Not authorized")
+		return
+	}
+
+	annotation := &Annotation{}
+	if r.Method == http.MethodDelete && len(r.URL.Query()) > 0 {
+		// Deletions can be sent as query string too
+		err := OpenTsdbDecoder.Decode(annotation, r.URL.Query())
+		if err == nil {
+			err = annotation.Validate()
+		}
+		if err != nil {
+			o.WarnCounter.Inc()
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else if err := DecodeRequestParams(w, r, annotation); err != nil {
+		o.WarnCounter.Inc()
+		return // Response was sent
+	}
+
+	txn := w.Header().Get(middlewares.TxnHeader)
+
+	switch r.Method {
+	case http.MethodGet:
+		existing, err := fetchAnnotation(token, txn, annotation.TSUID, annotation.StartTime)
+		if err != nil {
+			o.ErrCounter.Inc()
+			writeDetailedError(w, egressError(err.Error()))
+			return
+		}
+		if existing == nil {
+			o.WarnCounter.Inc()
+			writeError(w, http.StatusNotFound, "Unable to locate annotation in storage")
+			return
+		}
+		annotation = existing
+
+	case http.MethodPost, http.MethodPut:
+		// POST only updates the provided fields, PUT replaces the whole annotation
+		if r.Method == http.MethodPost {
+			existing, err := fetchAnnotation(token, txn, annotation.TSUID, annotation.StartTime)
+			if err != nil {
+				o.ErrCounter.Inc()
+				writeDetailedError(w, egressError(err.Error()))
+				return
+			}
+			annotation.merge(existing)
+		}
+
+		if err := writeAnnotations(token, []*Annotation{annotation}); err != nil {
+			o.ErrCounter.Inc()
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+				"proto": "opentsdb",
+			}).Error("Error storing annotation")
+			writeError(w, http.StatusInternalServerError, "Error storing annotation")
+			return
+		}
+
+	case http.MethodDelete:
+		if err := deleteAnnotations(token, annotation.TSUID, annotation.StartTime, annotation.StartTime); err != nil {
+			o.ErrCounter.Inc()
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+				"proto": "opentsdb",
+			}).Error("Error deleting annotation")
+			writeError(w, http.StatusInternalServerError, "Error deleting annotation")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	default:
+		o.WarnCounter.Inc()
+		w.Header().Add("Allow", "GET, POST, PUT, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method '%s' is not allowed", r.Method))
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(annotation)
+}
+
+// merge fill the fields of the annotation not provided with the existing ones
+func (a *Annotation) merge(existing *Annotation) {
+	if existing == nil {
+		return
+	}
+	if a.Description == "" {
+		a.Description = existing.Description
+	}
+	if a.Notes == "" {
+		a.Notes = existing.Notes
+	}
+	if a.Custom == nil {
+		a.Custom = existing.Custom
+	}
+	if a.EndTime == 0 {
+		a.EndTime = existing.EndTime
+	}
+}
+
+// HandleAnnotationBulk is the handler for /api/annotation/bulk
+func (o *OpenTSDB) HandleAnnotationBulk(w http.ResponseWriter, r *http.Request) {
+
+	token := core.RetrieveToken(r)
+	if len(token) == 0 {
+		o.WarnCounter.Inc()
+		writeError(w, 401, "Not authorized")
+		return
+	}
+
+	txn := w.Header().Get(middlewares.TxnHeader)
+
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			o.WarnCounter.Inc()
+			writeError(w, http.StatusBadRequest, "Bad request body")
+			return
+		}
+
+		annotations := []*Annotation{}
+		if err := json.Unmarshal(body, &annotations); err != nil {
+			o.WarnCounter.Inc()
+			writeError(w, http.StatusBadRequest, "can't parse annotations")
+			return
+		}
+		for _, annotation := range annotations {
+			if err := annotation.Validate(); err != nil {
+				o.WarnCounter.Inc()
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		if len(annotations) > 0 {
+			if err := writeAnnotations(token, annotations); err != nil {
+				o.ErrCounter.Inc()
+				log.WithFields(log.Fields{
+					"error": err.Error(),
+					"proto": "opentsdb",
+				}).Error("Error storing annotations")
+				writeError(w, http.StatusInternalServerError, "Error storing annotations")
+				return
+			}
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(annotations)
+
+	case http.MethodDelete:
+		bulk := &AnnotationBulkDelete{}
+		if err := DecodeRequestParams(w, r, bulk); err != nil {
+			o.WarnCounter.Inc()
+			return // Response was sent
+		}
+
+		tsuids := bulk.TSUIDs
+		if bulk.Global {
+			tsuids = append(tsuids, "")
+		}
+
+		start := time.Unix(0, int64toMicroSec(bulk.StartTime)*1000)
+		end := time.Unix(0, int64toMicroSec(bulk.EndTime)*1000)
+		for _, tsuid := range tsuids {
+			// Warp10 doesn't report the number of deleted datapoints, they are counted first
+			annotations, err := fetchAnnotations(token, txn, annotationLabels(tsuid), &start, end)
+			if err == nil {
+				bulk.TotalDeleted += len(annotations)
+				err = deleteAnnotations(token, tsuid, bulk.StartTime, bulk.EndTime)
+			}
+			if err != nil {
+				o.ErrCounter.Inc()
+				log.WithFields(log.Fields{
+					"error": err.Error(),
+					"proto": "opentsdb",
+				}).Error("Error deleting annotations")
+				writeError(w, http.StatusInternalServerError, "Error deleting annotations")
+				return
+			}
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(bulk)
+
+	default:
+		o.WarnCounter.Inc()
+		w.Header().Add("Allow", "POST, PUT, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method '%s' is not allowed", r.Method))
+	}
+}
+
+// attachAnnotations add the annotations of the query time range to the responses. Series
+// annotations are matched on the TSUIDs of the fetched series behind each response, and are
+// only fetched when some response has such series
+func attachAnnotations(token, txn string, query *QueryRequest, responses []*QueryResponse) {
+	seriesAnnotations := false
+	if !query.NoAnnotations {
+		for _, rep := range responses {
+			if len(rep.sources) > 0 {
+				seriesAnnotations = true
+				break
+			}
+		}
+	}
+	if !seriesAnnotations && !query.GlobalAnnotations {
+		return
+	}
+
+	labels := map[string]string{}
+	if !seriesAnnotations {
+		labels = annotationLabels("")
+	} else if !query.GlobalAnnotations {
+		labels = map[string]string{"scope": annotationScopeSeries}
+	}
+
+	annotations, err := fetchAnnotations(token, txn, labels, &query.Start.Time, query.End.Time)
+	if err != nil {
+		// Annotations are best effort, the query results are still returned
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+			"txn":   txn,
+			"proto": "opentsdb",
+		}).Error("Can't fetch the annotations of a query, they are missing from its results")
+		return
+	}
+
+	global := []*Annotation{}
+	byTSUID := map[string][]*Annotation{}
+	for _, annotation := range annotations {
+		if annotation.TSUID == "" {
+			global = append(global, annotation)
+		} else {
+			byTSUID[annotation.TSUID] = append(byTSUID[annotation.TSUID], annotation)
+		}
+	}
+
+	for _, rep := range responses {
+		if query.GlobalAnnotations && len(global) > 0 {
+			rep.GlobalAnnotations = global
+		}
+		if !seriesAnnotations {
+			continue
+		}
+		for _, tsuid := range rep.sources {
+			rep.Annotations = append(rep.Annotations, byTSUID[tsuid]...)
+		}
+		sort.SliceStable(rep.Annotations, func(i, j int) bool {
+			return rep.Annotations[i].StartTime < rep.Annotations[j].StartTime
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package opentsdb
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Maximum number of calendar buckets generated for a single sub query
+const maxCalendarBuckets = 10000
+
+// alignCalendar return the start of the calendar unit containing t, in the location of t.
+// Weeks start on sunday, as in OpenTSDB. Units shorter than a day are aligned in absolute
+// time, as the wall clock repeated when the DST ends would be resolved to its last occurrence.
+func alignCalendar(t time.Time, unit string) time.Time {
+	switch unit {
+	case "ms":
+		return t.Add(-time.Duration(t.Nanosecond() % int(time.Millisecond)))
+	case "s":
+		return t.Add(-time.Duration(t.Nanosecond()))
+	case "m":
+		return t.Add(-time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	case "h":
+		return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	case "d":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case "w":
+		return time.Date(t.Year(), t.Month(), t.Day()-int(t.Weekday()), 0, 0, 0, 0, t.Location())
+	case "n":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	case "y":
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+	}
+
+	return t
+}
+
+// addCalendar add count calendar units to t, days, weeks, months and years follow
+// the wall clock of the location of t so that they stay aligned across DST changes
+func addCalendar(t time.Time, count int64, unit string) time.Time {
+	switch unit {
+	case "d":
+		return t.AddDate(0, 0, int(count))
+	case "w":
+		return t.AddDate(0, 0, 7*int(count))
+	case "n":
+		return t.AddDate(0, int(count), 0)
+	case "y":
+		return t.AddDate(int(count), 0, 0)
+	}
+
+	return t.Add(time.Duration(count * durationUnits[unit]))
+}
+
+// calendarBoundaries return the boundaries of the calendar buckets covering [start, end]
+func calendarBoundaries(start, end time.Time, count int64, unit string, location *time.Location) ([]time.Time, error) {
+	first := alignCalendar(start.In(location), unit)
+
+	boundaries := []time.Time{first}
+	for i := int64(1); !boundaries[len(boundaries)-1].After(end); i++ {
+		if len(boundaries) > maxCalendarBuckets {
+			return nil, fmt.Errorf("Calendar downsampling produces more than %d buckets", maxCalendarBuckets)
+		}
+		boundaries = append(boundaries, addCalendar(first, i*count, unit))
+	}
+
+	return boundaries, nil
+}
+
+// generateCalendarBucketizeScript of an OpenTSDB subquery, buckets are aligned on the calendar
+// of the location and each bucket is reported at its start, as OpenTSDB does
+// nolint: interfacer
+func (q *Query) generateCalendarBucketizeScript(out *bytes.Buffer, start, end time.Time, count int64, unit, bucketizer, fillPolicy string) error {
+	boundaries, err := calendarBoundaries(start, end, count, unit, q.location)
+	if err != nil {
+		return err
+	}
+
+	span := count * durationUnits[unit] / 1000
+	fmt.Fprint(out, "'gts' STORE\n")
+	fmt.Fprintf(out, "%d 'bucketspan' STORE\n", span)
+
+	// Units below a day have a constant length: a regular BUCKETIZE aligned on the calendar is enough
+	switch unit {
+	case "ms", "s", "m", "h":
+		first := boundaries[0].UnixNano() / 1000
+		last := boundaries[len(boundaries)-1].UnixNano()/1000 - 1
+
+		fmt.Fprintf(out, "[ $gts %s %d $bucketspan %d ] BUCKETIZE\n", bucketizer, last, (last-first+1)/span)
+		fmt.Fprint(out, "$bucketspan 1 - -1 * TIMESHIFT\n")
+
+		q.generateFillScript(out, fillPolicy)
+		return nil
+	}
+
+	// Otherwise each bucket has its own length, they are computed one by one then merged
+	fmt.Fprint(out, "[")
+	for _, boundary := range boundaries {
+		fmt.Fprintf(out, " %d", boundary.UnixNano()/1000)
+	}
+	fmt.Fprint(out, " ] 'calendar' STORE\n")
+
+	fmt.Fprint(out, "$gts\n<%\n")
+	fmt.Fprint(out, "\tDROP 'calendar_gts' STORE\n")
+	fmt.Fprint(out, "\t[\n")
+	fmt.Fprint(out, "\t0 $calendar SIZE 2 -\n")
+	fmt.Fprint(out, "\t<%\n")
+	fmt.Fprint(out, "\t\t'calendar_index' STORE\n")
+	fmt.Fprint(out, "\t\t$calendar $calendar_index GET 'calendar_from' STORE\n")
+	fmt.Fprint(out, "\t\t$calendar $calendar_index 1 + GET 'calendar_to' STORE\n")
+	fmt.Fprintf(out, "\t\t[ $calendar_gts %s $calendar_to 1 - $calendar_to $calendar_from - 1 ] BUCKETIZE 0 GET\n", bucketizer)
+	fmt.Fprint(out, "\t\t$calendar_to 1 - $calendar_from - -1 * TIMESHIFT\n")
+
+	// Buckets are not regular anymore: missing ones can be filled with a value but not interpolated
+	switch fillPolicy {
+	case "nan":
+		fmt.Fprint(out, "\t\t<% DUP SIZE 0 == %> <% $calendar_from NaN NaN NaN NaN ADDVALUE %> IFT\n")
+	case "zero":
+		fmt.Fprint(out, "\t\t<% DUP SIZE 0 == %> <% $calendar_from NaN NaN NaN 0.0 ADDVALUE %> IFT\n")
+	}
+
+	fmt.Fprint(out, "\t%> FOR\n")
+	fmt.Fprint(out, "\t] MERGE\n")
+	fmt.Fprint(out, "%> LMAP\n")
+
+	return nil
+}
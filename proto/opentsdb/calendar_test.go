@@ -0,0 +1,110 @@
+package opentsdb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func utc(month time.Month, day, hour, min int) time.Time {
+	return time.Date(2019, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestAlignCalendarDST(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("Timezone database unavailable")
+	}
+
+	var tests = []struct {
+		t        time.Time
+		unit     string
+		expected time.Time
+	}{
+		// Spring forward, 2019-03-31 02:00 CET is 03:00 CEST
+		{utc(time.March, 31, 0, 30), "h", utc(time.March, 31, 0, 0)},
+		{utc(time.March, 31, 1, 30), "h", utc(time.March, 31, 1, 0)},
+		{utc(time.March, 31, 12, 0), "d", utc(time.March, 30, 23, 0)},
+		{utc(time.March, 31, 12, 0), "w", utc(time.March, 30, 23, 0)},
+		{utc(time.April, 15, 12, 0), "n", utc(time.March, 31, 22, 0)},
+		// Fall back, 2019-10-27 03:00 CEST is 02:00 CET, 02:30 happens twice
+		{utc(time.October, 27, 0, 30), "h", utc(time.October, 27, 0, 0)},
+		{utc(time.October, 27, 1, 30), "h", utc(time.October, 27, 1, 0)},
+		{utc(time.October, 27, 0, 45).Add(30 * time.Second), "m", utc(time.October, 27, 0, 45)},
+		{utc(time.October, 27, 12, 0), "d", utc(time.October, 26, 22, 0)},
+		{utc(time.October, 31, 12, 0), "n", utc(time.September, 30, 22, 0)},
+	}
+
+	for _, test := range tests {
+		if aligned := alignCalendar(test.t.In(paris), test.unit); !aligned.Equal(test.expected) {
+			t.Errorf("Expected %s aligned on %s to be %s, got %s", test.t, test.unit, test.expected, aligned.UTC())
+		}
+	}
+}
+
+func TestCalendarBoundariesDST(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("Timezone database unavailable")
+	}
+
+	var tests = []struct {
+		name       string
+		start, end time.Time
+		unit       string
+		expected   []time.Time
+	}{
+		{
+			name:  "spring forward day is 23 hours long",
+			start: utc(time.March, 30, 12, 0),
+			end:   utc(time.April, 1, 12, 0),
+			unit:  "d",
+			expected: []time.Time{
+				utc(time.March, 29, 23, 0), utc(time.March, 30, 23, 0), utc(time.March, 31, 22, 0), utc(time.April, 1, 22, 0),
+			},
+		},
+		{
+			name:  "fall back day is 25 hours long",
+			start: utc(time.October, 26, 12, 0),
+			end:   utc(time.October, 28, 12, 0),
+			unit:  "d",
+			expected: []time.Time{
+				utc(time.October, 25, 22, 0), utc(time.October, 26, 22, 0), utc(time.October, 27, 23, 0), utc(time.October, 28, 23, 0),
+			},
+		},
+		{
+			name:  "spring forward hours are contiguous",
+			start: utc(time.March, 31, 0, 15),
+			end:   utc(time.March, 31, 1, 30),
+			unit:  "h",
+			expected: []time.Time{
+				utc(time.March, 31, 0, 0), utc(time.March, 31, 1, 0), utc(time.March, 31, 2, 0),
+			},
+		},
+		{
+			name:  "fall back repeated hour is a bucket of its own",
+			start: utc(time.October, 27, 0, 15),
+			end:   utc(time.October, 27, 2, 0),
+			unit:  "h",
+			expected: []time.Time{
+				utc(time.October, 27, 0, 0), utc(time.October, 27, 1, 0), utc(time.October, 27, 2, 0), utc(time.October, 27, 3, 0),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		boundaries, err := calendarBoundaries(test.start, test.end, 1, test.unit, paris)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		got := []time.Time{}
+		for _, boundary := range boundaries {
+			got = append(got, boundary.UTC())
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ovh/erlenmeyer/core"
+)
+
+const (
+	// openTSDBVersion is the OpenTSDB version erlenmeyer is compatible with
+	openTSDBVersion = "2.4.0"
+)
+
+// Version an OpenTSDB version response
+// http://opentsdb.net/docs/build/html/api_http/version.html
+type Version struct {
+	Timestamp     string `json:"timestamp"`
+	Host          string `json:"host"`
+	Repo          string `json:"repo"`
+	FullRevision  string `json:"full_revision"`
+	ShortRevision string `json:"short_revision"`
+	User          string `json:"user"`
+	Version       string `json:"version"`
+	RepoStatus    string `json:"repo_status"`
+	Branch        string `json:"branch"`
+}
+
+// Serializer an OpenTSDB serializer description
+// http://opentsdb.net/docs/build/html/api_http/serializers.html
+type Serializer struct {
+	Serializer          string   `json:"serializer"`
+	Formatters          []string `json:"formatters"`
+	Parsers             []string `json:"parsers"`
+	Class               string   `json:"class"`
+	ResponseContentType string   `json:"response_content_type"`
+	RequestContentType  string   `json:"request_content_type"`
+	Version             string   `json:"version"`
+}
+
+// serializers supported by erlenmeyer, only the formatters and parsers
+// of the implemented endpoints are listed
+var serializers = []Serializer{
+	{
+		Serializer: "json",
+		Formatters: []string{
+			"formatAggregatorsV1",
+			"formatAnnotationV1",
+			"formatAnnotationsV1",
+			"formatConfigV1",
+			"formatFilterConfigV1",
+			"formatLastPointQueryV1",
+			"formatQueryV1",
+			"formatSearchResultsV1",
+			"formatSerializersV1",
+			"formatSuggestV1",
+			"formatTSMetaListV1",
+			"formatTSMetaV1",
+			"formatUIDAssignV1",
+			"formatUidMetaV1",
+			"formatVersionV1",
+		},
+		Parsers: []string{
+			"parseAnnotationBulkDeleteV1",
+			"parseAnnotationV1",
+			"parseAnnotationsV1",
+			"parseLastPointQueryV1",
+			"parseQueryV1",
+			"parseSearchQueryV1",
+			"parseSuggestV1",
+			"parseTSMetaV1",
+			"parseUidAssignV1",
+		},
+		Class:               "net.opentsdb.tsd.HttpJsonSerializer",
+		ResponseContentType: "application/json; charset=UTF-8",
+		RequestContentType:  "application/json",
+		Version:             openTSDBVersion,
+	},
+}
+
+// config return the OpenTSDB configuration matching erlenmeyer features
+func config() map[string]string {
+	aggregators := GetAggregators()
+	sort.Strings(aggregators)
+
+	filterTypes := []string{}
+	for filterType := range filters {
+		filterTypes = append(filterTypes, filterType)
+	}
+	sort.Strings(filterTypes)
+
+	return map[string]string{
+		"tsd.core.auto_create_metrics":            "false",
+		"tsd.core.enable_api":                     "true",
+		"tsd.core.enable_ui":                      "false",
+		"tsd.core.meta.enable_realtime_ts":        "false",
+		"tsd.core.meta.enable_realtime_uid":       "false",
+		"tsd.core.meta.enable_tsuid_incrementing": "false",
+		"tsd.core.meta.enable_tsuid_tracking":     "false",
+		"tsd.core.uid.random_metrics":             "false",
+		"tsd.http.query.allow_delete":             "true",
+		"tsd.http.request.enable_chunked":         "false",
+		"tsd.http.show_stack_trace":               "false",
+		"tsd.mode":                                "rw",
+		"tsd.query.allow_simultaneous_duplicates": "true",
+		"tsd.query.aggregators":                   strings.Join(aggregators, ","),
+		"tsd.query.filters":                       strings.Join(filterTypes, ","),
+	}
+}
+
+// HandleVersion is the handler for /api/version
+func (o *OpenTSDB) HandleVersion(w http.ResponseWriter, r *http.Request) {
+	token := core.RetrieveToken(r)
+	if len(token) == 0 {
+		o.WarnCounter.Inc()
+		writeError(w, 401, "Not authorized")
+		return
+	}
+
+	host, _ := os.Hostname()
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(&Version{
+		Host:       host,
+		Repo:       "erlenmeyer",
+		Version:    openTSDBVersion,
+		RepoStatus: "MINT",
+	})
+}
+
+// HandleConfig is the handler for /api/config
+func (o *OpenTSDB) HandleConfig(w http.ResponseWriter, r *http.Request) {
+	token := core.RetrieveToken(r)
+	if len(token) == 0 {
+		o.WarnCounter.Inc()
+		writeError(w, 401, "Not authorized")
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(config())
+}
+
+// HandleSerializers is the handler for /api/serializers
+func (o *OpenTSDB) HandleSerializers(w http.ResponseWriter, r *http.Request) {
+	token := core.RetrieveToken(r)
+	if len(token) == 0 {
+		o.WarnCounter.Inc()
+		writeError(w, 401, "Not authorized")
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(serializers)
+}
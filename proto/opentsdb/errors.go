@@ -0,0 +1,90 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ovh/erlenmeyer/models"
+)
+
+var (
+	urlDecoderRe    = regexp.MustCompile(`URLDecoder: ([^<]*)`)
+	scriptLineRe    = regexp.MustCompile(`line #(\d+)`)
+	fetchLimitRe    = regexp.MustCompile(`(?:limit of )(\d+)(?: datapoints, current count is )(\d+)</pre>`)
+	socketTimeoutRe = regexp.MustCompile(`(?:hostname=)([^,]*)`)
+)
+
+// writeError send an OpenTSDB error response
+// http://opentsdb.net/docs/build/html/api_http/index.html#errors
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeDetailedError(w, models.NewDetailedError(code, message, ""))
+}
+
+// writeDetailedError send an OpenTSDB error response with its details
+func writeDetailedError(w http.ResponseWriter, e *models.DetailedError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Error.Code)
+	json.NewEncoder(w).Encode(e)
+}
+
+// egressError classify and log an error returned by Warp 10 as an OpenTSDB error,
+// the Warp 10 exception is only logged as it may leak internal stack traces
+func egressError(errorText string) *models.DetailedError {
+	switch {
+	case strings.Contains(errorText, "URLDecoder"):
+		e := ""
+		if parts := urlDecoderRe.FindStringSubmatch(errorText); len(parts) > 1 {
+			e = parts[1]
+		}
+		l := "-1"
+		if parts := scriptLineRe.FindStringSubmatch(errorText); len(parts) > 1 {
+			l = parts[1]
+		}
+		log.WithFields(log.Fields{
+			"error":       errorText,
+			"proto":       "opentsdb",
+			"query-error": e,
+			"line":        l,
+		}).Warn("Malformed WarpScript")
+		return models.NewDetailedError(http.StatusBadRequest, "Unable to build a backend query from the request", "")
+
+	case strings.Contains(errorText, "FETCH exceeded limit of"):
+		max := "-1"
+		current := "-1"
+		if parts := fetchLimitRe.FindStringSubmatch(errorText); len(parts) > 2 {
+			max = parts[1]
+			current = parts[2]
+		}
+		log.WithFields(log.Fields{
+			"error":   errorText,
+			"proto":   "opentsdb",
+			"current": current,
+			"max":     max,
+		}).Warn("Max datapoints fetching excedeed")
+		return models.NewDetailedError(http.StatusRequestEntityTooLarge, "Sorry, you have attempted to fetch more than our limit of datapoints",
+			fmt.Sprintf("The limit is %s datapoints, please reduce the time range or the number of series", max))
+
+	case strings.Contains(errorText, "SocketTimeoutException"):
+		host := ""
+		if parts := socketTimeoutRe.FindStringSubmatch(errorText); len(parts) > 1 {
+			host = parts[1]
+		}
+		log.WithFields(log.Fields{
+			"error": errorText,
+			"proto": "opentsdb",
+			"host":  host,
+		}).Error("Socket timeout")
+		return models.NewDetailedError(http.StatusGatewayTimeout, "Timeout while reading data from the storage", "")
+	}
+
+	log.WithFields(log.Fields{
+		"error": errorText,
+		"proto": "opentsdb",
+	}).Error("Egress error: uncategorized error")
+	return models.NewDetailedError(http.StatusInternalServerError, "Unexpected error from the storage", "")
+}
@@ -0,0 +1,527 @@
+package opentsdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ovh/erlenmeyer/core"
+	"github.com/ovh/erlenmeyer/middlewares"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	// Intersection keeps only the series present on both sides of an operator
+	Intersection = "intersection"
+
+	// Union keeps all the series, missing sides are filled using the fill policy
+	Union = "union"
+)
+
+var (
+	expIntervalRe   = regexp.MustCompile("^" + durationPattern + "$")
+	expTimeOffsetRe = regexp.MustCompile("^" + durationPattern + "(?:-ago)?$")
+	expIdentifierRe = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+	// Translation from expression fill policies to downsampling fill policies
+	expFillToDownsampling = map[string]string{
+		none:     none,
+		"nan":    "nan",
+		"null":   "nan",
+		"zero":   "zero",
+		"scalar": "scalar",
+	}
+)
+
+// ExpQueryRequest an OpenTSDB expression query
+// http://opentsdb.net/docs/build/html/api_http/query/exp.html
+type ExpQueryRequest struct {
+	// The time range and the default aggregation of the metrics
+	Time *ExpTime `json:"time"`
+	// Named sets of filters used by the metrics
+	Filters []*ExpFilter `json:"filters"`
+	// The metrics to fetch
+	Metrics []*ExpMetric `json:"metrics"`
+	// Arithmetic expressions between metrics and other expressions
+	Expressions []*Expression `json:"expressions"`
+	// The metrics and expressions to return, all expressions when empty
+	Outputs []*ExpOutput `json:"outputs"`
+}
+
+// ExpTime the time section of an expression query
+type ExpTime struct {
+	Start       *TSDBTime       `json:"start"`
+	End         *TSDBTime       `json:"end"`
+	Aggregator  string          `json:"aggregator"`
+	Downsampler *ExpDownsampler `json:"downsampler"`
+	Rate        *bool           `json:"rate"`
+	RateOptions *RateOptions    `json:"rateOptions"`
+}
+
+// ExpDownsampler the downsampling applied to all the metrics
+type ExpDownsampler struct {
+	Interval   string         `json:"interval"`
+	Aggregator string         `json:"aggregator"`
+	FillPolicy *ExpFillPolicy `json:"fillPolicy"`
+}
+
+// ExpFillPolicy how missing values are replaced
+type ExpFillPolicy struct {
+	Policy string  `json:"policy"`
+	Value  float64 `json:"value"`
+}
+
+// ExpFilter a named set of filters
+type ExpFilter struct {
+	ID           string       `json:"id"`
+	Tags         []FilterSpec `json:"tags"`
+	ExplicitTags bool         `json:"explicitTags"`
+}
+
+// ExpMetric a named metric sub-query
+type ExpMetric struct {
+	ID         string         `json:"id"`
+	Metric     string         `json:"metric"`
+	Filter     string         `json:"filter"`
+	Aggregator string         `json:"aggregator"`
+	FillPolicy *ExpFillPolicy `json:"fillPolicy"`
+	TimeOffset string         `json:"timeOffset"`
+}
+
+// Expression a named arithmetic expression
+type Expression struct {
+	ID         string         `json:"id"`
+	Expr       string         `json:"expr"`
+	Join       *ExpJoin       `json:"join"`
+	FillPolicy *ExpFillPolicy `json:"fillPolicy"`
+
+	tree *expNode
+}
+
+// ExpJoin how series are matched between the operands of an expression
+type ExpJoin struct {
+	Operator       string `json:"operator"`
+	UseQueryTags   bool   `json:"useQueryTags"`
+	IncludeAggTags bool   `json:"includeAggTags"`
+}
+
+// ExpOutput a metric or an expression to return
+type ExpOutput struct {
+	ID    string `json:"id"`
+	Alias string `json:"alias"`
+}
+
+// ExpResponse an OpenTSDB expression query response
+type ExpResponse struct {
+	Outputs []*ExpOutputResponse `json:"outputs"`
+	Query   *ExpQueryRequest     `json:"query"`
+}
+
+// ExpOutputResponse the series of an output, dps rows start with the
+// timestamp followed by a value for each series
+type ExpOutputResponse struct {
+	ID      string          `json:"id"`
+	Alias   string          `json:"alias,omitempty"`
+	DPs     [][]interface{} `json:"dps"`
+	DPsMeta ExpDPsMeta      `json:"dpsMeta"`
+	Meta    []ExpSeriesMeta `json:"meta"`
+}
+
+// ExpDPsMeta describe the dps of an output
+type ExpDPsMeta struct {
+	FirstTimestamp int64 `json:"firstTimestamp"`
+	LastTimestamp  int64 `json:"lastTimestamp"`
+	SetCount       int   `json:"setCount"`
+	Series         int   `json:"series"`
+}
+
+// ExpSeriesMeta describe a column of the dps of an output
+type ExpSeriesMeta struct {
+	Index          int               `json:"index"`
+	Metrics        []string          `json:"metrics"`
+	CommonTags     map[string]string `json:"commonTags,omitempty"`
+	AggregatedTags []string          `json:"aggregatedTags,omitempty"`
+}
+
+// HandleQueryExp is the handler for /api/query/exp
+func (o *OpenTSDB) HandleQueryExp(w http.ResponseWriter, r *http.Request) {
+
+	token := core.RetrieveToken(r)
+	if len(token) == 0 {
+		o.WarnCounter.Inc()
+		writeError(w, 401, "Not authorized")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		o.WarnCounter.Inc()
+		w.Header().Add("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method '%s' is not allowed", r.Method))
+		return
+	}
+
+	query := &ExpQueryRequest{}
+	if success, message, status := query.parseRequestBody(r.Body); !success {
+		o.WarnCounter.Inc()
+		writeError(w, status, message)
+		return
+	}
+
+	executeExpQuery(w, token, query)
+}
+
+func (e *ExpQueryRequest) parseRequestBody(requestBody io.ReadCloser) (bool, string, int) {
+	defer requestBody.Close()
+	body, err := ioutil.ReadAll(requestBody)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+			"proto": "opentsdb",
+		}).Error("can't fully read the request body")
+		return false, "Bad request body", http.StatusInternalServerError
+	}
+	if err := json.Unmarshal(body, e); err != nil {
+		msg := "can't parse query"
+		log.WithFields(log.Fields{
+			"error":   err.Error(),
+			"proto":   "opentsdb",
+			"request": string(body),
+		}).Warn(msg)
+		return false, msg, http.StatusBadRequest
+	}
+
+	if err := e.Validate(); err != nil {
+		log.WithFields(log.Fields{
+			"error":   err.Error(),
+			"proto":   "opentsdb",
+			"request": string(body),
+		}).Warn("Invalid query")
+		return false, fmt.Sprintf("Invalid query: %s", err.Error()), http.StatusBadRequest
+	}
+	return true, "", 0
+}
+
+func validateFillPolicy(fillPolicy *ExpFillPolicy) error {
+	if fillPolicy == nil {
+		return nil
+	}
+	if _, exists := expFillToDownsampling[fillPolicy.Policy]; !exists {
+		return fmt.Errorf("invalid fill policy %s", fillPolicy.Policy)
+	}
+	return nil
+}
+
+// Validate is the implementation of Validate for ExpQueryRequest
+// nolint: gocyclo
+func (e *ExpQueryRequest) Validate() error {
+	if e.Time == nil || e.Time.Start == nil {
+		return errors.New("missing time start")
+	}
+	if e.Time.End == nil {
+		e.Time.End = &TSDBTime{time.Now()}
+	}
+	if e.Time.Start.Time.After(e.Time.End.Time) {
+		return errors.New("Start date is after end date")
+	}
+	if _, exists := aggregatorToReduce[e.Time.Aggregator]; !exists {
+		return fmt.Errorf("invalid aggregator %s", e.Time.Aggregator)
+	}
+
+	if d := e.Time.Downsampler; d != nil {
+		if !expIntervalRe.MatchString(d.Interval) {
+			return fmt.Errorf("invalid downsampling interval %s", d.Interval)
+		}
+		if _, exists := downsamplerToBucketizer[d.Aggregator]; !exists {
+			return fmt.Errorf("Downsampling operator '%s' is not available", d.Aggregator)
+		}
+		if err := validateFillPolicy(d.FillPolicy); err != nil {
+			return err
+		}
+	}
+
+	filters := map[string]bool{}
+	for _, filter := range e.Filters {
+		filters[filter.ID] = true
+	}
+
+	ids := map[string]bool{}
+	for _, metric := range e.Metrics {
+		if !expIdentifierRe.MatchString(metric.ID) || ids[metric.ID] {
+			return fmt.Errorf("invalid or duplicated metric id '%s'", metric.ID)
+		}
+		ids[metric.ID] = true
+
+		if metric.Metric == "" {
+			return errors.New("missing metric name")
+		}
+		if metric.Filter != "" && !filters[metric.Filter] {
+			return fmt.Errorf("unknown filter '%s' for metric '%s'", metric.Filter, metric.ID)
+		}
+		if metric.Aggregator != "" {
+			if _, exists := aggregatorToReduce[metric.Aggregator]; !exists {
+				return fmt.Errorf("invalid aggregator %s", metric.Aggregator)
+			}
+		}
+		if metric.TimeOffset != "" && !expTimeOffsetRe.MatchString(metric.TimeOffset) {
+			return fmt.Errorf("invalid time offset %s", metric.TimeOffset)
+		}
+		if err := validateFillPolicy(metric.FillPolicy); err != nil {
+			return err
+		}
+	}
+
+	for _, expression := range e.Expressions {
+		if !expIdentifierRe.MatchString(expression.ID) || ids[expression.ID] {
+			return fmt.Errorf("invalid or duplicated expression id '%s'", expression.ID)
+		}
+		ids[expression.ID] = true
+	}
+
+	for _, expression := range e.Expressions {
+		tree, err := parseExpression(expression.Expr)
+		if err != nil {
+			return fmt.Errorf("invalid expression '%s': %s", expression.ID, err.Error())
+		}
+		for _, variable := range tree.variables() {
+			if !ids[variable] {
+				return fmt.Errorf("unknown variable '%s' in expression '%s'", variable, expression.ID)
+			}
+		}
+		expression.tree = tree
+
+		if expression.Join == nil {
+			expression.Join = &ExpJoin{Operator: Intersection}
+		}
+		switch expression.Join.Operator {
+		case "":
+			expression.Join.Operator = Intersection
+		case Intersection, Union:
+		default:
+			return fmt.Errorf("invalid join operator %s", expression.Join.Operator)
+		}
+		if err := validateFillPolicy(expression.FillPolicy); err != nil {
+			return err
+		}
+	}
+
+	for _, output := range e.Outputs {
+		if !ids[output.ID] {
+			return fmt.Errorf("unknown output '%s'", output.ID)
+		}
+	}
+
+	return nil
+}
+
+// filter return the filter used by a metric
+func (e *ExpQueryRequest) filter(metric *ExpMetric) *ExpFilter {
+	for _, filter := range e.Filters {
+		if filter.ID == metric.Filter {
+			return filter
+		}
+	}
+	return &ExpFilter{}
+}
+
+// subQuery convert a metric into an OpenTSDB sub-query
+func (e *ExpQueryRequest) subQuery(metric *ExpMetric) *Query {
+	filter := e.filter(metric)
+
+	q := &Query{
+		Aggregator:   e.Time.Aggregator,
+		Metric:       metric.Metric,
+		Rate:         e.Time.Rate,
+		RateOptions:  e.Time.RateOptions,
+		Filters:      filter.Tags,
+		ExplicitTags: filter.ExplicitTags,
+	}
+	if metric.Aggregator != "" {
+		q.Aggregator = metric.Aggregator
+	}
+
+	// Validate only fill the rate options since the aggregator is known
+	q.Validate() // nolint: errcheck, gas
+
+	return q
+}
+
+// timeOffset of a metric, 0 when not set
+func (m *ExpMetric) timeOffset() time.Duration {
+	splits := expTimeOffsetRe.FindStringSubmatch(m.TimeOffset)
+	if splits == nil {
+		return 0
+	}
+	return DecodeDuration(splits[1], splits[2])
+}
+
+// downSampling of a metric using the downsampler of the time section
+func (e *ExpQueryRequest) downSampling(out *bytes.Buffer, q *Query, start time.Time, end time.Time) (bool, string, int) {
+	d := e.Time.Downsampler
+	if d == nil || q.Aggregator == none {
+		return q.downSampling(out, start, end)
+	}
+
+	splits := expIntervalRe.FindStringSubmatch(d.Interval)
+	period := DecodeDuration(splits[1], splits[2])
+
+	fillPolicy := none
+	if d.FillPolicy != nil {
+		fillPolicy = expFillToDownsampling[d.FillPolicy.Policy]
+	}
+
+	q.generateBucketizeScript(out, period.Nanoseconds()/1000, downsamplerToBucketizer[d.Aggregator], fillPolicy)
+	if fillPolicy == "scalar" {
+		fmt.Fprintf(out, "[ NaN NaN NaN %s ] FILLVALUE\n", strconv.FormatFloat(d.FillPolicy.Value, 'g', -1, 64))
+	}
+
+	return true, "", 0
+}
+
+// script build a single WarpScript fetching all the metrics, the series of
+// each metric are left on the stack in a list, the first metric on top
+func (e *ExpQueryRequest) script(token string) (string, string, int) {
+	out := &bytes.Buffer{}
+	fmt.Fprint(out, "JSONSTRICT\n")
+	fmt.Fprintf(out, "'3' MINREV <%% '%s' CAPADD %%> <%% '%s' AUTHENTICATE %%> IFTE\n", token, token)
+
+	for i, metric := range e.Metrics {
+		q := e.subQuery(metric)
+		offset := metric.timeOffset()
+		start := e.Time.Start.Time.Add(-offset)
+		end := e.Time.End.Time.Add(-offset)
+
+		fmt.Fprintf(out, "'%s'\n", token)
+
+		//---- Selection: FETCH
+		groupingTags := q.selection(out, start, end)
+
+		//---- Downsample: BUCKETIZE
+		if success, message, httpCode := e.downSampling(out, q, start, end); !success {
+			return "", message, httpCode
+		}
+
+		//---- Aggregation: REDUCE
+		if success, message, httpCode := q.agregation(out, groupingTags); !success {
+			return "", message, httpCode
+		}
+
+		if offset != 0 {
+			fmt.Fprintf(out, "$gts <%% DROP %d TIMESHIFT %%> LMAP 'gts' STORE\n", offset.Nanoseconds()/1000)
+		}
+		fmt.Fprintf(out, "$gts SORT 'metric_%d' STORE\n\n", i)
+	}
+
+	for i := len(e.Metrics) - 1; i >= 0; i-- {
+		fmt.Fprintf(out, "$metric_%d\n", i)
+	}
+
+	return out.String(), "", 0
+}
+
+func executeExpQuery(w http.ResponseWriter, token string, query *ExpQueryRequest) {
+
+	body, message, httpCode := query.script(token)
+	if len(message) > 0 {
+		writeError(w, httpCode, message)
+		return
+	}
+
+	results := [][]core.GeoTimeSeries{}
+	if len(query.Metrics) > 0 {
+		warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "opentsdb-query-exp")
+
+		var err error
+		results, err = warpServer.QueryGTSs(body, w.Header().Get(middlewares.TxnHeader))
+		if err != nil {
+			writeDetailedError(w, egressError(err.Error()))
+			return
+		}
+	}
+
+	evaluator := newExpEvaluator(query)
+	for i, metric := range query.Metrics {
+		if i < len(results) {
+			evaluator.addMetric(metric, results[i])
+		}
+	}
+
+	outputs := query.Outputs
+	if len(outputs) == 0 {
+		for _, expression := range query.Expressions {
+			outputs = append(outputs, &ExpOutput{ID: expression.ID})
+		}
+	}
+
+	response := &ExpResponse{
+		Outputs: []*ExpOutputResponse{},
+		Query:   query,
+	}
+	for _, output := range outputs {
+		set, err := evaluator.evaluate(output.ID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid query: %s", err.Error()))
+			return
+		}
+		response.Outputs = append(response.Outputs, set.toOutput(output))
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(response)
+}
+
+// toOutput convert a set of series into an output, rows are sorted by timestamp
+func (s *expSet) toOutput(output *ExpOutput) *ExpOutputResponse {
+	rep := &ExpOutputResponse{
+		ID:    output.ID,
+		Alias: output.Alias,
+		DPs:   [][]interface{}{},
+		Meta:  []ExpSeriesMeta{{Index: 0, Metrics: []string{"timestamp"}}},
+	}
+
+	timestamps := []int64{}
+	seen := map[int64]bool{}
+	for i, series := range s.series {
+		rep.Meta = append(rep.Meta, ExpSeriesMeta{
+			Index:          i + 1,
+			Metrics:        series.metrics,
+			CommonTags:     series.tags,
+			AggregatedTags: series.aggregatedTags,
+		})
+		for ts := range series.dps {
+			if !seen[ts] {
+				seen[ts] = true
+				timestamps = append(timestamps, ts)
+			}
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	for _, ts := range timestamps {
+		row := make([]interface{}, len(s.series)+1)
+		row[0] = ts
+		for i, series := range s.series {
+			if value, ok := series.dps[ts]; ok && isFinite(value) {
+				row[i+1] = value
+			}
+		}
+		rep.DPs = append(rep.DPs, row)
+	}
+
+	rep.DPsMeta = ExpDPsMeta{SetCount: len(rep.DPs), Series: len(s.series)}
+	if len(timestamps) > 0 {
+		rep.DPsMeta.FirstTimestamp = timestamps[0]
+		rep.DPsMeta.LastTimestamp = timestamps[len(timestamps)-1]
+	}
+
+	return rep
+}
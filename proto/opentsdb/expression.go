@@ -0,0 +1,511 @@
+package opentsdb
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ovh/erlenmeyer/core"
+)
+
+// ----------------------------------------------------------------------------
+// JEXL arithmetic expressions parsing
+//
+// expr    := term (('+' | '-') term)*
+// term    := unary (('*' | '/' | '%') unary)*
+// unary   := ('-' | '+') unary | primary
+// primary := number | identifier | '(' expr ')'
+
+// expNode is a node of a parsed expression, leaves are either a variable or a number
+type expNode struct {
+	op       rune
+	variable string
+	value    float64
+	left     *expNode
+	right    *expNode
+}
+
+type expParser struct {
+	input []rune
+	pos   int
+}
+
+// parseExpression parse an arithmetic expression between metrics and expressions ids
+func parseExpression(expr string) (*expNode, error) {
+	p := &expParser{input: []rune(expr)}
+
+	node, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.skipSpaces(); p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected '%c' at position %d", p.input[p.pos], p.pos)
+	}
+
+	return node, nil
+}
+
+func (p *expParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// accept consume the next rune if it is one of ops
+func (p *expParser) accept(ops string) (rune, bool) {
+	p.skipSpaces()
+	if p.pos < len(p.input) && strings.ContainsRune(ops, p.input[p.pos]) {
+		p.pos++
+		return p.input[p.pos-1], true
+	}
+	return 0, false
+}
+
+func (p *expParser) expr() (*expNode, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.accept("+-")
+		if !ok {
+			return left, nil
+		}
+
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = &expNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *expParser) term() (*expNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.accept("*/%")
+		if !ok {
+			return left, nil
+		}
+
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &expNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *expParser) unary() (*expNode, error) {
+	if op, ok := p.accept("+-"); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if op == '+' {
+			return operand, nil
+		}
+		return &expNode{op: '*', left: &expNode{value: -1}, right: operand}, nil
+	}
+
+	return p.primary()
+}
+
+func (p *expParser) primary() (*expNode, error) {
+	if _, ok := p.accept("("); ok {
+		node, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, fmt.Errorf("missing ')' at position %d", p.pos)
+		}
+		return node, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) {
+		r := p.input[p.pos]
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' {
+			break
+		}
+		p.pos++
+	}
+
+	token := string(p.input[start:p.pos])
+	switch {
+	case token == "":
+		if p.pos < len(p.input) {
+			return nil, fmt.Errorf("unexpected '%c' at position %d", p.input[p.pos], p.pos)
+		}
+		return nil, fmt.Errorf("unexpected end of expression")
+	case expIdentifierRe.MatchString(token):
+		return &expNode{variable: token}, nil
+	}
+
+	value, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token '%s' at position %d", token, start)
+	}
+	return &expNode{value: value}, nil
+}
+
+// variables return the ids used by an expression
+func (n *expNode) variables() []string {
+	if n.op == 0 {
+		if n.variable == "" {
+			return []string{}
+		}
+		return []string{n.variable}
+	}
+	return append(n.left.variables(), n.right.variables()...)
+}
+
+// ----------------------------------------------------------------------------
+// expressions evaluation
+
+// expSeries is a series of an expression, datapoints are keyed by timestamps in milliseconds
+type expSeries struct {
+	tags           map[string]string
+	metrics        []string
+	aggregatedTags []string
+	dps            map[int64]float64
+}
+
+// expSet is the result of a metric or an expression, either a list of
+// series or a scalar
+type expSet struct {
+	series     []*expSeries
+	scalar     *float64
+	fillPolicy *ExpFillPolicy
+	// tag keys of the filters of the metrics used to compute the set
+	queryTags []string
+}
+
+type expEvaluator struct {
+	query      *ExpQueryRequest
+	sets       map[string]*expSet
+	evaluating map[string]bool
+}
+
+func newExpEvaluator(query *ExpQueryRequest) *expEvaluator {
+	return &expEvaluator{
+		query:      query,
+		sets:       map[string]*expSet{},
+		evaluating: map[string]bool{},
+	}
+}
+
+// addMetric register the series fetched for a metric
+func (ev *expEvaluator) addMetric(metric *ExpMetric, results []core.GeoTimeSeries) {
+	set := &expSet{
+		series:     []*expSeries{},
+		fillPolicy: metric.FillPolicy,
+		queryTags:  []string{},
+	}
+
+	for _, filter := range ev.query.filter(metric).Tags {
+		set.queryTags = append(set.queryTags, filter.TagKey)
+	}
+
+	for _, result := range results {
+		delete(result.Labels, ".app")
+		series := &expSeries{
+			tags:           result.Labels,
+			metrics:        []string{metric.Metric},
+			aggregatedTags: []string{},
+			dps:            map[int64]float64{},
+		}
+
+		for _, value := range result.Values {
+			v, ok := value[len(value)-1].(float64)
+			if !ok {
+				continue
+			}
+			series.dps[int64(value[0].(float64))/1000] = v
+		}
+		set.series = append(set.series, series)
+	}
+
+	ev.sets[metric.ID] = set
+}
+
+// evaluate return the set of series of a metric or an expression
+func (ev *expEvaluator) evaluate(id string) (*expSet, error) {
+	if set, ok := ev.sets[id]; ok {
+		return set, nil
+	}
+
+	for _, expression := range ev.query.Expressions {
+		if expression.ID != id {
+			continue
+		}
+
+		if ev.evaluating[id] {
+			return nil, fmt.Errorf("circular reference to expression '%s'", id)
+		}
+		ev.evaluating[id] = true
+
+		set, err := ev.evaluateNode(expression, expression.tree)
+		if err != nil {
+			return nil, err
+		}
+
+		set.fillPolicy = expression.FillPolicy
+		ev.sets[id] = set
+		return set, nil
+	}
+
+	// Metrics without results
+	return &expSet{series: []*expSeries{}, queryTags: []string{}}, nil
+}
+
+func (ev *expEvaluator) evaluateNode(expression *Expression, node *expNode) (*expSet, error) {
+	if node.op == 0 {
+		if node.variable == "" {
+			value := node.value
+			return &expSet{scalar: &value, queryTags: []string{}}, nil
+		}
+		return ev.evaluate(node.variable)
+	}
+
+	left, err := ev.evaluateNode(expression, node.left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := ev.evaluateNode(expression, node.right)
+	if err != nil {
+		return nil, err
+	}
+
+	set := join(node.op, left, right, expression.Join)
+	set.fillPolicy = expression.FillPolicy
+	return set, nil
+}
+
+func apply(op rune, left, right float64) float64 {
+	switch op {
+	case '+':
+		return left + right
+	case '-':
+		return left - right
+	case '*':
+		return left * right
+	case '/':
+		return left / right
+	case '%':
+		return math.Mod(left, right)
+	}
+	return math.NaN()
+}
+
+// fillValue return the value of a missing datapoint, false when the
+// datapoint has to be skipped
+func fillValue(fillPolicy *ExpFillPolicy) (float64, bool) {
+	if fillPolicy == nil {
+		return 0, false
+	}
+
+	switch fillPolicy.Policy {
+	case "nan", "null":
+		return math.NaN(), true
+	case "zero":
+		return 0, true
+	case "scalar":
+		return fillPolicy.Value, true
+	}
+	return 0, false
+}
+
+// joinKey is the identity of a series used to match series of both sides of an operator
+func (s *expSeries) joinKey(queryTags []string) string {
+	keys := queryTags
+	if keys == nil {
+		keys = make([]string, 0, len(s.tags))
+		for key := range s.tags {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	parts := []string{}
+	for _, key := range keys {
+		if value, ok := s.tags[key]; ok {
+			parts = append(parts, key+"="+value)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// combine two series, a nil series is only made of missing datapoints
+func combine(op rune, left, right *expSeries, leftFill, rightFill *ExpFillPolicy) *expSeries {
+	result := &expSeries{
+		tags:           map[string]string{},
+		metrics:        []string{},
+		aggregatedTags: []string{},
+		dps:            map[int64]float64{},
+	}
+
+	timestamps := map[int64]bool{}
+	metrics := map[string]bool{}
+	for _, s := range []*expSeries{left, right} {
+		if s == nil {
+			continue
+		}
+		for ts := range s.dps {
+			timestamps[ts] = true
+		}
+		for _, metric := range s.metrics {
+			if !metrics[metric] {
+				metrics[metric] = true
+				result.metrics = append(result.metrics, metric)
+			}
+		}
+	}
+	sort.Strings(result.metrics)
+
+	// Keep the tags common to both sides
+	switch {
+	case left == nil:
+		result.tags = right.tags
+	case right == nil:
+		result.tags = left.tags
+	default:
+		for key, value := range left.tags {
+			if right.tags[key] == value {
+				result.tags[key] = value
+			} else {
+				result.aggregatedTags = append(result.aggregatedTags, key)
+			}
+		}
+		sort.Strings(result.aggregatedTags)
+	}
+
+	valueAt := func(s *expSeries, ts int64, fillPolicy *ExpFillPolicy) (float64, bool) {
+		if s != nil {
+			if value, ok := s.dps[ts]; ok {
+				return value, true
+			}
+		}
+		return fillValue(fillPolicy)
+	}
+
+	for ts := range timestamps {
+		l, okLeft := valueAt(left, ts, leftFill)
+		r, okRight := valueAt(right, ts, rightFill)
+		if okLeft && okRight {
+			result.dps[ts] = apply(op, l, r)
+		}
+	}
+
+	return result
+}
+
+// join apply an operator between two sets, series are matched by tags
+// nolint: gocyclo
+func join(op rune, left, right *expSet, spec *ExpJoin) *expSet {
+	queryTags := append(append([]string{}, left.queryTags...), right.queryTags...)
+	set := &expSet{
+		series:    []*expSeries{},
+		queryTags: queryTags,
+	}
+
+	// Scalars are applied to each series
+	switch {
+	case left.scalar != nil && right.scalar != nil:
+		value := apply(op, *left.scalar, *right.scalar)
+		set.scalar = &value
+		return set
+	case left.scalar != nil, right.scalar != nil:
+		for _, series := range append(left.series, right.series...) {
+			result := &expSeries{
+				tags:           series.tags,
+				metrics:        series.metrics,
+				aggregatedTags: series.aggregatedTags,
+				dps:            map[int64]float64{},
+			}
+			for ts, value := range series.dps {
+				if left.scalar != nil {
+					result.dps[ts] = apply(op, *left.scalar, value)
+				} else {
+					result.dps[ts] = apply(op, value, *right.scalar)
+				}
+			}
+			set.series = append(set.series, result)
+		}
+		return set
+	}
+
+	var keyTags []string
+	if spec.UseQueryTags {
+		keyTags = queryTags
+	}
+
+	// A single series without tags is matched with all the series of the other side
+	broadcast := func(s *expSet) *expSeries {
+		if len(s.series) == 1 && len(s.series[0].tags) == 0 {
+			return s.series[0]
+		}
+		return nil
+	}
+	if single := broadcast(right); single != nil {
+		for _, series := range left.series {
+			set.series = append(set.series, combine(op, series, single, left.fillPolicy, right.fillPolicy))
+		}
+		return set
+	}
+	if single := broadcast(left); single != nil {
+		for _, series := range right.series {
+			set.series = append(set.series, combine(op, single, series, left.fillPolicy, right.fillPolicy))
+		}
+		return set
+	}
+
+	rights := map[string]*expSeries{}
+	for _, series := range right.series {
+		rights[series.joinKey(keyTags)] = series
+	}
+
+	matched := map[string]bool{}
+	for _, series := range left.series {
+		key := series.joinKey(keyTags)
+		if other, ok := rights[key]; ok {
+			matched[key] = true
+			set.series = append(set.series, combine(op, series, other, left.fillPolicy, right.fillPolicy))
+		} else if spec.Operator == Union {
+			set.series = append(set.series, combine(op, series, nil, left.fillPolicy, right.fillPolicy))
+		}
+	}
+
+	if spec.Operator == Union {
+		for _, series := range right.series {
+			if !matched[series.joinKey(keyTags)] {
+				set.series = append(set.series, combine(op, nil, series, left.fillPolicy, right.fillPolicy))
+			}
+		}
+	}
+
+	// Drop series without datapoints, as with a none fill policy
+	series := set.series[:0]
+	for _, s := range set.series {
+		if len(s.dps) > 0 {
+			series = append(series, s)
+		}
+	}
+	set.series = series
+
+	return set
+}
+
+func isFinite(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0)
+}
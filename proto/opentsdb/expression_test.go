@@ -0,0 +1,280 @@
+package opentsdb
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ovh/erlenmeyer/core"
+)
+
+func TestParseExpression(t *testing.T) {
+	var tests = []struct {
+		expr      string
+		variables []string
+		err       string
+	}{
+		{"a + b * 2", []string{"a", "b"}, ""},
+		{"(a + b) / -c", []string{"a", "b", "c"}, ""},
+		{" a % 1.5 ", []string{"a"}, ""},
+		{"", nil, "unexpected end of expression"},
+		{"a +", nil, "unexpected end of expression"},
+		{"(a + b", nil, "missing ')'"},
+		{"a + b)", nil, "unexpected ')' at position 5"},
+		{"a $ b", nil, "unexpected '$' at position 2"},
+		{"a b", nil, "unexpected 'b' at position 2"},
+		{"1.2.3", nil, "invalid token '1.2.3'"},
+		{"a.b", nil, "invalid token 'a.b'"},
+	}
+
+	for _, test := range tests {
+		tree, err := parseExpression(test.expr)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected '%s' to fail with '%s', got %v", test.expr, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Fail to parse '%s': %v", test.expr, err)
+			continue
+		}
+		if variables := tree.variables(); !reflect.DeepEqual(variables, test.variables) {
+			t.Errorf("Expected variables %v for '%s', got %v", test.variables, test.expr, variables)
+		}
+	}
+}
+
+func TestParseExpressionPrecedence(t *testing.T) {
+	var tests = []struct {
+		expr  string
+		value float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"-2 * 3 + 7 % 4", -3},
+		{"8 / 2 / 2", 2},
+	}
+
+	for _, test := range tests {
+		query := &ExpQueryRequest{Expressions: []*Expression{{ID: "e", Expr: test.expr, Join: &ExpJoin{Operator: Intersection}}}}
+		tree, err := parseExpression(test.expr)
+		if err != nil {
+			t.Errorf("Fail to parse '%s': %v", test.expr, err)
+			continue
+		}
+		query.Expressions[0].tree = tree
+
+		set, err := newExpEvaluator(query).evaluate("e")
+		if err != nil {
+			t.Errorf("Fail to evaluate '%s': %v", test.expr, err)
+			continue
+		}
+		if set.scalar == nil || *set.scalar != test.value {
+			t.Errorf("Expected '%s' to be %v, got %v", test.expr, test.value, set.scalar)
+		}
+	}
+}
+
+// expTestQuery return a validated expression query with the metrics a and b
+func expTestQuery(t *testing.T, expressions ...*Expression) *ExpQueryRequest {
+	query := &ExpQueryRequest{
+		Time: &ExpTime{
+			Start:      &TSDBTime{time.Unix(0, 0)},
+			End:        &TSDBTime{time.Unix(3600, 0)},
+			Aggregator: "sum",
+		},
+		Metrics: []*ExpMetric{
+			{ID: "a", Metric: "sys.cpu"},
+			{ID: "b", Metric: "sys.mem"},
+		},
+		Expressions: expressions,
+	}
+	if err := query.Validate(); err != nil {
+		t.Fatalf("Fail to validate the query: %v", err)
+	}
+	return query
+}
+
+func TestExpressionReferences(t *testing.T) {
+	var tests = []struct {
+		expressions []*Expression
+		err         string
+	}{
+		{[]*Expression{{ID: "e", Expr: "e + a"}}, "circular reference to expression 'e'"},
+		{[]*Expression{{ID: "e", Expr: "f * 2"}, {ID: "f", Expr: "a + e"}}, "circular reference to expression 'e'"},
+		{[]*Expression{{ID: "e", Expr: "f * 2"}, {ID: "f", Expr: "a + b"}}, ""},
+	}
+
+	for _, test := range tests {
+		query := expTestQuery(t, test.expressions...)
+		_, err := newExpEvaluator(query).evaluate("e")
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("Fail to evaluate '%s': %v", test.expressions[0].Expr, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.err {
+			t.Errorf("Expected '%s' to fail with '%s', got %v", test.expressions[0].Expr, test.err, err)
+		}
+	}
+
+	// Unknown variables are rejected when validating the query
+	query := &ExpQueryRequest{
+		Time:        &ExpTime{Start: &TSDBTime{time.Unix(0, 0)}, Aggregator: "sum"},
+		Metrics:     []*ExpMetric{{ID: "a", Metric: "sys.cpu"}},
+		Expressions: []*Expression{{ID: "e", Expr: "a + c"}},
+	}
+	if err := query.Validate(); err == nil || !strings.Contains(err.Error(), "unknown variable 'c'") {
+		t.Errorf("Expected an unknown variable error, got %v", err)
+	}
+}
+
+// expTestSeries return a fetched series with a datapoint per value, every second
+func expTestSeries(host string, values ...interface{}) core.GeoTimeSeries {
+	series := core.GeoTimeSeries{Labels: map[string]string{}, Values: [][]interface{}{}}
+	if host != "" {
+		series.Labels["host"] = host
+	}
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		series.Values = append(series.Values, []interface{}{float64((i + 1) * 1000000), value})
+	}
+	return series
+}
+
+// expTestResult return the values of each series of a set ordered by timestamp,
+// series are ordered by their first value
+func expTestResult(set *expSet) [][]float64 {
+	result := [][]float64{}
+	for _, series := range set.series {
+		timestamps := []int64{}
+		for ts := range series.dps {
+			timestamps = append(timestamps, ts)
+		}
+		sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+		values := []float64{}
+		for _, ts := range timestamps {
+			values = append(values, series.dps[ts])
+		}
+		result = append(result, values)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i][0] < result[j][0] })
+	return result
+}
+
+func TestExpressionJoin(t *testing.T) {
+	var tests = []struct {
+		name       string
+		join       *ExpJoin
+		fillPolicy *ExpFillPolicy
+		a          []core.GeoTimeSeries
+		b          []core.GeoTimeSeries
+		expected   [][]float64
+	}{
+		{
+			name:     "intersection keeps the series on both sides",
+			join:     &ExpJoin{Operator: Intersection},
+			a:        []core.GeoTimeSeries{expTestSeries("h1", 1.0, 2.0), expTestSeries("h2", 3.0, 4.0)},
+			b:        []core.GeoTimeSeries{expTestSeries("h1", 10.0, 20.0), expTestSeries("h3", 30.0, 40.0)},
+			expected: [][]float64{{11, 22}},
+		},
+		{
+			name:     "intersection skips the missing datapoints",
+			join:     &ExpJoin{Operator: Intersection},
+			a:        []core.GeoTimeSeries{expTestSeries("h1", 1.0, 2.0, 3.0)},
+			b:        []core.GeoTimeSeries{expTestSeries("h1", 10.0, nil, 30.0)},
+			expected: [][]float64{{11, 33}},
+		},
+		{
+			name:     "union without fill policy drops the unmatched series",
+			join:     &ExpJoin{Operator: Union},
+			a:        []core.GeoTimeSeries{expTestSeries("h1", 1.0, 2.0), expTestSeries("h2", 3.0, 4.0)},
+			b:        []core.GeoTimeSeries{expTestSeries("h1", 10.0, 20.0), expTestSeries("h3", 30.0, 40.0)},
+			expected: [][]float64{{11, 22}},
+		},
+		{
+			name:       "union fills the missing sides",
+			join:       &ExpJoin{Operator: Union},
+			fillPolicy: &ExpFillPolicy{Policy: "scalar", Value: 100},
+			a:          []core.GeoTimeSeries{expTestSeries("h1", 1.0, 2.0), expTestSeries("h2", 3.0, 4.0)},
+			b:          []core.GeoTimeSeries{expTestSeries("h1", 10.0, nil), expTestSeries("h3", 30.0, 40.0)},
+			expected:   [][]float64{{11, 102}, {103, 104}, {130, 140}},
+		},
+		{
+			name:     "a series without tags is applied to all the series",
+			join:     &ExpJoin{Operator: Intersection},
+			a:        []core.GeoTimeSeries{expTestSeries("h1", 1.0, 2.0), expTestSeries("h2", 3.0, 4.0)},
+			b:        []core.GeoTimeSeries{expTestSeries("", 10.0, 20.0)},
+			expected: [][]float64{{11, 22}, {13, 24}},
+		},
+	}
+
+	for _, test := range tests {
+		query := expTestQuery(t, &Expression{ID: "e", Expr: "a + b", Join: test.join})
+		for _, metric := range query.Metrics {
+			metric.FillPolicy = test.fillPolicy
+		}
+
+		ev := newExpEvaluator(query)
+		ev.addMetric(query.Metrics[0], test.a)
+		ev.addMetric(query.Metrics[1], test.b)
+
+		set, err := ev.evaluate("e")
+		if err != nil {
+			t.Errorf("%s: fail to evaluate: %v", test.name, err)
+			continue
+		}
+		if result := expTestResult(set); !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, result)
+		}
+	}
+}
+
+func TestExpressionJoinQueryTags(t *testing.T) {
+	// Matched on the host filter only, the dc tag differs and is aggregated
+	query := expTestQuery(t, &Expression{ID: "e", Expr: "a / b", Join: &ExpJoin{Operator: Intersection, UseQueryTags: true}})
+	query.Filters = []*ExpFilter{{ID: "f", Tags: []FilterSpec{{TagKey: "host"}}}}
+	query.Metrics[0].Filter = "f"
+
+	a := expTestSeries("h1", 1.0)
+	a.Labels["dc"] = "gra"
+	b := expTestSeries("h1", 0.0)
+	b.Labels["dc"] = "rbx"
+
+	ev := newExpEvaluator(query)
+	ev.addMetric(query.Metrics[0], []core.GeoTimeSeries{a})
+	ev.addMetric(query.Metrics[1], []core.GeoTimeSeries{b})
+
+	set, err := ev.evaluate("e")
+	if err != nil {
+		t.Fatalf("Fail to evaluate: %v", err)
+	}
+	if len(set.series) != 1 {
+		t.Fatalf("Expected a single series, got %d", len(set.series))
+	}
+
+	series := set.series[0]
+	if !reflect.DeepEqual(series.tags, map[string]string{"host": "h1"}) {
+		t.Errorf("Expected the common tags only, got %v", series.tags)
+	}
+	if !reflect.DeepEqual(series.aggregatedTags, []string{"dc"}) {
+		t.Errorf("Expected dc to be aggregated, got %v", series.aggregatedTags)
+	}
+	if !reflect.DeepEqual(series.metrics, []string{"sys.cpu", "sys.mem"}) {
+		t.Errorf("Expected both metrics, got %v", series.metrics)
+	}
+	for _, value := range series.dps {
+		if !math.IsInf(value, 1) {
+			t.Errorf("Expected a division by zero to be +Inf, got %v", value)
+		}
+	}
+}
@@ -38,7 +38,7 @@ func (c *OpenTSDB) HandleConfigFilters(responseWriter http.ResponseWriter, reque
 	token := core.RetrieveToken(request)
 	if len(token) == 0 {
 		c.WarnCounter.Inc()
-		http.Error(responseWriter, "Not authorized", 401)
+		writeError(responseWriter, 401, "Not authorized")
 		return
 	}
 	responseWriter.Header().Add("Content-Type", "application/json")
@@ -0,0 +1,320 @@
+package opentsdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ovh/erlenmeyer/core"
+	"github.com/ovh/erlenmeyer/middlewares"
+	"github.com/ovh/erlenmeyer/proto/graphite"
+	"github.com/spf13/viper"
+)
+
+var (
+	// OpenTSDB sub-queries in URI format inside graphite expressions:
+	// agg:[interval-agg[-fill]:][rate[{counter[,max[,reset]]}]:][explicit_tags:]metric[{tags}][{filters}]
+	gexpSubQueryRe = regexp.MustCompile(`[a-z0-9]+:(?:rate\{[^}]*\}:|[^:(),{}'"\s]+:)*` + identifier + `(?:\{[^}]*\}){0,2}`)
+	rateOptionsRe  = regexp.MustCompile(`^rate(?:\{([^}]*)\})?$`)
+	filterRe       = regexp.MustCompile(`^(` + identifier + `)=(\w+)\((.*)\)$`)
+
+	// graphite function calls on several sub-queries
+	gexpSeriesListsRe = regexp.MustCompile(`(\w+)\(\s*(subquery\d+(?:\s*,\s*subquery\d+)+)\s*\)`)
+)
+
+// GExpQuery an OpenTSDB graphite expression query
+// http://opentsdb.net/docs/build/html/api_http/query/gexp.html
+type GExpQuery struct {
+	Start        string   `schema:"start" json:"start"`
+	End          string   `schema:"end"   json:"end"`
+	Expressions  []string `schema:"exp"   json:"exp"`
+	MSResolution bool     `schema:"ms"    json:"ms"`
+
+	start TSDBTime
+	end   TSDBTime
+}
+
+// Validate is the implementation of Validate for GExpQuery
+func (g *GExpQuery) Validate() error {
+	if g.Start == "" {
+		return errors.New("missing start time")
+	}
+	if err := g.start.Parse(g.Start); err != nil {
+		return err
+	}
+
+	g.end = TSDBTime{time.Now()}
+	if g.End != "" {
+		if err := g.end.Parse(g.End); err != nil {
+			return err
+		}
+	}
+
+	if g.start.Time.After(g.end.Time) {
+		return errors.New("Start date is after end date")
+	}
+
+	if len(g.Expressions) == 0 {
+		return errors.New("missing exp parameter")
+	}
+	return nil
+}
+
+// HandleQueryGExp is the handler for /api/query/gexp
+func (o *OpenTSDB) HandleQueryGExp(w http.ResponseWriter, r *http.Request) {
+
+	token := core.RetrieveToken(r)
+	if len(token) == 0 {
+		o.WarnCounter.Inc()
+		writeError(w, 401, "Not authorized")
+		return
+	}
+
+	query := &GExpQuery{}
+	if err := DecodeRequestParams(w, r, query); err != nil {
+		o.WarnCounter.Inc()
+		return // Response was sent
+	}
+
+	responses := []*QueryResponse{}
+	for loopIndex, exp := range query.Expressions {
+		body, groupingTags, err := query.script(token, exp)
+		if err != nil {
+			o.WarnCounter.Inc()
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid expression '%s': %s", exp, err.Error()))
+			return
+		}
+
+		warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "opentsdb-query-gexp")
+		results, err := warpServer.QueryGTSs(body, w.Header().Get(middlewares.TxnHeader))
+		if err != nil {
+			o.ErrCounter.Inc()
+			writeDetailedError(w, egressError(err.Error()))
+			return
+		}
+
+		if len(results) == 0 {
+			continue
+		}
+		for _, result := range results[0] {
+			responses, _ = appendResponses([]core.GeoTimeSeries{result}, responses, groupingTags, &query.MSResolution, result.Class, loopIndex)
+		}
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(responses)
+}
+
+// script build the WarpScript of a graphite expression, the OpenTSDB
+// sub-queries are fetched first then the graphite functions are applied on them
+func (g *GExpQuery) script(token, exp string) (string, []string, error) {
+	out := &bytes.Buffer{}
+	fmt.Fprint(out, "JSONSTRICT\n")
+	fmt.Fprintf(out, "'3' MINREV <%% '%s' CAPADD %%> <%% '%s' AUTHENTICATE %%> IFTE\n", token, token)
+
+	selections := map[string]string{}
+	groupingTags := []string{}
+	var err error
+
+	target := gexpSubQueryRe.ReplaceAllStringFunc(exp, func(m string) string {
+		name := fmt.Sprintf("subquery%d", len(selections))
+
+		subquery, parseErr := parseSubQuery(m)
+		if parseErr == nil {
+			parseErr = subquery.Validate()
+		}
+		if parseErr != nil {
+			err = fmt.Errorf("%s: %s", m, parseErr.Error())
+			return name
+		}
+
+		fmt.Fprintf(out, "'%s'\n", token)
+
+		//---- Selection: FETCH
+		tags := subquery.selection(out, g.start.Time, g.end.Time)
+		groupingTags = append(groupingTags, tags...)
+
+		//---- Downsample: BUCKETIZE
+		if success, message, _ := subquery.downSampling(out, g.start.Time, g.end.Time); !success {
+			err = errors.New(message)
+			return name
+		}
+
+		//---- Aggregation: REDUCE
+		if success, message, _ := subquery.agregation(out, tags); !success {
+			err = errors.New(message)
+			return name
+		}
+
+		fmt.Fprintf(out, "$gts SORT '%s' STORE\n\n", name)
+		selections[name] = "$" + name
+
+		return name
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if len(selections) == 0 {
+		return "", nil, errors.New("no OpenTSDB sub-query found")
+	}
+
+	target = mergeSeriesLists(target, selections)
+
+	root := core.NewEmptyNode()
+	if _, err := graphite.ParseSelections(target, selections, root); err != nil {
+		return "", nil, err
+	}
+
+	// Scalar results are expanded over the query time range
+	fmt.Fprintf(out, "%d 'start' STORE\n", g.start.Time.UnixNano()/1000)
+	fmt.Fprintf(out, "%d 'end' STORE\n", g.end.Time.UnixNano()/1000)
+	out.WriteString(root.ToWarpScript(token, exp, ""))
+
+	return out.String(), groupingTags, nil
+}
+
+// mergeSeriesLists merge the sub-queries given to graphite functions taking
+// several series lists, like sumSeries, as a single selection
+func mergeSeriesLists(target string, selections map[string]string) string {
+	descriptions := graphite.ListFunctions()
+
+	return gexpSeriesListsRe.ReplaceAllStringFunc(target, func(call string) string {
+		matches := gexpSeriesListsRe.FindStringSubmatch(call)
+		description, ok := descriptions[matches[1]]
+		if !ok || len(description.Params) == 0 || description.Params[0].Type != "seriesLists" {
+			return call
+		}
+
+		names := strings.Split(strings.Replace(matches[2], " ", "", -1), ",")
+		merged := strings.Join(names, "_")
+
+		selection := "$" + names[0]
+		for _, name := range names[1:] {
+			selection += " $" + name + " APPEND"
+		}
+		selections[merged] = selection
+
+		return fmt.Sprintf("%s(%s)", matches[1], merged)
+	})
+}
+
+// splitOutside split s on sep when sep is not enclosed in braces or parenthesis
+func splitOutside(s string, sep rune) []string {
+	parts := []string{}
+	depth := 0
+	last := 0
+	for i, r := range s {
+		switch r {
+		case '{', '(':
+			depth++
+		case '}', ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(parts, s[last:])
+}
+
+// parseSubQuery parse an OpenTSDB sub-query in URI format
+// http://opentsdb.net/docs/build/html/api_http/query/index.html#uri-query-string-format
+// nolint: gocyclo
+func parseSubQuery(m string) (*Query, error) {
+	parts := splitOutside(m, ':')
+	if len(parts) < 2 {
+		return nil, errors.New("missing aggregator or metric")
+	}
+
+	q := &Query{
+		Aggregator: parts[0],
+		Tags:       map[string]string{},
+		Filters:    []FilterSpec{},
+	}
+
+	for _, part := range parts[1 : len(parts)-1] {
+		switch {
+		case part == "explicit_tags":
+			q.ExplicitTags = true
+		case rateOptionsRe.MatchString(part):
+			rate := true
+			q.Rate = &rate
+			q.RateOptions = &RateOptions{}
+
+			options := strings.Split(rateOptionsRe.FindStringSubmatch(part)[1], ",")
+			if options[0] == "counter" {
+				q.RateOptions.Counter = true
+			}
+			if len(options) > 1 && options[1] != "" {
+				counterMax, err := strconv.ParseInt(options[1], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid counter max %s", options[1])
+				}
+				q.RateOptions.CounterMax = &counterMax
+			}
+			if len(options) > 2 && options[2] != "" {
+				resetValue, err := strconv.ParseInt(options[2], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid reset value %s", options[2])
+				}
+				q.RateOptions.ResetValue = &resetValue
+			}
+		case downsamplingRe.MatchString(part):
+			downsample := part
+			q.Downsample = &downsample
+		default:
+			return nil, fmt.Errorf("unknown option %s", part)
+		}
+	}
+
+	metric := parts[len(parts)-1]
+	braces := strings.Index(metric, "{")
+	if braces == -1 {
+		q.Metric = metric
+		return q, nil
+	}
+	q.Metric = metric[:braces]
+
+	// The first braces are grouping tags, the second ones filters
+	groups := strings.SplitAfter(metric[braces:], "}")
+	for i, group := range groups {
+		group = strings.TrimSuffix(strings.TrimPrefix(group, "{"), "}")
+		if group == "" {
+			continue
+		}
+
+		for _, definition := range splitOutside(group, ',') {
+			if matches := filterRe.FindStringSubmatch(definition); matches != nil {
+				if _, ok := filters[matches[2]]; !ok {
+					return nil, fmt.Errorf("unknown filter %s", matches[2])
+				}
+				q.Filters = append(q.Filters, FilterSpec{Type: matches[2], TagKey: matches[1], Expression: matches[3], GroupBy: i == 0})
+				continue
+			}
+
+			tag := strings.SplitN(definition, "=", 2)
+			if len(tag) != 2 || !isIdentifier(tag[0]) || tag[1] == "" {
+				return nil, fmt.Errorf("%s: %s", errIllFormedTagText, definition)
+			}
+			switch {
+			case i == 0:
+				q.Tags[tag[0]] = tag[1]
+			case tag[1] == wildcard:
+				q.Filters = append(q.Filters, FilterSpec{Type: WildCard, TagKey: tag[0], Expression: tag[1]})
+			default:
+				q.Filters = append(q.Filters, FilterSpec{Type: LiteralOr, TagKey: tag[0], Expression: tag[1]})
+			}
+		}
+	}
+
+	return q, nil
+}
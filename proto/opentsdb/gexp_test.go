@@ -0,0 +1,127 @@
+package opentsdb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type gexpScriptTest struct {
+	Expression     string
+	GroupingTags   []string
+	ShouldContains []string
+	Error          string
+}
+
+func TestGExpScript(t *testing.T) {
+	for _, test := range gexpScriptTests {
+		query := &GExpQuery{Start: "1h-ago", Expressions: []string{test.Expression}}
+		if err := query.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		ws, groupingTags, err := query.script("token", test.Expression)
+		if test.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), test.Error) {
+				t.Errorf("Expected '%s' to fail with '%s', got %v", test.Expression, test.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Fail to translate '%s': %v", test.Expression, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(groupingTags, test.GroupingTags) {
+			t.Errorf("Expected grouping tags %v for '%s', got %v", test.GroupingTags, test.Expression, groupingTags)
+		}
+		for _, shouldContain := range test.ShouldContains {
+			if !strings.Contains(ws, shouldContain) {
+				t.Errorf("Query does not contain '%s'", shouldContain)
+				t.Errorf("WarpScript %s", ws)
+			}
+		}
+	}
+}
+
+var gexpScriptTests = []gexpScriptTest{
+	{
+		Expression:   "scale(sum:sys.cpu{host=a},10)",
+		GroupingTags: []string{},
+		ShouldContains: []string{
+			"'sys.cpu'\n'host' '=a'\n2 ->MAP",
+			"reducer.sum\n3 ->LIST REDUCE",
+			"$gts SORT 'subquery0' STORE",
+			"$subquery0\n",
+			"[ SWAP 10 mapper.mul 0 0 0 ] MAP",
+		},
+	},
+	{
+		Expression:   "sumSeries(sum:sys.cpu{host=*},max:1m-avg:sys.mem)",
+		GroupingTags: []string{"host"},
+		ShouldContains: []string{
+			"'host' '~.*'",
+			"'host' 1 ->LIST\nreducer.sum",
+			"60000000 'bucketspan' STORE\n[ $gts bucketizer.mean",
+			"reducer.max\n3 ->LIST REDUCE",
+			"$gts SORT 'subquery1' STORE",
+			"$subquery0 $subquery1 APPEND",
+			"[ SWAP $equivalenceClass reducer.sum ] REDUCE",
+		},
+	},
+	{
+		Expression:   "absolute(sum:rate{counter,100,0}:sys.cpu{}{dc=literal_or(gra|rbx)})",
+		GroupingTags: []string{},
+		ShouldContains: []string{
+			"'dc' '~gra|rbx'",
+			"[ SWAP 100 mapper.min.x 0 0 0 ] MAP",
+			"[ SWAP  mapper.abs 0 0 0 ] MAP",
+		},
+	},
+	{
+		Expression: "scale(foo:sys.cpu,1)",
+		Error:      "foo:sys.cpu: invalid aggregator foo",
+	},
+	{
+		Expression: "scale(sum:1m-blah:sys.cpu,1)",
+		Error:      "Downsampling operator 'blah' is not available",
+	},
+	{
+		Expression: "scale(sum:sys.cpu{host},1)",
+		Error:      errIllFormedTagText,
+	},
+	{
+		Expression: "scale(1,2)",
+		Error:      "no OpenTSDB sub-query found",
+	},
+}
+
+func TestParseSubQuery(t *testing.T) {
+	q, err := parseSubQuery("sum:1m-avg-zero:rate{counter,100,0}:explicit_tags:sys.cpu{host=a}{dc=wildcard(gra*)}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.Aggregator != "sum" || q.Metric != "sys.cpu" || !q.ExplicitTags {
+		t.Errorf("Unexpected sub-query %+v", q)
+	}
+	if q.Downsample == nil || *q.Downsample != "1m-avg-zero" {
+		t.Errorf("Expected the 1m-avg-zero downsampling, got %v", q.Downsample)
+	}
+	if q.Rate == nil || !*q.Rate || !q.RateOptions.Counter || *q.RateOptions.CounterMax != 100 || *q.RateOptions.ResetValue != 0 {
+		t.Errorf("Unexpected rate options %+v", q.RateOptions)
+	}
+	if !reflect.DeepEqual(q.Tags, map[string]string{"host": "a"}) {
+		t.Errorf("Expected the host grouping tag, got %v", q.Tags)
+	}
+	expected := []FilterSpec{{Type: "wildcard", TagKey: "dc", Expression: "gra*"}}
+	if !reflect.DeepEqual(q.Filters, expected) {
+		t.Errorf("Expected filters %v, got %v", expected, q.Filters)
+	}
+
+	for _, m := range []string{"sys.cpu", "sum:foo:sys.cpu", "sum:rate{counter,x}:sys.cpu", "sum:sys.cpu{}{dc=unknown(a)}"} {
+		if _, err := parseSubQuery(m); err == nil {
+			t.Errorf("Expected '%s' to be rejected", m)
+		}
+	}
+}
@@ -36,7 +36,7 @@ type queryLookup struct {
 
 type result struct {
 	Metric string            `json:"metric"`
-	TSUID  int               `json:"tsuid"`
+	TSUID  string            `json:"tsuid"`
 	Tags   map[string]string `json:"tags"`
 }
 
@@ -201,7 +201,7 @@ func buildLookupResponse(metric string, tags []tag, elapsedTime int64, gtsList [
 		result := result{
 			Metric: gts.Class,
 			Tags:   gts.Labels,
-			TSUID:  0,
+			TSUID:  pseudoTSUID(gts.Class, gts.Labels),
 		}
 		results = append(results, result)
 	}
@@ -226,7 +226,7 @@ func (c *OpenTSDB) HandleLookup(responseWriter http.ResponseWriter, request *htt
 	token := core.RetrieveToken(request)
 	if len(token) == 0 {
 		c.WarnCounter.Inc()
-		http.Error(responseWriter, "Not authorized", 401)
+		writeError(responseWriter, 401, "Not authorized")
 		return
 	}
 
@@ -235,7 +235,7 @@ func (c *OpenTSDB) HandleLookup(responseWriter http.ResponseWriter, request *htt
 	query, err = extractQueryLookupFromRequest(request)
 	if err != nil {
 		c.WarnCounter.Inc()
-		http.Error(responseWriter, err.Error(), 400)
+		writeError(responseWriter, 400, err.Error())
 		return
 	}
 
@@ -255,7 +255,7 @@ func (c *OpenTSDB) HandleLookup(responseWriter http.ResponseWriter, request *htt
 			"path":   request.URL.String(),
 			"ip":     request.Header.Get("X-Forwarded-For"),
 		}).Warn(message)
-		http.Error(responseWriter, message, 400)
+		writeError(responseWriter, 400, message)
 		return
 	}
 
@@ -274,7 +274,7 @@ func (c *OpenTSDB) HandleLookup(responseWriter http.ResponseWriter, request *htt
 			"path":   request.URL.String(),
 			"ip":     request.Header.Get("X-Forwarded-For"),
 		}).Warn("Bad response from Egress")
-		http.Error(responseWriter, err.Error(), 500)
+		writeDetailedError(responseWriter, egressError(err.Error()))
 		return
 	}
 
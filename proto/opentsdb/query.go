@@ -9,12 +9,15 @@ import (
 	"io/ioutil"
 	"net/http"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ovh/erlenmeyer/core"
 	"github.com/ovh/erlenmeyer/middlewares"
+	"github.com/ovh/erlenmeyer/models"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 
@@ -133,6 +136,22 @@ type QueryRequest struct {
 	// Whether or not to output data point timestamps in milliseconds or seconds
 	MSResolution *bool `json:"msResolution"`
 	Delete       bool  `json:"delete"`
+	// Whether or not to return the annotations of the time series in the results
+	NoAnnotations bool `json:"noAnnotations"`
+	// Whether or not to return the global annotations of the time range
+	GlobalAnnotations bool `json:"globalAnnotations"`
+	// Whether or not to output the TSUIDs associated with time series in the results
+	ShowTSUIDs bool `json:"showTSUIDs"`
+	// Whether or not to append a summary of the query execution statistics
+	ShowSummary bool `json:"showSummary"`
+	// Whether or not to output the execution statistics of each sub query
+	ShowStats bool `json:"showStats"`
+	// Whether or not to echo the sub query with each result
+	ShowQuery bool `json:"showQuery"`
+	// An optional IANA timezone for calendar downsampling. Default value = UTC
+	Timezone string `json:"timezone"`
+	// Whether or not to align downsampling buckets on the calendar of the timezone
+	UseCalendar bool `json:"useCalendar"`
 }
 
 // Query an OpenTSDB single query
@@ -153,22 +172,48 @@ type Query struct {
 	Filters []FilterSpec `json:"filters"`
 	// Returns the series that include only the tag keys provided in the filters.
 	ExplicitTags bool `json:"explicitTags"`
+	// Percentiles to compute across the grouped series, each one is returned as a metric_pct_XX series
+	Percentiles []float64 `json:"percentiles"`
+
+	// Location of the calendar downsampling buckets, nil for buckets aligned on epoch
+	location *time.Location
 }
 
 // QueryResponse an OpenTSDB Query response
 type QueryResponse struct {
-	Metric        string             `json:"metric"`
-	Tags          map[string]string  `json:"tags"`
-	Query         IndexResponse      `json:"query"`
-	AggregateTags []string           `json:"aggregateTags"`
-	DPs           map[string]float64 `json:"dps"`
+	Metric            string             `json:"metric"`
+	Tags              map[string]string  `json:"tags"`
+	Query             IndexResponse      `json:"query"`
+	AggregateTags     []string           `json:"aggregateTags"`
+	DPs               map[string]float64 `json:"dps"`
+	TSUIDs            []string           `json:"tsuids,omitempty"`
+	Annotations       []*Annotation      `json:"annotations,omitempty"`
+	GlobalAnnotations []*Annotation      `json:"globalAnnotations,omitempty"`
+	Stats             *QueryStats        `json:"stats,omitempty"`
+
+	// TSUIDs of the fetched series behind the result, to match their annotations
+	sources []string
 }
 
-// IndexResponse query struct containing the query index
+// IndexResponse query struct containing the query index, and the sub query itself when showQuery is set
 type IndexResponse struct {
+	*Query
 	Index int `json:"index"`
 }
 
+// QueryStats execution statistics of a sub query, built from the Warp10 response headers
+type QueryStats struct {
+	QueryIndex int `json:"queryIndex"`
+	// Number of datapoints in the results
+	EmittedDPs int `json:"emittedDPs"`
+	// Number of datapoints fetched by Warp10
+	FetchedDPs int64 `json:"dpsPreFilter"`
+	// WarpScript execution time in milliseconds
+	ProcessingTime float64 `json:"processingTime"`
+	// Number of WarpScript operations
+	Ops int64 `json:"ops"`
+}
+
 var (
 	errIllFormedTag             = errors.New(errIllFormedTagText)
 	identifierRE                = regexp.MustCompile("^" + identifier + "$")
@@ -233,7 +278,7 @@ func (o *OpenTSDB) HandleQuery(w http.ResponseWriter, r *http.Request) {
 	token := core.RetrieveToken(r)
 	if len(token) == 0 {
 		o.WarnCounter.Inc()
-		http.Error(w, "Not authorized", 401)
+		writeError(w, 401, "Not authorized")
 		return
 	}
 
@@ -242,7 +287,7 @@ func (o *OpenTSDB) HandleQuery(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		o.WarnCounter.Inc()
-		http.Error(w, "Please use the POST version of queries", http.StatusNotImplemented)
+		writeError(w, http.StatusNotImplemented, "Please use the POST version of queries")
 		log.WithFields(log.Fields{
 			"proto": "opentsdb",
 		}).Error("GET Queries not implemented")
@@ -250,7 +295,7 @@ func (o *OpenTSDB) HandleQuery(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		if success, message, status := query.parseRequestBody(r.Body); !success {
 			o.WarnCounter.Inc()
-			http.Error(w, message, status)
+			writeError(w, status, message)
 			return
 		}
 		if query.Delete {
@@ -261,14 +306,14 @@ func (o *OpenTSDB) HandleQuery(w http.ResponseWriter, r *http.Request) {
 	case http.MethodDelete:
 		if success, message, status := query.parseRequestBody(r.Body); !success {
 			o.WarnCounter.Inc()
-			http.Error(w, message, status)
+			writeError(w, status, message)
 			return
 		}
 		executeDelete(w, token, query)
 	default:
 		o.WarnCounter.Inc()
 		w.Header().Add("Allow", "POST, DELETE")
-		http.Error(w, fmt.Sprintf("Method '%s' is not allowed", r.Method), http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method '%s' is not allowed", r.Method))
 		return
 	}
 }
@@ -286,7 +331,7 @@ func (o *OpenTSDB) HandleQueryLast(responseWriter http.ResponseWriter, request *
 			"status": 401,
 			"path":   request.URL.String(),
 		}).Error("401 Not Authorized")
-		http.Error(responseWriter, "Not authorized", 401)
+		writeError(responseWriter, 401, "Not authorized")
 		return
 	}
 
@@ -300,7 +345,7 @@ func (o *OpenTSDB) HandleQueryLast(responseWriter http.ResponseWriter, request *
 			"status": 400,
 			"path":   request.URL.String(),
 		}).Error("Bad request")
-		http.Error(responseWriter, "Bad request", 400)
+		writeError(responseWriter, 400, "Bad request")
 		return
 	}
 	out := &bytes.Buffer{}
@@ -315,7 +360,7 @@ func (o *OpenTSDB) HandleQueryLast(responseWriter http.ResponseWriter, request *
 			"status": 400,
 			"path":   request.URL.String(),
 		}).Error(message)
-		http.Error(responseWriter, message, http.StatusBadRequest)
+		writeError(responseWriter, http.StatusBadRequest, message)
 		return
 	}
 
@@ -325,12 +370,7 @@ func (o *OpenTSDB) HandleQueryLast(responseWriter http.ResponseWriter, request *
 	response, err := warpServer.Query(outStr, responseWriter.Header().Get(middlewares.TxnHeader))
 	if err != nil {
 		o.ErrCounter.Inc()
-		message := "Bad response from Egress"
-		log.WithFields(log.Fields{
-			"error": err.Error(),
-			"proto": "opentsdb",
-		}).Error(message)
-		http.Error(responseWriter, message, http.StatusBadGateway)
+		writeDetailedError(responseWriter, egressError(err.Error()))
 		return
 	}
 
@@ -342,7 +382,7 @@ func (o *OpenTSDB) HandleQueryLast(responseWriter http.ResponseWriter, request *
 			"error": err.Error(),
 			"proto": "opentsdb",
 		}).Error(message)
-		http.Error(responseWriter, message, http.StatusBadGateway)
+		writeError(responseWriter, http.StatusBadGateway, message)
 		return
 	}
 
@@ -355,7 +395,7 @@ func (o *OpenTSDB) HandleQueryLast(responseWriter http.ResponseWriter, request *
 			"error": err.Error(),
 			"proto": "opentsdb",
 		}).Error(message)
-		http.Error(responseWriter, message, http.StatusBadGateway)
+		writeError(responseWriter, http.StatusBadGateway, message)
 		return
 	}
 
@@ -366,7 +406,7 @@ func (o *OpenTSDB) HandleQueryLast(responseWriter http.ResponseWriter, request *
 			"error": err.Error(),
 			"proto": "opentsdb",
 		}).Error(message)
-		http.Error(responseWriter, message, http.StatusBadGateway)
+		writeError(responseWriter, http.StatusBadGateway, message)
 		return
 	}
 	responseWriter.Header().Add("Content-Type", "application/json")
@@ -461,6 +501,12 @@ func (q *Query) Validate() error { // nolint: golint
 		return fmt.Errorf("invalid aggregator %s", q.Aggregator)
 	}
 
+	for _, percentile := range q.Percentiles {
+		if percentile <= 0 || percentile > 100 {
+			return fmt.Errorf("invalid percentile %g", percentile)
+		}
+	}
+
 	if q.Rate == nil {
 		q.Rate = new(bool)
 		*q.Rate = false
@@ -547,24 +593,35 @@ func (q *Query) agregation(out *bytes.Buffer, groupingTags []string) (success bo
 			}
 		}
 	}
-	if q.Aggregator == none {
+	if q.Aggregator == none && len(q.Percentiles) == 0 {
 
 		fmt.Fprint(out, "'gts' STORE\n")
 		success = true
 		return
 	}
 	// Equivalence class
-	if len(groupingTags) == 0 {
-		fmt.Fprint(out, "[]\n")
-	} else {
+	equivalenceClass := "[]"
+	if len(groupingTags) != 0 {
+		equivalenceClass = ""
 		for _, tagk := range groupingTags {
-			fmt.Fprintf(out, "'%s' ", tagk)
+			equivalenceClass += fmt.Sprintf("'%s' ", tagk)
 		}
-		fmt.Fprintf(out, "%d ->LIST\n", len(groupingTags))
+		equivalenceClass += fmt.Sprintf("%d ->LIST", len(groupingTags))
 	}
 
-	fmt.Fprintf(out, "%s\n", aggregatorToReduce[q.Aggregator])
-	fmt.Fprint(out, "3 ->LIST REDUCE\n\n")
+	if len(q.Percentiles) == 0 {
+		fmt.Fprintf(out, "%s\n", equivalenceClass)
+		fmt.Fprintf(out, "%s\n", aggregatorToReduce[q.Aggregator])
+		fmt.Fprint(out, "3 ->LIST REDUCE\n\n")
+	} else {
+		// One series per percentile, suffixed by the percentile
+		fmt.Fprint(out, "'percentiles_gts' STORE\n[\n")
+		for _, percentile := range q.Percentiles {
+			fmt.Fprintf(out, "[ $percentiles_gts %s %s reducer.percentile ] REDUCE\n", equivalenceClass, formatDouble(percentile))
+			fmt.Fprintf(out, "<%% DROP '+%s' RENAME %%> LMAP\n", percentileSuffix(percentile))
+		}
+		fmt.Fprint(out, "] FLATTEN\n\n")
+	}
 
 	// If rate is asked for, add another reducer
 	if q.Rate != nil && *q.Rate {
@@ -594,6 +651,20 @@ func (q *Query) agregation(out *bytes.Buffer, groupingTags []string) (success bo
 	return
 }
 
+// formatDouble format a float as a double, both in WarpScript and in Java
+func formatDouble(value float64) string {
+	formatted := strconv.FormatFloat(value, 'f', -1, 64)
+	if !strings.Contains(formatted, ".") {
+		formatted += ".0"
+	}
+	return formatted
+}
+
+// percentileSuffix return the metric suffix of a percentile, as OpenTSDB does
+func percentileSuffix(percentile float64) string {
+	return "_pct_" + formatDouble(percentile)
+}
+
 func appendResponses(warp10Results []core.GeoTimeSeries, responses []*QueryResponse, groupingTags []string, queryResolution *bool, metric string, loopIndex int) ([]*QueryResponse, int) {
 	byteCount := 0
 
@@ -626,6 +697,50 @@ func appendResponses(warp10Results []core.GeoTimeSeries, responses []*QueryRespo
 	return responses, byteCount
 }
 
+// indexSources index the sorted TSUIDs of the fetched series by the key of the result
+// they are behind: the series itself without aggregator, else its group
+func (q *Query) indexSources(series []core.GeoTimeSeries, groupingTags []string) map[string][]string {
+	sources := map[string][]string{}
+	for _, gts := range series {
+		labels := gts.Labels
+		if _, ok := labels[".app"]; ok {
+			labels = make(map[string]string, len(gts.Labels))
+			for key, value := range gts.Labels {
+				if key != ".app" {
+					labels[key] = value
+				}
+			}
+		}
+
+		key := q.sourceKey(labels, groupingTags)
+		sources[key] = append(sources[key], pseudoTSUID(gts.Class, labels))
+	}
+	for _, tsuids := range sources {
+		sort.Strings(tsuids)
+	}
+	return sources
+}
+
+// sourceKey return the key matching a result and its fetched series: all their tags
+// without aggregator, else the values of the grouping tags
+func (q *Query) sourceKey(tags map[string]string, groupingTags []string) string {
+	keys := groupingTags
+	if q.Aggregator == none && len(q.Percentiles) == 0 {
+		keys = make([]string, 0, len(tags))
+		for key := range tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(strconv.Quote(key))
+		b.WriteString(strconv.Quote(tags[key]))
+	}
+	return b.String()
+}
+
 // Validate is the implementation of Validate for QueryRequest
 func (handler *QueryRequest) Validate() error { // nolint: golint
 	if handler.Start == nil && handler.End == nil {
@@ -643,10 +758,21 @@ func (handler *QueryRequest) Validate() error { // nolint: golint
 		return errors.New("Start date is after end date")
 	}
 
+	location := time.UTC
+	if handler.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(handler.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %s", handler.Timezone)
+		}
+	}
+
 	for _, query := range handler.Queries {
 		if err := query.Validate(); err != nil {
 			return err
 		}
+		if handler.UseCalendar {
+			query.location = location
+		}
 	}
 	return nil
 }
@@ -776,6 +902,12 @@ func (q *Query) generateBucketizeScript(out *bytes.Buffer, bucketSpan int64, buc
 	} else {
 		fmt.Fprintf(out, "[ $gts %s $end TOTIMESTAMP $end TOTIMESTAMP $start TOTIMESTAMP - 1 ]  BUCKETIZE\n", bucketizer)
 	}
+	q.generateFillScript(out, fillPolicy)
+}
+
+// generateFillScript fill the missing buckets of an OpenTSDB subquery
+// nolint: interfacer
+func (q *Query) generateFillScript(out *bytes.Buffer, fillPolicy string) {
 	switch fillPolicy {
 	case "", none:
 		if needsInterpolate(q.Aggregator) {
@@ -820,7 +952,22 @@ func (q *Query) downSampling(out *bytes.Buffer, start time.Time, end time.Time)
 			httpCode = http.StatusBadRequest
 			return
 		}
-		q.generateBucketizeScript(out, period.Nanoseconds()/1000, bucketizer, requestedFillPolicy)
+
+		if q.location != nil && splits[2] != "all" {
+			count, _ := strconv.ParseInt(splits[1], 10, 64) // nolint: gas
+			if count <= 0 {
+				message = "Wrong downsampling value: " + *q.Downsample
+				httpCode = http.StatusBadRequest
+				return
+			}
+			if err := q.generateCalendarBucketizeScript(out, start, end, count, splits[2], bucketizer, requestedFillPolicy); err != nil {
+				message = err.Error()
+				httpCode = http.StatusBadRequest
+				return
+			}
+		} else {
+			q.generateBucketizeScript(out, period.Nanoseconds()/1000, bucketizer, requestedFillPolicy)
+		}
 	} else {
 		// Here we force a buketizer.mean by default as there is no down sampling specified.
 		// We assume this is a sensible option between all available bucketizers!
@@ -831,109 +978,194 @@ func (q *Query) downSampling(out *bytes.Buffer, start time.Time, end time.Time)
 	return
 }
 
-// nolint: gocyclo
+// subQueryResult is the outcome of a sub query execution
+type subQueryResult struct {
+	responses []*QueryResponse
+	stats     *QueryStats
+	err       *models.DetailedError
+}
+
 func executeQuery(w http.ResponseWriter, token string, query *QueryRequest) {
 
+	txn := w.Header().Get(middlewares.TxnHeader)
+
+	// Sub queries are executed concurrently, with at most parallelism Warp10 executions at a time
+	parallelism := viper.GetInt("opentsdb.query.parallelism")
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	slots := make(chan struct{}, parallelism)
+
+	results := make([]*subQueryResult, len(query.Queries))
+	var wg sync.WaitGroup
+	for loopIndex, subquery := range query.Queries {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(loopIndex int, subquery *Query) {
+			defer wg.Done()
+			results[loopIndex] = executeSubQuery(token, txn, query, subquery, loopIndex)
+			<-slots
+		}(loopIndex, subquery)
+	}
+	wg.Wait()
+
+	// Results are merged in the sub queries order, failures are reported per sub query
 	responses := []*QueryResponse{}
+	stats := []*QueryStats{}
+	output := []interface{}{}
+	var failure *models.DetailedError
+	failures := []string{}
+	for loopIndex, result := range results {
+		if result.err != nil {
+			if failure == nil {
+				failure = result.err
+			}
+			failures = append(failures, fmt.Sprintf("sub query #%d: %s", loopIndex, result.err.Error.Message))
+			output = append(output, &subQueryError{DetailedError: result.err, Query: IndexResponse{Index: loopIndex}})
+			continue
+		}
+		responses = append(responses, result.responses...)
+		stats = append(stats, result.stats)
+		for _, rep := range result.responses {
+			output = append(output, rep)
+		}
+	}
+
+	// Without any successful sub query, the query fails
+	if failure != nil && len(failures) == len(results) {
+		writeDetailedError(w, models.NewDetailedError(failure.Error.Code, failure.Error.Message, strings.Join(failures, "\n")))
+		return
+	}
+
+	attachAnnotations(token, txn, query, responses)
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	if failure == nil && !query.ShowSummary {
+		json.NewEncoder(w).Encode(responses)
+		return
+	}
+
+	// The summary is a trailing element of the results array
+	if query.ShowSummary {
+		output = append(output, map[string]interface{}{"statsSummary": statsSummary(stats)})
+	}
+	json.NewEncoder(w).Encode(output)
+}
+
+// subQueryError is the results array entry of a failed sub query, when others succeed
+type subQueryError struct {
+	*models.DetailedError
+	Query IndexResponse `json:"query"`
+}
+
+// executeSubQuery run an OpenTSDB sub query on Warp10
+func executeSubQuery(token, txn string, query *QueryRequest, subquery *Query, loopIndex int) *subQueryResult {
 
 	startTimeWithRetention := query.Start.Time
 
-	for loopIndex, subquery := range query.Queries {
+	out := &bytes.Buffer{}
+	fmt.Fprint(out, "JSONSTRICT\n")
+	fmt.Fprintf(out, "'3' MINREV <%% '%s' CAPADD %%> <%% '%s' AUTHENTICATE %%> IFTE\n", token, token)
+	fmt.Fprintf(out, "'%s'\n", token)
 
-		out := &bytes.Buffer{}
-		fmt.Fprint(out, "JSONSTRICT\n")
-		fmt.Fprintf(out, "'3' MINREV <%% '%s' CAPADD %%> <%% '%s' AUTHENTICATE %%> IFTE\n", token, token)
-		fmt.Fprintf(out, "'%s'\n", token)
+	// OpenTSDB order: Selection, Grouping, Downsampling, Aggregation, Interpolation, Rate conversion
+	//---- Selection: FETCH
 
-		// OpenTSDB order: Selection, Grouping, Downsampling, Aggregation, Interpolation, Rate conversion
-		//---- Selection: FETCH
+	groupingTags := subquery.selection(out, startTimeWithRetention, query.End.Time)
 
-		groupingTags := subquery.selection(out, startTimeWithRetention, query.End.Time)
+	// Keep the fetched series, without datapoints, to report the TSUIDs and the annotations
+	// of the series behind each result
+	if query.ShowTSUIDs || !query.NoAnnotations {
+		fmt.Fprint(out, "DUP <% DROP CLONEEMPTY %> LMAP 'series' STORE\n")
+	} else {
+		fmt.Fprint(out, "[] 'series' STORE\n")
+	}
 
-		//---- Downsample: BUCKETIZE
-		if success, errorMsg, httpCode := subquery.downSampling(out, startTimeWithRetention, query.End.Time); !success {
-			http.Error(w, errorMsg, httpCode)
-			return
-		}
+	//---- Downsample: BUCKETIZE
+	if success, errorMsg, httpCode := subquery.downSampling(out, startTimeWithRetention, query.End.Time); !success {
+		return &subQueryResult{err: models.NewDetailedError(httpCode, errorMsg, "")}
+	}
 
-		//---- Aggregation: REDUCE
-		if success, errorMsg, httpCode := subquery.agregation(out, groupingTags); !success {
-			http.Error(w, errorMsg, httpCode)
-			return
-		}
+	//---- Aggregation: REDUCE
+	if success, errorMsg, httpCode := subquery.agregation(out, groupingTags); !success {
+		return &subQueryResult{err: models.NewDetailedError(httpCode, errorMsg, "")}
+	}
 
-		//---- Build resulting structure on top of the stack with fields «count» and «gts»
-		fmt.Fprint(out, "{ 'gts' $gts SORT }\n")
+	//---- Build resulting structure on top of the stack with fields «count» and «gts»
+	fmt.Fprint(out, "{ 'gts' $gts SORT 'series' $series }\n")
 
-		//----- Send request
-		body := out.String()
-		warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "opentsdb-query")
-		warp10Results, err := warpServer.QueryGTS(body, w.Header().Get(middlewares.TxnHeader))
+	//----- Send request
+	body := out.String()
+	warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "opentsdb-query")
+	warp10Results, err := warpServer.QueryGTS(body, txn)
 
-		if err != nil {
-			errorText := err.Error()
-			if strings.Contains(errorText, "URLDecoder") {
-				re := regexp.MustCompile(`URLDecoder: ([^<]*)`)
-				e := ""
-				parts := re.FindStringSubmatch(errorText)
-				if len(e) > 1 {
-					e = parts[1]
-				}
-				re = regexp.MustCompile(`line #(\d+)`)
-				l := "-1"
-				parts = re.FindStringSubmatch(errorText)
-				if len(e) > 1 {
-					l = parts[1]
-				}
-				log.WithFields(log.Fields{
-					"error":       errorText,
-					"proto":       "opentsdb",
-					"query-error": e,
-					"line":        l,
-				}).Warn("Malformed WarpScript")
-			} else if strings.Contains(errorText, "FETCH exceeded limit of") {
-				re := regexp.MustCompile(`(?:limit of )(\d+)(?: datapoints, current count is )(\d+)</pre>`)
-				parts := re.FindStringSubmatch(errorText)
-				current := "-1"
-				max := "-1"
-				if len(parts) > 2 {
-					current = parts[1]
-					max = parts[2]
-				}
-				log.WithFields(log.Fields{
-					"error":   errorText,
-					"proto":   "opentsdb",
-					"current": current,
-					"max":     max,
-				}).Warn("Max datapoints fetching excedeed")
-			} else if strings.Contains(errorText, "SocketTimeoutException") {
-				re := regexp.MustCompile(`(?:hostname=)([^,]*)`)
-				parts := re.FindStringSubmatch(errorText)
-				host := ""
-				if len(parts) > 1 {
-					host = parts[1]
-				}
-				log.WithFields(log.Fields{
-					"error": errorText,
-					"proto": "opentsdb",
-					"host":  host,
-				}).Error("Socket timeout")
-			} else {
-				log.WithFields(log.Fields{
-					"error": errorText,
-					"proto": "opentsdb",
-				}).Error("Egress error: uncategorized error")
-			}
-			http.Error(w, errorText, http.StatusInternalServerError)
-			return
-		}
+	if err != nil {
+		return &subQueryResult{err: egressError(err.Error())}
+	}
 
+	responses := []*QueryResponse{}
+	if len(subquery.Percentiles) == 0 {
 		responses, _ = appendResponses(warp10Results.GTS, responses, groupingTags, query.MSResolution, subquery.Metric, loopIndex)
+	} else {
+		// Percentile series are renamed with their suffix
+		for _, result := range warp10Results.GTS {
+			responses, _ = appendResponses([]core.GeoTimeSeries{result}, responses, groupingTags, query.MSResolution, result.Class, loopIndex)
+		}
 	}
 
-	w.Header().Add("Content-Type", "application/json")
-	w.WriteHeader(200)
-	json.NewEncoder(w).Encode(responses)
+	subqueryStats := &QueryStats{
+		QueryIndex:     loopIndex,
+		FetchedDPs:     int64(warp10Results.Stats.Fetched),
+		ProcessingTime: warp10Results.Stats.Elapsed / float64(time.Millisecond),
+		Ops:            int64(warp10Results.Stats.Ops),
+	}
+	sources := map[string][]string{}
+	if query.ShowTSUIDs || !query.NoAnnotations {
+		sources = subquery.indexSources(warp10Results.Series, groupingTags)
+	}
+	for _, rep := range responses {
+		subqueryStats.EmittedDPs += len(rep.DPs)
+
+		if query.ShowQuery {
+			rep.Query.Query = subquery
+		}
+		rep.sources = sources[subquery.sourceKey(rep.Tags, groupingTags)]
+		if query.ShowTSUIDs {
+			rep.TSUIDs = rep.sources
+		}
+		if query.ShowStats {
+			rep.Stats = subqueryStats
+		}
+	}
+
+	return &subQueryResult{responses: responses, stats: subqueryStats}
+}
+
+// statsSummary sum up the execution statistics of all the sub queries
+func statsSummary(stats []*QueryStats) map[string]interface{} {
+	datapoints := 0
+	rawDatapoints := int64(0)
+	processingTime := 0.0
+	ops := int64(0)
+
+	summary := map[string]interface{}{}
+	for _, s := range stats {
+		datapoints += s.EmittedDPs
+		rawDatapoints += s.FetchedDPs
+		processingTime += s.ProcessingTime
+		ops += s.Ops
+		summary[fmt.Sprintf("queryIdx_%02d", s.QueryIndex)] = s
+	}
+
+	summary["datapoints"] = datapoints
+	summary["rawDatapoints"] = rawDatapoints
+	summary["processingTime"] = processingTime
+	summary["ops"] = ops
+
+	return summary
 }
 
 func isIdentifier(identifier string) bool {
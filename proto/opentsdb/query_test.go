@@ -0,0 +1,47 @@
+package opentsdb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ovh/erlenmeyer/core"
+)
+
+func TestIndexSources(t *testing.T) {
+	series := []core.GeoTimeSeries{
+		{Class: "sys.cpu", Labels: map[string]string{"host": "a", "dc": "gra", ".app": "app"}},
+		{Class: "sys.cpu", Labels: map[string]string{"host": "b", "dc": "gra"}},
+		{Class: "sys.cpu", Labels: map[string]string{"host": "c", "dc": "rbx"}},
+	}
+	tsuid := func(host, dc string) string {
+		return pseudoTSUID("sys.cpu", map[string]string{"host": host, "dc": dc})
+	}
+
+	// Without aggregator a result is backed by the series with the same tags
+	query := &Query{Aggregator: none}
+	sources := query.indexSources(series, nil)
+	got := sources[query.sourceKey(map[string]string{"host": "a", "dc": "gra"}, nil)]
+	if !reflect.DeepEqual(got, []string{tsuid("a", "gra")}) {
+		t.Errorf("Expected the TSUID of the series, got %v", got)
+	}
+	if _, ok := series[0].Labels[".app"]; !ok {
+		t.Error("Expected the fetched series labels to be left unchanged")
+	}
+
+	// Aggregated, a result is backed by all the series of its group
+	query = &Query{Aggregator: "sum"}
+	sources = query.indexSources(series, []string{"dc"})
+	got = sources[query.sourceKey(map[string]string{"dc": "gra"}, []string{"dc"})]
+	expected := []string{tsuid("a", "gra"), tsuid("b", "gra")}
+	if expected[0] > expected[1] {
+		expected[0], expected[1] = expected[1], expected[0]
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	got = sources[query.sourceKey(map[string]string{}, []string{"dc"})]
+	if len(got) != 0 {
+		t.Errorf("Expected no series for an unknown group, got %v", got)
+	}
+}
@@ -0,0 +1,157 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ovh/erlenmeyer/core"
+	"github.com/ovh/erlenmeyer/middlewares"
+)
+
+// SearchQuery an OpenTSDB search query
+// http://opentsdb.net/docs/build/html/api_http/search/index.html
+type SearchQuery struct {
+	Query      string `schema:"query"      json:"query"`
+	Limit      int    `schema:"limit"      json:"limit"`
+	StartIndex int    `schema:"startIndex" json:"startIndex"`
+}
+
+// SearchResponse an OpenTSDB search response
+type SearchResponse struct {
+	Type         string      `json:"type"`
+	Query        string      `json:"query"`
+	Limit        int         `json:"limit"`
+	StartIndex   int         `json:"startIndex"`
+	Time         int64       `json:"time"`
+	TotalResults int         `json:"totalResults"`
+	Results      interface{} `json:"results"`
+}
+
+// Validate is the implementation of Validate for SearchQuery
+func (q *SearchQuery) Validate() error {
+	if q.Limit == 0 {
+		q.Limit = 25
+	}
+	if q.Limit < 0 || q.StartIndex < 0 {
+		return errors.New("Invalid limit or start index")
+	}
+	return nil
+}
+
+// page return the bounds of the requested page of total results
+func (q *SearchQuery) page(total int) (int, int) {
+	start := q.StartIndex
+	if start > total {
+		start = total
+	}
+	end := start + q.Limit
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// HandleSearchTSMeta is the handler for /api/search/tsmeta, the query is a
+// metric and tags lookup string like /api/search/lookup ones
+func (o *OpenTSDB) HandleSearchTSMeta(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	token := core.RetrieveToken(r)
+	if len(token) == 0 {
+		o.WarnCounter.Inc()
+		writeError(w, 401, "Not authorized")
+		return
+	}
+
+	query := &SearchQuery{}
+	if err := DecodeRequestParams(w, r, query); err != nil {
+		o.WarnCounter.Inc()
+		return // Response was sent
+	}
+
+	lookup := &queryLookup{Metric: wildcard, Tags: []tag{}}
+	if query.Query != "" {
+		var err error
+		if lookup, err = unMarshallQueryLookupFromQueryString(query.Query); err != nil {
+			o.WarnCounter.Inc()
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	series, err := findSeries(token, w.Header().Get(middlewares.TxnHeader), lookup)
+	if err != nil {
+		o.ErrCounter.Inc()
+		writeDetailedError(w, egressError(err.Error()))
+		return
+	}
+
+	start, end := query.page(len(series))
+	metas := make([]*TSMeta, 0, end-start)
+	for _, gts := range series[start:end] {
+		metas = append(metas, newTSMeta(gts))
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(&SearchResponse{
+		Type:         "TSMETA",
+		Query:        query.Query,
+		Limit:        query.Limit,
+		StartIndex:   query.StartIndex,
+		Time:         time.Since(startTime).Nanoseconds() / 1000,
+		TotalResults: len(series),
+		Results:      metas,
+	})
+}
+
+// HandleSearchUIDMeta is the handler for /api/search/uidmeta, the query is
+// matched case insensitively against the metric, tag key and tag value names
+func (o *OpenTSDB) HandleSearchUIDMeta(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	token := core.RetrieveToken(r)
+	if len(token) == 0 {
+		o.WarnCounter.Inc()
+		writeError(w, 401, "Not authorized")
+		return
+	}
+
+	query := &SearchQuery{}
+	if err := DecodeRequestParams(w, r, query); err != nil {
+		o.WarnCounter.Inc()
+		return // Response was sent
+	}
+
+	series, err := findSeries(token, w.Header().Get(middlewares.TxnHeader), &queryLookup{Metric: wildcard, Tags: []tag{}})
+	if err != nil {
+		o.ErrCounter.Inc()
+		writeDetailedError(w, egressError(err.Error()))
+		return
+	}
+
+	pattern := strings.ToLower(strings.Trim(query.Query, wildcard))
+	metas := []*UIDMeta{}
+	for _, meta := range uidMetas(series) {
+		if strings.Contains(strings.ToLower(meta.Name), pattern) {
+			metas = append(metas, meta)
+		}
+	}
+
+	start, end := query.page(len(metas))
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(&SearchResponse{
+		Type:         "UIDMETA",
+		Query:        query.Query,
+		Limit:        query.Limit,
+		StartIndex:   query.StartIndex,
+		Time:         time.Since(startTime).Nanoseconds() / 1000,
+		TotalResults: len(metas),
+		Results:      metas[start:end],
+	})
+}
@@ -45,7 +45,7 @@ func (c *OpenTSDB) HandleSuggest(w http.ResponseWriter, r *http.Request) {
 	token := core.RetrieveToken(r)
 	if len(token) == 0 {
 		c.WarnCounter.Inc()
-		http.Error(w, "Not authorized", 401)
+		writeError(w, 401, "Not authorized")
 		return
 	}
 
@@ -64,7 +64,7 @@ func (c *OpenTSDB) HandleSuggest(w http.ResponseWriter, r *http.Request) {
 	selector, err := buildWarpScript(suggest)
 	if err != nil {
 		c.ErrCounter.Inc()
-		http.Error(w, err.Error(), 500)
+		writeError(w, 500, err.Error())
 		return
 	}
 
@@ -73,7 +73,7 @@ func (c *OpenTSDB) HandleSuggest(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		c.ErrCounter.Inc()
-		http.Error(w, err.Error(), 500)
+		writeDetailedError(w, egressError(err.Error()))
 		return
 	}
 
@@ -132,24 +132,22 @@ func DecodeRequestParams(w http.ResponseWriter, r *http.Request, dst interface{}
 	var reason string
 
 	if r.Method == "GET" {
-		err = OpenTsdbDecoder.Decode(dst, r.URL.Query())
+		if err = OpenTsdbDecoder.Decode(dst, r.URL.Query()); err != nil {
+			reason = fmt.Sprintf("can't parse query: %s", err)
+		}
 	} else {
 		defer r.Body.Close()
-		body, err := ioutil.ReadAll(r.Body)
+		var body []byte
+		body, err = ioutil.ReadAll(r.Body)
 		if err != nil {
 			reason = fmt.Sprintf("can't fully read the request body: %s", err)
-		}
-
-		if err := json.Unmarshal(body, dst); err != nil {
+		} else if err = json.Unmarshal(body, dst); err != nil {
 			reason = fmt.Sprintf("can't parse query: %s", err)
 		}
 	}
 
 	if err != nil {
-
-		w.WriteHeader(http.StatusBadRequest)
-		w.Header().Add("Content-Type", "text/plain")
-		w.Write([]byte(reason))
+		writeError(w, http.StatusBadRequest, reason)
 		return err
 	}
 
@@ -158,10 +156,7 @@ func DecodeRequestParams(w http.ResponseWriter, r *http.Request, dst interface{}
 		if err := validatable.Validate(); err != nil {
 			// OpenTSDB returns a 400 for validation errors even if
 			// although 422 (Unprocessable entity) would be more suitable
-			w.WriteHeader(http.StatusBadRequest)
-			w.Header().Add("Content-Type", "text/plain")
-			w.Write([]byte(err.Error()))
-
+			writeError(w, http.StatusBadRequest, err.Error())
 			return err
 		}
 	}
@@ -0,0 +1,615 @@
+package opentsdb
+
+import (
+	"bytes"
+	"crypto/sha1" // nolint: gas
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/ovh/erlenmeyer/core"
+	"github.com/ovh/erlenmeyer/middlewares"
+)
+
+const (
+	uidTypeMetric = "metric"
+	uidTypeTagk   = "tagk"
+	uidTypeTagv   = "tagv"
+)
+
+// Attributes of a series holding its OpenTSDB meta data, the other ones are custom meta data
+var tsMetaAttributes = map[string]bool{
+	"description": true,
+	"notes":       true,
+	"displayName": true,
+	"units":       true,
+	"dataType":    true,
+}
+
+// errAmbiguousTSUID is returned when several series match a TSUID
+var errAmbiguousTSUID = errors.New("TSUID matches several series")
+
+// errTSUIDScanLimit is returned when a TSUID isn't found in the series scanned
+// but the scan was bounded by opentsdb.uid.gcount
+var errTSUIDScanLimit = errors.New("TSUID not found in the scanned series, the token has more series than opentsdb.uid.gcount")
+
+// UIDMeta the meta data of an OpenTSDB UID
+// http://opentsdb.net/docs/build/html/api_http/uid/uidmeta.html
+type UIDMeta struct {
+	UID         string            `json:"uid"`
+	Type        string            `json:"type"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Notes       string            `json:"notes"`
+	Created     int64             `json:"created"`
+	Custom      map[string]string `json:"custom"`
+	DisplayName string            `json:"displayName"`
+}
+
+// TSMeta the meta data of an OpenTSDB time series, stored in the Warp10 attributes of the series
+// http://opentsdb.net/docs/build/html/api_http/uid/tsmeta.html
+type TSMeta struct {
+	TSUID       string            `json:"tsuid"`
+	Metric      *UIDMeta          `json:"metric"`
+	Tags        []*UIDMeta        `json:"tags"`
+	Description string            `json:"description"`
+	Notes       string            `json:"notes"`
+	Created     int64             `json:"created"`
+	Custom      map[string]string `json:"custom"`
+	DisplayName string            `json:"displayName"`
+	Units       string            `json:"units"`
+	DataType    string            `json:"dataType"`
+}
+
+// UIDAssign an OpenTSDB UID assignment request
+// http://opentsdb.net/docs/build/html/api_http/uid/assign.html
+type UIDAssign struct {
+	Metric []string `schema:"metric" json:"metric"`
+	Tagk   []string `schema:"tagk"   json:"tagk"`
+	Tagv   []string `schema:"tagv"   json:"tagv"`
+}
+
+// UIDMetaQuery an OpenTSDB UID meta data query
+type UIDMetaQuery struct {
+	UID  string `schema:"uid"  json:"uid"`
+	Type string `schema:"type" json:"type"`
+}
+
+// TSMetaQuery an OpenTSDB time series meta data query
+type TSMetaQuery struct {
+	TSUID  string `schema:"tsuid" json:"tsuid"`
+	Metric string `schema:"m"     json:"m"`
+}
+
+// Validate is the implementation of Validate for UIDAssign
+func (a *UIDAssign) Validate() error {
+	// Names are comma separated in query strings
+	for _, names := range []*[]string{&a.Metric, &a.Tagk, &a.Tagv} {
+		split := []string{}
+		for _, name := range *names {
+			split = append(split, strings.Split(name, ",")...)
+		}
+		*names = split
+	}
+
+	if len(a.Metric)+len(a.Tagk)+len(a.Tagv) == 0 {
+		return errors.New("Missing values to assign UIDs")
+	}
+	return nil
+}
+
+// Validate is the implementation of Validate for UIDMetaQuery
+func (q *UIDMetaQuery) Validate() error {
+	if q.UID == "" {
+		return errors.New("Missing UID")
+	}
+	switch q.Type {
+	case uidTypeMetric, uidTypeTagk, uidTypeTagv:
+		return nil
+	}
+	return fmt.Errorf("Invalid UID type %s", q.Type)
+}
+
+// Validate is the implementation of Validate for TSMetaQuery
+func (q *TSMetaQuery) Validate() error {
+	if q.TSUID == "" && q.Metric == "" {
+		return errors.New("Missing TSUID or metric query")
+	}
+	if !tsuidRe.MatchString(q.TSUID) {
+		return fmt.Errorf("Invalid TSUID %s", q.TSUID)
+	}
+	return nil
+}
+
+// syntheticUID derive a stable UID from the type and the name of a metric, tag key or tag
+// value, as Warp10 does not assign UIDs. It is a full SHA-1 hash so that UIDs don't collide
+func syntheticUID(kind, name string) string {
+	sum := sha1.Sum([]byte(kind + ":" + name)) // nolint: gas
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// pseudoTSUID derive a stable TSUID from the classname and labels of a series: the metric UID
+// followed by the tag key and tag value UIDs, sorted on tag key UIDs as OpenTSDB does
+func pseudoTSUID(class string, labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, syntheticUID(uidTypeTagk, key)+syntheticUID(uidTypeTagv, value))
+	}
+	sort.Strings(pairs)
+
+	return syntheticUID(uidTypeMetric, class) + strings.Join(pairs, "")
+}
+
+func newUIDMeta(kind, name string) *UIDMeta {
+	return &UIDMeta{
+		UID:    syntheticUID(kind, name),
+		Type:   strings.ToUpper(kind),
+		Name:   name,
+		Custom: map[string]string{},
+	}
+}
+
+// newTSMeta build the meta data of a series from its attributes
+func newTSMeta(gts core.GeoTimeSeries) *TSMeta {
+	keys := make([]string, 0, len(gts.Labels))
+	for key := range gts.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	meta := &TSMeta{
+		TSUID:  pseudoTSUID(gts.Class, gts.Labels),
+		Metric: newUIDMeta(uidTypeMetric, gts.Class),
+		Tags:   make([]*UIDMeta, 0, 2*len(keys)),
+		Custom: map[string]string{},
+	}
+	for _, key := range keys {
+		meta.Tags = append(meta.Tags, newUIDMeta(uidTypeTagk, key), newUIDMeta(uidTypeTagv, gts.Labels[key]))
+	}
+
+	for key, value := range gts.Attrs {
+		switch key {
+		case "description":
+			meta.Description = value
+		case "notes":
+			meta.Notes = value
+		case "displayName":
+			meta.DisplayName = value
+		case "units":
+			meta.Units = value
+		case "dataType":
+			meta.DataType = value
+		default:
+			if !strings.HasPrefix(key, ".") {
+				meta.Custom[key] = value
+			}
+		}
+	}
+
+	return meta
+}
+
+// attributes return the Warp10 attributes holding the meta data
+func (m *TSMeta) attributes() map[string]string {
+	attributes := map[string]string{}
+	for key, value := range m.Custom {
+		attributes[key] = value
+	}
+	for key, value := range map[string]string{
+		"description": m.Description,
+		"notes":       m.Notes,
+		"displayName": m.DisplayName,
+		"units":       m.Units,
+		"dataType":    m.DataType,
+	} {
+		if value != "" {
+			attributes[key] = value
+		}
+	}
+	return attributes
+}
+
+// merge fill the meta data not provided with the existing ones
+func (m *TSMeta) merge(existing *TSMeta) {
+	for key, value := range existing.attributes() {
+		if _, reserved := tsMetaAttributes[key]; !reserved {
+			if _, ok := m.Custom[key]; !ok {
+				if m.Custom == nil {
+					m.Custom = map[string]string{}
+				}
+				m.Custom[key] = value
+			}
+		}
+	}
+	if m.Description == "" {
+		m.Description = existing.Description
+	}
+	if m.Notes == "" {
+		m.Notes = existing.Notes
+	}
+	if m.DisplayName == "" {
+		m.DisplayName = existing.DisplayName
+	}
+	if m.Units == "" {
+		m.Units = existing.Units
+	}
+	if m.DataType == "" {
+		m.DataType = existing.DataType
+	}
+}
+
+// findSeries run a Warp10 FIND of the series matching a lookup query, bounded to
+// opentsdb.uid.gcount series as UID and TSUID resolutions scan all the series of a token
+func findSeries(token, txn string, query *queryLookup) ([]core.GeoTimeSeries, error) {
+	metric, err := processMetric(query.Metric)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := processTags(query.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &bytes.Buffer{}
+	fmt.Fprint(out, "JSONSTRICT\n")
+	fmt.Fprintf(out, "{ 'token' '%s' 'class' '%s' 'labels' {", token, metric)
+	for key, value := range tags {
+		fmt.Fprintf(out, " '%s' '%s'", key, value)
+	}
+	fmt.Fprint(out, " }")
+	if gcount := viper.GetInt("opentsdb.uid.gcount"); gcount > 0 {
+		fmt.Fprintf(out, " 'gcount' %d", gcount)
+	}
+	fmt.Fprint(out, " } FIND\n")
+	fmt.Fprint(out, "'gts' STORE { 'fetched' 0 'count' 0 'gts' $gts }\n")
+
+	warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "opentsdb-uid")
+	result, err := warpServer.QueryGTS(out.String(), txn)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, gts := range result.GTS {
+		delete(gts.Labels, ".app")
+	}
+	return result.GTS, nil
+}
+
+// findSeriesByTSUID look for the series of a TSUID, as TSUIDs are hashes all series are scanned.
+// Several series matching a TSUID is an error, as the one to update can't be chosen, as well as
+// a TSUID not found when the scan reached opentsdb.uid.gcount series
+func findSeriesByTSUID(token, txn, tsuid string) (*core.GeoTimeSeries, error) {
+	series, err := findSeries(token, txn, &queryLookup{Metric: wildcard, Tags: []tag{}})
+	if err != nil {
+		return nil, err
+	}
+
+	tsuid = strings.ToUpper(tsuid)
+	var found *core.GeoTimeSeries
+	for i := range series {
+		if pseudoTSUID(series[i].Class, series[i].Labels) != tsuid {
+			continue
+		}
+		if found != nil {
+			return nil, errAmbiguousTSUID
+		}
+		found = &series[i]
+	}
+
+	if gcount := viper.GetInt("opentsdb.uid.gcount"); found == nil && gcount > 0 && len(series) >= gcount {
+		return nil, errTSUIDScanLimit
+	}
+	return found, nil
+}
+
+// writeTSMeta replace the Warp10 attributes of a series with its meta data
+func writeTSMeta(token string, gts *core.GeoTimeSeries, meta *TSMeta) error {
+	encode := func(values map[string]string) string {
+		pairs := make([]string, 0, len(values))
+		for key, value := range values {
+			pairs = append(pairs, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+		sort.Strings(pairs)
+		return "{" + strings.Join(pairs, ",") + "}"
+	}
+
+	body := url.QueryEscape(gts.Class) + encode(gts.Labels) + encode(meta.attributes())
+
+	warpServer := core.NewWarpServer(viper.GetString("warp_endpoint"), "opentsdb-uid")
+	return warpServer.Meta(token, body)
+}
+
+// HandleUIDAssign is the handler for /api/uid/assign, UIDs are derived from the names
+// so assigning them always succeeds for valid names
+func (o *OpenTSDB) HandleUIDAssign(w http.ResponseWriter, r *http.Request) {
+
+	token := core.RetrieveToken(r)
+	if len(token) == 0 {
+		o.WarnCounter.Inc()
+		writeError(w, 401, "Not authorized")
+		return
+	}
+
+	assign := &UIDAssign{}
+	if err := DecodeRequestParams(w, r, assign); err != nil {
+		o.WarnCounter.Inc()
+		return // Response was sent
+	}
+
+	response := map[string]map[string]string{}
+	status := http.StatusOK
+	for kind, names := range map[string][]string{
+		uidTypeMetric: assign.Metric,
+		uidTypeTagk:   assign.Tagk,
+		uidTypeTagv:   assign.Tagv,
+	} {
+		if len(names) == 0 {
+			continue
+		}
+
+		response[kind] = map[string]string{}
+		for _, name := range names {
+			if (kind == uidTypeTagv && !isValue(name)) || (kind != uidTypeTagv && !isIdentifier(name)) {
+				if _, ok := response[kind+"_errors"]; !ok {
+					response[kind+"_errors"] = map[string]string{}
+				}
+				response[kind+"_errors"][name] = fmt.Sprintf("Invalid %s name", kind)
+				status = http.StatusBadRequest
+				continue
+			}
+			response[kind][name] = syntheticUID(kind, name)
+		}
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleUIDMeta is the handler for /api/uid/uidmeta, the UID meta data are read only
+func (o *OpenTSDB) HandleUIDMeta(w http.ResponseWriter, r *http.Request) {
+
+	token := core.RetrieveToken(r)
+	if len(token) == 0 {
+		o.WarnCounter.Inc()
+		writeError(w, 401, "Not authorized")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		o.WarnCounter.Inc()
+		writeError(w, http.StatusNotImplemented, "UID meta data can't be modified as Warp10 does not store them")
+		return
+	}
+
+	query := &UIDMetaQuery{}
+	if err := DecodeRequestParams(w, r, query); err != nil {
+		o.WarnCounter.Inc()
+		return // Response was sent
+	}
+
+	series, err := findSeries(token, w.Header().Get(middlewares.TxnHeader), &queryLookup{Metric: wildcard, Tags: []tag{}})
+	if err != nil {
+		o.ErrCounter.Inc()
+		writeDetailedError(w, egressError(err.Error()))
+		return
+	}
+
+	uid := strings.ToUpper(query.UID)
+	for _, meta := range uidMetas(series) {
+		if meta.UID == uid && meta.Type == strings.ToUpper(query.Type) {
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(200)
+			json.NewEncoder(w).Encode(meta)
+			return
+		}
+	}
+
+	o.WarnCounter.Inc()
+	writeError(w, http.StatusNotFound, "Unable to locate UID")
+}
+
+// uidMetas return the meta data of the metrics, tag keys and tag values of series, sorted by type and name
+func uidMetas(series []core.GeoTimeSeries) []*UIDMeta {
+	names := map[string]map[string]bool{
+		uidTypeMetric: {},
+		uidTypeTagk:   {},
+		uidTypeTagv:   {},
+	}
+	for _, gts := range series {
+		names[uidTypeMetric][gts.Class] = true
+		for key, value := range gts.Labels {
+			names[uidTypeTagk][key] = true
+			names[uidTypeTagv][value] = true
+		}
+	}
+
+	metas := []*UIDMeta{}
+	for _, kind := range []string{uidTypeMetric, uidTypeTagk, uidTypeTagv} {
+		sorted := make([]string, 0, len(names[kind]))
+		for name := range names[kind] {
+			sorted = append(sorted, name)
+		}
+		sort.Strings(sorted)
+
+		for _, name := range sorted {
+			metas = append(metas, newUIDMeta(kind, name))
+		}
+	}
+	return metas
+}
+
+// HandleTSMeta is the handler for /api/uid/tsmeta
+// nolint: gocyclo
+func (o *OpenTSDB) HandleTSMeta(w http.ResponseWriter, r *http.Request) {
+
+	token := core.RetrieveToken(r)
+	if len(token) == 0 {
+		o.WarnCounter.Inc()
+		writeError(w, 401, "Not authorized")
+		return
+	}
+
+	txn := w.Header().Get(middlewares.TxnHeader)
+
+	switch r.Method {
+	case http.MethodGet, http.MethodDelete:
+		query := &TSMetaQuery{}
+		if r.Method == http.MethodDelete && len(r.URL.Query()) > 0 {
+			// Deletions can be sent as query string too
+			err := OpenTsdbDecoder.Decode(query, r.URL.Query())
+			if err == nil {
+				err = query.Validate()
+			}
+			if err != nil {
+				o.WarnCounter.Inc()
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		} else if err := DecodeRequestParams(w, r, query); err != nil {
+			o.WarnCounter.Inc()
+			return // Response was sent
+		}
+
+		// Metric queries return the meta data of all the matching series
+		if query.TSUID == "" {
+			if r.Method == http.MethodDelete {
+				o.WarnCounter.Inc()
+				writeError(w, http.StatusBadRequest, "Missing TSUID")
+				return
+			}
+
+			lookup, err := unMarshallQueryLookupFromQueryString(query.Metric)
+			if err != nil {
+				o.WarnCounter.Inc()
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			series, err := findSeries(token, txn, lookup)
+			if err != nil {
+				o.ErrCounter.Inc()
+				writeDetailedError(w, egressError(err.Error()))
+				return
+			}
+
+			metas := make([]*TSMeta, 0, len(series))
+			for _, gts := range series {
+				metas = append(metas, newTSMeta(gts))
+			}
+
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(200)
+			json.NewEncoder(w).Encode(metas)
+			return
+		}
+
+		gts, ok := o.findTSMetaSeries(w, token, txn, query.TSUID)
+		if !ok {
+			return // Response was sent
+		}
+
+		if r.Method == http.MethodDelete {
+			if err := writeTSMeta(token, gts, &TSMeta{}); err != nil {
+				o.ErrCounter.Inc()
+				log.WithFields(log.Fields{
+					"error": err.Error(),
+					"proto": "opentsdb",
+				}).Error("Error deleting series meta data")
+				writeError(w, http.StatusInternalServerError, "Error deleting series meta data")
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(newTSMeta(*gts))
+
+	case http.MethodPost, http.MethodPut:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			o.WarnCounter.Inc()
+			writeError(w, http.StatusBadRequest, "Bad request body")
+			return
+		}
+
+		meta := &TSMeta{}
+		if err := json.Unmarshal(body, meta); err != nil {
+			o.WarnCounter.Inc()
+			writeError(w, http.StatusBadRequest, "can't parse series meta data")
+			return
+		}
+		if err := (&TSMetaQuery{TSUID: meta.TSUID}).Validate(); err != nil {
+			o.WarnCounter.Inc()
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		gts, ok := o.findTSMetaSeries(w, token, txn, meta.TSUID)
+		if !ok {
+			return // Response was sent
+		}
+
+		// POST only updates the provided fields, PUT replaces the meta data
+		if r.Method == http.MethodPost {
+			meta.merge(newTSMeta(*gts))
+		}
+
+		if err := writeTSMeta(token, gts, meta); err != nil {
+			o.ErrCounter.Inc()
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+				"proto": "opentsdb",
+			}).Error("Error storing series meta data")
+			writeError(w, http.StatusInternalServerError, "Error storing series meta data")
+			return
+		}
+
+		gts.Attrs = meta.attributes()
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(newTSMeta(*gts))
+
+	default:
+		o.WarnCounter.Inc()
+		w.Header().Add("Allow", "GET, POST, PUT, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method '%s' is not allowed", r.Method))
+	}
+}
+
+// findTSMetaSeries look for the series of a TSUID, sending the error response when it can't be found
+func (o *OpenTSDB) findTSMetaSeries(w http.ResponseWriter, token, txn, tsuid string) (*core.GeoTimeSeries, bool) {
+	gts, err := findSeriesByTSUID(token, txn, tsuid)
+	if err == errAmbiguousTSUID {
+		o.WarnCounter.Inc()
+		writeError(w, http.StatusConflict, err.Error())
+		return nil, false
+	}
+	if err == errTSUIDScanLimit {
+		o.WarnCounter.Inc()
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if err != nil {
+		o.ErrCounter.Inc()
+		writeDetailedError(w, egressError(err.Error()))
+		return nil, false
+	}
+	if gts == nil {
+		o.WarnCounter.Inc()
+		writeError(w, http.StatusNotFound, "Unable to locate TSUID")
+		return nil, false
+	}
+	return gts, true
+}
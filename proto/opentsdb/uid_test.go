@@ -0,0 +1,53 @@
+package opentsdb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestFindSeriesByTSUID(t *testing.T) {
+	// Warp 10 FIND returning two series
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"fetched":0,"count":0,"gts":[
+			{"c":"sys.cpu","l":{"host":"a",".app":"app"},"a":{},"v":[]},
+			{"c":"sys.cpu","l":{"host":"b",".app":"app"},"a":{},"v":[]}
+		]}]`))
+	}))
+	defer server.Close()
+
+	viper.Set("warp_endpoint", server.URL)
+	defer viper.Set("warp_endpoint", nil)
+	defer viper.Set("opentsdb.uid.gcount", nil)
+
+	var tests = []struct {
+		tsuid  string
+		gcount int
+		host   string
+		err    error
+	}{
+		{pseudoTSUID("sys.cpu", map[string]string{"host": "b"}), 100, "b", nil},
+		{pseudoTSUID("sys.cpu", map[string]string{"host": "c"}), 100, "", nil},
+		{pseudoTSUID("sys.cpu", map[string]string{"host": "b"}), 2, "b", nil},
+		// The scan reached the bound, the series may be one of the series left out
+		{pseudoTSUID("sys.cpu", map[string]string{"host": "c"}), 2, "", errTSUIDScanLimit},
+	}
+
+	for _, test := range tests {
+		viper.Set("opentsdb.uid.gcount", test.gcount)
+
+		gts, err := findSeriesByTSUID("token", "", test.tsuid)
+		if err != test.err {
+			t.Errorf("Expected error %v with a gcount of %d, got %v", test.err, test.gcount, err)
+			continue
+		}
+		switch {
+		case test.host == "" && gts != nil:
+			t.Errorf("Expected no series with a gcount of %d, got %v", test.gcount, gts.Labels)
+		case test.host != "" && (gts == nil || gts.Labels["host"] != test.host):
+			t.Errorf("Expected the series of host %s with a gcount of %d, got %v", test.host, test.gcount, gts)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package prototests
+
+//
+// InfluxDB tests can be started with
+// go test ./proto/prototests -run 'TestInfluxDB' -v
+// Will execute the test on a warp 10 instance started at WARP_TEST_ENDPOINT or "http://127.0.0.1:8090/api/v0/exec"
+//
+
+import (
+	"os"
+	"strings"
+
+	"github.com/ovh/erlenmeyer/core"
+)
+
+// influxdbTestServer return the Warp 10 instance of the InfluxDB tests
+func influxdbTestServer() *core.HTTPWarp10Server {
+	endpoint := os.Getenv("WARP_TEST_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://127.0.0.1:8090/api/v0/exec"
+	}
+	return core.NewWarpServer(strings.TrimSuffix(endpoint, "/api/v0/exec"), "test")
+}
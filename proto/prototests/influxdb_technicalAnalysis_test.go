@@ -0,0 +1,128 @@
+package prototests
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/ovh/erlenmeyer/core"
+	"github.com/ovh/erlenmeyer/proto/influxdb"
+)
+
+//
+// Test can be started with
+// go test ./proto/prototests -run 'TestInfluxDBTechnicalAnalysis' -v
+// Will execute the test on a warp 10 instance started at WARP_TEST_ENDPOINT or "http://127.0.0.1:8090/api/v0/exec"
+//
+
+// taPoint is an expected output point of a technical analysis function
+type taPoint struct {
+	tick  int64
+	value float64
+}
+
+// taInterval is the interval between the fixture values, in microseconds
+const taInterval = 60000000
+
+var (
+	// taValues is the fixture series, one value every taInterval
+	taValues = []float64{10, 12, 11, 15, 14, 13, 18, 17, 21, 20, 19, 24}
+
+	// hwValues is the seasonal fixture series of the Holt-Winters functions
+	hwValues = []float64{10, 20, 15, 5, 12, 22, 17, 7, 14, 24, 19, 9}
+)
+
+// taSeriesScript push a list holding a series of values, one every taInterval
+func taSeriesScript(values []float64) string {
+	mc2 := "[ NEWGTS 'sample' RENAME\n"
+	for index, value := range values {
+		mc2 += fmt.Sprintf("%d NaN NaN NaN %s ADDVALUE\n", index*taInterval, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	return mc2 + "]\n"
+}
+
+// checkTechnicalAnalysis execute a technical analysis script on Warp 10 and
+// compare its output to the expected points
+func checkTechnicalAnalysis(t *testing.T, server *core.HTTPWarp10Server, expr string, mc2 string, expected []taPoint) {
+	stack, err := server.QueryGTSs(mc2, "test")
+	if err != nil {
+		t.Errorf("%s: fail to execute WarpScript: %v", expr, err)
+		return
+	}
+	if len(stack) != 1 || len(stack[0]) != 1 {
+		t.Errorf("%s: expected a single series, got %v", expr, stack)
+		return
+	}
+
+	gts := stack[0][0]
+	if len(gts.Values) != len(expected) {
+		t.Errorf("%s: expected %d points, got %d: %v", expr, len(expected), len(gts.Values), gts.Values)
+		return
+	}
+	for index, point := range expected {
+		tick, _ := gts.Values[index][0].(float64)
+		value, _ := gts.Values[index][len(gts.Values[index])-1].(float64)
+		if int64(tick) != point.tick || math.Abs(value-point.value) > 1e-9*math.Max(1, math.Abs(point.value)) {
+			t.Errorf("%s: expected %d %v at %d, got %v %v", expr, point.tick, point.value, index, tick, value)
+		}
+	}
+}
+
+// TestInfluxDBTechnicalAnalysis compare the technical analysis functions output to the one of
+// the InfluxDB 1.x algorithms (query/internal/gota, query/neldermead) on the same series
+func TestInfluxDBTechnicalAnalysis(t *testing.T) {
+	server := influxdbTestServer()
+
+	var tests = []struct {
+		expr     string
+		expected []taPoint
+	}{
+		{"exponential_moving_average(value, 3)", []taPoint{{120000000, 11.166666666666668}, {180000000, 13.083333333333334}, {240000000, 13.541666666666668}, {300000000, 13.270833333333334}, {360000000, 15.635416666666668}, {420000000, 16.317708333333336}, {480000000, 18.658854166666668}, {540000000, 19.329427083333336}, {600000000, 19.164713541666668}, {660000000, 21.582356770833336}}},
+		{"exponential_moving_average(value, 3, 0)", []taPoint{{0, 10.0}, {60000000, 11.333333333333334}, {120000000, 11.166666666666668}, {180000000, 13.083333333333334}, {240000000, 13.541666666666668}, {300000000, 13.270833333333334}, {360000000, 15.635416666666668}, {420000000, 16.317708333333336}, {480000000, 18.658854166666668}, {540000000, 19.329427083333336}, {600000000, 19.164713541666668}, {660000000, 21.582356770833336}}},
+		{"exponential_moving_average(value, 3, 4, 'simple')", []taPoint{{240000000, 13.5}, {300000000, 13.25}, {360000000, 15.625}, {420000000, 16.3125}, {480000000, 18.65625}, {540000000, 19.328125}, {600000000, 19.1640625}, {660000000, 21.58203125}}},
+		{"double_exponential_moving_average(value, 3)", []taPoint{{120000000, 11.305555555555557}, {180000000, 14.11111111111111}, {240000000, 14.284722222222223}, {300000000, 13.506944444444445}, {360000000, 16.93576388888889}, {420000000, 17.30902777777778}, {480000000, 20.325086805555557}, {540000000, 20.497829861111114}, {600000000, 19.66655815972222}, {660000000, 23.042100694444446}}},
+		{"double_exponential_moving_average(value, 3, -1, 'simple')", []taPoint{{240000000, 14.5}, {300000000, 13.625}, {360000000, 17.0}, {420000000, 17.34375}, {480000000, 20.34375}, {540000000, 20.5078125}, {600000000, 19.671875}, {660000000, 23.044921875}}},
+		{"triple_exponential_moving_average(value, 3)", []taPoint{{120000000, 11.226851851851851}, {180000000, 14.5162037037037}, {240000000, 14.344907407407407}, {300000000, 13.283564814814811}, {360000000, 17.356192129629623}, {420000000, 17.364728009259263}, {480000000, 20.69039351851852}, {540000000, 20.43156828703704}, {600000000, 19.30014829282407}, {660000000, 23.337845413773145}}},
+		{"triple_exponential_moving_average(value, 3, -1, 'simple')", []taPoint{{360000000, 17.333333333333336}, {420000000, 17.338541666666668}, {480000000, 20.669270833333336}, {540000000, 20.416666666666668}, {600000000, 19.290364583333336}, {660000000, 23.331705729166668}}},
+		{"triple_exponential_derivative(value, 3)", []taPoint{{180000000, 5.760171306209849}, {240000000, 5.972869001822234}, {300000000, 3.7925105082155186}, {360000000, 6.997238840312936}, {420000000, 6.953613900776312}, {480000000, 9.04000241281202}, {540000000, 7.868266012668146}, {600000000, 5.129599555536579}, {660000000, 6.541300505807568}}},
+		{"triple_exponential_derivative(value, 3, -1, 'simple')", []taPoint{{420000000, 7.847003154574139}, {480000000, 9.561243144424125}, {540000000, 8.142833305523123}, {600000000, 5.2692485727511285}, {660000000, 6.619640894100387}}},
+		{"relative_strength_index(value, 4)", []taPoint{{240000000, 78.94736842105263}, {300000000, 69.76744186046511}, {360000000, 82.96943231441048}, {420000000, 74.31551499348109}, {480000000, 83.49623010332309}, {540000000, 74.60700324378274}, {600000000, 65.33297725120784}, {660000000, 81.0428071355552}}},
+		{"relative_strength_index(value, 4, 2, 'simple')", []taPoint{{120000000, 92.3076923076923}, {180000000, 94.11764705882354}, {240000000, 88.88888888888889}, {300000000, 81.35593220338984}, {360000000, 88.08664259927798}, {420000000, 80.35126234906696}, {480000000, 86.61848990779966}, {540000000, 78.29416622869584}, {600000000, 69.40124675555161}, {660000000, 82.58686787498264}}},
+		{"chande_momentum_oscillator(value, 4)", []taPoint{{240000000, 50.0}, {300000000, 33.33333333333333}, {360000000, 50.0}, {420000000, 50.0}, {480000000, 50.0}, {540000000, 50.0}, {600000000, 50.0}, {660000000, 50.0}}},
+		{"chande_momentum_oscillator(value, 4, 1)", []taPoint{{60000000, 100.0}, {120000000, 33.33333333333333}, {180000000, 71.42857142857143}, {240000000, 50.0}, {300000000, 33.33333333333333}, {360000000, 50.0}, {420000000, 50.0}, {480000000, 50.0}, {540000000, 50.0}, {600000000, 50.0}, {660000000, 50.0}}},
+		{"chande_momentum_oscillator(value, 4, -1, 'exponential')", []taPoint{{240000000, 57.89473684210527}, {300000000, 39.53488372093023}, {360000000, 65.93886462882097}, {420000000, 48.63102998696219}, {480000000, 66.99246020664617}, {540000000, 49.214006487565506}, {600000000, 30.665954502415694}, {660000000, 62.08561427111038}}},
+		{"chande_momentum_oscillator(value, 4, -1, 'simple')", []taPoint{{240000000, 77.77777777777779}, {300000000, 62.71186440677967}, {360000000, 76.17328519855594}, {420000000, 60.70252469813393}, {480000000, 73.23697981559931}, {540000000, 56.5883324573917}, {600000000, 38.80249351110322}, {660000000, 65.17373574996527}}},
+		{"kaufmans_efficiency_ratio(value, 4)", []taPoint{{240000000, 0.5}, {300000000, 0.14285714285714285}, {360000000, 0.6363636363636364}, {420000000, 0.25}, {480000000, 0.6363636363636364}, {540000000, 0.6363636363636364}, {600000000, 0.14285714285714285}, {660000000, 0.6363636363636364}}},
+		{"kaufmans_efficiency_ratio(value, 4, 2)", []taPoint{{120000000, 0.8461538461538461}, {180000000, 0.8823529411764706}, {240000000, 0.5}, {300000000, 0.14285714285714285}, {360000000, 0.6363636363636364}, {420000000, 0.25}, {480000000, 0.6363636363636364}, {540000000, 0.6363636363636364}, {600000000, 0.14285714285714285}, {660000000, 0.6363636363636364}}},
+		{"kaufmans_adaptive_moving_average(value, 4)", []taPoint{{240000000, 14.866342929818476}, {300000000, 14.824048651376527}, {360000000, 15.460629442441709}, {420000000, 15.531822438513315}, {480000000, 16.627852073628723}, {540000000, 17.303758080655136}, {600000000, 17.342197601546754}, {660000000, 18.676673055460736}}},
+		{"kaufmans_adaptive_moving_average(value, 4, 0)", []taPoint{{0, 4.444444444444443}, {60000000, 10.88888888888889}, {120000000, 11.670491714676459}, {180000000, 12.42003175757663}, {240000000, 14.866342929818476}, {300000000, 14.824048651376527}, {360000000, 15.460629442441709}, {420000000, 15.531822438513315}, {480000000, 16.627852073628723}, {540000000, 17.303758080655136}, {600000000, 17.342197601546754}, {660000000, 18.676673055460736}}},
+	}
+
+	for _, test := range tests {
+		mc2, err := influxdb.TechnicalAnalysisWarpScript(test.expr, 0)
+		if err != nil {
+			t.Errorf("Expected nil for %s, got %v", test.expr, err)
+			continue
+		}
+		checkTechnicalAnalysis(t, server, test.expr, taSeriesScript(taValues)+mc2, test.expected)
+	}
+
+	var hwTests = []struct {
+		expr     string
+		expected []taPoint
+	}{
+		{"holt_winters(mean(value), 3, 0)", []taPoint{{720000000, 14.6301350031259}, {780000000, 14.630371191292769}, {840000000, 14.63046537326522}}},
+		{"holt_winters_with_fit(mean(value), 2, 0)", []taPoint{{0, 10.0}, {60000000, 21.062108748550564}, {120000000, 13.327947769664522}, {180000000, 13.496315255503756}, {240000000, 14.080525388963258}, {300000000, 14.39568074739723}, {360000000, 14.534414986333813}, {420000000, 14.591811360885297}, {480000000, 14.615027736013731}, {540000000, 14.624337461507325}, {600000000, 14.628057932405566}, {660000000, 14.629542744526233}, {720000000, 14.6301350031259}, {780000000, 14.630371191292769}}},
+		{"holt_winters(mean(value), 4, 4)", []taPoint{{720000000, 14.299433218179926}, {780000000, 20.55659996624827}, {840000000, 19.397763916508474}, {900000000, 7.689294276267803}}},
+	}
+
+	for _, test := range hwTests {
+		mc2, err := influxdb.TechnicalAnalysisWarpScript(test.expr, taInterval)
+		if err != nil {
+			t.Errorf("Expected nil for %s, got %v", test.expr, err)
+			continue
+		}
+		checkTechnicalAnalysis(t, server, test.expr, taSeriesScript(hwValues)+mc2, test.expected)
+	}
+}
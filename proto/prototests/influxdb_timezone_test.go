@@ -0,0 +1,70 @@
+package prototests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ovh/erlenmeyer/proto/influxdb"
+)
+
+//
+// Test can be started with
+// go test ./proto/prototests -run 'TestInfluxDBTimezoneDST' -v
+// Will execute the test on a warp 10 instance started at WARP_TEST_ENDPOINT or "http://127.0.0.1:8090/api/v0/exec"
+//
+
+// TestInfluxDBTimezoneDST check the daily buckets of a tz('Europe/Paris') clause around the
+// DST changes: the local days are 23 and 25 hours long
+func TestInfluxDBTimezoneDST(t *testing.T) {
+	server := influxdbTestServer()
+
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("Timezone database unavailable")
+	}
+
+	micros := func(date time.Time) int64 { return date.UnixNano() / 1000 }
+	end := time.Date(2019, 10, 29, 0, 0, 0, 0, time.UTC)
+
+	// One point every hour, from two days before each DST change
+	mc2 := fmt.Sprintf("%d 'end' STORE\n", micros(end))
+	mc2 += "NEWGTS 'sample' RENAME 'dst' STORE\n"
+	for _, start := range []time.Time{time.Date(2019, 3, 29, 0, 0, 0, 0, time.UTC), time.Date(2019, 10, 25, 0, 0, 0, 0, time.UTC)} {
+		mc2 += fmt.Sprintf("0 95 <%% 3600000000 * %d + 'tick' STORE $dst $tick NaN NaN NaN 1.0 ADDVALUE DROP %%> FOR\n", micros(start))
+	}
+	mc2 += "[ $dst ]\n"
+	mc2 += influxdb.LocalBucketizeWarpScript(paris, "bucketizer.count", 86400000000)
+
+	stack, err := server.QueryGTSs(mc2, "test")
+	if err != nil {
+		t.Fatalf("Fail to execute WarpScript: %v", err)
+	}
+	if len(stack) != 1 || len(stack[0]) != 1 {
+		t.Fatalf("Expected a single series, got %v", stack)
+	}
+
+	counts := map[int64]float64{}
+	for _, point := range stack[0][0].Values {
+		tick, _ := point[0].(float64)
+		count, _ := point[len(point)-1].(float64)
+		counts[int64(tick)] = count
+	}
+
+	// Buckets are ticked at the end of the local days
+	var tests = []struct {
+		tick  time.Time
+		count float64
+	}{
+		{time.Date(2019, 3, 31, 0, 0, 0, 0, paris), 24},
+		{time.Date(2019, 4, 1, 0, 0, 0, 0, paris), 23},
+		{time.Date(2019, 10, 27, 0, 0, 0, 0, paris), 24},
+		{time.Date(2019, 10, 28, 0, 0, 0, 0, paris), 25},
+	}
+
+	for _, test := range tests {
+		if count := counts[micros(test.tick)]; count != test.count {
+			t.Errorf("Expected %v points in the bucket of %s, got %v", test.count, test.tick, count)
+		}
+	}
+}